@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +13,15 @@ var (
 	DBName     string
 	DBHost     string
 	JWTSecret  string
+
+	AuditRetentionDays int
+
+	SMTPHost      string
+	SMTPPort      int
+	SMTPUser      string
+	SMTPPassword  string
+	SMTPFrom      string
+	ReportDropDir string
 )
 
 func LoadConfig() {
@@ -21,4 +31,28 @@ func LoadConfig() {
 	DBName = os.Getenv("DB_NAME")
 	DBHost = os.Getenv("DB_HOST")
 	JWTSecret = os.Getenv("JWT_SECRET")
+
+	AuditRetentionDays = getEnvInt("AUDIT_RETENTION_DAYS", 180)
+
+	SMTPHost = os.Getenv("SMTP_HOST")
+	SMTPPort = getEnvInt("SMTP_PORT", 587)
+	SMTPUser = os.Getenv("SMTP_USER")
+	SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	SMTPFrom = os.Getenv("SMTP_FROM")
+	ReportDropDir = getEnv("REPORT_DROP_DIR", "reports")
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
 }
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
 	"strings"
 	"time"
 
@@ -58,15 +60,17 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 	}
 
 	type Peserta struct {
-		ID       int
-		Fullname string
+		ID         int
+		Fullname   string
+		IsHideName bool
+		Gender     string
 	}
 
 	var peserta Peserta
 	if cached, found := localCache.Get("peserta:" + body.QRCode); found {
 		peserta = cached.(Peserta)
 	} else {
-		err := database.DB.QueryRow("SELECT id, fullname FROM peserta WHERE qr_code = ?", body.QRCode).Scan(&peserta.ID, &peserta.Fullname)
+		err := database.DB.QueryRow("SELECT id, fullname, isHideName, COALESCE(gender, '') FROM peserta WHERE qr_code = ?", body.QRCode).Scan(&peserta.ID, &peserta.Fullname, &peserta.IsHideName, &peserta.Gender)
 		if err != nil {
 			log.Println("QR Code not found in database:", err)
 			return c.Status(404).JSON(fiber.Map{"error": "No matching QR code found"})
@@ -81,7 +85,8 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 	if cached, found := localCache.Get(eventKey); found {
 		exists = cached.(bool)
 	} else {
-		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM detail_peserta WHERE id_peserta = ? AND id_event = ?)", userID, body.EventID).Scan(&exists)
+		// Peserta di antrian tunggu belum boleh absen
+		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM detail_peserta WHERE id_peserta = ? AND id_event = ? AND status = ?)", userID, body.EventID, services.EnrollmentActive).Scan(&exists)
 		if err != nil {
 			log.Println("Error checking event participation:", err)
 			return c.Status(500).JSON(fiber.Map{"error": "Database error while checking event participation"})
@@ -93,19 +98,43 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 	}
 
 	tag := ""
+	idMasjid, masjidErr := mesinMasjid(body.MesinID)
+
+	// Sesi terjadwal (kajian, tarawih, ...) didahulukan. Event yang punya sesi di
+	// masjid ini hanya menerima scan selama sesi berlangsung, kecuali event 3 yang
+	// jatuh ke jendela waktu sholat.
+	var session *services.SessionOccurrence
+	if masjidErr == nil {
+		active, hasSessions, err := services.ActiveSession(body.EventID, idMasjid, time.Now())
+		if err != nil {
+			log.Println("Error resolving active session:", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Database error while resolving session"})
+		}
+		if active == nil && hasSessions && body.EventID != 3 {
+			return c.Status(400).JSON(fiber.Map{"error": "Tidak ada sesi yang sedang berlangsung di masjid ini"})
+		}
+		session = active
+	}
 
-	if body.EventID == 3 {
-		masjidKey := "masjid:" + body.MesinID
-		var idMasjid int
-		if cached, found := localCache.Get(masjidKey); found {
-			idMasjid = cached.(int)
-		} else {
-			err := database.DB.QueryRow("SELECT id_masjid FROM petugas WHERE id_user = ?", body.MesinID).Scan(&idMasjid)
-			if err != nil {
-				log.Println("Masjid not found for the given MesinID:", err)
-				return c.Status(404).JSON(fiber.Map{"error": "Masjid not found for this MesinID"})
-			}
-			localCache.Set(masjidKey, idMasjid, cache.DefaultExpiration)
+	if session != nil {
+		tag = session.Session.Jenis
+
+		var alreadyExists bool
+		err := database.DB.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM absensi WHERE user_id = ? AND session_id = ? AND voided_at IS NULL AND created_at >= ? AND created_at < ?)`,
+			userID, session.Session.ID, session.StartAt, session.EndAt,
+		).Scan(&alreadyExists)
+		if err != nil {
+			log.Println("Error checking existing attendance:", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Database error while checking existing attendance"})
+		}
+		if alreadyExists {
+			return c.Status(400).JSON(fiber.Map{"error": "User sudah absen untuk sesi " + session.Session.Nama})
+		}
+	} else if body.EventID == 3 {
+		if masjidErr != nil {
+			log.Println("Masjid not found for the given MesinID:", masjidErr)
+			return c.Status(404).JSON(fiber.Map{"error": "Masjid not found for this MesinID"})
 		}
 
 		regionalKey := fmt.Sprintf("regional_id:%d", idMasjid)
@@ -134,7 +163,8 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 			localCache.Set(codeKey, kotaCode, cache.DefaultExpiration)
 		}
 
-		loc, _ := time.LoadLocation("Asia/Jakarta")
+		// Jadwal sholat dari API dalam waktu lokal kota, jadi dibandingkan di zona masjid
+		loc := services.MasjidLocation(idMasjid)
 		now := time.Now().In(loc)
 		date := now.Format("2006-01-02")
 		jadwalKey := fmt.Sprintf("jadwal:%s:%s", kotaCode, date)
@@ -173,6 +203,12 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 
 		currentTime := now
 
+		// Hari Jumat jendela dzuhur menjadi sholat Jumat dengan konfigurasi sendiri,
+		// hanya untuk peserta yang gendernya tercatat laki-laki. Gender kosong atau
+		// tidak dikenal tetap dicatat dzuhur; jumat juga memenuhi dzuhur di badge
+		// dan target collection jadi keduanya tidak merugikan peserta.
+		isJumat := isJumatFor(now, peserta.Gender)
+
 		validPrayers := map[string]bool{
 			"subuh":   true,
 			"dzuhur":  true,
@@ -214,6 +250,12 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 			if !ok || !validPrayers[lowerPrayer] {
 				continue
 			}
+			if lowerPrayer == "dzuhur" && isJumat {
+				lowerPrayer = jumatTag
+				if jumatConf, ok := configs[jumatTag]; ok {
+					conf = jumatConf
+				}
+			}
 
 			prayerDateTime, err := time.ParseInLocation("2006-01-02 15:04", date+" "+prayerTime, loc)
 			if err != nil {
@@ -234,10 +276,11 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 			return c.Status(400).JSON(fiber.Map{"error": "Absensi hanya diperbolehkan dalam rentang waktu yang telah ditentukan untuk sholat"})
 		}
 
+		dayStart, dayEnd, _ := utils.DayRange(date, date, loc)
 		var alreadyExists bool
 		err = database.DB.QueryRow(
-			`SELECT EXISTS(SELECT 1 FROM absensi WHERE user_id = ? AND event_id = ? AND tag = ? AND DATE(CONVERT_TZ(created_at, '+00:00', '+07:00')) = ? )`,
-			userID, body.EventID, tag, date,
+			`SELECT EXISTS(SELECT 1 FROM absensi WHERE user_id = ? AND event_id = ? AND tag = ? AND voided_at IS NULL AND created_at >= ? AND created_at < ? )`,
+			userID, body.EventID, tag, dayStart, dayEnd,
 		).Scan(&alreadyExists)
 		if err != nil {
 			log.Println("Error checking existing attendance:", err)
@@ -247,62 +290,144 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 		if alreadyExists {
 			return c.Status(400).JSON(fiber.Map{"error": "User sudah absen untuk sholat " + strings.Title(tag)})
 		}
+	}
 
-		// var count int
-		// err = database.DB.QueryRow(`
-		// 	SELECT COUNT(*) FROM absensi
-		// 	WHERE event_id = ? AND tag = ? AND DATE(CONVERT_TZ(created_at, '+00:00', '+07:00')) = ? and mesin_id = ?
-		// `, body.EventID, tag, date, body.MesinID).Scan(&count)
-		// if err != nil {
-		// 	log.Println("Error counting attendance:", err)
-		// 	return c.Status(500).JSON(fiber.Map{"error": "Failed to count attendance"})
-		// }
-		// urutanKehadiran := count + 1
-
-		// pointSholat := 0
-		// switch strings.ToLower(tag) {
-		// case "subuh":
-		// 	pointSholat = 40
-		// case "maghrib", "magrib":
-		// 	pointSholat = 30
-		// case "isya":
-		// 	pointSholat = 30
-		// }
-
-		// pointHadir := 0
-		// if urutanKehadiran <= 10 {
-		// 	pointHadir = 11 - urutanKehadiran
-		// }
-
-		// totalPoint := pointSholat + pointHadir
-
-		// _, err = database.DB.Exec(`
-		// 	INSERT INTO poin (user_id, tanggal, tag, point_sholat, point_kehadiran, total_point)
-		// 	VALUES (?, ?, ?, ?, ?, ?)`,
-		// 	userID, date, tag, pointSholat, pointHadir, totalPoint)
-		// if err != nil {
-		// 	log.Println("Error inserting point:", err)
-		// 	return c.Status(500).JSON(fiber.Map{"error": "Failed to save point"})
-		// }
+	scannedAt := time.Now().UTC()
+	record := services.AbsensiRecord{
+		UserID:    userID,
+		MesinID:   body.MesinID,
+		EventID:   body.EventID,
+		Tag:       tag,
+		Tanggal:   utils.LocalDate(scannedAt, services.MasjidLocation(idMasjid)),
+		CreatedAt: scannedAt,
+	}
+
+	// Absensi, poin dan counter dashboard disimpan dalam satu transaksi
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+	defer tx.Rollback()
+
+	var sessionID *int
+	if session != nil {
+		sessionID = &session.Session.ID
+
+		// Kunci baris sesi supaya scan bersamaan tidak melewati kapasitas
+		if session.Session.Capacity != nil {
+			if _, err := tx.Exec("SELECT id FROM event_sessions WHERE id = ? FOR UPDATE", session.Session.ID); err != nil {
+				log.Println("Error locking session:", err)
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+			}
+			attendance, err := services.SessionAttendance(tx, session)
+			if err != nil {
+				log.Println("Error counting session attendance:", err)
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+			}
+			if attendance >= *session.Session.Capacity {
+				return c.Status(409).JSON(fiber.Map{"error": "Kapasitas sesi " + session.Session.Nama + " sudah penuh"})
+			}
+		}
 	}
 
-	_, err := database.DB.Exec("INSERT INTO absensi (user_id, finger_id, jam, mesin_id, event_id, tag) VALUES (?, ?, ?, ?, ?, ?)",
-		userID, body.QRCode, time.Now().UTC(), body.MesinID, body.EventID, tag)
+	result, err := tx.Exec("INSERT INTO absensi (user_id, finger_id, jam, mesin_id, event_id, tag, session_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, body.QRCode, scannedAt, body.MesinID, body.EventID, tag, sessionID)
 	if err != nil {
 		log.Println("Error inserting attendance record:", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
 	}
 
+	record.ID, err = result.LastInsertId()
+	if err != nil {
+		log.Println("Error retrieving attendance ID:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+
+	if err := services.AwardPoin(tx, record); err != nil {
+		log.Println("Error saving point:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save point"})
+	}
+
+	if err := services.AdjustDailyCounters(tx, record.ID, 1); err != nil {
+		log.Println("Error updating daily counters:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+
+	err = services.EmitEvent(tx, services.EventAttendanceRecorded, fiber.Map{
+		"absensi_id": record.ID,
+		"user_id":    userID,
+		"fullname":   fullname,
+		"event_id":   body.EventID,
+		"tag":        tag,
+		"session_id": sessionID,
+		"mesin_id":   body.MesinID,
+		"scanned_at": scannedAt,
+	})
+	if err != nil {
+		log.Println("Error writing webhook outbox:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+
+	// Scan dilakukan oleh mesin, bukan user yang login
+	deviceActor := auditActor(c)
+	deviceActor.Type = "device"
+	deviceActor.ID = body.MesinID
+	recordAuditAs(deviceActor, tx, "absensi.scan", "absensi", record.ID, nil, fiber.Map{
+		"user_id":    userID,
+		"event_id":   body.EventID,
+		"tag":        tag,
+		"session_id": sessionID,
+		"mesin_id":   body.MesinID,
+	})
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing attendance record:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+
+	// Cek pola scan mencurigakan tanpa memperlambat response ke mesin
+	go services.CheckScanAnomalies(record)
+	go services.EvaluateScanAchievements(record)
+
+	// Layar live di masjid hanya untuk mesin yang terdaftar di petugas
+	if masjidErr == nil {
+		services.DefaultLiveHub.PublishScan(body.EventID, idMasjid, services.LiveScan{
+			AbsensiID: record.ID,
+			UserID:    userID,
+			Nama:      displayName(fullname, peserta.IsHideName),
+			Tag:       tag,
+			Tanggal:   record.Tanggal,
+			ScannedAt: scannedAt,
+		})
+	}
+
 	return c.JSON(fiber.Map{
-		"message":  "QR Code found and attendance recorded",
-		"qr_code":  body.QRCode,
-		"user_id":  userID,
-		"fullname": fullname,
-		"event_id": body.EventID,
-		"tag":      tag,
+		"message":    "QR Code found and attendance recorded",
+		"qr_code":    body.QRCode,
+		"user_id":    userID,
+		"fullname":   fullname,
+		"event_id":   body.EventID,
+		"tag":        tag,
+		"session_id": sessionID,
 	})
 }
 
+// mesinMasjid mencari masjid tempat mesin scan dipasang (petugas.id_user = mesin_id).
+func mesinMasjid(mesinID string) (int, error) {
+	masjidKey := "masjid:" + mesinID
+	if cached, found := localCache.Get(masjidKey); found {
+		return cached.(int), nil
+	}
+	var idMasjid int
+	err := database.DB.QueryRow("SELECT id_masjid FROM petugas WHERE id_user = ?", mesinID).Scan(&idMasjid)
+	if err != nil {
+		return 0, err
+	}
+	localCache.Set(masjidKey, idMasjid, cache.DefaultExpiration)
+	return idMasjid, nil
+}
+
 // func SaveAbsenQR(c *fiber.Ctx) error {
 // 	body := struct {
 // 		MesinID string `json:"mesin_id"`
@@ -789,3 +914,9 @@ func SaveAbsenQR(c *fiber.Ctx) error {
 // 		"tag":      tag,
 // 	})
 // }
+
+// isJumatFor mengecek apakah sholat dzuhur pada waktu t (waktu lokal masjid)
+// dicatat sebagai jumat untuk peserta dengan gender tersebut
+func isJumatFor(t time.Time, gender string) bool {
+	return t.Weekday() == time.Friday && gender == utils.GenderMale
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PesertaBadge struct {
+	BadgeID   int       `json:"badge_id"`
+	Code      string    `json:"code"`
+	Nama      string    `json:"nama"`
+	Deskripsi string    `json:"deskripsi"`
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// Handler untuk streak berjalan dan badge yang sudah diraih peserta
+func GetPesertaAchievements(c *fiber.Ctx) error {
+	pesertaID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid peserta id"})
+	}
+
+	var fullname string
+	var isHideName bool
+	err = database.DB.QueryRow("SELECT COALESCE(fullname, ''), isHideName FROM peserta WHERE id = ?", pesertaID).Scan(&fullname, &isHideName)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Peserta not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	fullname = displayName(fullname, isHideName)
+
+	streaks, err := services.PesertaStreaks(pesertaID)
+	if err != nil {
+		log.Println("Error computing streaks:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute streaks"})
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT b.id, b.code, b.nama, b.deskripsi, pb.awarded_at
+		FROM peserta_badges pb
+		JOIN badges b ON pb.badge_id = b.id
+		WHERE pb.peserta_id = ?
+		ORDER BY pb.awarded_at ASC`, pesertaID)
+	if err != nil {
+		log.Println("Error fetching peserta badges:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch badges"})
+	}
+	defer rows.Close()
+
+	badges := []PesertaBadge{}
+	for rows.Next() {
+		var b PesertaBadge
+		if err := rows.Scan(&b.BadgeID, &b.Code, &b.Nama, &b.Deskripsi, &b.AwardedAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		badges = append(badges, b)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Success",
+		"user_id":  pesertaID,
+		"fullname": fullname,
+		"streaks":  streaks,
+		"badges":   badges,
+	})
+}
+
+// Handler untuk backfill badge dari riwayat absensi (?user_id= untuk satu peserta)
+func BackfillAchievements(c *fiber.Ctx) error {
+	userID, _ := strconv.Atoi(c.Query("user_id", "0"))
+
+	total, err := services.BackfillAchievements(userID)
+	if err != nil {
+		log.Println("Error backfilling achievements:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to backfill achievements"})
+	}
+
+	recordAudit(c, database.DB, "achievement.backfill", "peserta", userID, nil, fiber.Map{"awarded": total})
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"awarded": total,
+	})
+}
+
+type BadgeRequest struct {
+	Code            string   `json:"code" validate:"required,max=50"`
+	Nama            string   `json:"nama" validate:"required,max=100"`
+	Deskripsi       string   `json:"deskripsi" validate:"max=255"`
+	EventID         int      `json:"event_id" validate:"omitempty,min=1"`
+	Tags            []string `json:"tags" validate:"required,min=1"`
+	ConsecutiveDays int      `json:"consecutive_days" validate:"min=0"`
+	MinCount        int      `json:"min_count" validate:"min=0"`
+	MasjidID        *int     `json:"masjid_id" validate:"omitempty,min=1"`
+	Active          *bool    `json:"active"`
+}
+
+// Handler untuk daftar semua badge termasuk yang nonaktif
+func GetBadges(c *fiber.Ctx) error {
+	badges, err := services.ListBadges()
+	if err != nil {
+		log.Println("Error fetching badges:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch badges"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    badges,
+	})
+}
+
+// Handler untuk membuat badge baru
+func CreateBadge(c *fiber.Ctx) error {
+	badge, ok := parseBadge(c, 0)
+	if !ok {
+		return nil
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO badges (code, nama, deskripsi, event_id, tags, consecutive_days, min_count, masjid_id, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		badge.Code, badge.Nama, badge.Deskripsi, badge.EventID, strings.Join(badge.Tags, ","),
+		badge.ConsecutiveDays, badge.MinCount, badge.MasjidID, badge.Active)
+	if err != nil {
+		log.Println("Error creating badge:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create badge"})
+	}
+	id, _ := result.LastInsertId()
+	badge.ID = int(id)
+
+	recordAudit(c, database.DB, "badge.create", "badge", badge.ID, nil, badge)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Badge created successfully",
+		"data":    badge,
+	})
+}
+
+// Handler untuk mengubah badge. Badge yang sudah diraih peserta tetap tercatat;
+// kriteria baru berlaku untuk evaluasi berikutnya.
+func UpdateBadge(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid badge id"})
+	}
+
+	before, err := services.LoadBadge(id)
+	if err == services.ErrBadgeNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Badge not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	badge, ok := parseBadge(c, id)
+	if !ok {
+		return nil
+	}
+	badge.ID = id
+
+	_, err = database.DB.Exec(`
+		UPDATE badges SET code = ?, nama = ?, deskripsi = ?, event_id = ?, tags = ?, consecutive_days = ?, min_count = ?, masjid_id = ?, active = ?
+		WHERE id = ?`,
+		badge.Code, badge.Nama, badge.Deskripsi, badge.EventID, strings.Join(badge.Tags, ","),
+		badge.ConsecutiveDays, badge.MinCount, badge.MasjidID, badge.Active, id)
+	if err != nil {
+		log.Println("Error updating badge:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update badge"})
+	}
+
+	recordAudit(c, database.DB, "badge.update", "badge", id, before, badge)
+
+	return c.JSON(fiber.Map{
+		"message": "Badge updated successfully",
+		"data":    badge,
+	})
+}
+
+// Handler untuk menghapus badge yang belum pernah diraih; badge yang sudah diraih
+// cukup dinonaktifkan supaya riwayat peserta tidak hilang
+func DeleteBadge(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid badge id"})
+	}
+
+	before, err := services.LoadBadge(id)
+	if err == services.ErrBadgeNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Badge not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	var awarded bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM peserta_badges WHERE badge_id = ?)", id).Scan(&awarded); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if awarded {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Badge sudah diraih peserta, nonaktifkan dengan active=false"})
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM badges WHERE id = ?", id); err != nil {
+		log.Println("Error deleting badge:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete badge"})
+	}
+
+	recordAudit(c, database.DB, "badge.delete", "badge", id, before, nil)
+
+	return c.JSON(fiber.Map{"message": "Badge deleted successfully"})
+}
+
+// parseBadge membaca dan memvalidasi body badge; kalau tidak valid response 400/409
+// sudah ditulis dan ok bernilai false. id adalah badge yang diubah (0 untuk create).
+func parseBadge(c *fiber.Ctx, id int) (services.Badge, bool) {
+	var req BadgeRequest
+	if err := c.BodyParser(&req); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		return services.Badge{}, false
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return services.Badge{}, false
+	}
+
+	badge := services.Badge{
+		Code:            strings.TrimSpace(req.Code),
+		Nama:            req.Nama,
+		Deskripsi:       req.Deskripsi,
+		EventID:         req.EventID,
+		ConsecutiveDays: req.ConsecutiveDays,
+		MinCount:        req.MinCount,
+		MasjidID:        req.MasjidID,
+		Active:          req.Active == nil || *req.Active,
+	}
+	if badge.EventID == 0 {
+		badge.EventID = 3
+	}
+
+	// Tag harus sholat yang dilacak; jumat boleh dipakai untuk badge khusus Jumat
+	known := map[string]bool{jumatTag: true}
+	for _, tag := range dailySholatTags {
+		known[tag] = true
+	}
+	seen := make(map[string]bool)
+	for _, tag := range req.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !known[tag] {
+			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown tag " + tag})
+			return services.Badge{}, false
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			badge.Tags = append(badge.Tags, tag)
+		}
+	}
+	if badge.ConsecutiveDays == 0 && badge.MinCount == 0 {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "consecutive_days or min_count must be greater than 0"})
+		return services.Badge{}, false
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM badges WHERE code = ? AND id <> ?)", badge.Code, id).Scan(&exists); err != nil {
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		return services.Badge{}, false
+	}
+	if exists {
+		c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Badge code already exists"})
+		return services.Badge{}, false
+	}
+	return badge, true
+}
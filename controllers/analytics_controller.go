@@ -0,0 +1,633 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CohortWeek struct {
+	Week        int     `json:"week"`
+	Active      int     `json:"active"`
+	PersenAktif float64 `json:"persen_aktif"`
+}
+
+// CohortRow adalah peserta yang mendaftar di minggu yang sama (Senin) beserta
+// berapa yang masih hadir di minggu ke-0, 1, 2, ... setelah mendaftar.
+type CohortRow struct {
+	Cohort    string       `json:"cohort"`
+	Size      int          `json:"size"`
+	Retention []CohortWeek `json:"retention"`
+}
+
+type PrayerTrend struct {
+	Date    string         `json:"date"`
+	DateEnd string         `json:"date_end"`
+	Counts  map[string]int `json:"counts"`
+	Total   int            `json:"total"`
+}
+
+type ChurnPeserta struct {
+	PesertaID  int       `json:"peserta_id"`
+	Fullname   string    `json:"fullname"`
+	Contact    string    `json:"contact"`
+	MasjidID   int       `json:"masjid_id"`
+	Masjid     string    `json:"masjid"`
+	LastSeen   time.Time `json:"last_seen"`
+	TotalHadir int       `json:"total_hadir"`
+	DaysAbsent int       `json:"days_absent"`
+}
+
+type MasjidGrowth struct {
+	MasjidID            int      `json:"masjid_id"`
+	MasjidNama          string   `json:"masjid_nama"`
+	MasjidRegional      string   `json:"masjid_regional"`
+	PendaftarBaru       int      `json:"pendaftar_baru"`
+	PendaftarSebelumnya int      `json:"pendaftar_sebelumnya"`
+	PendaftarGrowth     *float64 `json:"pendaftar_growth"`
+	PesertaAktif        int      `json:"peserta_aktif"`
+	PesertaAktifSebelum int      `json:"peserta_aktif_sebelumnya"`
+	PesertaAktifGrowth  *float64 `json:"peserta_aktif_growth"`
+	PeriodeMulai        string   `json:"periode_mulai"`
+	PeriodeSebelumnya   string   `json:"periode_sebelumnya_mulai"`
+}
+
+// Handler retention cohort per minggu pendaftaran.
+// Query: event_id (default 3), from, to (tanggal daftar, default 12 minggu terakhir), weeks (default 8).
+func GetRetentionCohorts(c *fiber.Ctx) error {
+	eventID, _ := strconv.Atoi(c.Query("event_id", "3"))
+	from, to, ok := analyticsRange(c, "from", "to", 12*7)
+	if !ok {
+		return nil
+	}
+	weeks, _ := strconv.Atoi(c.Query("weeks", "8"))
+	if weeks < 1 || weeks > 52 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "weeks must be between 1 and 52"})
+	}
+	format, ok := analyticsFormat(c)
+	if !ok {
+		return nil
+	}
+
+	if format != "" {
+		cohorts, err := fetchRetentionCohorts(eventID, from, to, weeks, nil)
+		if err != nil {
+			log.Println("Error fetching retention cohorts:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch retention cohorts"})
+		}
+		return utils.SendExport(c, format, fmt.Sprintf("cohort-%d-%s-%s", eventID, from, to), cohortTable(cohorts, weeks, from, to))
+	}
+	q, err := utils.ParseListQuery(c, utils.ListSpec{})
+	if err != nil {
+		return reportError(c, err, "Invalid pagination")
+	}
+
+	regStart, regEnd, err := utils.AnyZoneDayRange(from, to)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	var total int
+	err = database.DB.QueryRow(`
+		SELECT COUNT(DISTINCT DATE_SUB(tgl_daftar, INTERVAL WEEKDAY(tgl_daftar) DAY))
+		FROM (`+cohortRegistrantsSQL()+`) r`, eventID, regStart, regEnd, from, to).Scan(&total)
+	if err != nil {
+		log.Println("Error counting retention cohorts:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch retention cohorts"})
+	}
+
+	cohorts, err := fetchRetentionCohorts(eventID, from, to, weeks, q)
+	if err != nil {
+		log.Println("Error fetching retention cohorts:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch retention cohorts"})
+	}
+	return c.JSON(q.Response(cohorts, total))
+}
+
+// cohortRegistrantsSQL memilih peserta event yang mendaftar di antara dua tanggal
+// lokal. Argumen: event_id, created_at >=, created_at <, tanggal dari, tanggal sampai.
+func cohortRegistrantsSQL() string {
+	// Tanggal daftar dihitung di zona masjid peserta
+	tglDaftar := "DATE(" + services.MasjidLocalTimeSQL("p.created_at", "p.masjid_id") + ")"
+	return `
+		SELECT p.id, ` + tglDaftar + ` AS tgl_daftar
+		FROM peserta p
+		JOIN detail_peserta dp ON dp.id_peserta = p.id
+		WHERE dp.id_event = ? AND p.created_at >= ? AND p.created_at < ?
+			AND ` + tglDaftar + ` BETWEEN ? AND ?`
+}
+
+// fetchRetentionCohorts mengambil cohort urut minggu daftar; q nil berarti semua
+// cohort, selain itu hanya cohort di halaman q.
+func fetchRetentionCohorts(eventID int, from, to string, weeks int, q *utils.ListQuery) ([]CohortRow, error) {
+	regStart, regEnd, err := utils.AnyZoneDayRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	registrants := cohortRegistrantsSQL()
+
+	query := `
+		SELECT DATE_FORMAT(DATE_SUB(tgl_daftar, INTERVAL WEEKDAY(tgl_daftar) DAY), '%Y-%m-%d') AS cohort, COUNT(DISTINCT id)
+		FROM (` + registrants + `) r
+		GROUP BY cohort
+		ORDER BY cohort ASC`
+	args := []interface{}{eventID, regStart, regEnd, from, to}
+	if q != nil {
+		limitSQL, limitArgs := q.LimitSQL()
+		query += limitSQL
+		args = append(args, limitArgs...)
+	}
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cohorts := []CohortRow{}
+	index := make(map[string]int)
+	for rows.Next() {
+		row := CohortRow{Retention: make([]CohortWeek, weeks)}
+		if err := rows.Scan(&row.Cohort, &row.Size); err != nil {
+			return nil, err
+		}
+		for w := range row.Retention {
+			row.Retention[w].Week = w
+		}
+		index[row.Cohort] = len(cohorts)
+		cohorts = append(cohorts, row)
+	}
+	if len(cohorts) == 0 {
+		return cohorts, nil
+	}
+
+	activity, err := database.DB.Query(`
+		SELECT DATE_FORMAT(cohort, '%Y-%m-%d'), FLOOR(DATEDIFF(tgl_hadir, cohort) / 7) AS week, COUNT(DISTINCT user_id)
+		FROM (
+			SELECT a.user_id,
+				`+services.AbsensiLocalDateSQL("a")+` AS tgl_hadir,
+				DATE_SUB(r.tgl_daftar, INTERVAL WEEKDAY(r.tgl_daftar) DAY) AS cohort
+			FROM absensi a
+			JOIN (`+registrants+`) r ON a.user_id = r.id
+			WHERE a.event_id = ? AND a.voided_at IS NULL AND a.created_at >= ?
+		) x
+		WHERE cohort BETWEEN ? AND ?
+		GROUP BY cohort, week
+		HAVING week BETWEEN 0 AND ?`,
+		eventID, regStart, regEnd, from, to, eventID, regStart,
+		cohorts[0].Cohort, cohorts[len(cohorts)-1].Cohort, weeks-1)
+	if err != nil {
+		return nil, err
+	}
+	defer activity.Close()
+
+	for activity.Next() {
+		var cohort string
+		var week, active int
+		if err := activity.Scan(&cohort, &week, &active); err != nil {
+			return nil, err
+		}
+		i, ok := index[cohort]
+		if !ok {
+			continue
+		}
+		row := &cohorts[i]
+		row.Retention[week].Active = active
+		if row.Size > 0 {
+			row.Retention[week].PersenAktif = float64(active) / float64(row.Size) * 100
+		}
+	}
+	return cohorts, activity.Err()
+}
+
+func cohortTable(cohorts []CohortRow, weeks int, from, to string) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title:   "Retention Cohort Peserta",
+		Meta:    []string{"Tanggal daftar: " + from + " s/d " + to},
+		Headers: []string{"Cohort", "Peserta"},
+	}
+	for w := 0; w < weeks; w++ {
+		table.Headers = append(table.Headers, fmt.Sprintf("Minggu %d", w))
+	}
+	for _, row := range cohorts {
+		cells := []string{row.Cohort, strconv.Itoa(row.Size)}
+		for _, w := range row.Retention {
+			cells = append(cells, fmt.Sprintf("%d (%.1f%%)", w.Active, w.PersenAktif))
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table
+}
+
+// Handler tren jumlah jamaah per sholat, dibaca dari absensi_daily_counters.
+// Query: event_id (default 3), start_date, end_date, granularity=day|week|month, masjid_id, regional_id.
+func GetPrayerTrends(c *fiber.Ctx) error {
+	eventID, _ := strconv.Atoi(c.Query("event_id", "3"))
+	from, to, ok := analyticsRange(c, "start_date", "end_date", 30)
+	if !ok {
+		return nil
+	}
+	format, ok := analyticsFormat(c)
+	if !ok {
+		return nil
+	}
+	granularity := c.Query("granularity", "day")
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id", "0"))
+	regionalID, _ := strconv.Atoi(c.Query("regional_id", "0"))
+
+	start, _ := time.Parse("2006-01-02", from)
+	end, _ := time.Parse("2006-01-02", to)
+	periods, err := attendancePeriods(start, end, granularity)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format == "" {
+		// Periode dibentuk dari kalender, jadi halaman dipilih dulu lalu query
+		// hanya membaca counter di rentang tanggal halaman tersebut
+		q, err := utils.ParseListQuery(c, utils.ListSpec{})
+		if err != nil {
+			return reportError(c, err, "Invalid pagination")
+		}
+		total := len(periods)
+		pageStart, pageEnd := q.Bounds(total)
+		periods = periods[pageStart:pageEnd]
+		if len(periods) == 0 {
+			return c.JSON(q.Response([]PrayerTrend{}, total))
+		}
+		trends, err := fetchPrayerTrends(eventID, periods, from, granularity, masjidID, regionalID)
+		if err != nil {
+			log.Println("Error fetching prayer trends:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch prayer trends"})
+		}
+		return c.JSON(q.Response(trends, total))
+	}
+
+	trends, err := fetchPrayerTrends(eventID, periods, from, granularity, masjidID, regionalID)
+	if err != nil {
+		log.Println("Error fetching prayer trends:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch prayer trends"})
+	}
+	return utils.SendExport(c, format, fmt.Sprintf("tren-sholat-%d-%s-%s", eventID, from, to), prayerTrendTable(trends, from, to))
+}
+
+// fetchPrayerTrends menjumlahkan counter per sholat untuk setiap periode; hanya
+// tanggal di antara periode pertama dan terakhir (tidak sebelum from) yang dibaca.
+func fetchPrayerTrends(eventID int, periods []AttendancePeriod, from, granularity string, masjidID, regionalID int) ([]PrayerTrend, error) {
+	// Periode minggu/bulan pertama bisa mulai sebelum from
+	rangeFrom := periods[0].Date
+	if rangeFrom < from {
+		rangeFrom = from
+	}
+
+	bucket := "c.tanggal"
+	switch granularity {
+	case "week":
+		bucket = "DATE_SUB(c.tanggal, INTERVAL WEEKDAY(c.tanggal) DAY)"
+	case "month":
+		bucket = "DATE_FORMAT(c.tanggal, '%Y-%m-01')"
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(dailySholatTags)), ", ")
+
+	args := []interface{}{eventID, rangeFrom, periods[len(periods)-1].DateEnd}
+	for _, tag := range dailySholatTags {
+		args = append(args, tag)
+	}
+	args = append(args, masjidID, masjidID, regionalID, regionalID)
+
+	rows, err := database.DB.Query(`
+		SELECT DATE_FORMAT(`+bucket+`, '%Y-%m-%d') AS bucket, c.tag, SUM(c.jumlah)
+		FROM absensi_daily_counters c
+		LEFT JOIN masjid m ON c.masjid_id = m.id
+		WHERE c.event_id = ? AND c.tanggal BETWEEN ? AND ?
+			AND c.tag IN (`+placeholders+`)
+			AND (? = 0 OR c.masjid_id = ?)
+			AND (? = 0 OR m.regional_id = ?)
+		GROUP BY bucket, c.tag`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[string]int)
+	for rows.Next() {
+		var date, tag string
+		var n int
+		if err := rows.Scan(&date, &tag, &n); err != nil {
+			return nil, err
+		}
+		if counts[date] == nil {
+			counts[date] = make(map[string]int)
+		}
+		counts[date][tag] = n
+	}
+
+	trends := make([]PrayerTrend, len(periods))
+	for i, p := range periods {
+		trend := PrayerTrend{Date: p.Date, DateEnd: p.DateEnd, Counts: make(map[string]int)}
+		for _, tag := range dailySholatTags {
+			trend.Counts[tag] = counts[p.Date][tag]
+			trend.Total += trend.Counts[tag]
+		}
+		trends[i] = trend
+	}
+	return trends, rows.Err()
+}
+
+func prayerTrendTable(trends []PrayerTrend, from, to string) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title:   "Tren Jamaah per Sholat",
+		Meta:    []string{"Periode: " + from + " s/d " + to},
+		Headers: []string{"Mulai", "Sampai"},
+	}
+	for _, tag := range dailySholatTags {
+		table.Headers = append(table.Headers, strings.Title(tag))
+	}
+	table.Headers = append(table.Headers, "Total")
+
+	for _, t := range trends {
+		row := []string{t.Date, t.DateEnd}
+		for _, tag := range dailySholatTags {
+			row = append(row, strconv.Itoa(t.Counts[tag]))
+		}
+		table.Rows = append(table.Rows, append(row, strconv.Itoa(t.Total)))
+	}
+	return table
+}
+
+// churnListSpec: ?sort=last_seen|total_hadir|fullname, default yang terakhir hadir paling baru
+var churnListSpec = utils.ListSpec{
+	Sorts:       map[string]string{"last_seen": "x.last_seen", "total_hadir": "x.total_hadir", "fullname": "p.fullname"},
+	DefaultSort: "-last_seen",
+}
+
+// Handler daftar peserta yang aktif dalam active_days terakhir tetapi tidak hadir
+// selama absent_days terakhir. Query: event_id (default 3), active_days (30), absent_days (14), masjid_id.
+func GetChurnList(c *fiber.Ctx) error {
+	eventID, _ := strconv.Atoi(c.Query("event_id", "3"))
+	activeDays, _ := strconv.Atoi(c.Query("active_days", "30"))
+	absentDays, _ := strconv.Atoi(c.Query("absent_days", "14"))
+	if activeDays < 1 || absentDays < 1 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "active_days and absent_days must be positive"})
+	}
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id", "0"))
+	format, ok := analyticsFormat(c)
+	if !ok {
+		return nil
+	}
+	listQuery, err := utils.ParseListQuery(c, churnListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid pagination")
+	}
+
+	now := time.Now().UTC()
+	cutoff := now.AddDate(0, 0, -absentDays)
+	activeStart := cutoff.AddDate(0, 0, -activeDays)
+
+	base := `
+		FROM (
+			SELECT user_id, MAX(created_at) AS last_seen, COUNT(*) AS total_hadir
+			FROM absensi
+			WHERE event_id = ? AND voided_at IS NULL AND created_at >= ?
+			GROUP BY user_id
+			HAVING MAX(created_at) < ?
+		) x
+		JOIN peserta p ON p.id = x.user_id
+		LEFT JOIN masjid m ON p.masjid_id = m.id
+		WHERE (? = 0 OR p.masjid_id = ?)`
+	args := []interface{}{eventID, activeStart, cutoff, masjidID, masjidID}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) "+base, args...).Scan(&total); err != nil {
+		log.Println("Error counting churn list:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch churn list"})
+	}
+
+	query := `
+		SELECT p.id, COALESCE(p.fullname, ''), COALESCE(p.contact, ''), COALESCE(p.masjid_id, 0), COALESCE(m.nama, ''), x.last_seen, x.total_hadir
+		` + base + listQuery.OrderSQL("p.id")
+	if format == "" {
+		limitSQL, limitArgs := listQuery.LimitSQL()
+		query += limitSQL
+		args = append(args, limitArgs...)
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching churn list:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch churn list"})
+	}
+	defer rows.Close()
+
+	list := []ChurnPeserta{}
+	for rows.Next() {
+		var p ChurnPeserta
+		if err := rows.Scan(&p.PesertaID, &p.Fullname, &p.Contact, &p.MasjidID, &p.Masjid, &p.LastSeen, &p.TotalHadir); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		p.DaysAbsent = int(now.Sub(p.LastSeen).Hours() / 24)
+		list = append(list, p)
+	}
+
+	if format != "" {
+		return utils.SendExport(c, format, fmt.Sprintf("churn-%d", eventID), churnTable(list, activeDays, absentDays))
+	}
+	return c.JSON(listQuery.Response(list, total))
+}
+
+func churnTable(list []ChurnPeserta, activeDays, absentDays int) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title:   "Peserta Tidak Aktif",
+		Meta:    []string{fmt.Sprintf("Aktif dalam %d hari, tidak hadir %d hari terakhir", activeDays+absentDays, absentDays)},
+		Headers: []string{"No", "Nama", "Kontak", "Masjid", "Terakhir Hadir", "Jumlah Hadir", "Hari Absen"},
+	}
+	for i, p := range list {
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(i + 1), p.Fullname, p.Contact, p.Masjid,
+			p.LastSeen.In(services.MasjidLocation(p.MasjidID)).Format("2006-01-02 15:04"), strconv.Itoa(p.TotalHadir), strconv.Itoa(p.DaysAbsent),
+		})
+	}
+	return table
+}
+
+// Handler pertumbuhan pendaftar dan peserta aktif per masjid dibanding periode
+// sebelumnya dengan panjang yang sama. Query: event_id (default 3), start_date, end_date, regional_id.
+func GetMasjidGrowth(c *fiber.Ctx) error {
+	eventID, _ := strconv.Atoi(c.Query("event_id", "3"))
+	from, to, ok := analyticsRange(c, "start_date", "end_date", 30)
+	if !ok {
+		return nil
+	}
+	regionalID, _ := strconv.Atoi(c.Query("regional_id", "0"))
+	format, ok := analyticsFormat(c)
+	if !ok {
+		return nil
+	}
+
+	if format != "" {
+		growth, err := fetchMasjidGrowth(eventID, from, to, regionalID, nil)
+		if err != nil {
+			log.Println("Error fetching masjid growth:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch masjid growth"})
+		}
+		return utils.SendExport(c, format, fmt.Sprintf("growth-masjid-%d-%s-%s", eventID, from, to), masjidGrowthTable(growth, from, to))
+	}
+	q, err := utils.ParseListQuery(c, utils.ListSpec{})
+	if err != nil {
+		return reportError(c, err, "Invalid pagination")
+	}
+
+	total, err := countEventMasjid(eventID, regionalID)
+	if err != nil {
+		log.Println("Error counting masjid growth:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch masjid growth"})
+	}
+	growth, err := fetchMasjidGrowth(eventID, from, to, regionalID, q)
+	if err != nil {
+		log.Println("Error fetching masjid growth:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch masjid growth"})
+	}
+	return c.JSON(q.Response(growth, total))
+}
+
+// fetchMasjidGrowth mengambil pertumbuhan per masjid; q nil berarti semua masjid,
+// selain itu hanya halaman q.
+func fetchMasjidGrowth(eventID int, from, to string, regionalID int, q *utils.ListQuery) ([]MasjidGrowth, error) {
+	fromDate, _ := time.Parse("2006-01-02", from)
+	toDate, _ := time.Parse("2006-01-02", to)
+	days := int(toDate.Sub(fromDate).Hours()/24) + 1
+	prevFrom := fromDate.AddDate(0, 0, -days).Format("2006-01-02")
+	rangeStart, rangeEnd, err := utils.AnyZoneDayRange(prevFrom, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Periode ditentukan dari tanggal lokal masjid masing-masing
+	tglDaftar := "DATE(" + services.MasjidLocalTimeSQL("p.created_at", "p.masjid_id") + ")"
+	tglHadir := "DATE(" + services.MasjidLocalTimeSQL("a.created_at", "pt.id_masjid") + ")"
+
+	// Pertumbuhan peserta aktif terbesar dulu; masjid tanpa data periode sebelumnya di akhir
+	query := `
+		SELECT m.id, m.nama, COALESCE(r.nama, ''),
+			COALESCE(reg.baru, 0), COALESCE(reg.sebelumnya, 0),
+			COALESCE(akt.aktif, 0), COALESCE(akt.sebelumnya, 0)
+		FROM (SELECT DISTINCT id_masjid FROM setting WHERE id_event = ?) s
+		JOIN masjid m ON s.id_masjid = m.id
+		LEFT JOIN regional r ON m.regional_id = r.id
+		LEFT JOIN (
+			SELECT p.masjid_id,
+				COUNT(DISTINCT CASE WHEN ` + tglDaftar + ` >= ? THEN p.id END) AS baru,
+				COUNT(DISTINCT CASE WHEN ` + tglDaftar + ` < ? THEN p.id END) AS sebelumnya
+			FROM peserta p
+			JOIN detail_peserta dp ON dp.id_peserta = p.id
+			WHERE dp.id_event = ? AND p.created_at >= ? AND p.created_at < ?
+				AND ` + tglDaftar + ` BETWEEN ? AND ?
+			GROUP BY p.masjid_id
+		) reg ON reg.masjid_id = m.id
+		LEFT JOIN (
+			SELECT pt.id_masjid,
+				COUNT(DISTINCT CASE WHEN ` + tglHadir + ` >= ? THEN a.user_id END) AS aktif,
+				COUNT(DISTINCT CASE WHEN ` + tglHadir + ` < ? THEN a.user_id END) AS sebelumnya
+			FROM absensi a
+			JOIN petugas pt ON a.mesin_id = pt.id_user
+			WHERE a.event_id = ? AND a.voided_at IS NULL AND a.created_at >= ? AND a.created_at < ?
+				AND ` + tglHadir + ` BETWEEN ? AND ?
+			GROUP BY pt.id_masjid
+		) akt ON akt.id_masjid = m.id
+		WHERE (? = 0 OR m.regional_id = ?)
+		ORDER BY (COALESCE(akt.sebelumnya, 0) = 0),
+			(COALESCE(akt.aktif, 0) - akt.sebelumnya) / akt.sebelumnya DESC,
+			COALESCE(akt.aktif, 0) DESC, m.id`
+	args := []interface{}{
+		eventID,
+		from, from, eventID, rangeStart, rangeEnd, prevFrom, to,
+		from, from, eventID, rangeStart, rangeEnd, prevFrom, to,
+		regionalID, regionalID,
+	}
+	if q != nil {
+		limitSQL, limitArgs := q.LimitSQL()
+		query += limitSQL
+		args = append(args, limitArgs...)
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	growth := []MasjidGrowth{}
+	for rows.Next() {
+		g := MasjidGrowth{PeriodeMulai: from, PeriodeSebelumnya: prevFrom}
+		if err := rows.Scan(&g.MasjidID, &g.MasjidNama, &g.MasjidRegional,
+			&g.PendaftarBaru, &g.PendaftarSebelumnya, &g.PesertaAktif, &g.PesertaAktifSebelum); err != nil {
+			return nil, err
+		}
+		g.PendaftarGrowth = growthPercent(g.PendaftarBaru, g.PendaftarSebelumnya)
+		g.PesertaAktifGrowth = growthPercent(g.PesertaAktif, g.PesertaAktifSebelum)
+		growth = append(growth, g)
+	}
+
+	return growth, rows.Err()
+}
+
+func masjidGrowthTable(growth []MasjidGrowth, from, to string) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title: "Pertumbuhan per Masjid",
+		Meta:  []string{"Periode: " + from + " s/d " + to},
+		Headers: []string{"No", "Masjid", "Regional", "Pendaftar Baru", "Pendaftar Sebelumnya", "Growth Pendaftar",
+			"Peserta Aktif", "Aktif Sebelumnya", "Growth Aktif"},
+	}
+	for i, g := range growth {
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(i + 1), g.MasjidNama, g.MasjidRegional,
+			strconv.Itoa(g.PendaftarBaru), strconv.Itoa(g.PendaftarSebelumnya), formatGrowth(g.PendaftarGrowth),
+			strconv.Itoa(g.PesertaAktif), strconv.Itoa(g.PesertaAktifSebelum), formatGrowth(g.PesertaAktifGrowth),
+		})
+	}
+	return table
+}
+
+func growthPercent(current, previous int) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	g := float64(current-previous) / float64(previous) * 100
+	return &g
+}
+
+func formatGrowth(g *float64) string {
+	if g == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", *g)
+}
+
+// analyticsRange membaca rentang tanggal dari query, default defaultDays hari
+// terakhir (zona masjid_id kalau ada, selain itu WIB). Kalau tidak valid response
+// 400 sudah ditulis.
+func analyticsRange(c *fiber.Ctx, fromKey, toKey string, defaultDays int) (string, string, bool) {
+	today := time.Now().In(masjidLocation(c.Query("masjid_id")))
+	to := c.Query(toKey, today.Format("2006-01-02"))
+	from := c.Query(fromKey, today.AddDate(0, 0, 1-defaultDays).Format("2006-01-02"))
+	if !validDateRange(from, to) {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": fromKey + " and " + toKey + " must be YYYY-MM-DD and " + fromKey + " <= " + toKey})
+		return "", "", false
+	}
+	return from, to, true
+}
+
+func analyticsFormat(c *fiber.Ctx) (string, bool) {
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+		return "", false
+	}
+	return format, true
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AbsensiFlag struct {
+	ID         int64      `json:"id"`
+	AbsensiID  int64      `json:"absensi_id"`
+	Rule       string     `json:"rule"`
+	Detail     string     `json:"detail"`
+	Source     string     `json:"source"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	ReviewNote string     `json:"review_note"`
+	UserID     int        `json:"user_id"`
+	Fullname   string     `json:"fullname"`
+	MesinID    string     `json:"mesin_id"`
+	MasjidName string     `json:"masjid_name"`
+	Tag        string     `json:"tag"`
+	ScannedAt  time.Time  `json:"scanned_at"`
+}
+
+type ReviewAbsensiFlagRequest struct {
+	Action string `json:"action" validate:"required,oneof=approve void"`
+	Note   string `json:"note" validate:"max=200"`
+}
+
+// Handler untuk antrian review absensi yang ditandai rule anomali
+func GetAbsensiFlags(c *fiber.Ctx) error {
+	status := c.Query("status", "pending")
+	rule := c.Query("rule")
+	tanggal := c.Query("tanggal")
+
+	query := `
+		SELECT f.id, f.absensi_id, f.rule, f.detail, f.source, f.status, f.created_at, f.reviewed_at,
+			COALESCE(f.review_note, ''), a.user_id, COALESCE(p.fullname, ''), a.mesin_id,
+			COALESCE(m.nama, ''), COALESCE(a.tag, ''), a.created_at
+		FROM absensi_flags f
+		JOIN absensi a ON f.absensi_id = a.id
+		LEFT JOIN peserta p ON a.user_id = p.id
+		LEFT JOIN petugas pt ON a.mesin_id = pt.id_user
+		LEFT JOIN masjid m ON pt.id_masjid = m.id
+		WHERE f.status = ?`
+	args := []interface{}{status}
+
+	if rule != "" {
+		query += " AND f.rule = ?"
+		args = append(args, rule)
+	}
+	if tanggal != "" {
+		query += " AND DATE(" + services.MasjidLocalTimeSQL("a.created_at", "pt.id_masjid") + ") = ?"
+		args = append(args, tanggal)
+	}
+	query += " ORDER BY f.created_at DESC LIMIT 500"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching absensi flags:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch absensi flags"})
+	}
+	defer rows.Close()
+
+	flags := []AbsensiFlag{}
+	for rows.Next() {
+		var f AbsensiFlag
+		var reviewedAt sql.NullTime
+		if err := rows.Scan(&f.ID, &f.AbsensiID, &f.Rule, &f.Detail, &f.Source, &f.Status, &f.CreatedAt, &reviewedAt,
+			&f.ReviewNote, &f.UserID, &f.Fullname, &f.MesinID, &f.MasjidName, &f.Tag, &f.ScannedAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		if reviewedAt.Valid {
+			f.ReviewedAt = &reviewedAt.Time
+		}
+		flags = append(flags, f)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    flags,
+	})
+}
+
+// Handler untuk approve atau void absensi yang ditandai
+func ReviewAbsensiFlag(c *fiber.Ctx) error {
+	flagID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid flag id"})
+	}
+
+	var req ReviewAbsensiFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	reviewerID := jwtUserID(c)
+	now := time.Now().UTC()
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var absensiID int64
+	var rule, status string
+	err = tx.QueryRow("SELECT absensi_id, rule, status FROM absensi_flags WHERE id = ? FOR UPDATE", flagID).
+		Scan(&absensiID, &rule, &status)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Flag not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if status != "pending" {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Flag sudah direview"})
+	}
+
+	if req.Action == "approve" {
+		_, err = tx.Exec(`
+			UPDATE absensi_flags SET status = 'approved', reviewed_by = ?, reviewed_at = ?, review_note = ?
+			WHERE id = ?`, reviewerID, now, req.Note, flagID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to approve flag"})
+		}
+	} else {
+		reason := "anomali " + rule
+		if req.Note != "" {
+			reason += ": " + req.Note
+		}
+		err = services.VoidAbsensi(tx, absensiID, reviewerID, reason)
+		if err != nil && err != services.ErrAbsensiAlreadyVoided {
+			log.Println("Error voiding absensi:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to void absensi"})
+		}
+
+		// Flag lain yang masih pending untuk absensi yang sama ikut selesai
+		_, err = tx.Exec(`
+			UPDATE absensi_flags SET status = 'voided', reviewed_by = ?, reviewed_at = ?, review_note = ?
+			WHERE absensi_id = ? AND status = 'pending'`, reviewerID, now, req.Note, absensiID)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update flags"})
+		}
+	}
+
+	newStatus := "approved"
+	if req.Action == "void" {
+		newStatus = "voided"
+	}
+	recordAudit(c, tx, "absensi_flag."+req.Action, "absensi_flag", flagID,
+		fiber.Map{"status": status},
+		fiber.Map{"status": newStatus, "note": req.Note})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save review"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Flag reviewed successfully",
+		"flag_id":    flagID,
+		"absensi_id": absensiID,
+		"action":     req.Action,
+	})
+}
+
+// Handler untuk menjalankan batch anomali secara manual
+func RunAnomalyBatch(c *fiber.Ctx) error {
+	tanggal := c.Query("tanggal")
+	if tanggal == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "tanggal is required"})
+	}
+	if _, err := time.Parse("2006-01-02", tanggal); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date format. Use YYYY-MM-DD"})
+	}
+
+	total, err := services.RunAnomalyBatch(tanggal)
+	if err != nil {
+		log.Println("Error running anomaly batch:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to run anomaly batch"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"tanggal": tanggal,
+		"flagged": total,
+	})
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	ActorType string          `json:"actor_type"`
+	ActorID   string          `json:"actor_id"`
+	IP        string          `json:"ip"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Diff      json.RawMessage `json:"diff"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// auditActor mengambil actor yang sudah di-resolve middleware AuditActor
+func auditActor(c *fiber.Ctx) services.AuditActor {
+	if actor, ok := c.Locals("audit_actor").(services.AuditActor); ok {
+		return actor
+	}
+	return services.AuditActor{Type: "anonymous", IP: c.IP()}
+}
+
+// recordAudit mencatat audit event; kegagalan audit hanya di-log supaya tidak menggagalkan request
+func recordAudit(c *fiber.Ctx, exec services.Execer, action, entity string, entityID interface{}, before, after interface{}) {
+	recordAuditAs(auditActor(c), exec, action, entity, entityID, before, after)
+}
+
+func recordAuditAs(actor services.AuditActor, exec services.Execer, action, entity string, entityID interface{}, before, after interface{}) {
+	id := ""
+	switch v := entityID.(type) {
+	case string:
+		id = v
+	case int:
+		id = strconv.Itoa(v)
+	case int64:
+		id = strconv.FormatInt(v, 10)
+	}
+
+	if err := services.RecordAudit(exec, actor, action, entity, id, before, after); err != nil {
+		log.Println("Error recording audit event:", err)
+	}
+}
+
+// auditListSpec: filter persis per kolom, from/to tanggal (inklusif), urut id terbaru
+var auditListSpec = utils.ListSpec{
+	Sorts:       map[string]string{"id": "id"},
+	DefaultSort: "-id",
+	Filters: map[string]utils.FilterKind{
+		"actor_type": utils.FilterString,
+		"actor_id":   utils.FilterString,
+		"action":     utils.FilterString,
+		"entity":     utils.FilterString,
+		"entity_id":  utils.FilterString,
+		"from":       utils.FilterDate,
+		"to":         utils.FilterDate,
+	},
+	Cursor: true,
+}
+
+// Handler untuk query audit log (filter + pagination)
+func GetAuditEvents(c *fiber.Ctx) error {
+	q, err := utils.ParseListQuery(c, auditListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
+	}
+
+	var conditions []string
+	var args []interface{}
+	for _, field := range []string{"actor_type", "actor_id", "action", "entity", "entity_id"} {
+		if q.Has(field) {
+			conditions = append(conditions, field+" = ?")
+			args = append(args, q.String(field))
+		}
+	}
+	if q.Has("from") {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, q.String("from"))
+	}
+	if q.Has("to") {
+		conditions = append(conditions, "created_at < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, q.String("to"))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM audit_events "+where, args...).Scan(&total); err != nil {
+		log.Println("Error counting audit events:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch audit events"})
+	}
+
+	pageWhere, pageArgs := where, args
+	if cond, condArgs := q.CursorSQL("id"); cond != "" {
+		if pageWhere == "" {
+			pageWhere = "WHERE " + cond
+		} else {
+			pageWhere += " AND " + cond
+		}
+		pageArgs = append(append([]interface{}{}, args...), condArgs...)
+	}
+	limitSQL, limitArgs := q.LimitSQL()
+	rows, err := database.DB.Query(`
+		SELECT id, actor_type, actor_id, ip, action, entity, entity_id, COALESCE(diff, 'null'), created_at
+		FROM audit_events `+pageWhere+q.OrderSQL("id")+limitSQL,
+		append(pageArgs, limitArgs...)...)
+	if err != nil {
+		log.Println("Error fetching audit events:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch audit events"})
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		var diff string
+		if err := rows.Scan(&e.ID, &e.ActorType, &e.ActorID, &e.IP, &e.Action, &e.Entity, &e.EntityID, &diff, &e.CreatedAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		e.Diff = json.RawMessage(diff)
+		events = append(events, e)
+	}
+
+	if n := len(events); n > 0 {
+		q.NextAfter(n, nil, events[n-1].ID)
+	}
+	return c.JSON(q.Response(events, total))
+}
@@ -39,11 +39,17 @@ func Register(c *fiber.Ctx) error {
 	}
 
 	// Simpan ke database
-	_, err = database.DB.Exec("INSERT INTO users (username, email, password) VALUES (?, ?, ?)", req.Username, req.Email, hashedPassword)
+	result, err := database.DB.Exec("INSERT INTO users (username, email, password) VALUES (?, ?, ?)", req.Username, req.Email, hashedPassword)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to register user"})
 	}
 
+	userID, _ := result.LastInsertId()
+	recordAudit(c, database.DB, "user.register", "user", userID, nil, fiber.Map{
+		"username": req.Username,
+		"email":    req.Email,
+	})
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "User registered successfully"})
 }
 
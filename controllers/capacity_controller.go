@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Capacity kosong (null) menghapus batas kapasitas masjid untuk event tersebut
+type UpdateCapacityRequest struct {
+	MasjidID      int  `json:"masjid_id" validate:"required,min=1"`
+	EventID       int  `json:"event_id" validate:"required,min=1"`
+	Capacity      *int `json:"capacity" validate:"omitempty,min=0"`
+	WaitlistLimit *int `json:"waitlist_limit" validate:"omitempty,min=0"`
+}
+
+// Handler untuk sisa kursi per masjid di satu event, ?masjid_id= untuk satu masjid
+func GetEventCapacity(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Params("id_event"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event id"})
+	}
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id"))
+
+	capacities, err := services.LoadCapacities(eventID, masjidID)
+	if err != nil {
+		log.Println("Error fetching capacity:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch capacity"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    capacities,
+	})
+}
+
+// Handler untuk mengatur kapasitas (masjid, event). Kalau kapasitas dinaikkan,
+// antrian tunggu langsung dinaikkan sampai kursi terisi lagi.
+func UpdateEventCapacity(c *fiber.Ctx) error {
+	var req UpdateCapacityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	before, err := services.LoadCapacities(req.EventID, req.MasjidID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if len(before) == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Masjid is not part of this event"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if req.Capacity == nil {
+		_, err = tx.Exec("DELETE FROM masjid_event_capacity WHERE masjid_id = ? AND event_id = ?", req.MasjidID, req.EventID)
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO masjid_event_capacity (masjid_id, event_id, capacity, waitlist_limit) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE capacity = VALUES(capacity), waitlist_limit = VALUES(waitlist_limit)`,
+			req.MasjidID, req.EventID, *req.Capacity, req.WaitlistLimit)
+	}
+	if err != nil {
+		log.Println("Error saving capacity:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save capacity"})
+	}
+
+	promoted, err := services.PromoteWaitlist(tx, req.EventID, req.MasjidID)
+	if err != nil {
+		log.Println("Error promoting waitlist:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save capacity"})
+	}
+
+	recordAudit(c, tx, "capacity.update", "masjid_event_capacity", fmt.Sprintf("%d:%d", req.MasjidID, req.EventID), before[0], req)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save capacity"})
+	}
+	forgetEnrollments(req.EventID, promoted)
+
+	after, _ := services.LoadCapacities(req.EventID, req.MasjidID)
+	return c.JSON(fiber.Map{
+		"message":  "Capacity updated successfully",
+		"data":     after,
+		"promoted": promoted,
+	})
+}
@@ -0,0 +1,509 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Field yang tidak dikirim tidak diubah. Slug tetap supaya link yang sudah dibagikan tidak putus.
+type UpdateCollectionRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=1,max=255"`
+	SholatTrack []int   `json:"sholat_track" validate:"omitempty,min=1,dive,min=1,max=6"`
+	DateStart   *string `json:"date_start"`
+	DateEnd     *string `json:"date_end"`
+	MasjidIDs   []int   `json:"masjid_id" validate:"omitempty,min=1,dive,min=0"`
+}
+
+type UpdateCollectionTargetsRequest struct {
+	Targets []services.CollectionTarget `json:"targets" validate:"max=20,dive"`
+}
+
+// Pin opsional (4-8 angka); link kedaluwarsa setelah ExpiresInDays hari (default 30).
+type CreateShareTokenRequest struct {
+	Label         string `json:"label" validate:"max=100"`
+	Privacy       string `json:"privacy" validate:"omitempty,oneof=full hide initials"`
+	Pin           string `json:"pin" validate:"omitempty,numeric,min=4,max=8"`
+	ExpiresInDays *int   `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+type CollectionMember struct {
+	ID       int64  `json:"id"`
+	Fullname string `json:"fullname"`
+}
+
+// Handler untuk detail collection beserta anggotanya. QR code anggota tidak
+// ditampilkan karena QR code wali dipakai untuk membuka data keluarga.
+func GetCollection(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT p.id, COALESCE(p.fullname, '')
+		FROM collection_items ci
+		JOIN peserta p ON ci.id_peserta = p.id
+		WHERE ci.collection_id = ?
+		ORDER BY p.fullname`, col.ID)
+	if err != nil {
+		log.Println("Error fetching collection members:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collection"})
+	}
+	defer rows.Close()
+
+	members := []CollectionMember{}
+	for rows.Next() {
+		var m CollectionMember
+		if err := rows.Scan(&m.ID, &m.Fullname); err != nil {
+			log.Println("Error scanning row:", err)
+			continue
+		}
+		members = append(members, m)
+	}
+	categoryIDs, err := services.CollectionCategoryIDs(col.ID)
+	if err != nil {
+		log.Println("Error fetching collection categories:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collection"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":      "Success",
+		"data":         col,
+		"members":      members,
+		"category_ids": categoryIDs,
+	})
+}
+
+// Handler untuk mengubah nama, tanggal, sholat yang dilacak atau masjid collection
+func UpdateCollection(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	var req UpdateCollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	after := *col
+	if req.Name != nil {
+		after.Name = *req.Name
+	}
+	if req.DateStart != nil {
+		after.DateStart = *req.DateStart
+	}
+	if req.DateEnd != nil {
+		after.DateEnd = *req.DateEnd
+	}
+	if req.SholatTrack != nil {
+		after.TrackingCode = collectionTrackingCode(req.SholatTrack)
+	}
+	if req.MasjidIDs != nil {
+		after.MasjidID = collectionMasjidString(req.MasjidIDs)
+	}
+	if !validDateRange(after.DateStart, after.DateEnd) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date range. Use YYYY-MM-DD"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE collections SET name = ?, tracking_code = ?, date_start = ?, date_end = ?, masjid_id = ?, updated_at = ?
+		WHERE id = ?`,
+		after.Name, after.TrackingCode, after.DateStart, after.DateEnd, after.MasjidID, time.Now(), col.ID)
+	if err != nil {
+		log.Println("Error updating collection:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update collection"})
+	}
+
+	recordAudit(c, tx, "collection.update", "collection", col.ID, col, after)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update collection"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Collection updated successfully", "data": after})
+}
+
+// Handler untuk menghapus collection beserta anggota, target dan relasi kategorinya
+func DeleteCollection(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.DeleteCollection(tx, col.ID); err != nil {
+		log.Println("Error deleting collection:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete collection"})
+	}
+
+	recordAudit(c, tx, "collection.delete", "collection", col.ID, col, nil)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete collection"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Collection deleted successfully"})
+}
+
+// Handler untuk menambah banyak anggota sekaligus lewat qr_codes, peserta_ids
+// dan/atau filter (misalnya semua pendaftar masjid X). Anggota yang sudah ada dilewati.
+func AddCollectionMembers(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	ids, missing, ok := memberSelectorBody(c)
+	if !ok {
+		return nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	added, err := services.AddCollectionMembers(tx, col, ids)
+	if err != nil {
+		log.Println("Error adding collection members:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add members"})
+	}
+
+	for _, id := range added {
+		err = services.EmitEvent(tx, services.EventCollectionMemberAdd, fiber.Map{
+			"collection_id":   col.ID,
+			"collection_slug": col.Slug,
+			"peserta_id":      id,
+		})
+		if err != nil {
+			log.Println("Error writing webhook outbox:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add members"})
+		}
+	}
+
+	recordAudit(c, tx, "collection.add_members", "collection", col.ID, nil, fiber.Map{"peserta_ids": added})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to add members"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Members added successfully",
+		"added":     len(added),
+		"skipped":   len(ids) - len(added),
+		"not_found": missing,
+	})
+}
+
+// Handler untuk mengeluarkan banyak anggota sekaligus, body sama dengan AddCollectionMembers
+func RemoveCollectionMembers(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	ids, missing, ok := memberSelectorBody(c)
+	if !ok {
+		return nil
+	}
+	return removeCollectionMembers(c, col, ids, missing)
+}
+
+// Handler untuk mengeluarkan satu anggota collection
+func DeleteCollectionMember(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	pesertaID, err := strconv.ParseInt(c.Params("id_peserta"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid peserta id"})
+	}
+	return removeCollectionMembers(c, col, []int64{pesertaID}, nil)
+}
+
+func removeCollectionMembers(c *fiber.Ctx, col *services.Collection, ids []int64, missing []string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	removed, err := services.RemoveCollectionMembers(tx, col.ID, ids)
+	if err != nil {
+		log.Println("Error removing collection members:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove members"})
+	}
+
+	for _, id := range removed {
+		err = services.EmitEvent(tx, services.EventCollectionMemberDel, fiber.Map{
+			"collection_id":   col.ID,
+			"collection_slug": col.Slug,
+			"peserta_id":      id,
+		})
+		if err != nil {
+			log.Println("Error writing webhook outbox:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove members"})
+		}
+	}
+
+	recordAudit(c, tx, "collection.remove_members", "collection", col.ID, fiber.Map{"peserta_ids": removed}, nil)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to remove members"})
+	}
+
+	response := fiber.Map{
+		"message": "Members removed successfully",
+		"removed": len(removed),
+	}
+	if missing != nil {
+		response["not_found"] = missing
+	}
+	return c.JSON(response)
+}
+
+// Handler untuk target kehadiran collection
+func GetCollectionTargets(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	targets, err := services.LoadCollectionTargets(col.ID)
+	if err != nil {
+		log.Println("Error fetching collection targets:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch targets"})
+	}
+	return c.JSON(fiber.Map{"message": "Success", "data": targets})
+}
+
+// Handler untuk mengganti seluruh target kehadiran collection
+func UpdateCollectionTargets(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	var req UpdateCollectionTargetsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	var tracked []string
+	for _, code := range strings.Split(col.TrackingCode, ",") {
+		if tag, ok := collectionSholatMap[strings.TrimSpace(code)]; ok {
+			tracked = append(tracked, tag)
+		}
+	}
+	if err := services.ValidateCollectionTargets(req.Targets, tracked); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	before, err := services.LoadCollectionTargets(col.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch targets"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.ReplaceCollectionTargets(tx, col.ID, req.Targets); err != nil {
+		log.Println("Error saving collection targets:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save targets"})
+	}
+
+	recordAudit(c, tx, "collection.targets", "collection", col.ID, fiber.Map{"targets": before}, fiber.Map{"targets": req.Targets})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save targets"})
+	}
+
+	targets, _ := services.LoadCollectionTargets(col.ID)
+	return c.JSON(fiber.Map{"message": "Targets updated successfully", "data": targets})
+}
+
+// Handler untuk daftar link berbagi collection
+func GetCollectionShareTokens(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	tokens, err := services.LoadShareTokens(col.ID)
+	if err != nil {
+		log.Println("Error fetching share tokens:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch share links"})
+	}
+	return c.JSON(fiber.Map{"message": "Success", "data": tokens})
+}
+
+// Handler untuk membuat link berbagi collection. Token mentah hanya dikembalikan di sini.
+func CreateCollectionShareToken(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	var req CreateShareTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	if req.Privacy == "" {
+		req.Privacy = services.SharePrivacyHide
+	}
+	days := 30
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	expiresAt := time.Now().UTC().AddDate(0, 0, days)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	raw, id, err := services.CreateShareToken(tx, col.ID, req.Label, req.Privacy, req.Pin, &expiresAt, jwtUserID(c))
+	if err != nil {
+		log.Println("Error creating share token:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create share link"})
+	}
+
+	recordAudit(c, tx, "collection.share_create", "collection", col.ID, nil, fiber.Map{
+		"share_token_id": id,
+		"label":          req.Label,
+		"privacy":        req.Privacy,
+		"has_pin":        req.Pin != "",
+		"expires_at":     expiresAt,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create share link"})
+	}
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Share link created successfully",
+		"data": fiber.Map{
+			"id":         id,
+			"token":      raw,
+			"path":       "/api/v1/collections-absensi/" + col.Slug + "?token=" + raw,
+			"privacy":    req.Privacy,
+			"has_pin":    req.Pin != "",
+			"expires_at": expiresAt,
+		},
+	})
+}
+
+// Handler untuk mencabut link berbagi collection
+func RevokeCollectionShareToken(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	tokenID, err := strconv.Atoi(c.Params("token_id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid share link id"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	err = services.RevokeShareToken(tx, col.ID, tokenID)
+	if err == services.ErrShareTokenNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Share link not found"})
+	} else if err != nil {
+		log.Println("Error revoking share token:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke share link"})
+	}
+
+	recordAudit(c, tx, "collection.share_revoke", "collection", col.ID, nil, fiber.Map{"share_token_id": tokenID})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke share link"})
+	}
+	return c.JSON(fiber.Map{"message": "Share link revoked successfully"})
+}
+
+// collectionParam mengambil collection dari :id; owned berarti user yang login
+// harus pemiliknya. Kalau gagal response sudah ditulis dan hasilnya false.
+func collectionParam(c *fiber.Ctx, owned bool) (*services.Collection, bool) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid collection id"})
+		return nil, false
+	}
+	col, err := services.LoadCollection(id)
+	if err == services.ErrCollectionNotFound {
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Collection not found"})
+		return nil, false
+	} else if err != nil {
+		log.Println("Error fetching collection:", err)
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		return nil, false
+	}
+	if owned {
+		if err := services.CheckCollectionOwner(col, jwtUserID(c), isAdminUser(c)); err != nil {
+			c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Collection belongs to another user or can only be managed by an admin"})
+			return nil, false
+		}
+	}
+	return col, true
+}
+
+// memberSelectorBody membaca services.MemberSelector dari body dan mengubahnya
+// menjadi id peserta. Kalau gagal response sudah ditulis dan hasilnya false.
+func memberSelectorBody(c *fiber.Ctx) ([]int64, []string, bool) {
+	var sel services.MemberSelector
+	if err := c.BodyParser(&sel); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		return nil, nil, false
+	}
+	if err := utils.Validate.Struct(sel); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return nil, nil, false
+	}
+
+	ids, missing, err := services.ResolveMemberSelector(sel)
+	if err == services.ErrNoMemberSelector || err == services.ErrEmptyMemberFilter {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return nil, nil, false
+	} else if err != nil {
+		log.Println("Error resolving collection members:", err)
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		return nil, nil, false
+	}
+	return ids, missing, true
+}
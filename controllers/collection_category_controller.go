@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MasjidID kosong berarti kategori global; ParentID kosong berarti kategori akar.
+type CollectionCategoryRequest struct {
+	Name     string `json:"name" validate:"required,max=255"`
+	ParentID *int   `json:"parent_id" validate:"omitempty,min=1"`
+	MasjidID *int   `json:"masjid_id" validate:"omitempty,min=1"`
+}
+
+type CollectionCategoriesRequest struct {
+	CategoryIDs []int `json:"category_ids" validate:"max=50,dive,min=1"`
+}
+
+// Handler untuk membuat kategori collection
+func CreateCollectionCategory(c *fiber.Ctx) error {
+	return saveCollectionCategory(c, 0)
+}
+
+// Handler untuk mengubah nama, parent atau masjid kategori collection
+func UpdateCollectionCategory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category id"})
+	}
+	return saveCollectionCategory(c, id)
+}
+
+// Handler untuk menghapus kategori collection; collection-nya tidak ikut terhapus
+func DeleteCollectionCategory(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category id"})
+	}
+	before, err := services.LoadCategory(id)
+	if err != nil {
+		return collectionCategoryError(c, err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.DeleteCategory(tx, id); err != nil {
+		return collectionCategoryError(c, err)
+	}
+	recordAudit(c, tx, "collection_category.delete", "collection_category", id, before, nil)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete category"})
+	}
+	return c.JSON(fiber.Map{"message": "Category deleted successfully"})
+}
+
+// Handler untuk mengganti seluruh kategori sebuah collection
+func UpdateCollectionCategories(c *fiber.Ctx) error {
+	col, ok := collectionParam(c, true)
+	if !ok {
+		return nil
+	}
+	var req CollectionCategoriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	before, err := services.CollectionCategoryIDs(col.ID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.SetCollectionCategories(tx, col, req.CategoryIDs); err != nil {
+		return collectionCategoryError(c, err)
+	}
+	recordAudit(c, tx, "collection.categories", "collection", col.ID,
+		fiber.Map{"category_ids": before}, fiber.Map{"category_ids": req.CategoryIDs})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update categories"})
+	}
+
+	ids, _ := services.CollectionCategoryIDs(col.ID)
+	return c.JSON(fiber.Map{"message": "Categories updated successfully", "data": ids})
+}
+
+func saveCollectionCategory(c *fiber.Ctx, id int) error {
+	var req CollectionCategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	var before *services.CollectionCategory
+	if id != 0 {
+		var err error
+		if before, err = services.LoadCategory(id); err != nil {
+			return collectionCategoryError(c, err)
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	savedID, err := services.SaveCategory(tx, id, req.Name, req.ParentID, req.MasjidID)
+	if err != nil {
+		return collectionCategoryError(c, err)
+	}
+
+	action := "collection_category.create"
+	if id != 0 {
+		action = "collection_category.update"
+	}
+	recordAudit(c, tx, action, "collection_category", savedID, before, req)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save category"})
+	}
+
+	category, _ := services.LoadCategory(savedID)
+	if id == 0 {
+		return c.Status(http.StatusCreated).JSON(fiber.Map{"message": "Category created successfully", "data": category})
+	}
+	return c.JSON(fiber.Map{"message": "Category updated successfully", "data": category})
+}
+
+// collectionCategoryError menulis response untuk error kategori dari services
+func collectionCategoryError(c *fiber.Ctx, err error) error {
+	switch err {
+	case services.ErrCategoryNotFound:
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	case services.ErrCategoryParentInvalid, services.ErrCategoryCycle, services.ErrCategoryScope:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case services.ErrCategoryHasChildren:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	log.Println("Error saving collection category:", err)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+}
@@ -1,11 +1,17 @@
 package controllers
 
 import (
+	"database/sql"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"shollu/database"
+	"shollu/services"
 	"shollu/utils"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,11 +20,12 @@ import (
 
 type CreateCollectionRequest struct {
 	Name        string  `json:"name" validate:"required"`
-	SholatTrack []int   `json:"sholat_track" validate:"required,dive,number,min=1,max=5"` // e.g. [1,2,3]
+	SholatTrack []int   `json:"sholat_track" validate:"required,dive,number,min=1,max=6"` // e.g. [1,2,3]
 	DateStart   string  `json:"date_start" validate:"required"`                           // Format: YYYY-MM-DD
 	DateEnd     string  `json:"date_end" validate:"required"`                             // Format: YYYY-MM-DD
 	MasjidIDs   []int   `json:"masjid_id" validate:"required,dive,number"`
 	PesertaIDs  []int64 `json:"peserta_ids" validate:"required,dive,required"`
+	CategoryIDs []int   `json:"category_ids" validate:"omitempty,dive,min=1"`
 }
 
 func slugify(name string) string {
@@ -48,34 +55,22 @@ func CreateCollection(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate unique slug"})
 	}
-	sholatTrackStr := ""
-	for i, v := range req.SholatTrack {
-		if i > 0 {
-			sholatTrackStr += ","
-		}
-		sholatTrackStr += fmt.Sprint(v)
-	}
-	trackingCode := sholatTrackStr
+	trackingCode := collectionTrackingCode(req.SholatTrack)
+	masjidIDStr := collectionMasjidString(req.MasjidIDs)
 	now := time.Now()
 
-	// Gabungkan masjid_id menjadi string dipisah koma
-	masjidIDStr := ""
-	if len(req.MasjidIDs) == 1 && req.MasjidIDs[0] == 0 {
-		masjidIDStr = "all"
-	} else {
-		for i, id := range req.MasjidIDs {
-			if i > 0 {
-				masjidIDStr += ","
-			}
-			masjidIDStr += fmt.Sprint(id)
-		}
+	// Collection dan anggotanya disimpan dalam satu transaksi supaya tidak ada collection setengah jadi
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
+	defer tx.Rollback()
 
-	// Insert ke tabel `collections`
-	result, err := database.DB.Exec(`
-		INSERT INTO collections (create_time, name, slug, tracking_code, date_start, date_end, masjid_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		now, req.Name, slug, trackingCode, dateStart, dateEnd, masjidIDStr)
+	// Insert ke tabel `collections`; pemiliknya user yang login (kosong lewat route publik)
+	result, err := tx.Exec(`
+		INSERT INTO collections (create_time, name, slug, tracking_code, date_start, date_end, masjid_id, owner_user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0))`,
+		now, req.Name, slug, trackingCode, dateStart, dateEnd, masjidIDStr, jwtUserID(c))
 
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create collection"})
@@ -87,27 +82,64 @@ func CreateCollection(c *fiber.Ctx) error {
 	}
 
 	// Insert peserta ke collection_items
-	for _, idPeserta := range req.PesertaIDs {
-		_, err := database.DB.Exec(`
-			INSERT INTO collection_items (create_time, collection_id, collection_slug, id_peserta)
-			VALUES (?, ?, ?, ?)`, now, collectionID, slug, idPeserta)
+	col := &services.Collection{ID: collectionID, Slug: slug, MasjidID: masjidIDStr}
+	if _, err := services.AddCollectionMembers(tx, col, req.PesertaIDs); err != nil {
+		log.Println("Error inserting collection items:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to insert collection items"})
+	}
 
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": fmt.Sprintf("Failed to insert collection item for peserta ID %d", idPeserta),
-			})
+	if len(req.CategoryIDs) > 0 {
+		if err := services.SetCollectionCategories(tx, col, req.CategoryIDs); err != nil {
+			return collectionCategoryError(c, err)
 		}
 	}
 
+	recordAudit(c, tx, "collection.create", "collection", collectionID, nil, fiber.Map{
+		"name":          req.Name,
+		"slug":          slug,
+		"tracking_code": trackingCode,
+		"date_start":    req.DateStart,
+		"date_end":      req.DateEnd,
+		"masjid_id":     masjidIDStr,
+		"peserta_ids":   req.PesertaIDs,
+		"category_ids":  req.CategoryIDs,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create collection"})
+	}
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{
 		"message":         "Collection created successfully",
 		"collection_id":   collectionID,
 		"tracking_code":   trackingCode,
 		"slug":            slug,
 		"sholat_tracking": req.SholatTrack,
+		"category_ids":    req.CategoryIDs,
 	})
 }
 
+// collectionTrackingCode menggabungkan kode sholat menjadi string dipisah koma
+func collectionTrackingCode(sholatTrack []int) string {
+	codes := make([]string, len(sholatTrack))
+	for i, v := range sholatTrack {
+		codes[i] = strconv.Itoa(v)
+	}
+	return strings.Join(codes, ",")
+}
+
+// collectionMasjidString menggabungkan masjid_id menjadi string dipisah koma; [0] berarti semua masjid
+func collectionMasjidString(masjidIDs []int) string {
+	if len(masjidIDs) == 1 && masjidIDs[0] == 0 {
+		return "all"
+	}
+	ids := make([]string, len(masjidIDs))
+	for i, id := range masjidIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return strings.Join(ids, ",")
+}
+
 func generateUniqueSlug(baseSlug string) (string, error) {
 	slug := baseSlug
 	suffix := ""
@@ -161,25 +193,16 @@ func ViewCollection(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Collection not found"})
 	}
 
-	// Map kode sholat ke nama tag
-	sholatMap := map[string]string{
-		"1": "subuh",
-		"2": "dzuhur",
-		"3": "ashar",
-		"4": "maghrib",
-		"5": "isya",
-	}
-
 	var sholatTags []string
 	for _, code := range strings.Split(collection.SholatTrack, ",") {
-		if tag, ok := sholatMap[code]; ok {
+		if tag, ok := collectionSholatMap[code]; ok {
 			sholatTags = append(sholatTags, tag)
 		}
 	}
 
 	// Ambil peserta: id dan fullname
 	pesertaRows, err := database.DB.Query(`
-        SELECT p.id, p.fullname 
+        SELECT p.id, p.fullname, p.isHideName
         FROM collection_items ci
         JOIN peserta p ON ci.id_peserta = p.id
         WHERE ci.collection_id = ?`, collection.ID)
@@ -192,15 +215,16 @@ func ViewCollection(c *fiber.Ctx) error {
 	for pesertaRows.Next() {
 		var id int
 		var fullname string
-		pesertaRows.Scan(&id, &fullname)
-		pesertaMap[id] = fullname
+		var hidden bool
+		pesertaRows.Scan(&id, &fullname, &hidden)
+		pesertaMap[id] = collectionDisplayName(c, fullname, hidden)
 	}
 	if len(pesertaMap) == 0 {
 		return c.JSON(fiber.Map{"message": "No peserta found"})
 	}
 
 	// Tanggal dari query
-	dateFromStr := c.Query("date_from", time.Now().Format("2006-01-02"))
+	dateFromStr := c.Query("date_from", utils.Today(utils.DefaultLocation()))
 	dateToStr := c.Query("date_to", dateFromStr)
 
 	dateFrom, err := time.Parse("2006-01-02", dateFromStr)
@@ -255,12 +279,13 @@ func ViewCollection(c *fiber.Ctx) error {
 	// }
 
 	absenQuery := fmt.Sprintf(`
-		SELECT a.user_id, DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) as tanggal, a.tag
+		SELECT a.user_id, DATE(`+services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")+`) as tanggal, a.tag
 		FROM absensi a
 		JOIN petugas p ON a.mesin_id = p.id_user
 		WHERE a.tag IN (%s)
 			AND a.user_id IN (%s)
-			AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
+			AND a.voided_at IS NULL
+			AND DATE(`+services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")+`) BETWEEN '%s' AND '%s'
 	`, inTags, inPeserta, dateFromStr, dateToStr)
 
 	// Jalankan query absensi
@@ -344,9 +369,86 @@ func ViewCollection(c *fiber.Ctx) error {
 
 }
 
+// CollectionCell adalah status satu sholat pada satu tanggal di grid collection
+type CollectionCell struct {
+	Status     string `json:"status"`
+	MasjidID   int    `json:"masjid_id,omitempty"`
+	MasjidName string `json:"masjid_name,omitempty"`
+}
+
+type CollectionGridRow struct {
+	UserID   int                                  `json:"-"`
+	Fullname string                               `json:"fullname"`
+	Absen    map[string]map[string]CollectionCell `json:"absen"`
+	Total    int                                  `json:"total"`
+	Progress *services.CollectionProgress         `json:"progress,omitempty"`
+	HideName bool                                 `json:"-"`
+	Gender   string                               `json:"-"`
+	Dob      *time.Time                           `json:"-"`
+}
+
+// CollectionGrid adalah rekap collection: peserta x tanggal x sholat
+type CollectionGrid struct {
+	ID         int64
+	Name       string
+	Slug       string
+	SholatTags []string
+	Dates      []string
+	Rows       []CollectionGridRow
+}
+
 func ViewCollectionNew(c *fiber.Ctx) error {
 	slug := c.Params("slug")
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
 
+	dateFromStr := c.Query("date_from", utils.Today(utils.DefaultLocation()))
+	dateToStr := c.Query("date_to", dateFromStr)
+
+	grid, err := fetchCollectionGrid(slug, dateFromStr, dateToStr)
+	if err != nil {
+		return reportError(c, err, "Failed to get absensi")
+	}
+	if len(grid.Rows) == 0 {
+		return c.JSON(fiber.Map{"message": "No peserta found"})
+	}
+	applyCollectionPrivacy(c, grid)
+
+	if format != "" {
+		return utils.SendExport(c, format, fmt.Sprintf("collection-%s-%s-%s", slug, dateFromStr, dateToStr), collectionGridTable(grid))
+	}
+
+	targets, err := applyCollectionTargets(grid)
+	if err != nil {
+		log.Println("Error evaluating collection targets:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to evaluate targets"})
+	}
+
+	response := fiber.Map{
+		"sholat_tracked": grid.SholatTags,
+		"dates":          grid.Dates,
+		"data":           grid.Rows,
+	}
+	if len(targets) > 0 {
+		response["targets"] = targets
+		response["progress"] = collectionProgressSummary(grid, targets)
+	}
+	if c.QueryBool("demografi") {
+		demografi, err := collectionDemographics(grid)
+		if err != nil {
+			log.Println("Error computing collection demographics:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to compute demographics"})
+		}
+		response["demografi"] = demografi
+	}
+
+	return c.JSON(response)
+}
+
+// fetchCollectionGrid menyusun grid kehadiran peserta collection pada rentang tanggal
+func fetchCollectionGrid(slug, dateFromStr, dateToStr string) (*CollectionGrid, error) {
 	// Ambil data collection
 	var collection struct {
 		ID          int64
@@ -365,51 +467,48 @@ func ViewCollectionNew(c *fiber.Ctx) error {
 		&collection.DateStart, &collection.DateEnd, &collection.MasjidID, &collection.SholatTrack,
 	)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Collection not found"})
-	}
-
-	sholatMap := map[string]string{
-		"1": "subuh", "2": "dzuhur", "3": "ashar", "4": "maghrib", "5": "isya",
+		return nil, fiber.NewError(fiber.StatusNotFound, "Collection not found")
 	}
 
-	var sholatTags []string
+	grid := &CollectionGrid{ID: collection.ID, Name: collection.Name, Slug: collection.Slug}
 	for _, code := range strings.Split(collection.SholatTrack, ",") {
-		if tag, ok := sholatMap[code]; ok {
-			sholatTags = append(sholatTags, tag)
+		if tag, ok := collectionSholatMap[code]; ok {
+			grid.SholatTags = append(grid.SholatTags, tag)
 		}
 	}
 
 	// Ambil peserta
 	pesertaRows, err := database.DB.Query(`
-		SELECT p.id, p.fullname 
+		SELECT p.id, p.fullname, COALESCE(p.gender, ''), p.dob, p.isHideName
 		FROM collection_items ci
 		JOIN peserta p ON ci.id_peserta = p.id
 		WHERE ci.collection_id = ?`, collection.ID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get peserta"})
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to get peserta")
 	}
 	defer pesertaRows.Close()
 
-	pesertaMap := make(map[int]string)
+	pesertaMap := make(map[int]CollectionGridRow)
 	for pesertaRows.Next() {
-		var id int
-		var fullname string
-		pesertaRows.Scan(&id, &fullname)
-		pesertaMap[id] = fullname
+		var row CollectionGridRow
+		var dob sql.NullString
+		pesertaRows.Scan(&row.UserID, &row.Fullname, &row.Gender, &dob, &row.HideName)
+		if dob.Valid && len(dob.String) >= 10 {
+			if t, err := time.Parse("2006-01-02", dob.String[:10]); err == nil {
+				row.Dob = &t
+			}
+		}
+		pesertaMap[row.UserID] = row
 	}
 	if len(pesertaMap) == 0 {
-		return c.JSON(fiber.Map{"message": "No peserta found"})
+		return grid, nil
 	}
 
-	dateFromStr := c.Query("date_from", time.Now().Format("2006-01-02"))
-	dateToStr := c.Query("date_to", dateFromStr)
-
 	dateFrom, _ := time.Parse("2006-01-02", dateFromStr)
 	dateTo, _ := time.Parse("2006-01-02", dateToStr)
 
-	var dates []string
 	for d := dateFrom; !d.After(dateTo); d = d.AddDate(0, 0, 1) {
-		dates = append(dates, d.Format("2006-01-02"))
+		grid.Dates = append(grid.Dates, d.Format("2006-01-02"))
 	}
 
 	var pesertaIDs []string
@@ -417,19 +516,25 @@ func ViewCollectionNew(c *fiber.Ctx) error {
 		pesertaIDs = append(pesertaIDs, fmt.Sprintf("%d", id))
 	}
 	inPeserta := strings.Join(pesertaIDs, ",")
-	inTags := "'" + strings.Join(sholatTags, "','") + "'"
+	// Kalau hanya dzuhur yang dilacak, scan jumat laki-laki dihitung sebagai dzuhur
+	queryTags := grid.SholatTags
+	jumatAsDzuhur := slices.Contains(grid.SholatTags, "dzuhur") && !slices.Contains(grid.SholatTags, jumatTag)
+	if jumatAsDzuhur {
+		queryTags = append(append([]string{}, grid.SholatTags...), jumatTag)
+	}
+	inTags := "'" + strings.Join(queryTags, "','") + "'"
 
 	var absenQuery string
 	if collection.MasjidID == "all" {
 		absenQuery = fmt.Sprintf(`
-			SELECT a.user_id, DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) as tanggal, 
+			SELECT a.user_id, DATE(`+services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")+`) as tanggal, 
 				   a.tag, m.id as masjid_id, m.nama as masjid_name
 			FROM absensi a
 			JOIN petugas p ON a.mesin_id = p.id_user
 			JOIN masjid m ON p.id_masjid = m.id
-			WHERE a.tag IN (%s) AND a.user_id IN (%s)
-			  AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
-		`, inTags, inPeserta, dateFromStr, dateToStr)
+			WHERE a.tag IN (%s) AND a.user_id IN (%s) AND a.voided_at IS NULL
+			  AND DATE(`+services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")+`) BETWEEN ? AND ?
+		`, inTags, inPeserta)
 	} else {
 		masjidIDs := strings.Split(collection.MasjidID, ",")
 		for i := range masjidIDs {
@@ -438,27 +543,23 @@ func ViewCollectionNew(c *fiber.Ctx) error {
 		inMasjid := strings.Join(masjidIDs, ",")
 
 		absenQuery = fmt.Sprintf(`
-			SELECT a.user_id, DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) as tanggal, 
+			SELECT a.user_id, DATE(`+services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")+`) as tanggal, 
 				   a.tag, m.id as masjid_id, m.nama as masjid_name
 			FROM absensi a
 			JOIN petugas p ON a.mesin_id = p.id_user
 			JOIN masjid m ON p.id_masjid = m.id
-			WHERE p.id_masjid IN (%s) AND a.tag IN (%s) AND a.user_id IN (%s)
-			  AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
-		`, inMasjid, inTags, inPeserta, dateFromStr, dateToStr)
+			WHERE p.id_masjid IN (%s) AND a.tag IN (%s) AND a.user_id IN (%s) AND a.voided_at IS NULL
+			  AND DATE(`+services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")+`) BETWEEN ? AND ?
+		`, inMasjid, inTags, inPeserta)
 	}
 
-	absenRows, err := database.DB.Query(absenQuery)
+	absenRows, err := database.DB.Query(absenQuery, dateFromStr, dateToStr)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get absensi"})
+		return nil, err
 	}
 	defer absenRows.Close()
 
-	absensiMap := make(map[int]map[string]map[string]struct {
-		Status     string
-		MasjidID   int
-		MasjidName string
-	})
+	absensiMap := make(map[int]map[string]map[string]CollectionCell)
 
 	for absenRows.Next() {
 		var userID int
@@ -467,210 +568,575 @@ func ViewCollectionNew(c *fiber.Ctx) error {
 		var masjidID int
 		var masjidName string
 		absenRows.Scan(&userID, &tanggal, &tag, &masjidID, &masjidName)
+		if tag == jumatTag && jumatAsDzuhur {
+			tag = "dzuhur"
+		}
 
 		tanggalStr := tanggal.Format("2006-01-02")
 		if absensiMap[userID] == nil {
-			absensiMap[userID] = make(map[string]map[string]struct {
-				Status     string
-				MasjidID   int
-				MasjidName string
-			})
+			absensiMap[userID] = make(map[string]map[string]CollectionCell)
 		}
 		if absensiMap[userID][tanggalStr] == nil {
-			absensiMap[userID][tanggalStr] = make(map[string]struct {
-				Status     string
-				MasjidID   int
-				MasjidName string
-			})
+			absensiMap[userID][tanggalStr] = make(map[string]CollectionCell)
 		}
-		absensiMap[userID][tanggalStr][tag] = struct {
-			Status     string
-			MasjidID   int
-			MasjidName string
-		}{
+		absensiMap[userID][tanggalStr][tag] = CollectionCell{
 			Status:     "Y",
 			MasjidID:   masjidID,
 			MasjidName: masjidName,
 		}
 	}
 
-	var result []map[string]interface{}
-	for userID, fullname := range pesertaMap {
-		userAbsen := make(map[string]map[string]interface{})
-		totalY := 0
+	for userID, row := range pesertaMap {
+		row.Absen = make(map[string]map[string]CollectionCell)
 
-		for _, date := range dates {
-			userAbsen[date] = make(map[string]interface{})
-			for _, tag := range sholatTags {
+		for _, date := range grid.Dates {
+			row.Absen[date] = make(map[string]CollectionCell)
+			for _, tag := range grid.SholatTags {
 				if data, ok := absensiMap[userID][date][tag]; ok {
-					userAbsen[date][tag] = map[string]interface{}{
-						"status":      "Y",
-						"masjid_id":   data.MasjidID,
-						"masjid_name": data.MasjidName,
-					}
-					totalY++
+					row.Absen[date][tag] = data
+					row.Total++
 				} else {
-					userAbsen[date][tag] = map[string]interface{}{
-						"status": "N",
-					}
+					row.Absen[date][tag] = CollectionCell{Status: "N"}
 				}
 			}
 		}
 
-		result = append(result, map[string]interface{}{
-			"fullname": fullname,
-			"absen":    userAbsen,
-			"total":    totalY,
-		})
+		grid.Rows = append(grid.Rows, row)
 	}
 
-	sort.Slice(result, func(i, j int) bool {
-		return result[i]["total"].(int) > result[j]["total"].(int)
+	sort.Slice(grid.Rows, func(i, j int) bool {
+		if grid.Rows[i].Total != grid.Rows[j].Total {
+			return grid.Rows[i].Total > grid.Rows[j].Total
+		}
+		return grid.Rows[i].Fullname < grid.Rows[j].Fullname
 	})
 
+	return grid, nil
+}
+
+// Handler untuk peringkat anggota collection. Skor adalah rata-rata capaian
+// target (atau total kehadiran kalau collection belum punya target); default
+// rentangnya seluruh periode collection.
+func GetCollectionRanking(c *fiber.Ctx) error {
+	col, err := services.LoadCollectionBySlug(c.Params("slug"))
+	if err == services.ErrCollectionNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Collection not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	dateFromStr := c.Query("date_from", col.DateStart)
+	dateToStr := c.Query("date_to", col.DateEnd)
+	if !validDateRange(dateFromStr, dateToStr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date range. Use YYYY-MM-DD"})
+	}
+
+	grid, err := fetchCollectionGrid(col.Slug, dateFromStr, dateToStr)
+	if err != nil {
+		return reportError(c, err, "Failed to get absensi")
+	}
+	applyCollectionPrivacy(c, grid)
+	targets, err := applyCollectionTargets(grid)
+	if err != nil {
+		log.Println("Error evaluating collection targets:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to evaluate targets"})
+	}
+
+	ranking := make([]services.RankEntry, 0, len(grid.Rows))
+	for _, r := range grid.Rows {
+		entry := services.RankEntry{
+			UserID:   r.UserID,
+			Fullname: r.Fullname,
+			Score:    float64(r.Total),
+			Total:    r.Total,
+			Progress: r.Progress,
+		}
+		if r.Progress != nil {
+			entry.Score = r.Progress.Percent
+		}
+		for _, cells := range r.Absen {
+			for _, cell := range cells {
+				if cell.Status == "Y" {
+					entry.HariHadir++
+					break
+				}
+			}
+		}
+		ranking = append(ranking, entry)
+	}
+	services.RankEntries(ranking)
+
+	scoreBy := "total"
+	if len(targets) > 0 {
+		scoreBy = "progress"
+	}
 	return c.JSON(fiber.Map{
-		"sholat_tracked": sholatTags,
-		"dates":          dates,
-		"data":           result,
+		"message":   "Success",
+		"name":      col.Name,
+		"date_from": dateFromStr,
+		"date_to":   dateToStr,
+		"score_by":  scoreBy,
+		"data":      ranking,
 	})
 }
 
+// collectionDisplayName menerapkan mode privasi share token ke nama peserta;
+// request dengan JWT tetap melihat nama lengkap
+func collectionDisplayName(c *fiber.Ctx, fullname string, hidden bool) string {
+	share, ok := c.Locals("share_token").(*services.ShareToken)
+	if !ok {
+		return fullname
+	}
+	switch share.Privacy {
+	case services.SharePrivacyFull:
+		return fullname
+	case services.SharePrivacyInitials:
+		if !hidden {
+			return nameInitials(fullname)
+		}
+	}
+	return displayName(fullname, hidden)
+}
+
+// applyCollectionPrivacy mengganti nama setiap baris grid sesuai collectionDisplayName
+func applyCollectionPrivacy(c *fiber.Ctx, grid *CollectionGrid) {
+	for i := range grid.Rows {
+		grid.Rows[i].Fullname = collectionDisplayName(c, grid.Rows[i].Fullname, grid.Rows[i].HideName)
+	}
+}
+
+// nameInitials mengubah "Ahmad Fauzi" menjadi "A.F."
+func nameInitials(fullname string) string {
+	var b strings.Builder
+	for _, part := range strings.Fields(fullname) {
+		r := []rune(part)
+		b.WriteString(strings.ToUpper(string(r[0])) + ".")
+	}
+	return b.String()
+}
+
+// applyCollectionTargets mengisi Progress setiap baris grid dengan capaian target
+// collection; tanpa target Progress tetap nil
+func applyCollectionTargets(grid *CollectionGrid) ([]services.CollectionTarget, error) {
+	targets, err := services.LoadCollectionTargets(grid.ID)
+	if err != nil || len(targets) == 0 {
+		return targets, err
+	}
+	today := utils.Today(utils.DefaultLocation())
+	for i := range grid.Rows {
+		progress := services.EvaluateTargets(targets, grid.Dates, grid.SholatTags, collectionHadir(grid.Rows[i]), today)
+		grid.Rows[i].Progress = &progress
+	}
+	return targets, nil
+}
+
+// collectionHadir mengubah sel Y/N baris grid menjadi map tanggal -> tag -> hadir
+func collectionHadir(row CollectionGridRow) map[string]map[string]bool {
+	hadir := make(map[string]map[string]bool, len(row.Absen))
+	for date, cells := range row.Absen {
+		hadir[date] = make(map[string]bool, len(cells))
+		for tag, cell := range cells {
+			hadir[date][tag] = cell.Status == "Y"
+		}
+	}
+	return hadir
+}
+
+// collectionProgressSummary meringkas capaian target semua anggota grid
+func collectionProgressSummary(grid *CollectionGrid, targets []services.CollectionTarget) fiber.Map {
+	met, atRisk := 0, 0
+	var sum float64
+	for _, r := range grid.Rows {
+		if r.Progress == nil {
+			continue
+		}
+		if r.Progress.Met {
+			met++
+		}
+		if r.Progress.AtRisk {
+			atRisk++
+		}
+		sum += r.Progress.Percent
+	}
+	avg := 0.0
+	if len(grid.Rows) > 0 {
+		avg = math.Round(sum/float64(len(grid.Rows))*100) / 100
+	}
+	return fiber.Map{
+		"targets":     len(targets),
+		"members":     len(grid.Rows),
+		"met":         met,
+		"at_risk":     atRisk,
+		"avg_percent": avg,
+	}
+}
+
+// collectionDemographics menghitung kehadiran grid per sholat x gender x kelompok
+// umur. Satu peserta dihitung sekali per tanggal, umur dihitung pada tanggal itu.
+func collectionDemographics(grid *CollectionGrid) ([]services.DemographicCount, error) {
+	brackets, err := services.LoadAgeBrackets()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[services.DemographicCount]int)
+	for _, r := range grid.Rows {
+		gender := r.Gender
+		if gender == "" {
+			gender = services.GenderUnknown
+		}
+		for date, cells := range r.Absen {
+			at, _ := time.Parse("2006-01-02", date)
+			kategori := services.ClassifyAge(brackets, r.Dob, at)
+			for tag, cell := range cells {
+				if cell.Status == "Y" {
+					counts[services.DemographicCount{Tag: tag, Gender: gender, Kategori: kategori}]++
+				}
+			}
+		}
+	}
+
+	result := []services.DemographicCount{}
+	for key, n := range counts {
+		key.Jumlah = n
+		result = append(result, key)
+	}
+	services.SortDemographics(result)
+	return result, nil
+}
+
+// collectionGridTable merender grid menjadi satu kolom per (tanggal, sholat) dengan
+// sel Y/N; nama masjid tempat sholat dicatat sebagai catatan kaki
+func collectionGridTable(grid *CollectionGrid) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title:   grid.Name,
+		Headers: []string{"No", "Nama"},
+	}
+	if len(grid.Dates) > 0 {
+		table.Meta = []string{"Periode: " + grid.Dates[0] + " s/d " + grid.Dates[len(grid.Dates)-1]}
+	}
+	for _, date := range grid.Dates {
+		d, _ := time.Parse("2006-01-02", date)
+		for _, tag := range grid.SholatTags {
+			table.Headers = append(table.Headers, d.Format("02/01")+" "+strings.Title(tag))
+		}
+	}
+	table.Headers = append(table.Headers, "Total")
+
+	// Kalau semua kehadiran di satu masjid, cukup dicantumkan di keterangan
+	masjids := make(map[string]bool)
+	for _, r := range grid.Rows {
+		for _, cells := range r.Absen {
+			for _, cell := range cells {
+				if cell.Status == "Y" {
+					masjids[cell.MasjidName] = true
+				}
+			}
+		}
+	}
+	singleMasjid := len(masjids) <= 1
+	if singleMasjid {
+		for name := range masjids {
+			table.Meta = append(table.Meta, "Masjid: "+name)
+		}
+	}
+
+	totals := make([]int, len(grid.Dates)*len(grid.SholatTags))
+	sum := 0
+	for i, r := range grid.Rows {
+		row := []string{strconv.Itoa(i + 1), r.Fullname}
+		col := 0
+		for _, date := range grid.Dates {
+			for _, tag := range grid.SholatTags {
+				cell := r.Absen[date][tag]
+				value := cell.Status
+				if cell.Status == "Y" {
+					if !singleMasjid {
+						value += table.Footnote(cell.MasjidName)
+					}
+					totals[col]++
+				}
+				row = append(row, value)
+				col++
+			}
+		}
+		sum += r.Total
+		table.Rows = append(table.Rows, append(row, strconv.Itoa(r.Total)))
+	}
+
+	table.Totals = []string{"", "Total"}
+	for _, n := range totals {
+		table.Totals = append(table.Totals, strconv.Itoa(n))
+	}
+	table.Totals = append(table.Totals, strconv.Itoa(sum))
+	return table
+}
+
+// collectionsMetaListSpec: ringkasan tiap collection cukup berat, jadi default 20 per halaman.
+// ?masjid_id=, ?q= (nama), ?active=true (sedang berjalan), ?sort=created|name|date_start
+var collectionsMetaListSpec = utils.ListSpec{
+	Sorts:        map[string]string{"created": "create_time", "name": "name", "date_start": "date_start"},
+	DefaultSort:  "-created",
+	Filters:      map[string]utils.FilterKind{"masjid_id": utils.FilterInt, "q": utils.FilterString, "active": utils.FilterBool},
+	Cursor:       true,
+	DefaultLimit: 20,
+}
+
 func GetCollectionsMeta(c *fiber.Ctx) error {
+	q, err := utils.ParseListQuery(c, collectionsMetaListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
+	}
+
+	var conditions []string
+	var args []interface{}
+	// Selain admin hanya melihat collection miliknya sendiri
+	if !isAdminUser(c) {
+		conditions = append(conditions, "owner_user_id = ?")
+		args = append(args, jwtUserID(c))
+	}
+	if q.Has("masjid_id") {
+		conditions = append(conditions, "(masjid_id = 'all' OR FIND_IN_SET(?, REPLACE(masjid_id, ' ', '')) > 0)")
+		args = append(args, q.Int("masjid_id"))
+	}
+	if q.Has("q") {
+		conditions = append(conditions, "name LIKE ?")
+		args = append(args, "%"+q.String("q")+"%")
+	}
+	if q.Has("active") {
+		today := utils.Today(utils.DefaultLocation())
+		if q.Bool("active") {
+			conditions = append(conditions, "? BETWEEN DATE(date_start) AND DATE(date_end)")
+		} else {
+			conditions = append(conditions, "NOT (? BETWEEN DATE(date_start) AND DATE(date_end))")
+		}
+		args = append(args, today)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM collections"+where, args...).Scan(&total); err != nil {
+		log.Println("Error counting collections:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
+	}
+
+	if cond, condArgs := q.CursorSQL("id"); cond != "" {
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, condArgs...)
+	}
+	limitSQL, limitArgs := q.LimitSQL()
 	rows, err := database.DB.Query(`
-		SELECT id, name, slug, tracking_code, date_start, date_end, masjid_id
-		FROM collections ORDER BY create_time DESC
-	`)
+		SELECT id, name, slug, tracking_code, date_start, date_end, masjid_id, create_time
+		FROM collections`+where+q.OrderSQL("id")+limitSQL, append(args, limitArgs...)...)
 	if err != nil {
+		log.Println("Error fetching collections:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
 	}
 	defer rows.Close()
 
-	sholatMap := map[string]string{
-		"1": "subuh",
-		"2": "dzuhur",
-		"3": "ashar",
-		"4": "maghrib",
-		"5": "isya",
+	page := []collectionMeta{}
+	var lastSort interface{}
+	for rows.Next() {
+		var col collectionMeta
+		var createTime time.Time
+		if err := rows.Scan(&col.ID, &col.Name, &col.Slug, &col.TrackingCode, &col.DateStart, &col.DateEnd, &col.MasjidID, &createTime); err != nil {
+			log.Println("Error scanning collection:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
+		}
+		switch q.Sort {
+		case "created":
+			lastSort = createTime
+		case "name":
+			lastSort = col.Name
+		case "date_start":
+			lastSort = dateOnly(col.DateStart)
+		}
+		page = append(page, col)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error fetching collections:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
 	}
 
-	var collections []map[string]interface{}
+	collections, err := collectionsMetaSummaries(page)
+	if err != nil {
+		log.Println("Error summarizing collections:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
+	}
 
-	for rows.Next() {
-		var id int
-		var name, slug, trackingCode, dateStart, dateEnd, masjidID string
-		if err := rows.Scan(&id, &name, &slug, &trackingCode, &dateStart, &dateEnd, &masjidID); err != nil {
-			continue
-		}
+	var lastID int64
+	if len(page) > 0 {
+		lastID = page[len(page)-1].ID
+	}
+	q.NextAfter(len(page), lastSort, lastID)
+	response := q.Response(collections, total)
+	response["collections"] = collections
+	return c.JSON(response)
+}
 
-		// Get peserta IDs
-		pesertaRows, err := database.DB.Query(`SELECT id_peserta FROM collection_items WHERE collection_id = ?`, id)
-		if err != nil {
-			continue
+// collectionMeta adalah satu baris collections di daftar GetCollectionsMeta
+type collectionMeta struct {
+	ID           int64
+	Name         string
+	Slug         string
+	TrackingCode string
+	DateStart    string
+	DateEnd      string
+	MasjidID     string
+}
+
+// collectionsMetaSummaries menghitung ringkasan kehadiran per sholat dan capaian
+// target untuk satu halaman collection. Anggota, absensi dan target semua
+// collection diambil sekaligus, bukan per collection.
+func collectionsMetaSummaries(page []collectionMeta) ([]fiber.Map, error) {
+	collections := make([]fiber.Map, 0, len(page))
+	if len(page) == 0 {
+		return collections, nil
+	}
+	ids := make([]int64, len(page))
+	args := make([]interface{}, len(page))
+	for i, col := range page {
+		ids[i] = col.ID
+		args[i] = col.ID
+	}
+	inIDs := "?" + strings.Repeat(",?", len(ids)-1)
+
+	members := make(map[int64][]int)
+	memberRows, err := database.DB.Query(`
+		SELECT collection_id, id_peserta FROM collection_items
+		WHERE collection_id IN (`+inIDs+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer memberRows.Close()
+	for memberRows.Next() {
+		var collectionID int64
+		var pesertaID int
+		if err := memberRows.Scan(&collectionID, &pesertaID); err != nil {
+			return nil, err
 		}
+		members[collectionID] = append(members[collectionID], pesertaID)
+	}
+	if err := memberRows.Err(); err != nil {
+		return nil, err
+	}
 
-		var pesertaIDs []string
-		for pesertaRows.Next() {
-			var pid int
-			pesertaRows.Scan(&pid)
-			pesertaIDs = append(pesertaIDs, fmt.Sprintf("%d", pid))
+	// Satu baris per (collection, peserta, sholat, tanggal) di masjid dan
+	// rentang tanggal masing-masing collection
+	localTime := services.MasjidLocalTimeSQL("a.created_at", "p.id_masjid")
+	absenRows, err := database.DB.Query(`
+		SELECT DISTINCT c.id, a.user_id, a.tag, DATE_FORMAT(`+localTime+`, '%Y-%m-%d')
+		FROM collections c
+		JOIN collection_items ci ON ci.collection_id = c.id
+		JOIN absensi a ON a.user_id = ci.id_peserta
+		JOIN petugas p ON a.mesin_id = p.id_user
+		WHERE c.id IN (`+inIDs+`) AND a.voided_at IS NULL
+			AND (c.masjid_id = 'all' OR FIND_IN_SET(p.id_masjid, REPLACE(c.masjid_id, ' ', '')) > 0)
+			AND DATE(`+localTime+`) BETWEEN DATE(c.date_start) AND DATE(c.date_end)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer absenRows.Close()
+	// collection -> peserta -> tanggal -> tag
+	hadir := make(map[int64]map[int]map[string]map[string]bool)
+	for absenRows.Next() {
+		var collectionID int64
+		var userID int
+		var tag, tanggal string
+		if err := absenRows.Scan(&collectionID, &userID, &tag, &tanggal); err != nil {
+			return nil, err
 		}
-		pesertaRows.Close()
-		if len(pesertaIDs) == 0 {
-			continue
+		if hadir[collectionID] == nil {
+			hadir[collectionID] = make(map[int]map[string]map[string]bool)
+		}
+		if hadir[collectionID][userID] == nil {
+			hadir[collectionID][userID] = make(map[string]map[string]bool)
 		}
+		if hadir[collectionID][userID][tanggal] == nil {
+			hadir[collectionID][userID][tanggal] = make(map[string]bool)
+		}
+		hadir[collectionID][userID][tanggal][tag] = true
+	}
+	if err := absenRows.Err(); err != nil {
+		return nil, err
+	}
+
+	targets, err := services.LoadTargetsByCollection(ids)
+	if err != nil {
+		return nil, err
+	}
 
-		inPeserta := strings.Join(pesertaIDs, ",")
-		trackedSholat := strings.Split(trackingCode, ",")
+	today := utils.Today(utils.DefaultLocation())
+	for _, col := range page {
 		var sholatTags []string
-		for _, code := range trackedSholat {
-			if tag, ok := sholatMap[code]; ok {
+		for _, code := range strings.Split(col.TrackingCode, ",") {
+			if tag, ok := collectionSholatMap[code]; ok {
 				sholatTags = append(sholatTags, tag)
 			}
 		}
-		inTags := "'" + strings.Join(sholatTags, "','") + "'"
-
-		// Build absensi query
-		var absenQuery string
-		if masjidID == "all" {
-			// absenQuery = fmt.Sprintf(`
-			// 	SELECT a.tag, COUNT(*) as total
-			// 	FROM absensi a
-			// 	JOIN petugas p ON a.mesin_id = p.id_user
-			// 	WHERE a.user_id IN (%s) AND a.tag IN (%s)
-			// 	AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
-			// 	GROUP BY a.tag
-			// `, inPeserta, inTags, dateStart, dateEnd)
-			absenQuery = fmt.Sprintf(`
-				SELECT tag, COUNT(*) as total FROM (
-					SELECT DISTINCT a.user_id, a.tag, DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) as tanggal
-					FROM absensi a
-					JOIN petugas p ON a.mesin_id = p.id_user
-					WHERE a.user_id IN (%s)
-					AND a.tag IN (%s)
-					AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
-				) as unique_daily_absen
-				GROUP BY tag
-			`, inPeserta, inTags, dateStart, dateEnd)
+		// Sama dengan fetchCollectionGrid: kalau hanya dzuhur yang dilacak, jumat dihitung dzuhur
+		jumatAsDzuhur := slices.Contains(sholatTags, "dzuhur") && !slices.Contains(sholatTags, jumatTag)
 
-		} else {
-			masjidIDs := strings.Split(masjidID, ",")
-			for i := range masjidIDs {
-				masjidIDs[i] = strings.TrimSpace(masjidIDs[i])
+		summaries := make(map[string]int)
+		tracked := make(map[int]map[string]map[string]bool)
+		for userID, days := range hadir[col.ID] {
+			tracked[userID] = make(map[string]map[string]bool)
+			for tanggal, tags := range days {
+				tracked[userID][tanggal] = make(map[string]bool)
+				for tag := range tags {
+					if slices.Contains(sholatTags, tag) {
+						summaries[tag]++
+						tracked[userID][tanggal][tag] = true
+					} else if tag == jumatTag && jumatAsDzuhur {
+						tracked[userID][tanggal]["dzuhur"] = true
+					}
+				}
 			}
-			inMasjid := strings.Join(masjidIDs, ",")
-			// absenQuery = fmt.Sprintf(`
-			// 	SELECT a.tag, COUNT(*) as total
-			// 	FROM absensi a
-			// 	JOIN petugas p ON a.mesin_id = p.id_user
-			// 	WHERE p.id_masjid IN (%s)
-			// 	AND a.user_id IN (%s)
-			// 	AND a.tag IN (%s)
-			// 	AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
-			// 	GROUP BY a.tag
-			// `, inMasjid, inPeserta, inTags, dateStart, dateEnd)
-			absenQuery = fmt.Sprintf(`
-				SELECT tag, COUNT(*) as total FROM (
-					SELECT DISTINCT a.user_id, a.tag, DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) as tanggal
-					FROM absensi a
-					JOIN petugas p ON a.mesin_id = p.id_user
-					WHERE p.id_masjid IN (%s)
-					AND a.user_id IN (%s)
-					AND a.tag IN (%s)
-					AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) BETWEEN '%s' AND '%s'
-				) as unique_daily_absen
-				GROUP BY tag
-			`, inMasjid, inPeserta, inTags, dateStart, dateEnd)
-
-		}
-
-		// Execute absensi summary query
-		summaryRows, err := database.DB.Query(absenQuery)
-		if err != nil {
-			continue
 		}
 
-		summaries := make(map[string]int)
-		for summaryRows.Next() {
-			var tag string
-			var total int
-			summaryRows.Scan(&tag, &total)
-			summaries[tag] = total
-		}
-		summaryRows.Close()
-
-		collections = append(collections, fiber.Map{
-			"id":         id,
-			"name":       name,
-			"slug":       slug,
-			"start_date": dateStart,
-			"end_date":   dateEnd,
+		meta := fiber.Map{
+			"id":         col.ID,
+			"name":       col.Name,
+			"slug":       col.Slug,
+			"start_date": col.DateStart,
+			"end_date":   col.DateEnd,
+			"members":    len(members[col.ID]),
 			"summaries":  summaries,
-		})
+		}
+
+		// Capaian target dihitung untuk seluruh periode collection
+		dateStart, errStart := time.Parse("2006-01-02", dateOnly(col.DateStart))
+		dateEnd, errEnd := time.Parse("2006-01-02", dateOnly(col.DateEnd))
+		if colTargets := targets[col.ID]; len(colTargets) > 0 && len(members[col.ID]) > 0 && errStart == nil && errEnd == nil {
+			var dates []string
+			for d := dateStart; !d.After(dateEnd); d = d.AddDate(0, 0, 1) {
+				dates = append(dates, d.Format("2006-01-02"))
+			}
+			grid := &CollectionGrid{ID: col.ID, SholatTags: sholatTags, Dates: dates}
+			for _, userID := range members[col.ID] {
+				progress := services.EvaluateTargets(colTargets, dates, sholatTags, tracked[userID], today)
+				grid.Rows = append(grid.Rows, CollectionGridRow{UserID: userID, Progress: &progress})
+			}
+			meta["progress"] = collectionProgressSummary(grid, colTargets)
+		}
+
+		collections = append(collections, meta)
 	}
+	return collections, nil
+}
 
-	return c.JSON(fiber.Map{
-		"collections": collections,
-	})
+// dateOnly memotong DATETIME dari database menjadi YYYY-MM-DD
+func dateOnly(value string) string {
+	if len(value) >= 10 {
+		return value[:10]
+	}
+	return value
 }
 
 func GetCollectionsMetaDetail(c *fiber.Ctx) error {
@@ -732,6 +1198,14 @@ func GetCollectionsMetaDetail(c *fiber.Ctx) error {
 	})
 }
 
+// pesertaMasjidListSpec: ?event_id= (default 3), ?masjid_id=, ?q= (nama atau QR), ?sort=id|fullname
+var pesertaMasjidListSpec = utils.ListSpec{
+	Sorts:       map[string]string{"id": "p.id", "fullname": "p.fullname"},
+	DefaultSort: "id",
+	Filters:     map[string]utils.FilterKind{"event_id": utils.FilterInt, "masjid_id": utils.FilterInt, "q": utils.FilterString},
+	Cursor:      true,
+}
+
 func GetPesertaDanMasjid(c *fiber.Ctx) error {
 	type Peserta struct {
 		ID       int64  `json:"id"`
@@ -744,13 +1218,39 @@ func GetPesertaDanMasjid(c *fiber.Ctx) error {
 		Nama string `json:"nama"`
 	}
 
-	var pesertaList []Peserta
-	rows, err := database.DB.Query(`
-		SELECT p.id, p.qr_code, p.fullname
+	q, err := utils.ParseListQuery(c, pesertaMasjidListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
+	}
+	eventID := 3
+	if q.Has("event_id") {
+		eventID = q.Int("event_id")
+	}
+	where := " WHERE dp.id_event = ? AND (? = 0 OR dp.masjid_id = ?)"
+	args := []interface{}{eventID, q.Int("masjid_id"), q.Int("masjid_id")}
+	if q.Has("q") {
+		where += " AND (p.fullname LIKE ? OR p.qr_code = ?)"
+		args = append(args, "%"+q.String("q")+"%", q.String("q"))
+	}
+	from := `
 		FROM detail_peserta dp
-		JOIN peserta p ON dp.id_peserta = p.id
-		WHERE dp.id_event = 3
-	`)
+		JOIN peserta p ON dp.id_peserta = p.id`
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Gagal mengambil data peserta",
+		})
+	}
+	if cond, condArgs := q.CursorSQL("p.id"); cond != "" {
+		where += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	limitSQL, limitArgs := q.LimitSQL()
+
+	pesertaList := []Peserta{}
+	rows, err := database.DB.Query("SELECT p.id, p.qr_code, p.fullname"+from+where+q.OrderSQL("p.id")+limitSQL,
+		append(args, limitArgs...)...)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Gagal mengambil data peserta",
@@ -787,10 +1287,18 @@ func GetPesertaDanMasjid(c *fiber.Ctx) error {
 		masjidList = append(masjidList, m)
 	}
 
-	return c.JSON(fiber.Map{
-		"peserta": pesertaList,
-		"masjid":  masjidList,
-	})
+	if n := len(pesertaList); n > 0 {
+		last := pesertaList[n-1]
+		var sortValue interface{}
+		if q.Sort == "fullname" {
+			sortValue = last.Fullname
+		}
+		q.NextAfter(n, sortValue, last.ID)
+	}
+	response := q.Response(pesertaList, total)
+	response["peserta"] = pesertaList
+	response["masjid"] = masjidList
+	return c.JSON(response)
 }
 
 type AddPesertaToCollectionRequest struct {
@@ -806,9 +1314,21 @@ func AddPesertaToCollection(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Permintaan tidak valid"})
 	}
 
+	// Hanya pemilik koleksi (atau admin untuk koleksi lama tanpa pemilik) yang
+	// boleh menambah peserta; dicek sebelum apa pun supaya isi koleksi tidak bocor
+	col, err := services.LoadCollection(req.CollectionID)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{
+			"error": "Koleksi tidak ditemukan",
+		})
+	}
+	if err := services.CheckCollectionOwner(col, jwtUserID(c), isAdminUser(c)); err != nil {
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Koleksi ini milik user lain"})
+	}
+
 	// 1. Validasi apakah peserta dengan QR tersebut ada
 	var pesertaID int64
-	err := database.DB.QueryRow(`
+	err = database.DB.QueryRow(`
 		SELECT id FROM peserta WHERE qr_code = ?`, req.QrPeserta).Scan(&pesertaID)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{
@@ -834,19 +1354,17 @@ func AddPesertaToCollection(c *fiber.Ctx) error {
 		})
 	}
 
-	// 3. Ambil slug koleksi
-	var slug string
-	err = database.DB.QueryRow(`
-		SELECT slug FROM collections WHERE id = ?`, req.CollectionID).Scan(&slug)
+	slug := col.Slug
+
+	// 3. Insert ke collection_items
+	tx, err := database.DB.Begin()
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{
-			"error": "Koleksi tidak ditemukan",
-		})
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
 	}
+	defer tx.Rollback()
 
-	// 4. Insert ke collection_items
 	now := time.Now()
-	_, err = database.DB.Exec(`
+	_, err = tx.Exec(`
 		INSERT INTO collection_items (create_time, collection_id, collection_slug, id_peserta)
 		VALUES (?, ?, ?, ?)`, now, req.CollectionID, slug, pesertaID)
 	if err != nil {
@@ -855,33 +1373,43 @@ func AddPesertaToCollection(c *fiber.Ctx) error {
 		})
 	}
 
+	err = services.EmitEvent(tx, services.EventCollectionMemberAdd, fiber.Map{
+		"collection_id":   req.CollectionID,
+		"collection_slug": slug,
+		"peserta_id":      pesertaID,
+	})
+	if err != nil {
+		log.Println("Error writing webhook outbox:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal menambahkan peserta"})
+	}
+
+	recordAudit(c, tx, "collection.add_peserta", "collection", req.CollectionID, nil, fiber.Map{
+		"id_peserta": pesertaID,
+		"qr_code":    req.QrPeserta,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Gagal menambahkan peserta"})
+	}
+
 	return c.Status(http.StatusCreated).JSON(fiber.Map{
 		"message": "✅ Peserta berhasil ditambahkan ke koleksi",
 	})
 }
 
+// Handler untuk daftar kategori collection. ?masjid_id= membatasi ke kategori
+// global dan kategori masjid itu, ?tree=true mengembalikan bentuk pohon.
 func GetKategoriCollection(c *fiber.Ctx) error {
-	rows, err := database.DB.Query(`SELECT id, category_name FROM category_collection ORDER BY category_name ASC`)
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id"))
+	categories, err := services.LoadCategories(masjidID)
 	if err != nil {
+		log.Println("Error fetching categories:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Gagal mengambil data kategori",
 		})
 	}
-	defer rows.Close()
-
-	var categories []fiber.Map
-	for rows.Next() {
-		var id int
-		var name string
-		if err := rows.Scan(&id, &name); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Gagal membaca data kategori",
-			})
-		}
-		categories = append(categories, fiber.Map{
-			"id":   id,
-			"name": name,
-		})
+	if c.QueryBool("tree") {
+		categories = services.CategoryTree(categories)
 	}
 
 	return c.JSON(fiber.Map{
@@ -889,112 +1417,45 @@ func GetKategoriCollection(c *fiber.Ctx) error {
 	})
 }
 
-func GetCollectionsByCategory(c *fiber.Ctx) error {
-	idCategory := c.Query("id_category")
-	idMasjid := c.Query("id_masjid") // optional
+// collectionCategoryListSpec: ?id_category= wajib, ?id_masjid=, ?sort=date_start|name|id
+var collectionCategoryListSpec = utils.ListSpec{
+	Sorts:       map[string]string{"id": "c.id", "name": "c.name", "date_start": "c.date_start"},
+	DefaultSort: "-date_start",
+	Filters:     map[string]utils.FilterKind{"id_category": utils.FilterInt, "id_masjid": utils.FilterInt},
+	Cursor:      true,
+}
 
-	if idCategory == "" {
+// Handler untuk collection dalam satu kategori beserta sub kategorinya.
+// ?id_masjid= hanya mengambil collection yang mencakup masjid tersebut.
+func GetCollectionsByCategory(c *fiber.Ctx) error {
+	q, err := utils.ParseListQuery(c, collectionCategoryListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
+	}
+	if !q.Has("id_category") {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
 			"error": "Parameter id_category wajib diisi",
 		})
 	}
 
-	// Ambil collection_id yang terhubung dengan category_id
-	rows, err := database.DB.Query(`
-		SELECT dc.collection_id 
-		FROM detail_category_collection dc
-		WHERE dc.category_id = ?`, idCategory)
+	categories, err := services.LoadCategories(0)
 	if err != nil {
+		log.Println("Error fetching categories:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Gagal mengambil data detail category collection",
-		})
-	}
-	defer rows.Close()
-
-	var collectionIDs []int
-	for rows.Next() {
-		var cid int
-		if err := rows.Scan(&cid); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Gagal membaca data collection_id",
-			})
-		}
-		collectionIDs = append(collectionIDs, cid)
-	}
-
-	if len(collectionIDs) == 0 {
-		return c.JSON(fiber.Map{
-			"collections": []fiber.Map{},
+			"error": "Gagal mengambil data kategori",
 		})
 	}
+	categoryIDs := services.CategoryDescendants(categories, q.Int("id_category"))
 
-	// Build IN clause
-	var inClause string
-	for i, id := range collectionIDs {
-		if i > 0 {
-			inClause += ","
-		}
-		inClause += fmt.Sprintf("%d", id)
-	}
-
-	// Query collections
-	var query string
-	if idMasjid != "" {
-		query = fmt.Sprintf(`
-			SELECT id, name, slug, masjid_id 
-			FROM collections 
-			WHERE id IN (%s)
-		`, inClause)
-	} else {
-		query = fmt.Sprintf(`
-			SELECT id, name, slug, masjid_id 
-			FROM collections 
-			WHERE id IN (%s)
-		`, inClause)
-	}
-
-	cRows, err := database.DB.Query(query)
+	collections, total, err := services.CollectionsByCategory(categoryIDs, q.Int("id_masjid"), q)
 	if err != nil {
+		log.Println("Error fetching collections by category:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Gagal mengambil data collections",
 		})
 	}
-	defer cRows.Close()
-
-	var collections []fiber.Map
-	for cRows.Next() {
-		var id int
-		var name, slug, masjidID string
-		if err := cRows.Scan(&id, &name, &slug, &masjidID); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Gagal membaca data collections",
-			})
-		}
-
-		// Jika ada idMasjid, filter masjid_id
-		include := true
-		if idMasjid != "" && masjidID != "all" {
-			ids := strings.Split(masjidID, ",")
-			include = false
-			for _, mID := range ids {
-				if strings.TrimSpace(mID) == idMasjid {
-					include = true
-					break
-				}
-			}
-		}
-
-		if include {
-			collections = append(collections, fiber.Map{
-				"id":     id,
-				"name":   name,
-				"slug":   slug,
-				"masjid": masjidID,
-			})
-		}
-	}
 
-	return c.JSON(fiber.Map{
-		"collections": collections,
-	})
+	response := q.Response(collections, total)
+	response["collections"] = collections
+	return c.JSON(response)
 }
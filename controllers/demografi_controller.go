@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type UpdateAgeBracketsRequest struct {
+	Brackets []services.AgeBracket `json:"brackets" validate:"required,min=1,dive"`
+	DateFrom string                `json:"date_from"`
+	DateTo   string                `json:"date_to"`
+}
+
+// Handler untuk melihat kelompok umur yang dipakai di breakdown demografi
+func GetAgeBrackets(c *fiber.Ctx) error {
+	brackets, err := services.LoadAgeBrackets()
+	if err != nil {
+		log.Println("Error fetching age brackets:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch age brackets"})
+	}
+	return c.JSON(fiber.Map{"message": "Success", "data": brackets})
+}
+
+// Handler untuk mengganti seluruh kelompok umur. Kalau date_from/date_to diisi,
+// counter harian di rentang itu dibangun ulang dengan kelompok yang baru.
+func UpdateAgeBrackets(c *fiber.Ctx) error {
+	var req UpdateAgeBracketsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	if err := services.ValidateAgeBrackets(req.Brackets); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if (req.DateFrom != "" || req.DateTo != "") && !validDateRange(req.DateFrom, req.DateTo) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date range. Use YYYY-MM-DD"})
+	}
+
+	before, err := services.LoadAgeBrackets()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch age brackets"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.ReplaceAgeBrackets(tx, req.Brackets); err != nil {
+		log.Println("Error saving age brackets:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save age brackets"})
+	}
+
+	recordAudit(c, tx, "age_brackets.update", "age_brackets", 0, fiber.Map{"brackets": before}, fiber.Map{"brackets": req.Brackets})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save age brackets"})
+	}
+
+	response := fiber.Map{"message": "Age brackets updated successfully"}
+	if req.DateFrom != "" && req.DateTo != "" {
+		rows, err := services.RebuildDailyCounters(req.DateFrom, req.DateTo)
+		if err != nil {
+			log.Println("Error rebuilding daily counters:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Brackets saved but failed to rebuild counters"})
+		}
+		response["rebuilt"] = rows
+	}
+
+	return c.JSON(response)
+}
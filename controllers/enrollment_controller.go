@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type EnrollRequest struct {
+	EventID  int    `json:"event_id" validate:"required,min=1"`
+	MasjidID int    `json:"masjid_id" validate:"required,min=1"`
+	Reason   string `json:"reason" validate:"max=255"`
+	// Jawaban field tambahan formulir event tujuan
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+type CancelEnrollmentRequest struct {
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+type TransferEnrollmentRequest struct {
+	MasjidID int    `json:"masjid_id" validate:"required,min=1"`
+	Reason   string `json:"reason" validate:"max=255"`
+}
+
+// Handler untuk daftar pendaftaran event peserta beserta riwayatnya
+func GetPesertaEnrollments(c *fiber.Ctx) error {
+	pesertaID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid peserta id"})
+	}
+	eventID, _ := strconv.Atoi(c.Query("event_id"))
+
+	enrollments, err := services.LoadEnrollments(pesertaID)
+	if err != nil {
+		log.Println("Error fetching enrollments:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch enrollments"})
+	}
+	history, err := services.LoadEnrollmentHistory(pesertaID, eventID)
+	if err != nil {
+		log.Println("Error fetching enrollment history:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch enrollments"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    enrollments,
+		"history": history,
+	})
+}
+
+// Handler untuk mendaftarkan peserta yang sudah ada ke event lain (atau daftar
+// ulang setelah batal). Kalau kuota penuh peserta masuk antrian tunggu.
+func EnrollPeserta(c *fiber.Ctx) error {
+	pesertaID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid peserta id"})
+	}
+	var req EnrollRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	customFields, ok := checkCustomFields(c, req.EventID, req.CustomFields, utils.Validate.Struct(req))
+	if !ok {
+		return nil
+	}
+
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM peserta WHERE id = ?)", pesertaID).Scan(&exists); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if !exists {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Peserta not found"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	status, err := services.Enroll(tx, pesertaID, req.EventID, req.MasjidID, jwtUserID(c), req.Reason, customFields)
+	if err != nil {
+		return enrollmentError(c, err)
+	}
+
+	err = services.EmitEvent(tx, services.EventPesertaRegistered, fiber.Map{
+		"peserta_id": pesertaID,
+		"masjid_id":  req.MasjidID,
+		"event_id":   req.EventID,
+		"waitlist":   status == services.EnrollmentWaitlist,
+	})
+	if err != nil {
+		log.Println("Error writing webhook outbox:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enroll peserta"})
+	}
+
+	recordAudit(c, tx, "enrollment.enroll", "peserta", pesertaID, nil, fiber.Map{
+		"event_id":  req.EventID,
+		"masjid_id": req.MasjidID,
+		"status":    status,
+		"reason":    req.Reason,
+		"custom":    customFields,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to enroll peserta"})
+	}
+	forgetEnrollments(req.EventID, []int{pesertaID})
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Peserta enrolled successfully",
+		"status":  services.EnrollmentStatusNames[status],
+	})
+}
+
+// Handler untuk membatalkan pendaftaran peserta di satu event; kursinya langsung
+// diberikan ke antrian tunggu terlama
+func CancelPesertaEnrollment(c *fiber.Ctx) error {
+	pesertaID, eventID, ok := enrollmentParams(c)
+	if !ok {
+		return nil
+	}
+	var req CancelEnrollmentRequest
+	if len(c.Body()) > 0 && !parseEnrollmentBody(c, &req) {
+		return nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	masjidID, promoted, err := services.CancelEnrollment(tx, pesertaID, eventID, jwtUserID(c), req.Reason)
+	if err != nil {
+		return enrollmentError(c, err)
+	}
+
+	recordAudit(c, tx, "enrollment.cancel", "peserta", pesertaID, nil, fiber.Map{
+		"event_id":  eventID,
+		"masjid_id": masjidID,
+		"reason":    req.Reason,
+		"promoted":  promoted,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to cancel enrollment"})
+	}
+	forgetEnrollments(eventID, append(promoted, pesertaID))
+
+	return c.JSON(fiber.Map{
+		"message":  "Enrollment cancelled successfully",
+		"promoted": promoted,
+	})
+}
+
+// Handler untuk memindahkan pendaftaran peserta ke masjid lain di event yang sama
+func TransferPesertaEnrollment(c *fiber.Ctx) error {
+	pesertaID, eventID, ok := enrollmentParams(c)
+	if !ok {
+		return nil
+	}
+	var req TransferEnrollmentRequest
+	if !parseEnrollmentBody(c, &req) {
+		return nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	status, fromMasjidID, promoted, err := services.TransferEnrollment(tx, pesertaID, eventID, req.MasjidID, jwtUserID(c), req.Reason)
+	if err != nil {
+		return enrollmentError(c, err)
+	}
+
+	recordAudit(c, tx, "enrollment.transfer", "peserta", pesertaID,
+		fiber.Map{"event_id": eventID, "masjid_id": fromMasjidID},
+		fiber.Map{"event_id": eventID, "masjid_id": req.MasjidID, "status": status, "reason": req.Reason, "promoted": promoted})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to transfer enrollment"})
+	}
+	forgetEnrollments(eventID, append(promoted, pesertaID))
+
+	return c.JSON(fiber.Map{
+		"message":  "Enrollment transferred successfully",
+		"status":   services.EnrollmentStatusNames[status],
+		"promoted": promoted,
+	})
+}
+
+func enrollmentParams(c *fiber.Ctx) (int, int, bool) {
+	pesertaID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid peserta id"})
+		return 0, 0, false
+	}
+	eventID, err := strconv.Atoi(c.Params("id_event"))
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event id"})
+		return 0, 0, false
+	}
+	return pesertaID, eventID, true
+}
+
+// parseEnrollmentBody membaca dan memvalidasi body; kalau tidak valid response
+// 400 sudah ditulis dan hasilnya false
+func parseEnrollmentBody(c *fiber.Ctx, req interface{}) bool {
+	if err := c.BodyParser(req); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		return false
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return false
+	}
+	return true
+}
+
+// enrollmentError menerjemahkan error pendaftaran ke status code
+func enrollmentError(c *fiber.Ctx, err error) error {
+	switch err {
+	case services.ErrEnrollmentNotFound:
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Peserta is not registered for this event"})
+	case services.ErrAlreadyEnrolled:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Peserta is already enrolled in this event"})
+	case services.ErrSameMasjid:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Enrollment is already in this masjid"})
+	case services.ErrCapacityFull:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Kuota masjid ini sudah penuh"})
+	}
+	log.Println("Error updating enrollment:", err)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update enrollment"})
+}
+
+// forgetEnrollments membuang cache cek pendaftaran di SaveAbsenQR supaya
+// perubahan status langsung berlaku saat scan
+func forgetEnrollments(eventID int, pesertaIDs []int) {
+	for _, id := range pesertaIDs {
+		localCache.Delete(fmt.Sprintf("event:%d:%d", id, eventID))
+	}
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type UpdateFormFieldsRequest struct {
+	Fields []services.FormField `json:"fields" validate:"dive"`
+}
+
+// Registration adalah satu pendaftaran event beserta jawaban formulirnya
+type Registration struct {
+	PesertaID    int                    `json:"peserta_id"`
+	FullName     string                 `json:"fullname"`
+	Contact      string                 `json:"contact"`
+	Gender       string                 `json:"gender"`
+	MasjidID     int                    `json:"masjid_id"`
+	MasjidNama   string                 `json:"masjid_nama"`
+	Status       int                    `json:"status"`
+	StatusLabel  string                 `json:"status_label"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+// Handler untuk definisi field tambahan formulir pendaftaran event
+func GetEventFormFields(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Params("id_event"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event id"})
+	}
+	fields, err := services.LoadFormFields(eventID)
+	if err != nil {
+		log.Println("Error fetching form fields:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch form fields"})
+	}
+	return c.JSON(fiber.Map{"message": "Success", "data": fields})
+}
+
+// Handler untuk mengganti seluruh field tambahan formulir event. fields kosong
+// berarti event kembali memakai formulir standar.
+func UpdateEventFormFields(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Params("id_event"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event id"})
+	}
+	var req UpdateFormFieldsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	if err := services.ValidateFormFields(req.Fields); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	before, err := services.LoadFormFields(eventID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch form fields"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if err := services.ReplaceFormFields(tx, eventID, req.Fields); err != nil {
+		log.Println("Error saving form fields:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save form fields"})
+	}
+
+	recordAudit(c, tx, "form_fields.update", "event", eventID, fiber.Map{"fields": before}, fiber.Map{"fields": req.Fields})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save form fields"})
+	}
+
+	fields, _ := services.LoadFormFields(eventID)
+	return c.JSON(fiber.Map{"message": "Form fields updated successfully", "data": fields})
+}
+
+// Handler untuk daftar pendaftar event beserta jawaban formulirnya. Filter:
+// ?masjid_id=, ?status= (default 1), ?custom_field=&custom_value=; ?format= untuk export.
+func GetEventRegistrations(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Params("id_event"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event id"})
+	}
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id"))
+	status, err := strconv.Atoi(c.Query("status", strconv.Itoa(services.EnrollmentActive)))
+	if err != nil || services.EnrollmentStatusNames[status] == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid status"})
+	}
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
+
+	fields, err := services.LoadFormFields(eventID)
+	if err != nil {
+		log.Println("Error fetching form fields:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch registrations"})
+	}
+	filter, filterArgs, ok := customFieldFilter(c, fields, "dp")
+	if !ok {
+		return nil
+	}
+
+	query := `
+		SELECT p.id, p.fullname, COALESCE(p.contact, ''), COALESCE(p.gender, ''), COALESCE(dp.masjid_id, 0),
+			COALESCE(m.nama, ''), dp.status, dp.custom_fields
+		FROM detail_peserta dp
+		JOIN peserta p ON dp.id_peserta = p.id
+		LEFT JOIN masjid m ON dp.masjid_id = m.id
+		WHERE dp.id_event = ? AND dp.status = ?
+			AND (? = 0 OR dp.masjid_id = ?)` + filter + `
+		ORDER BY m.nama, p.fullname`
+	args := append([]interface{}{eventID, status, masjidID, masjidID}, filterArgs...)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching registrations:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch registrations"})
+	}
+	defer rows.Close()
+
+	registrations := []Registration{}
+	for rows.Next() {
+		var r Registration
+		var custom sql.NullString
+		if err := rows.Scan(&r.PesertaID, &r.FullName, &r.Contact, &r.Gender, &r.MasjidID, &r.MasjidNama, &r.Status, &custom); err != nil {
+			log.Println("Error scanning registration:", err)
+			continue
+		}
+		r.StatusLabel = services.EnrollmentStatusNames[r.Status]
+		r.CustomFields = map[string]interface{}{}
+		if custom.Valid {
+			if err := json.Unmarshal([]byte(custom.String), &r.CustomFields); err != nil {
+				log.Println("Error decoding custom fields:", err)
+			}
+		}
+		registrations = append(registrations, r)
+	}
+
+	if format != "" {
+		return utils.SendExport(c, format, fmt.Sprintf("pendaftar-event-%d", eventID), registrationsTable(eventID, fields, registrations))
+	}
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"fields":  fields,
+		"data":    registrations,
+	})
+}
+
+func registrationsTable(eventID int, fields []services.FormField, registrations []Registration) *utils.ExportTable {
+	headers := []string{"No", "Nama", "Kontak", "Gender", "Masjid", "Status"}
+	for _, f := range fields {
+		headers = append(headers, f.Label)
+	}
+	table := &utils.ExportTable{
+		Title:   "Pendaftar Event",
+		Meta:    []string{fmt.Sprintf("Event: %d", eventID), fmt.Sprintf("Jumlah: %d", len(registrations))},
+		Headers: headers,
+	}
+	for i, r := range registrations {
+		row := []string{strconv.Itoa(i + 1), r.FullName, r.Contact, r.Gender, r.MasjidNama, r.StatusLabel}
+		for _, f := range fields {
+			row = append(row, services.FormatCustomField(r.CustomFields[f.Key]))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// customFieldFilter membaca ?custom_field=&custom_value= dan mengembalikan
+// kondisi tambahan (diawali AND) untuk alias detail_peserta dpAlias. Kalau
+// filternya tidak valid response 400 sudah ditulis dan hasilnya false.
+func customFieldFilter(c *fiber.Ctx, fields []services.FormField, dpAlias string) (string, []interface{}, bool) {
+	key := c.Query("custom_field")
+	if key == "" {
+		return "", nil, true
+	}
+	for _, f := range fields {
+		if f.Key == key {
+			cond, args := services.CustomFieldFilterSQL(dpAlias, f, c.Query("custom_value"))
+			return " AND " + cond, args, true
+		}
+	}
+	c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown custom_field"})
+	return "", nil, false
+}
+
+// checkCustomFields memvalidasi jawaban formulir event bersama hasil validasi
+// struct (validationErr boleh nil) supaya semua error dikirim sekaligus. Kalau
+// ada yang tidak valid response 400 sudah ditulis dan hasilnya false.
+func checkCustomFields(c *fiber.Ctx, eventID int, values map[string]interface{}, validationErr error) (map[string]interface{}, bool) {
+	errors := map[string]string{}
+	if validationErr != nil {
+		errors = utils.FormatValidationErrors(validationErr)
+	}
+
+	fields, err := services.LoadFormFields(eventID)
+	if err != nil {
+		log.Println("Error fetching form fields:", err)
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		return nil, false
+	}
+	clean, fieldErrors := services.CheckCustomFields(fields, values)
+	for k, v := range fieldErrors {
+		errors[k] = v
+	}
+
+	if len(errors) > 0 {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return nil, false
+	}
+	return clean, true
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type UpdateGuardianRequest struct {
+	PesertaID int `json:"peserta_id" validate:"required,min=1"`
+}
+
+// MemberAbsensi adalah satu scan anggota keluarga dalam waktu lokal masjid
+type MemberAbsensi struct {
+	ID         int64  `json:"id"`
+	EventID    int    `json:"event_id"`
+	Tanggal    string `json:"tanggal"`
+	Jam        string `json:"jam"`
+	Tag        string `json:"tag"`
+	MasjidNama string `json:"masjid_nama"`
+}
+
+// Handler untuk wali melihat anggota keluarga dan ringkasan kehadirannya.
+// :qr_code adalah QR wali utama; ?event_id=, ?start_date=&end_date= (default 30 hari terakhir).
+func GetHousehold(c *fiber.Ctx) error {
+	household, ok := guardianHousehold(c)
+	if !ok {
+		return nil
+	}
+	eventID, _ := strconv.Atoi(c.Query("event_id"))
+	startDate, endDate, ok := householdDateRange(c, household)
+	if !ok {
+		return nil
+	}
+
+	members, err := services.HouseholdAttendance(household, eventID, startDate, endDate)
+	if err != nil {
+		log.Println("Error fetching household attendance:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch household"})
+	}
+	// Route ini cukup memakai QR wali, jadi tanggal lahir dan QR Code anggota
+	// (yang bisa dipakai untuk absen atas nama mereka) tidak ikut dikirim
+	for i := range members {
+		members[i].Dob = ""
+		members[i].QRCode = ""
+	}
+
+	return c.JSON(fiber.Map{
+		"message":      "Success",
+		"household_id": household.ID,
+		"guardian_id":  household.GuardianID,
+		"start_date":   startDate,
+		"end_date":     endDate,
+		"data":         members,
+	})
+}
+
+// Handler untuk wali melihat daftar absensi satu anggota keluarga
+func GetHouseholdMemberAbsensi(c *fiber.Ctx) error {
+	household, ok := guardianHousehold(c)
+	if !ok {
+		return nil
+	}
+	memberID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid peserta id"})
+	}
+	var member *services.HouseholdMember
+	for i := range household.Members {
+		if household.Members[i].PesertaID == memberID {
+			member = &household.Members[i]
+		}
+	}
+	if member == nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Peserta is not a member of this household"})
+	}
+	eventID, _ := strconv.Atoi(c.Query("event_id"))
+	startDate, endDate, ok := householdDateRange(c, household)
+	if !ok {
+		return nil
+	}
+
+	rangeStart, rangeEnd, _ := utils.AnyZoneDayRange(startDate, endDate)
+	localTime := services.AbsensiLocalTimeSQL("a")
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.event_id, DATE_FORMAT(`+localTime+`, '%Y-%m-%d'), DATE_FORMAT(`+localTime+`, '%H:%i'),
+			COALESCE(a.tag, ''), COALESCE(m.nama, '')
+		FROM absensi a
+		LEFT JOIN petugas pt ON a.mesin_id = pt.id_user
+		LEFT JOIN masjid m ON pt.id_masjid = m.id
+		WHERE a.user_id = ? AND a.voided_at IS NULL
+			AND (? = 0 OR a.event_id = ?)
+			AND a.created_at >= ? AND a.created_at < ?
+			AND DATE(`+localTime+`) BETWEEN ? AND ?
+		ORDER BY a.created_at DESC`,
+		memberID, eventID, eventID, rangeStart, rangeEnd, startDate, endDate)
+	if err != nil {
+		log.Println("Error fetching member absensi:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch absensi"})
+	}
+	defer rows.Close()
+
+	absensi := []MemberAbsensi{}
+	for rows.Next() {
+		var a MemberAbsensi
+		if err := rows.Scan(&a.ID, &a.EventID, &a.Tanggal, &a.Jam, &a.Tag, &a.MasjidNama); err != nil {
+			log.Println("Error scanning row:", err)
+			continue
+		}
+		absensi = append(absensi, a)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Success",
+		"peserta_id": member.PesertaID,
+		"fullname":   member.FullName,
+		"start_date": startDate,
+		"end_date":   endDate,
+		"data":       absensi,
+	})
+}
+
+// Handler untuk admin mencari keluarga berdasarkan nomor HP (?contact=)
+func GetHouseholdByContact(c *fiber.Ctx) error {
+	contact := c.Query("contact")
+	if contact == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "contact is required"})
+	}
+	household, err := services.HouseholdByContact(contact)
+	if err == services.ErrHouseholdNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Household not found"})
+	} else if err != nil {
+		log.Println("Error fetching household:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch household"})
+	}
+	return c.JSON(fiber.Map{"message": "Success", "data": household})
+}
+
+// Handler untuk mengganti wali utama keluarga
+func UpdateHouseholdGuardian(c *fiber.Ctx) error {
+	householdID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid household id"})
+	}
+	var req UpdateGuardianRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	before, err := services.LoadHousehold(householdID)
+	if err == services.ErrHouseholdNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Household not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	err = services.SetGuardian(tx, householdID, req.PesertaID)
+	if err == services.ErrNotHouseholdMember {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Peserta is not a member of this household"})
+	} else if err != nil {
+		log.Println("Error updating guardian:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update guardian"})
+	}
+
+	recordAudit(c, tx, "household.guardian", "household", householdID,
+		fiber.Map{"guardian_peserta_id": before.GuardianID}, fiber.Map{"guardian_peserta_id": req.PesertaID})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update guardian"})
+	}
+
+	household, _ := services.LoadHousehold(householdID)
+	return c.JSON(fiber.Map{"message": "Guardian updated successfully", "data": household})
+}
+
+// guardianHousehold mengambil keluarga dari :qr_code wali utama; kalau gagal
+// response sudah ditulis dan hasilnya false
+func guardianHousehold(c *fiber.Ctx) (*services.Household, bool) {
+	household, err := services.GuardianHousehold(c.Params("qr_code"))
+	switch err {
+	case nil:
+		return household, true
+	case services.ErrHouseholdNotFound:
+		c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Household not found"})
+	case services.ErrNotGuardian:
+		c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "Only the primary guardian can view this household"})
+	default:
+		log.Println("Error fetching household:", err)
+		c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch household"})
+	}
+	return nil, false
+}
+
+// householdDateRange membaca ?start_date=&end_date=, default 30 hari terakhir di
+// zona masjid wali
+func householdDateRange(c *fiber.Ctx, household *services.Household) (string, string, bool) {
+	loc := utils.DefaultLocation()
+	if len(household.Members) > 0 {
+		loc = services.MasjidLocation(household.Members[0].MasjidID)
+	}
+	endDate := c.Query("end_date", utils.Today(loc))
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "end_date must be YYYY-MM-DD"})
+		return "", "", false
+	}
+	startDate := c.Query("start_date", end.AddDate(0, 0, -29).Format("2006-01-02"))
+	if !validDateRange(startDate, endDate) {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date range. Use YYYY-MM-DD"})
+		return "", "", false
+	}
+	return startDate, endDate, true
+}
@@ -1,8 +1,14 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
 	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,20 +22,145 @@ type RekapAbsen struct {
 	IsHideName int       `json:"isHideName"`
 }
 
+type SholatStatus struct {
+	Status       bool   `json:"status"`
+	InThisMasjid bool   `json:"inThisMasjid"`
+	MasjidName   string `json:"masjidName,omitempty"`
+}
+
+type RekapSholat struct {
+	Name       string                  `json:"name"`
+	IsHideName int                     `json:"isHideName"`
+	Sholat     map[string]SholatStatus `json:"sholat"`
+}
+
+var dailySholatTags = []string{"subuh", "dzuhur", "ashar", "maghrib", "isya"}
+
+// Tag sholat Jumat, menggantikan dzuhur untuk jamaah laki-laki di hari Jumat
+const jumatTag = services.TagJumat
+
+// sholatTagsOn mengembalikan kolom sholat untuk tanggal (YYYY-MM-DD); hari Jumat
+// ada kolom jumat tambahan setelah dzuhur.
+func sholatTagsOn(tanggal string) []string {
+	day, err := time.Parse("2006-01-02", tanggal)
+	if err != nil || day.Weekday() != time.Friday {
+		return dailySholatTags
+	}
+	return []string{"subuh", "dzuhur", jumatTag, "ashar", "maghrib", "isya"}
+}
+
 // Handler untuk mendapatkan rekap absen berdasarkan filter tanggal
 func GetRekapAbsen(c *fiber.Ctx) error {
 	idMasjid := c.Params("id_masjid") // Ambil id_masjid dari parameter URL
 	idEvent := c.Query("id_event")    // Ambil id_event dari query parameter
 	tanggal := c.Query("tanggal")     // Ambil tanggal dari query parameter
+	format := c.Query("format")
 
-	// Gunakan tanggal hari ini jika tidak ada query parameter tanggal
+	// Gunakan tanggal hari ini (zona masjid) jika tidak ada query parameter tanggal
 	if tanggal == "" {
-		tanggal = time.Now().Format("2006-01-02")
+		tanggal = utils.Today(masjidLocation(idMasjid))
+	}
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
+	q, err := utils.ParseListQuery(c, rekapAbsenListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
 	}
 
+	// ?session_id= merekap satu kemunculan sesi di masjid ini
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		id, err := strconv.Atoi(sessionID)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session_id"})
+		}
+		if format != "" {
+			occ, rekapList, err := fetchRekapSesi(id, idMasjid, c.Query("tanggal"))
+			if err != nil {
+				return reportError(c, err, "Failed to fetch rekap absen")
+			}
+			return utils.SendExport(c, format, fmt.Sprintf("rekap-sesi-%d-%s-%s", id, idMasjid, occ.Tanggal), rekapSesiTable(occ, rekapList, idMasjid))
+		}
+		occ, query, args, err := rekapSesiQuery(id, idMasjid, c.Query("tanggal"))
+		if err != nil {
+			return reportError(c, err, "Failed to fetch rekap absen")
+		}
+		response, err := pageRekapAbsen(q, query, args)
+		if err != nil {
+			return reportError(c, err, "Failed to fetch rekap absen")
+		}
+		response["session"] = occ
+		return c.JSON(response)
+	}
+
+	if format != "" {
+		rekapList, err := fetchRekapAbsen(idMasjid, idEvent, tanggal, c.Query("jam_min"), c.Query("jam_max"))
+		if err != nil {
+			return reportError(c, err, "Failed to fetch rekap absen")
+		}
+		table := rekapAbsenTable(rekapList, idMasjid, idEvent, tanggal)
+		return utils.SendExport(c, format, fmt.Sprintf("rekap-absen-%s-%s", idMasjid, tanggal), table)
+	}
+
+	query, args, err := rekapAbsenQuery(idMasjid, idEvent, tanggal, c.Query("jam_min"), c.Query("jam_max"))
+	if err != nil {
+		return reportError(c, err, "Failed to fetch rekap absen")
+	}
+	response, err := pageRekapAbsen(q, query, args)
+	if err != nil {
+		return reportError(c, err, "Failed to fetch rekap absen")
+	}
+	return c.JSON(response)
+}
+
+// rekapAbsenListSpec: ?sort=jam|fullname, default jam scan paling awal.
+// Default limit maksimum supaya rekap harian satu masjid biasanya tetap satu halaman.
+var rekapAbsenListSpec = utils.ListSpec{
+	Sorts:        map[string]string{"jam": "r.jam", "fullname": "r.fullname"},
+	DefaultSort:  "jam",
+	DefaultLimit: utils.MaxListLimit,
+}
+
+// pageRekapAbsen menghitung total lalu mengambil satu halaman dari query rekap
+// (hasil rekapAbsenQuery/rekapSesiQuery) langsung di database.
+func pageRekapAbsen(q *utils.ListQuery, query string, args []interface{}) (fiber.Map, error) {
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM ("+query+") r", args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	limitSQL, limitArgs := q.LimitSQL()
+	rekapList, err := queryRekapAbsen(
+		"SELECT r.user_id, r.fullname, r.jam, r.isHideName FROM ("+query+") r"+q.OrderSQL("r.user_id")+limitSQL,
+		append(append([]interface{}{}, args...), limitArgs...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return q.Response(rekapList, total), nil
+}
+
+// fetchRekapAbsen mengambil seluruh rekap absen satu masjid (untuk export dan
+// laporan), urut jam scan.
+func fetchRekapAbsen(idMasjid, idEvent, tanggal, jamMin, jamMax string) ([]RekapAbsen, error) {
+	query, args, err := rekapAbsenQuery(idMasjid, idEvent, tanggal, jamMin, jamMax)
+	if err != nil {
+		return nil, err
+	}
+	return queryRekapAbsen(query+" ORDER BY jam ASC", args)
+}
+
+// rekapAbsenQuery menyusun query rekap absen satu masjid (satu baris per peserta,
+// tanpa ORDER BY). Error validasi dikembalikan sebagai *fiber.Error supaya
+// handler bisa meneruskan status code-nya.
+func rekapAbsenQuery(idMasjid, idEvent, tanggal, jamMin, jamMax string) (string, []interface{}, error) {
 	var query string
 	var args []interface{}
 
+	// Semua absensi di sini dari mesin masjid yang sama, jadi cukup satu offset
+	loc := masjidLocation(idMasjid)
+	offset := utils.UTCOffset(loc)
+
 	switch idEvent {
 	case "1":
 		query = `
@@ -37,18 +168,9 @@ func GetRekapAbsen(c *fiber.Ctx) error {
 			FROM absensi
 			LEFT JOIN petugas ON absensi.mesin_id = petugas.id_user
 			LEFT JOIN peserta ON absensi.user_id = peserta.id
-			WHERE absensi.event_id = ? AND petugas.id_masjid = ?
-			AND DATE(CONVERT_TZ(absensi.jam, '+00:00', '+07:00')) = DATE(?) GROUP BY absensi.user_id, peserta.fullname`
-		args = append(args, idEvent, idMasjid, tanggal)
-		// case "2":
-		// 	query = `
-		// 		SELECT absensi.user_id, COALESCE(peserta.fullname, '') AS fullname, absensi.created_at AS jam, peserta.isHideName
-		// 		FROM absensi
-		// 		LEFT JOIN petugas ON absensi.mesin_id = petugas.id_user
-		// 		LEFT JOIN peserta ON absensi.user_id = peserta.id
-		// 		WHERE absensi.event_id = ? AND petugas.id_masjid = ?
-		// 		AND DATE(CONVERT_TZ(absensi.jam, '+00:00', '+07:00')) = DATE(?) GROUP BY absensi.user_id, peserta.fullname`
-		// 	args = append(args, idEvent, idMasjid, tanggal)
+			WHERE absensi.event_id = ? AND petugas.id_masjid = ? AND absensi.voided_at IS NULL
+			AND DATE(CONVERT_TZ(absensi.jam, '+00:00', ?)) = DATE(?) GROUP BY absensi.user_id, peserta.fullname`
+		args = append(args, idEvent, idMasjid, offset, tanggal)
 	case "2":
 		query = `
 			SELECT absensi.user_id, 
@@ -60,45 +182,24 @@ func GetRekapAbsen(c *fiber.Ctx) error {
 			LEFT JOIN peserta ON absensi.user_id = peserta.id
 			WHERE absensi.event_id = ? 
 			AND petugas.id_masjid = ? 
+			AND absensi.voided_at IS NULL
 			AND (
-				CONVERT_TZ(absensi.created_at, '+00:00', '+07:00') 
+				CONVERT_TZ(absensi.created_at, '+00:00', ?) 
 				BETWEEN CONCAT(?, ' 19:00:00') 
 				AND CONCAT(DATE_ADD(?, INTERVAL 1 DAY), ' 06:00:00')
 			)
-			GROUP BY absensi.user_id, peserta.fullname, peserta.isHideName
-			order by jam asc;
-		`
-		args = append(args, idEvent, idMasjid, tanggal, tanggal)
+			GROUP BY absensi.user_id, peserta.fullname, peserta.isHideName`
+		args = append(args, idEvent, idMasjid, offset, tanggal, tanggal)
 	case "3":
-		jamMin := c.Query("jam_min") // Ambil jam_min dari query parameter
-		jamMax := c.Query("jam_max") // Ambil jam_max dari query parameter
-
-		// Load lokasi zona waktu Jakarta
-		locJakarta, err := time.LoadLocation("Asia/Jakarta")
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load timezone"})
-		}
-
-		// Konversi jam_min dan jam_max dari WIB ke UTC
+		// jam_min dan jam_max adalah jam lokal masjid, dibandingkan dengan jam lokal
+		// scan supaya jendela yang melewati tengah malam UTC (subuh WIB/WIT) tetap cocok
 		if jamMin != "" && jamMax != "" {
-			tanggalWIB := tanggal + " " + jamMin
-			jamMinTime, err := time.ParseInLocation("2006-01-02 15:04:05", tanggalWIB, locJakarta)
-			if err != nil {
-				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid jam_min format"})
+			if _, err := time.Parse("15:04:05", jamMin); err != nil {
+				return "", nil, fiber.NewError(http.StatusBadRequest, "Invalid jam_min format")
 			}
-
-			tanggalWIB = tanggal + " " + jamMax
-			jamMaxTime, err := time.ParseInLocation("2006-01-02 15:04:05", tanggalWIB, locJakarta)
-			if err != nil {
-				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid jam_max format"})
+			if _, err := time.Parse("15:04:05", jamMax); err != nil {
+				return "", nil, fiber.NewError(http.StatusBadRequest, "Invalid jam_max format")
 			}
-
-			// Konversi ke UTC
-			jamMinUTC := jamMinTime.UTC().Format("15:04:05")
-			jamMaxUTC := jamMaxTime.UTC().Format("15:04:05")
-
-			jamMin = jamMinUTC
-			jamMax = jamMaxUTC
 		}
 
 		query = `
@@ -106,58 +207,92 @@ func GetRekapAbsen(c *fiber.Ctx) error {
 			FROM absensi
 			LEFT JOIN petugas ON absensi.mesin_id = petugas.id_user
 			LEFT JOIN peserta ON absensi.user_id = peserta.id
-			WHERE absensi.event_id = ? AND petugas.id_masjid = ?
-			AND DATE(CONVERT_TZ(absensi.created_at, '+00:00', '+07:00')) = DATE(?)
-			AND TIME(absensi.created_at) BETWEEN ? AND ? GROUP BY absensi.user_id, peserta.fullname`
-		args = append(args, idEvent, idMasjid, tanggal, jamMin, jamMax)
+			WHERE absensi.event_id = ? AND petugas.id_masjid = ? AND absensi.voided_at IS NULL
+			AND DATE(CONVERT_TZ(absensi.created_at, '+00:00', ?)) = DATE(?)
+			AND TIME(CONVERT_TZ(absensi.created_at, '+00:00', ?)) BETWEEN ? AND ? GROUP BY absensi.user_id, peserta.fullname`
+		args = append(args, idEvent, idMasjid, offset, tanggal, offset, jamMin, jamMax)
 	default:
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event_id"})
+		return "", nil, fiber.NewError(http.StatusBadRequest, "Invalid event_id")
 	}
+	return query, args, nil
+}
 
+// queryRekapAbsen menjalankan query rekap (user_id, fullname, jam, isHideName).
+func queryRekapAbsen(query string, args []interface{}) ([]RekapAbsen, error) {
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch rekap absen"})
+		return nil, err
 	}
 	defer rows.Close()
 
-	var rekapList []RekapAbsen
-
+	rekapList := []RekapAbsen{}
 	for rows.Next() {
 		var rekap RekapAbsen
 		if err := rows.Scan(&rekap.UserID, &rekap.Fullname, &rekap.Jam, &rekap.IsHideName); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			return nil, err
 		}
+		rekap.Jam = rekap.Jam.UTC() // Pastikan UTC
 		rekapList = append(rekapList, rekap)
 	}
+	return rekapList, rows.Err()
+}
 
-	for i := range rekapList {
-		rekapList[i].Jam = rekapList[i].Jam.UTC() // Pastikan UTC
+func rekapAbsenTable(rekapList []RekapAbsen, idMasjid, idEvent, tanggal string) *utils.ExportTable {
+	loc := masjidLocation(idMasjid)
+	table := &utils.ExportTable{
+		Title:   "Rekap Absensi",
+		Meta:    []string{"Masjid: " + masjidName(idMasjid), "Event: " + idEvent, "Tanggal: " + tanggal},
+		Headers: []string{"No", "Nama", "Jam (" + utils.ZoneAbbr(loc) + ")"},
+	}
+	for i, r := range rekapList {
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(i + 1),
+			displayName(r.Fullname, r.IsHideName == 1),
+			r.Jam.In(loc).Format("2006-01-02 15:04"),
+		})
 	}
+	table.Totals = []string{"", "Total", strconv.Itoa(len(rekapList))}
+	return table
+}
 
-	if len(rekapList) == 0 {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"message": "No attendance records found"})
+func GetRekapSholat(c *fiber.Ctx) error {
+	idMasjid := c.Params("id_masjid")
+	tanggal := c.Query("tanggal")
+	if tanggal == "" {
+		tanggal = utils.Today(masjidLocation(idMasjid))
+	}
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
+
+	result, err := fetchRekapSholat(idMasjid, tanggal)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if format != "" {
+		table := rekapSholatTable(result, idMasjid, tanggal)
+		return utils.SendExport(c, format, fmt.Sprintf("rekap-sholat-%s-%s", idMasjid, tanggal), table)
 	}
 
 	return c.JSON(fiber.Map{
 		"message": "Success",
-		"data":    rekapList,
+		"data":    result,
 	})
 }
 
-func GetRekapSholat(c *fiber.Ctx) error {
-	idMasjid := c.Params("id_masjid")
+// fetchRekapSholat mengambil status 5 waktu per peserta yang pernah sholat di masjid ini pada tanggal tsb
+func fetchRekapSholat(idMasjid, tanggal string) ([]RekapSholat, error) {
 	idEvent := "3" // fix untuk event 3
-	tanggal := c.Query("tanggal")
-	if tanggal == "" {
-		tanggal = time.Now().Format("2006-01-02")
-	}
 
 	// Ambil semua absensi di tanggal itu (event_id = 3)
 	query := `
 		SELECT
 			peserta.id,
 			peserta.fullname,
-			TIME(CONVERT_TZ(absensi.created_at, '+00:00', '+07:00')) AS jam_local,
+			peserta.isHideName,
+			TIME(` + services.MasjidLocalTimeSQL("absensi.created_at", "petugas.id_masjid") + `) AS jam_local,
 			COALESCE(absensi.tag, '') AS tag,
 			petugas.id_masjid,
 			masjid.nama as masjid_name
@@ -166,47 +301,38 @@ func GetRekapSholat(c *fiber.Ctx) error {
 		LEFT JOIN petugas ON absensi.mesin_id = petugas.id_user
 		LEFT JOIN masjid ON petugas.id_masjid = masjid.id
 		WHERE absensi.event_id = ?
-		AND DATE(CONVERT_TZ(absensi.created_at, '+00:00', '+07:00')) = ?
+		AND absensi.voided_at IS NULL
+		AND DATE(` + services.MasjidLocalTimeSQL("absensi.created_at", "petugas.id_masjid") + `) = ?
 		ORDER BY absensi.created_at ASC
 	`
 
 	rows, err := database.DB.Query(query, idEvent, tanggal)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-
+		return nil, err
 	}
 	defer rows.Close()
 
-	type SholatStatus struct {
-		Status       bool   `json:"status"`
-		InThisMasjid bool   `json:"inThisMasjid"`
-		MasjidName   string `json:"masjidName,omitempty"`
-	}
-
-	type Rekap struct {
-		Name   string                  `json:"name"`
-		Sholat map[string]SholatStatus `json:"sholat"`
-	}
-
-	rekapMap := make(map[int]*Rekap)
+	rekapMap := make(map[int]*RekapSholat)
 
 	for rows.Next() {
 		var userID int
 		var name string
+		var isHideName int
 		var tag string
 		var jam string
 		var masjidID string
 		var masjidName string
 
-		if err := rows.Scan(&userID, &name, &jam, &tag, &masjidID, &masjidName); err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		if err := rows.Scan(&userID, &name, &isHideName, &jam, &tag, &masjidID, &masjidName); err != nil {
+			return nil, err
 		}
 
 		// jika belum pernah muncul, inisialisasi map
 		if _, ok := rekapMap[userID]; !ok {
-			rekapMap[userID] = &Rekap{
-				Name:   name,
-				Sholat: make(map[string]SholatStatus),
+			rekapMap[userID] = &RekapSholat{
+				Name:       name,
+				IsHideName: isHideName,
+				Sholat:     make(map[string]SholatStatus),
 			}
 		}
 
@@ -223,18 +349,10 @@ func GetRekapSholat(c *fiber.Ctx) error {
 
 			rekapMap[userID].Sholat[tag] = status
 		}
-
-		// // jika tag sholat belum ada di data user ini, set status-nya
-		// if _, exists := rekapMap[userID].Sholat[tag]; !exists {
-		// 	rekapMap[userID].Sholat[tag] = SholatStatus{
-		// 		Status:       true,
-		// 		InThisMasjid: masjidID == idMasjid,
-		// 	}
-		// }
 	}
 
 	// Filter hanya peserta yang pernah sholat di masjid ini
-	var result []Rekap
+	var result []RekapSholat
 	for _, r := range rekapMap {
 		adaDiMasjidIni := false
 		for _, status := range r.Sholat {
@@ -244,8 +362,8 @@ func GetRekapSholat(c *fiber.Ctx) error {
 			}
 		}
 		if adaDiMasjidIni {
-			// Tambahkan tag sholat kosong ke dalam map jika belum ada (subuh-dzuhur-ashar-maghrib-isya)
-			for _, tag := range []string{"subuh", "dzuhur", "ashar", "maghrib", "isya"} {
+			// Tambahkan tag sholat kosong ke dalam map jika belum ada (subuh-dzuhur-ashar-maghrib-isya, plus jumat)
+			for _, tag := range sholatTagsOn(tanggal) {
 				if _, ok := r.Sholat[tag]; !ok {
 					r.Sholat[tag] = SholatStatus{Status: false, InThisMasjid: false}
 				}
@@ -254,10 +372,54 @@ func GetRekapSholat(c *fiber.Ctx) error {
 		}
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Success",
-		"data":    result,
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
 	})
+
+	return result, nil
+}
+
+func rekapSholatTable(result []RekapSholat, idMasjid, tanggal string) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title:   "Rekap Sholat Berjamaah",
+		Meta:    []string{"Masjid: " + masjidName(idMasjid), "Tanggal: " + tanggal},
+		Headers: []string{"No", "Nama"},
+	}
+	tags := sholatTagsOn(tanggal)
+	for _, tag := range tags {
+		table.Headers = append(table.Headers, strings.Title(tag))
+	}
+	table.Headers = append(table.Headers, "Total")
+
+	totals := make([]int, len(tags))
+	for i, r := range result {
+		row := []string{strconv.Itoa(i + 1), displayName(r.Name, r.IsHideName == 1)}
+		count := 0
+		for j, tag := range tags {
+			status := r.Sholat[tag]
+			cell := "N"
+			if status.Status {
+				cell = "Y"
+				// Sholat di masjid lain diberi catatan kaki nama masjidnya
+				if !status.InThisMasjid {
+					cell += table.Footnote(status.MasjidName)
+				}
+				count++
+				totals[j]++
+			}
+			row = append(row, cell)
+		}
+		table.Rows = append(table.Rows, append(row, strconv.Itoa(count)))
+	}
+
+	table.Totals = []string{"", "Total"}
+	sum := 0
+	for _, n := range totals {
+		table.Totals = append(table.Totals, strconv.Itoa(n))
+		sum += n
+	}
+	table.Totals = append(table.Totals, strconv.Itoa(sum))
+	return table
 }
 
 // func GetRekapSholat(c *fiber.Ctx) error {
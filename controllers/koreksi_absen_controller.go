@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ManualAbsensiRequest struct {
+	QRCode   string `json:"qr_code" validate:"required"`
+	MasjidID int    `json:"masjid_id" validate:"required_without=MesinID,omitempty,min=1"`
+	MesinID  string `json:"mesin_id" validate:"required_without=MasjidID"`
+	EventID  int    `json:"event_id" validate:"required,min=1"`
+	Tag      string `json:"tag" validate:"omitempty,oneof=subuh dzuhur ashar maghrib isya jumat"`
+	Waktu    string `json:"waktu" validate:"required"` // Format: YYYY-MM-DD HH:MM (waktu lokal masjid)
+	Reason   string `json:"reason" validate:"required,min=5,max=255"`
+}
+
+type KoreksiAbsensiRequest struct {
+	Reason string `json:"reason" validate:"required,min=5,max=255"`
+}
+
+type AbsensiAuditEntry struct {
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	ActorID   *int            `json:"actor_id"`
+	Reason    string          `json:"reason"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Handler untuk input absensi manual ketika scanner gagal
+func CreateManualAbsensi(c *fiber.Ctx) error {
+	var req ManualAbsensiRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	if req.EventID == 3 && req.Tag == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "tag is required for event 3"})
+	}
+
+	var userID int
+	var gender string
+	err := database.DB.QueryRow("SELECT id, COALESCE(gender, '') FROM peserta WHERE qr_code = ?", req.QRCode).Scan(&userID, &gender)
+	if err != nil {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No matching QR code found"})
+	}
+
+	var registered bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM detail_peserta WHERE id_peserta = ? AND id_event = ? AND status = ?)", userID, req.EventID, services.EnrollmentActive).Scan(&registered)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error while checking event participation"})
+	}
+	if !registered {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User is not registered for this event"})
+	}
+
+	// Absensi terhubung ke masjid lewat mesin (petugas), pakai mesin pertama masjid jika hanya masjid_id yang dikirim
+	mesinID := req.MesinID
+	if mesinID == "" {
+		err = database.DB.QueryRow("SELECT id_user FROM petugas WHERE id_masjid = ? ORDER BY id_user LIMIT 1", req.MasjidID).Scan(&mesinID)
+		if err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Masjid tidak memiliki mesin/petugas"})
+		}
+	}
+
+	// Waktu diinput dalam jam lokal masjid
+	idMasjid, _ := mesinMasjid(mesinID)
+	loc := services.MasjidLocation(idMasjid)
+	waktu, err := time.ParseInLocation("2006-01-02 15:04", req.Waktu, loc)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid waktu format. Use YYYY-MM-DD HH:MM"})
+	}
+	if waktu.After(time.Now()) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "waktu tidak boleh di masa depan"})
+	}
+
+	// Aturan jumat sama dengan SaveAbsenQR: dzuhur hari Jumat untuk laki-laki dicatat jumat
+	if req.Tag == "dzuhur" && isJumatFor(waktu, gender) {
+		req.Tag = jumatTag
+	} else if req.Tag == jumatTag && !isJumatFor(waktu, gender) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "tag jumat hanya untuk peserta laki-laki di hari Jumat"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if req.Tag != "" {
+		// Kunci baris peserta supaya dua input manual bersamaan tidak sama-sama lolos cek duplikat
+		if _, err := tx.Exec("SELECT id FROM peserta WHERE id = ? FOR UPDATE", userID); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error while checking existing attendance"})
+		}
+
+		tanggal := waktu.Format("2006-01-02")
+		dayStart, dayEnd, _ := utils.DayRange(tanggal, tanggal, loc)
+		var alreadyExists bool
+		err = tx.QueryRow(
+			`SELECT EXISTS(SELECT 1 FROM absensi WHERE user_id = ? AND event_id = ? AND tag = ? AND voided_at IS NULL AND created_at >= ? AND created_at < ? )`,
+			userID, req.EventID, req.Tag, dayStart, dayEnd,
+		).Scan(&alreadyExists)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error while checking existing attendance"})
+		}
+		if alreadyExists {
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "User sudah absen untuk sholat " + req.Tag})
+		}
+	}
+
+	record, err := services.CreateManualAbsensi(tx, services.ManualAbsensi{
+		UserID:  userID,
+		QRCode:  req.QRCode,
+		MesinID: mesinID,
+		EventID: req.EventID,
+		Tag:     req.Tag,
+		Waktu:   waktu,
+		Reason:  req.Reason,
+		ActorID: jwtUserID(c),
+	})
+	if err != nil {
+		log.Println("Error inserting manual attendance:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+	absensiID := record.ID
+
+	err = services.EmitEvent(tx, services.EventAttendanceRecorded, fiber.Map{
+		"absensi_id": absensiID,
+		"user_id":    userID,
+		"event_id":   req.EventID,
+		"tag":        req.Tag,
+		"mesin_id":   mesinID,
+		"scanned_at": record.CreatedAt,
+		"is_manual":  true,
+	})
+	if err != nil {
+		log.Println("Error writing webhook outbox:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+
+	recordAudit(c, tx, "absensi.manual_create", "absensi", absensiID, nil, fiber.Map{
+		"user_id":  userID,
+		"mesin_id": mesinID,
+		"event_id": req.EventID,
+		"tag":      req.Tag,
+		"waktu":    req.Waktu,
+		"reason":   req.Reason,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save attendance record"})
+	}
+
+	// Badge dievaluasi seperti scan QR; cek anomali tidak dijalankan karena input
+	// manual dilakukan petugas, bukan mesin
+	go services.EvaluateScanAchievements(record)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message":    "Manual attendance recorded",
+		"absensi_id": absensiID,
+		"user_id":    userID,
+		"mesin_id":   mesinID,
+		"event_id":   req.EventID,
+		"tag":        req.Tag,
+	})
+}
+
+// Handler untuk void absensi yang salah (soft delete)
+func VoidAbsensi(c *fiber.Ctx) error {
+	return koreksiAbsensi(c, "void")
+}
+
+// Handler untuk membatalkan void absensi
+func RestoreAbsensi(c *fiber.Ctx) error {
+	return koreksiAbsensi(c, "restore")
+}
+
+func koreksiAbsensi(c *fiber.Ctx, action string) error {
+	absensiID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid absensi id"})
+	}
+
+	var req KoreksiAbsensiRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	actorID := jwtUserID(c)
+	if action == "void" {
+		err = services.VoidAbsensi(tx, absensiID, actorID, req.Reason)
+	} else {
+		err = restoreAbsensiChecked(tx, absensiID, actorID, req.Reason)
+	}
+
+	switch err {
+	case nil:
+	case services.ErrAbsensiNotFound:
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Absensi not found"})
+	case services.ErrAbsensiAlreadyVoided:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Absensi sudah di-void"})
+	case services.ErrAbsensiNotVoided:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Absensi tidak dalam status void"})
+	case errDuplicateAbsensi:
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Sudah ada absensi aktif untuk sholat yang sama di tanggal ini"})
+	default:
+		log.Println("Error updating absensi:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update absensi"})
+	}
+
+	recordAudit(c, tx, "absensi."+action, "absensi", absensiID, nil, fiber.Map{"reason": req.Reason})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update absensi"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Absensi updated successfully",
+		"absensi_id": absensiID,
+		"action":     action,
+	})
+}
+
+var errDuplicateAbsensi = errors.New("duplicate active absensi")
+
+// restoreAbsensiChecked memastikan restore tidak menghasilkan absensi ganda untuk sholat yang sama
+func restoreAbsensiChecked(tx *sql.Tx, absensiID int64, actorID int, reason string) error {
+	snapshot, err := services.LoadAbsensiSnapshot(tx, absensiID)
+	if err != nil {
+		return err
+	}
+
+	if snapshot.Tag != "" {
+		var duplicate bool
+		err = tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM absensi
+			WHERE user_id = ? AND event_id = ? AND tag = ? AND id <> ? AND voided_at IS NULL
+			AND `+services.AbsensiLocalDateSQL("")+` = (SELECT `+services.AbsensiLocalDateSQL("src")+` FROM absensi src WHERE src.id = ?))`,
+			snapshot.UserID, snapshot.EventID, snapshot.Tag, absensiID, absensiID).Scan(&duplicate)
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			return errDuplicateAbsensi
+		}
+	}
+
+	return services.RestoreAbsensi(tx, absensiID, actorID, reason)
+}
+
+// Handler untuk melihat riwayat perubahan satu absensi
+func GetAbsensiAudit(c *fiber.Ctx) error {
+	absensiID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid absensi id"})
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, action, actor_id, reason, COALESCE(before_data, 'null'), COALESCE(after_data, 'null'), created_at
+		FROM absensi_audit WHERE absensi_id = ? ORDER BY id ASC`, absensiID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch audit log"})
+	}
+	defer rows.Close()
+
+	entries := []AbsensiAuditEntry{}
+	for rows.Next() {
+		var e AbsensiAuditEntry
+		var actorID sql.NullInt64
+		var before, after string
+		if err := rows.Scan(&e.ID, &e.Action, &actorID, &e.Reason, &before, &after, &e.CreatedAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		if actorID.Valid {
+			id := int(actorID.Int64)
+			e.ActorID = &id
+		}
+		e.Before = json.RawMessage(before)
+		e.After = json.RawMessage(after)
+		entries = append(entries, e)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    entries,
+	})
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/services"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseLiveFeed membaca id_event, id_masjid dan posisi terakhir client. Posisi
+// diambil dari header Last-Event-ID (dikirim otomatis oleh EventSource saat
+// reconnect) atau query ?last_event_id=.
+func parseLiveFeed(params func(string, ...string) string, header, query string) (eventID, masjidID int, lastEventID int64, err error) {
+	if eventID, err = strconv.Atoi(params("id_event")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid id_event")
+	}
+	if masjidID, err = strconv.Atoi(params("id_masjid")); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid id_masjid")
+	}
+	last := header
+	if last == "" {
+		last = query
+	}
+	if last != "" {
+		lastEventID, _ = strconv.ParseInt(last, 10, 64)
+	}
+	return eventID, masjidID, lastEventID, nil
+}
+
+// Handler live feed scan absensi untuk layar masjid via Server-Sent Events
+func StreamLiveFeed(c *fiber.Ctx) error {
+	eventID, masjidID, lastEventID, err := parseLiveFeed(c.Params, c.Get("Last-Event-ID"), c.Query("last_event_id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sub := services.DefaultLiveHub.Subscribe(eventID, masjidID, lastEventID)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		ticker := time.NewTicker(services.LiveHeartbeat)
+		defer ticker.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+		for {
+			select {
+			case msg := <-sub.C:
+				data, _ := json.Marshal(msg.Data)
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case <-sub.Done:
+				// Terlalu lambat membaca, client akan reconnect dan replay
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// LiveFeedUpgrade menolak request ke endpoint WebSocket yang bukan upgrade.
+func LiveFeedUpgrade(c *fiber.Ctx) error {
+	if websocket.IsWebSocketUpgrade(c) {
+		return c.Next()
+	}
+	return fiber.ErrUpgradeRequired
+}
+
+// Handler live feed scan absensi untuk layar masjid via WebSocket. Pesan sama
+// dengan SSE: {"id", "type", "data"}.
+var LiveFeedWebSocket = websocket.New(func(conn *websocket.Conn) {
+	defer conn.Close()
+
+	eventID, masjidID, lastEventID, err := parseLiveFeed(conn.Params, "", conn.Query("last_event_id"))
+	if err != nil {
+		conn.WriteJSON(fiber.Map{"error": err.Error()})
+		return
+	}
+
+	sub := services.DefaultLiveHub.Subscribe(eventID, masjidID, lastEventID)
+	defer sub.Close()
+
+	// Layar tidak mengirim apa-apa; pembacaan hanya untuk mendeteksi koneksi tertutup
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(services.LiveHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-sub.C:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-sub.Done:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow consumer"), time.Now().Add(time.Second))
+			return
+		case <-closed:
+			return
+		}
+	}
+}, websocket.Config{
+	RecoverHandler: func(conn *websocket.Conn) {
+		if err := recover(); err != nil {
+			log.Println("Live feed websocket panic:", err)
+		}
+	},
+})
@@ -1,8 +1,14 @@
 package controllers
 
 import (
+	"database/sql"
+	"log"
 	"net/http"
 	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -12,26 +18,71 @@ type Masjid struct {
 	ID     int    `json:"id"`
 	Name   string `json:"name"`
 	Alamat string `json:"alamat"`
+
+	// Ketersediaan kursi di event yang diminta; Capacity/Sisa nil berarti tidak dibatasi
+	Capacity *int `json:"capacity"`
+	Sisa     *int `json:"sisa"`
+	Waitlist int  `json:"waitlist"`
+	Tersedia bool `json:"tersedia"`
 }
 
 // Struct untuk response masjid
 type MasjidGet struct {
-	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Alamat string `json:"alamat"`
-	Foto   string `json:"foto"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Alamat   string `json:"alamat"`
+	Foto     string `json:"foto"`
+	Timezone string `json:"timezone"`
+}
+
+type UpdateTimezoneRequest struct {
+	Timezone string `json:"timezone"`
+}
+
+// masjidListSpec: ?q= (nama/alamat), ?regional_id=, ?sort=name|id
+var masjidListSpec = utils.ListSpec{
+	Sorts:       map[string]string{"id": "masjid.id", "name": "masjid.nama"},
+	DefaultSort: "name",
+	Filters:     map[string]utils.FilterKind{"q": utils.FilterString, "regional_id": utils.FilterInt},
+	Cursor:      true,
 }
 
 // Handler untuk mendapatkan daftar masjid
 func GetMasjidList(c *fiber.Ctx) error {
 	idEvent := c.Params("id_event")
-	rows, err := database.DB.Query("SELECT masjid.id, masjid.nama, masjid.alamat FROM masjid left join setting on masjid.id = setting.id_masjid where setting.id_event = ?", idEvent)
+	q, err := utils.ParseListQuery(c, masjidListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
+	}
+	where := " WHERE setting.id_event = ?"
+	args := []interface{}{idEvent}
+	if q.Has("q") {
+		where += " AND (masjid.nama LIKE ? OR masjid.alamat LIKE ?)"
+		args = append(args, "%"+q.String("q")+"%", "%"+q.String("q")+"%")
+	}
+	if q.Has("regional_id") {
+		where += " AND masjid.regional_id = ?"
+		args = append(args, q.Int("regional_id"))
+	}
+	from := " FROM masjid left join setting on masjid.id = setting.id_masjid"
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch masjid"})
+	}
+	if cond, condArgs := q.CursorSQL("masjid.id"); cond != "" {
+		where += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	limitSQL, limitArgs := q.LimitSQL()
+	rows, err := database.DB.Query("SELECT masjid.id, masjid.nama, masjid.alamat"+from+where+q.OrderSQL("masjid.id")+limitSQL,
+		append(args, limitArgs...)...)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch masjid"})
 	}
 	defer rows.Close()
 
-	var masjids []Masjid
+	masjids := []Masjid{}
 
 	// Iterasi hasil query
 	for rows.Next() {
@@ -42,28 +93,144 @@ func GetMasjidList(c *fiber.Ctx) error {
 		masjids = append(masjids, masjid)
 	}
 
+	eventID, _ := strconv.Atoi(idEvent)
+	capacities, err := services.LoadCapacities(eventID, 0)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch capacity"})
+	}
+	byMasjid := make(map[int]services.MasjidCapacity, len(capacities))
+	for _, mc := range capacities {
+		byMasjid[mc.MasjidID] = mc
+	}
+	for i := range masjids {
+		mc := byMasjid[masjids[i].ID]
+		masjids[i].Capacity, masjids[i].Sisa, masjids[i].Waitlist = mc.Capacity, mc.Sisa, mc.Waitlist
+		masjids[i].Tersedia = mc.Sisa == nil || *mc.Sisa > 0
+	}
+
 	// Cek jika data kosong
-	if len(masjids) == 0 {
+	if total == 0 {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"message": "No masjid found"})
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Success",
-		"data":    masjids,
-	})
+	if n := len(masjids); n > 0 {
+		var sortValue interface{}
+		if q.Sort == "name" {
+			sortValue = masjids[n-1].Name
+		}
+		q.NextAfter(n, sortValue, int64(masjids[n-1].ID))
+	}
+	return c.JSON(q.Response(masjids, total))
 }
 
 func GetMasjidByID(c *fiber.Ctx) error {
 	idMasjid := c.Params("id_masjid")
 	var masjid MasjidGet
 
-	err := database.DB.QueryRow("SELECT id, nama, alamat, foto FROM masjid WHERE id = ?", idMasjid).Scan(&masjid.ID, &masjid.Name, &masjid.Alamat, &masjid.Foto)
+	var timezone sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT m.id, m.nama, m.alamat, m.foto, COALESCE(m.timezone, r.timezone)
+		FROM masjid m LEFT JOIN regional r ON m.regional_id = r.id
+		WHERE m.id = ?`, idMasjid).Scan(&masjid.ID, &masjid.Name, &masjid.Alamat, &masjid.Foto, &timezone)
 	if err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Masjid not found"})
 	}
+	masjid.Timezone = utils.Location(timezone.String).String()
 
 	return c.JSON(fiber.Map{
 		"message": "Success",
 		"data":    masjid,
 	})
 }
+
+// masjidLocation mengembalikan zona waktu masjid dari id berupa string (param/query).
+func masjidLocation(idMasjid string) *time.Location {
+	id, _ := strconv.Atoi(idMasjid)
+	return services.MasjidLocation(id)
+}
+
+// Handler untuk mengatur zona waktu regional (Asia/Jakarta, Asia/Makassar, Asia/Jayapura, ...)
+func UpdateRegionalTimezone(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid regional id"})
+	}
+	var req UpdateTimezoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if !utils.IsSupportedTimezone(req.Timezone) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported timezone"})
+	}
+
+	var before string
+	if err := database.DB.QueryRow("SELECT timezone FROM regional WHERE id = ?", id).Scan(&before); err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Regional not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE regional SET timezone = ? WHERE id = ?", req.Timezone, id); err != nil {
+		log.Println("Error updating regional timezone:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update timezone"})
+	}
+	recordAudit(c, tx, "regional.timezone", "regional", id, fiber.Map{"timezone": before}, fiber.Map{"timezone": req.Timezone})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update timezone"})
+	}
+	services.InvalidateTimezones()
+
+	return c.JSON(fiber.Map{"message": "Timezone updated successfully"})
+}
+
+// Handler untuk mengatur zona waktu masjid. Timezone kosong berarti ikut regional.
+func UpdateMasjidTimezone(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid masjid id"})
+	}
+	var req UpdateTimezoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.Timezone != "" && !utils.IsSupportedTimezone(req.Timezone) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported timezone"})
+	}
+
+	var before sql.NullString
+	if err := database.DB.QueryRow("SELECT timezone FROM masjid WHERE id = ?", id).Scan(&before); err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Masjid not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	var timezone interface{}
+	if req.Timezone != "" {
+		timezone = req.Timezone
+	}
+	if _, err := tx.Exec("UPDATE masjid SET timezone = ? WHERE id = ?", timezone, id); err != nil {
+		log.Println("Error updating masjid timezone:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update timezone"})
+	}
+	recordAudit(c, tx, "masjid.timezone", "masjid", id, fiber.Map{"timezone": before.String}, fiber.Map{"timezone": req.Timezone})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update timezone"})
+	}
+	services.InvalidateTimezones()
+
+	return c.JSON(fiber.Map{"message": "Timezone updated successfully"})
+}
@@ -3,8 +3,10 @@ package controllers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"log"
 	"net/http"
 	"shollu/database"
+	"shollu/services"
 	"shollu/utils"
 	"time"
 
@@ -21,6 +23,8 @@ type RegisterPesertaRequest struct {
 	IsHideName bool   `json:"isHideName"`
 	QRCode     string `json:"qrCode" validate:"omitempty,len=12"`
 	EventID    int    `json:"event_id" validate:"omitempty,min=1"`
+	// Jawaban field tambahan formulir event (lihat event_form_fields)
+	CustomFields map[string]interface{} `json:"custom_fields"`
 }
 
 func GenerateRandomID() string {
@@ -117,10 +121,19 @@ func RegisterPesertaItikaf(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	// Validasi input
-	if err := utils.Validate.Struct(req); err != nil {
-		errors := utils.FormatValidationErrors(err)
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	// Gender disimpan sebagai enum male/female, variasi lain (Laki-laki, pria, ...) dinormalisasi dulu
+	req.Gender = utils.NormalizeGender(req.Gender)
+
+	// Gunakan Event ID dari request jika diberikan, atau gunakan default 2
+	eventID := req.EventID
+	if eventID == 0 {
+		eventID = 2
+	}
+
+	// Validasi input beserta field tambahan formulir event
+	customFields, ok := checkCustomFields(c, eventID, req.CustomFields, utils.Validate.Struct(req))
+	if !ok {
+		return nil
 	}
 
 	// Konversi DOB ke format time.Time
@@ -129,18 +142,20 @@ func RegisterPesertaItikaf(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date format. Use YYYY-MM-DD"})
 	}
 
-	// Cek apakah nomor HP sudah terdaftar
+	// Cek apakah nomor HP sudah terdaftar. Satu nomor bisa dipakai beberapa
+	// anggota keluarga, jadi peserta lama dicari berdasarkan namanya; nama yang
+	// belum ada menjadi anggota keluarga baru dengan QR Code sendiri.
+	members, err := services.ContactMembers(req.Contact)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	if existing := services.MatchMember(members, req.FullName); existing != nil {
+		// Peserta lama cukup didaftarkan ke event ini (kalau belum), QR Code tetap yang lama
+		return enrollExistingPeserta(c, existing.PesertaID, existing.QRCode, eventID, req.MasjidID, customFields)
+	}
+
 	var idPeserta int64
 	var qrCode string
-	err = database.DB.QueryRow("SELECT id, qr_code FROM peserta WHERE contact = ?", req.Contact).Scan(&idPeserta, &qrCode)
-	if err == nil {
-		// Jika peserta sudah terdaftar, kembalikan response sukses dengan QR Code dari database
-		return c.Status(http.StatusCreated).JSON(fiber.Map{
-			"message":    "Peserta has been registered",
-			"qr_code":    qrCode,
-			"is_peserta": idPeserta,
-		})
-	}
 
 	// Gunakan QR Code dari request jika diberikan, atau generate yang baru
 	if req.QRCode == "" {
@@ -158,14 +173,14 @@ func RegisterPesertaItikaf(c *fiber.Ctx) error {
 		qrCode = req.QRCode
 	}
 
-	// Gunakan Event ID dari request jika diberikan, atau gunakan default 2
-	eventID := req.EventID
-	if eventID == 0 {
-		eventID = 2
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
 	}
+	defer tx.Rollback()
 
 	// Insert ke `peserta`
-	result, err := database.DB.Exec("INSERT INTO peserta (fullname, contact, gender, dob, masjid_id, isHideName, qr_code, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+	result, err := tx.Exec("INSERT INTO peserta (fullname, contact, gender, dob, masjid_id, isHideName, qr_code, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
 		req.FullName, req.Contact, req.Gender, dob, req.MasjidID, req.IsHideName, qrCode, 1)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to insert peserta"})
@@ -177,15 +192,130 @@ func RegisterPesertaItikaf(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to retrieve peserta ID"})
 	}
 
-	// Insert ke `detail_peserta`
-	_, err = database.DB.Exec("INSERT INTO detail_peserta (id_peserta, id_event, status) VALUES (?, ?, ?)", idPeserta, eventID, 1)
-	if err != nil {
+	// Nomor HP yang sudah dipakai: peserta baru masuk ke keluarga nomor itu
+	var householdID int
+	if len(members) > 0 {
+		householdID, err = services.EnsureHousehold(tx, req.Contact)
+		if err != nil {
+			log.Println("Error linking household:", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to register peserta"})
+		}
+	}
+
+	// Insert ke `detail_peserta`; kursi dihitung di transaksi ini, kalau penuh peserta masuk antrian tunggu
+	status, err := services.Enroll(tx, int(idPeserta), eventID, req.MasjidID, 0, "", customFields)
+	if err == services.ErrCapacityFull {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Kuota masjid ini sudah penuh"})
+	} else if err != nil {
+		log.Println("Error inserting detail peserta:", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to insert detail peserta"})
 	}
 
+	err = services.EmitEvent(tx, services.EventPesertaRegistered, fiber.Map{
+		"peserta_id":   idPeserta,
+		"fullname":     req.FullName,
+		"contact":      req.Contact,
+		"gender":       req.Gender,
+		"masjid_id":    req.MasjidID,
+		"isHideName":   req.IsHideName,
+		"event_id":     eventID,
+		"waitlist":     status == services.EnrollmentWaitlist,
+		"household_id": householdID,
+	})
+	if err != nil {
+		log.Println("Error writing webhook outbox:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to register peserta"})
+	}
+
+	recordAudit(c, tx, "peserta.register", "peserta", idPeserta, nil, fiber.Map{
+		"fullname":     req.FullName,
+		"contact":      req.Contact,
+		"gender":       req.Gender,
+		"dob":          req.Dob,
+		"masjid_id":    req.MasjidID,
+		"isHideName":   req.IsHideName,
+		"qr_code":      qrCode,
+		"event_id":     eventID,
+		"status":       status,
+		"custom":       customFields,
+		"household_id": householdID,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to register peserta"})
+	}
+
+	message := "Peserta registered successfully"
+	if status == services.EnrollmentWaitlist {
+		message = "Peserta added to waitlist"
+	}
+	response := fiber.Map{
+		"message":    message,
+		"qr_code":    qrCode,
+		"is_peserta": idPeserta,
+		"waitlist":   status == services.EnrollmentWaitlist,
+	}
+	if householdID != 0 {
+		response["household_id"] = householdID
+	}
+	return c.Status(http.StatusCreated).JSON(response)
+}
+
+// enrollExistingPeserta mendaftarkan peserta yang nomor HP-nya sudah ada ke event
+// yang diminta. Kalau sudah terdaftar di event itu, response sama seperti sebelumnya.
+func enrollExistingPeserta(c *fiber.Ctx, idPeserta int, qrCode string, eventID, masjidID int, customFields map[string]interface{}) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	status, err := services.Enroll(tx, idPeserta, eventID, masjidID, 0, "", customFields)
+	if err == services.ErrAlreadyEnrolled {
+		return c.Status(http.StatusCreated).JSON(fiber.Map{
+			"message":    "Peserta has been registered",
+			"qr_code":    qrCode,
+			"is_peserta": idPeserta,
+			"waitlist":   status == services.EnrollmentWaitlist,
+		})
+	} else if err == services.ErrCapacityFull {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Kuota masjid ini sudah penuh"})
+	} else if err != nil {
+		log.Println("Error enrolling existing peserta:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to register peserta"})
+	}
+
+	err = services.EmitEvent(tx, services.EventPesertaRegistered, fiber.Map{
+		"peserta_id": idPeserta,
+		"masjid_id":  masjidID,
+		"event_id":   eventID,
+		"waitlist":   status == services.EnrollmentWaitlist,
+	})
+	if err != nil {
+		log.Println("Error writing webhook outbox:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to register peserta"})
+	}
+
+	recordAudit(c, tx, "enrollment.enroll", "peserta", idPeserta, nil, fiber.Map{
+		"event_id":  eventID,
+		"masjid_id": masjidID,
+		"status":    status,
+		"custom":    customFields,
+	})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to register peserta"})
+	}
+	forgetEnrollments(eventID, []int{idPeserta})
+
+	message := "Peserta registered to event successfully"
+	if status == services.EnrollmentWaitlist {
+		message = "Peserta added to waitlist"
+	}
 	return c.Status(http.StatusCreated).JSON(fiber.Map{
-		"message":    "Peserta registered successfully",
+		"message":    message,
 		"qr_code":    qrCode,
 		"is_peserta": idPeserta,
+		"waitlist":   status == services.EnrollmentWaitlist,
 	})
 }
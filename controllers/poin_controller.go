@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type LeaderboardEntry struct {
+	Rank       int    `json:"rank"`
+	UserID     int    `json:"user_id"`
+	Fullname   string `json:"fullname"`
+	TotalPoint int    `json:"total_point"`
+	TotalHadir int    `json:"total_hadir"`
+}
+
+type UpdatePoinRulesRequest struct {
+	EventID  int                 `json:"event_id" validate:"required"`
+	Rules    []services.PoinRule `json:"rules" validate:"required,min=1,dive"`
+	DateFrom string              `json:"date_from"`
+	DateTo   string              `json:"date_to"`
+}
+
+type RecomputePoinRequest struct {
+	EventID  int    `json:"event_id" validate:"required"`
+	DateFrom string `json:"date_from" validate:"required"`
+	DateTo   string `json:"date_to" validate:"required"`
+}
+
+// Kode tracking_code collection ke tag sholat; 6 adalah sholat Jumat
+var collectionSholatMap = map[string]string{
+	"1": "subuh", "2": "dzuhur", "3": "ashar", "4": "maghrib", "5": "isya", "6": jumatTag,
+}
+
+// leaderboardPeriod menentukan rentang tanggal dari query period (daily, weekly, period)
+func leaderboardPeriod(c *fiber.Ctx) (string, string, error) {
+	// Default hari ini di zona masjid kalau leaderboard per masjid
+	loc := utils.DefaultLocation()
+	if c.Query("scope") == "masjid" {
+		loc = masjidLocation(c.Query("id"))
+	}
+	date := c.Query("date", utils.Today(loc))
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch c.Query("period", "daily") {
+	case "weekly":
+		// Minggu dihitung Senin s/d Minggu
+		offset := (int(day.Weekday()) + 6) % 7
+		start := day.AddDate(0, 0, -offset)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 6).Format("2006-01-02"), nil
+	case "period":
+		dateFrom, err := time.Parse("2006-01-02", c.Query("date_from"))
+		if err != nil {
+			return "", "", err
+		}
+		dateTo, err := time.Parse("2006-01-02", c.Query("date_to"))
+		if err != nil {
+			return "", "", err
+		}
+		return dateFrom.Format("2006-01-02"), dateTo.Format("2006-01-02"), nil
+	default:
+		return date, date, nil
+	}
+}
+
+// Handler untuk leaderboard poin per masjid, regional, collection atau semua
+func GetLeaderboard(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Query("event_id", "3"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event_id"})
+	}
+
+	dateFrom, dateTo, err := leaderboardPeriod(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date format. Use YYYY-MM-DD"})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	scope := c.Query("scope", "all")
+	scopeID := c.Query("id")
+	if scope != "all" && scopeID == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "id is required for scope " + scope})
+	}
+
+	query := `
+		SELECT po.user_id, COALESCE(p.fullname, ''), p.isHideName, SUM(po.total_point) AS total_point, COUNT(*) AS total_hadir
+		FROM poin po
+		JOIN absensi a ON po.absensi_id = a.id AND a.voided_at IS NULL
+		JOIN peserta p ON po.user_id = p.id
+		JOIN petugas pt ON po.mesin_id = pt.id_user
+		JOIN masjid m ON pt.id_masjid = m.id
+		WHERE po.event_id = ? AND po.tanggal BETWEEN ? AND ?`
+	args := []interface{}{eventID, dateFrom, dateTo}
+
+	switch scope {
+	case "masjid":
+		query += " AND pt.id_masjid = ?"
+		args = append(args, scopeID)
+	case "regional":
+		query += " AND m.regional_id = ?"
+		args = append(args, scopeID)
+	case "collection":
+		var collectionID int64
+		var masjidID, trackingCode string
+		// ?id= angka berarti id collection, selain itu slug
+		var row *sql.Row
+		if id, err := strconv.Atoi(scopeID); err == nil {
+			row = database.DB.QueryRow("SELECT id, masjid_id, tracking_code FROM collections WHERE id = ?", id)
+		} else {
+			row = database.DB.QueryRow("SELECT id, masjid_id, tracking_code FROM collections WHERE slug = ?", scopeID)
+		}
+		err := row.Scan(&collectionID, &masjidID, &trackingCode)
+		if err == sql.ErrNoRows {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Collection not found"})
+		} else if err != nil {
+			log.Println("Error fetching collection:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+
+		query += " AND po.user_id IN (SELECT id_peserta FROM collection_items WHERE collection_id = ?)"
+		args = append(args, collectionID)
+
+		if masjidID != "all" {
+			ids := strings.Split(masjidID, ",")
+			query += " AND pt.id_masjid IN (?" + strings.Repeat(",?", len(ids)-1) + ")"
+			for _, id := range ids {
+				args = append(args, strings.TrimSpace(id))
+			}
+		}
+
+		var tags []string
+		for _, code := range strings.Split(trackingCode, ",") {
+			if tag, ok := collectionSholatMap[strings.TrimSpace(code)]; ok {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > 0 {
+			query += " AND po.tag IN (?" + strings.Repeat(",?", len(tags)-1) + ")"
+			for _, tag := range tags {
+				args = append(args, tag)
+			}
+		}
+	case "all":
+	default:
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "scope must be one of masjid, regional, collection, all"})
+	}
+
+	query += `
+		GROUP BY po.user_id, p.fullname, p.isHideName
+		ORDER BY total_point DESC, total_hadir DESC, po.user_id ASC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching leaderboard:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch leaderboard"})
+	}
+	defer rows.Close()
+
+	leaderboard := []LeaderboardEntry{}
+	for rows.Next() {
+		var e LeaderboardEntry
+		var isHideName bool
+		if err := rows.Scan(&e.UserID, &e.Fullname, &isHideName, &e.TotalPoint, &e.TotalHadir); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		e.Fullname = displayName(e.Fullname, isHideName)
+
+		// Poin sama dapat peringkat sama (1, 2, 2, 4)
+		e.Rank = len(leaderboard) + 1
+		if n := len(leaderboard); n > 0 && leaderboard[n-1].TotalPoint == e.TotalPoint {
+			e.Rank = leaderboard[n-1].Rank
+		}
+		leaderboard = append(leaderboard, e)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Success",
+		"event_id":  eventID,
+		"scope":     scope,
+		"id":        scopeID,
+		"date_from": dateFrom,
+		"date_to":   dateTo,
+		"data":      leaderboard,
+	})
+}
+
+// Handler untuk melihat aturan poin sebuah event
+func GetPoinRules(c *fiber.Ctx) error {
+	eventID, err := strconv.Atoi(c.Query("event_id", "3"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event_id"})
+	}
+
+	rules, err := services.LoadPoinRules(eventID)
+	if err != nil {
+		log.Println("Error fetching poin rules:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch poin rules"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    rules,
+	})
+}
+
+// Handler untuk mengubah aturan poin, opsional sekaligus menghitung ulang rentang tanggal
+func UpdatePoinRules(c *fiber.Ctx) error {
+	var req UpdatePoinRulesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	for _, rule := range req.Rules {
+		if rule.Tag == "" || rule.PointSholat < 0 || rule.ArrivalTopN < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid rule for tag " + rule.Tag})
+		}
+	}
+	// Recompute opsional, tapi kalau salah satu tanggal dikirim rentangnya harus valid
+	recompute := req.DateFrom != "" || req.DateTo != ""
+	if recompute && !validDateRange(req.DateFrom, req.DateTo) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date range. Use YYYY-MM-DD"})
+	}
+
+	before, err := services.LoadPoinRules(req.EventID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch poin rules"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	for _, rule := range req.Rules {
+		_, err := tx.Exec(`
+			INSERT INTO poin_rules (event_id, tag, point_sholat, arrival_top_n, active)
+			VALUES (?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE point_sholat = VALUES(point_sholat), arrival_top_n = VALUES(arrival_top_n), active = VALUES(active)`,
+			req.EventID, strings.ToLower(rule.Tag), rule.PointSholat, rule.ArrivalTopN, rule.Active)
+		if err != nil {
+			log.Println("Error saving poin rule:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save poin rules"})
+		}
+	}
+
+	recordAudit(c, tx, "poin_rules.update", "event", req.EventID, fiber.Map{"rules": before}, fiber.Map{"rules": req.Rules})
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save poin rules"})
+	}
+	services.InvalidatePoinRules()
+
+	response := fiber.Map{"message": "Poin rules updated successfully"}
+	if recompute {
+		total, err := services.RecomputePoin(req.EventID, req.DateFrom, req.DateTo)
+		if err != nil {
+			log.Println("Error recomputing poin:", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Rules saved but failed to recompute poin"})
+		}
+		response["recomputed"] = total
+	}
+
+	return c.JSON(response)
+}
+
+// Handler untuk menghitung ulang poin event dalam rentang tanggal
+func RecomputePoin(c *fiber.Ctx) error {
+	var req RecomputePoinRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+	}
+	if !validDateRange(req.DateFrom, req.DateTo) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid date range. Use YYYY-MM-DD"})
+	}
+
+	total, err := services.RecomputePoin(req.EventID, req.DateFrom, req.DateTo)
+	if err != nil {
+		log.Println("Error recomputing poin:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to recompute poin"})
+	}
+
+	recordAudit(c, database.DB, "poin.recompute", "event", req.EventID, nil, fiber.Map{
+		"date_from": req.DateFrom,
+		"date_to":   req.DateTo,
+		"total":     total,
+	})
+
+	return c.JSON(fiber.Map{
+		"message":    "Success",
+		"recomputed": total,
+	})
+}
@@ -0,0 +1,390 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReportScheduleRequest struct {
+	Name       string            `json:"name" validate:"required,max=100"`
+	Report     string            `json:"report" validate:"required"`
+	Params     map[string]string `json:"params"`
+	Format     string            `json:"format" validate:"required,oneof=xlsx csv pdf"`
+	CronExpr   string            `json:"cron_expr" validate:"required"`
+	Channel    string            `json:"channel" validate:"required,oneof=email webhook file"`
+	Target     string            `json:"target" validate:"max=500"`
+	MaxRetries int               `json:"max_retries" validate:"min=0,max=10"`
+	Active     *bool             `json:"active"`
+}
+
+type ReportRun struct {
+	ID          int64      `json:"id"`
+	ScheduleID  int        `json:"schedule_id"`
+	Status      string     `json:"status"`
+	Attempt     int        `json:"attempt"`
+	TriggerType string     `json:"trigger_type"`
+	FileName    string     `json:"file_name"`
+	Error       string     `json:"error"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	NextRetryAt *time.Time `json:"next_retry_at"`
+}
+
+// Laporan yang bisa dijadwalkan, memakai fetcher yang sama dengan endpoint-nya
+func init() {
+	services.RegisterReport("rekap_per_masjid", func(params map[string]string) (*utils.ExportTable, string, error) {
+		eventDate, err := resolveReportDate(params["date"], 1, utils.DefaultLocation())
+		if err != nil {
+			return nil, "", err
+		}
+		regionalID, _ := strconv.Atoi(params["regional_id"])
+		result, err := fetchRekapPerMasjid(eventDate, regionalID, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		return rekapPerMasjidTable(result, eventDate), "rekap-masjid-" + eventDate, nil
+	})
+
+	services.RegisterReport("rekap_sholat", func(params map[string]string) (*utils.ExportTable, string, error) {
+		tanggal, err := resolveReportDate(params["date"], 1, masjidLocation(params["id_masjid"]))
+		if err != nil {
+			return nil, "", err
+		}
+		result, err := fetchRekapSholat(params["id_masjid"], tanggal)
+		if err != nil {
+			return nil, "", err
+		}
+		return rekapSholatTable(result, params["id_masjid"], tanggal), fmt.Sprintf("rekap-sholat-%s-%s", params["id_masjid"], tanggal), nil
+	})
+
+	services.RegisterReport("rekap_absen", func(params map[string]string) (*utils.ExportTable, string, error) {
+		tanggal, err := resolveReportDate(params["date"], 1, masjidLocation(params["id_masjid"]))
+		if err != nil {
+			return nil, "", err
+		}
+		result, err := fetchRekapAbsen(params["id_masjid"], params["id_event"], tanggal, params["jam_min"], params["jam_max"])
+		if err != nil {
+			return nil, "", err
+		}
+		return rekapAbsenTable(result, params["id_masjid"], params["id_event"], tanggal), fmt.Sprintf("rekap-absen-%s-%s", params["id_masjid"], tanggal), nil
+	})
+
+	// Rekap sesi: tanggal kosong berarti kemunculan terakhir
+	services.RegisterReport("rekap_sesi", func(params map[string]string) (*utils.ExportTable, string, error) {
+		sessionID, err := strconv.Atoi(params["session_id"])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid session_id %q", params["session_id"])
+		}
+		tanggal := ""
+		if params["date"] != "" {
+			if tanggal, err = resolveReportDate(params["date"], 1, masjidLocation(params["id_masjid"])); err != nil {
+				return nil, "", err
+			}
+		}
+		occ, result, err := fetchRekapSesi(sessionID, params["id_masjid"], tanggal)
+		if err != nil {
+			return nil, "", err
+		}
+		return rekapSesiTable(occ, result, params["id_masjid"]), fmt.Sprintf("rekap-sesi-%d-%s", sessionID, occ.Tanggal), nil
+	})
+
+	services.RegisterReport("event_statistics", func(params map[string]string) (*utils.ExportTable, string, error) {
+		eventDate, err := resolveReportDate(params["date"], 1, utils.DefaultLocation())
+		if err != nil {
+			return nil, "", err
+		}
+		eventID, err := strconv.Atoi(params["event_id"])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid event_id %q", params["event_id"])
+		}
+		stats, err := fetchEventStatistics(eventID, eventDate)
+		if err != nil {
+			return nil, "", err
+		}
+		return eventStatisticsTable(stats), fmt.Sprintf("statistik-event-%d-%s", eventID, eventDate), nil
+	})
+
+	// Ringkasan collection: default 7 hari terakhir sampai kemarin
+	services.RegisterReport("collection", func(params map[string]string) (*utils.ExportTable, string, error) {
+		dateTo, err := resolveReportDate(params["date_to"], 1, utils.DefaultLocation())
+		if err != nil {
+			return nil, "", err
+		}
+		dateFrom := params["date_from"]
+		if dateFrom == "" {
+			days, _ := strconv.Atoi(params["days"])
+			if days < 1 {
+				days = 7
+			}
+			end, _ := time.Parse("2006-01-02", dateTo)
+			dateFrom = end.AddDate(0, 0, 1-days).Format("2006-01-02")
+		}
+		grid, err := fetchCollectionGrid(params["slug"], dateFrom, dateTo)
+		if err != nil {
+			return nil, "", err
+		}
+		return collectionGridTable(grid), fmt.Sprintf("collection-%s-%s-%s", params["slug"], dateFrom, dateTo), nil
+	})
+}
+
+// resolveReportDate menerima "today", "yesterday" atau YYYY-MM-DD; kosong berarti
+// defaultDaysAgo hari sebelum hari ini di zona loc
+func resolveReportDate(value string, defaultDaysAgo int, loc *time.Location) (string, error) {
+	today := time.Now().In(loc)
+	switch value {
+	case "":
+		return today.AddDate(0, 0, -defaultDaysAgo).Format("2006-01-02"), nil
+	case "today":
+		return today.Format("2006-01-02"), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1).Format("2006-01-02"), nil
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	return value, nil
+}
+
+// reportError meneruskan *fiber.Error (validasi) apa adanya, error lain menjadi 500
+func reportError(c *fiber.Ctx, err error, message string) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return c.Status(fe.Code).JSON(fiber.Map{"error": fe.Message})
+	}
+	log.Println(message+":", err)
+	return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": message})
+}
+
+// displayName menyamarkan nama peserta yang memilih disembunyikan
+func displayName(fullname string, hidden bool) string {
+	if hidden {
+		return "Hamba Allah"
+	}
+	return fullname
+}
+
+// masjidName mengambil nama masjid untuk judul laporan, fallback ke id-nya
+func masjidName(idMasjid string) string {
+	var nama string
+	if err := database.DB.QueryRow("SELECT nama FROM masjid WHERE id = ?", idMasjid).Scan(&nama); err != nil {
+		return idMasjid
+	}
+	return nama
+}
+
+// Handler untuk daftar jadwal laporan
+func GetReportSchedules(c *fiber.Ctx) error {
+	schedules, err := services.LoadReportSchedules(false)
+	if err != nil {
+		log.Println("Error fetching report schedules:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch report schedules"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    schedules,
+		"reports": services.ReportNames(),
+	})
+}
+
+// Handler untuk membuat jadwal laporan baru
+func CreateReportSchedule(c *fiber.Ctx) error {
+	schedule, ok := parseReportSchedule(c)
+	if !ok {
+		return nil
+	}
+
+	params, _ := json.Marshal(schedule.Params)
+	result, err := database.DB.Exec(`
+		INSERT INTO report_schedules (name, report, params, format, cron_expr, channel, target, max_retries, active, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schedule.Name, schedule.Report, string(params), schedule.Format, schedule.CronExpr, schedule.Channel,
+		schedule.Target, schedule.MaxRetries, schedule.Active, jwtUserID(c))
+	if err != nil {
+		log.Println("Error creating report schedule:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create report schedule"})
+	}
+	id, _ := result.LastInsertId()
+	schedule.ID = int(id)
+
+	recordAudit(c, database.DB, "report_schedule.create", "report_schedule", id, nil, schedule)
+	reloadReportSchedules()
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Report schedule created successfully",
+		"data":    schedule,
+	})
+}
+
+// Handler untuk mengubah jadwal laporan
+func UpdateReportSchedule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule id"})
+	}
+	before, err := services.LoadReportSchedule(id)
+	if err == services.ErrReportScheduleNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report schedule not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	schedule, ok := parseReportSchedule(c)
+	if !ok {
+		return nil
+	}
+	schedule.ID = id
+
+	params, _ := json.Marshal(schedule.Params)
+	_, err = database.DB.Exec(`
+		UPDATE report_schedules SET name = ?, report = ?, params = ?, format = ?, cron_expr = ?, channel = ?,
+			target = ?, max_retries = ?, active = ?
+		WHERE id = ?`,
+		schedule.Name, schedule.Report, string(params), schedule.Format, schedule.CronExpr, schedule.Channel,
+		schedule.Target, schedule.MaxRetries, schedule.Active, id)
+	if err != nil {
+		log.Println("Error updating report schedule:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update report schedule"})
+	}
+
+	recordAudit(c, database.DB, "report_schedule.update", "report_schedule", id, before, schedule)
+	reloadReportSchedules()
+
+	return c.JSON(fiber.Map{
+		"message": "Report schedule updated successfully",
+		"data":    schedule,
+	})
+}
+
+// Handler untuk menghapus jadwal laporan (riwayat run tetap disimpan)
+func DeleteReportSchedule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule id"})
+	}
+	before, err := services.LoadReportSchedule(id)
+	if err == services.ErrReportScheduleNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report schedule not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM report_schedules WHERE id = ?", id); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete report schedule"})
+	}
+
+	recordAudit(c, database.DB, "report_schedule.delete", "report_schedule", id, before, nil)
+	reloadReportSchedules()
+
+	return c.JSON(fiber.Map{"message": "Report schedule deleted successfully"})
+}
+
+// Handler untuk menjalankan jadwal laporan sekarang juga
+func RunReportSchedule(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule id"})
+	}
+
+	runID, err := services.RunReportSchedule(id, "manual")
+	if err == services.ErrReportScheduleNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Report schedule not found"})
+	} else if err != nil {
+		return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error(), "run_id": runID})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Report delivered successfully",
+		"run_id":  runID,
+	})
+}
+
+// Handler untuk riwayat run sebuah jadwal
+func GetReportRuns(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule id"})
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, schedule_id, status, attempt, trigger_type, file_name, COALESCE(error, ''), started_at, finished_at, next_retry_at
+		FROM report_runs WHERE schedule_id = ?
+		ORDER BY id DESC LIMIT 100`, id)
+	if err != nil {
+		log.Println("Error fetching report runs:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch report runs"})
+	}
+	defer rows.Close()
+
+	runs := []ReportRun{}
+	for rows.Next() {
+		var r ReportRun
+		var finishedAt, nextRetryAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.Status, &r.Attempt, &r.TriggerType, &r.FileName, &r.Error,
+			&r.StartedAt, &finishedAt, &nextRetryAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		if finishedAt.Valid {
+			r.FinishedAt = &finishedAt.Time
+		}
+		if nextRetryAt.Valid {
+			r.NextRetryAt = &nextRetryAt.Time
+		}
+		runs = append(runs, r)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    runs,
+	})
+}
+
+// parseReportSchedule membaca dan memvalidasi body jadwal; kalau tidak valid response
+// 400 sudah ditulis dan ok bernilai false
+func parseReportSchedule(c *fiber.Ctx) (*services.ReportSchedule, bool) {
+	var req ReportScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		return nil, false
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return nil, false
+	}
+
+	schedule := &services.ReportSchedule{
+		Name:       req.Name,
+		Report:     req.Report,
+		Params:     req.Params,
+		Format:     req.Format,
+		CronExpr:   req.CronExpr,
+		Channel:    req.Channel,
+		Target:     req.Target,
+		MaxRetries: req.MaxRetries,
+		Active:     req.Active == nil || *req.Active,
+	}
+	if schedule.Params == nil {
+		schedule.Params = map[string]string{}
+	}
+	if err := services.ValidateReportSchedule(*schedule); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return nil, false
+	}
+	return schedule, true
+}
+
+func reloadReportSchedules() {
+	if err := services.ReloadReportSchedules(); err != nil {
+		log.Println("Error reloading report schedules:", err)
+	}
+}
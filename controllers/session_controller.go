@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// start_at/end_at dikirim dalam waktu lokal masjid ("2006-01-02 15:04");
+// sesi tanpa masjid memakai zona default.
+type EventSessionRequest struct {
+	EventID         int    `json:"event_id" validate:"required"`
+	MasjidID        *int   `json:"masjid_id"`
+	Nama            string `json:"nama" validate:"required,max=150"`
+	Jenis           string `json:"jenis" validate:"required"`
+	StartAt         string `json:"start_at" validate:"required"`
+	EndAt           string `json:"end_at" validate:"required"`
+	Recurrence      string `json:"recurrence" validate:"omitempty,oneof=none daily weekly"`
+	RecurrenceUntil string `json:"recurrence_until"`
+	Capacity        *int   `json:"capacity"`
+	Active          *bool  `json:"active"`
+}
+
+// Handler untuk daftar sesi aktif event, ?masjid_id= untuk sesi yang berlaku di satu masjid
+func GetEventSessions(c *fiber.Ctx) error {
+	return listEventSessions(c, true)
+}
+
+// Handler admin untuk daftar semua sesi, termasuk yang tidak aktif
+func GetAdminEventSessions(c *fiber.Ctx) error {
+	return listEventSessions(c, false)
+}
+
+func listEventSessions(c *fiber.Ctx, activeOnly bool) error {
+	eventID, _ := strconv.Atoi(c.Query("event_id"))
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id"))
+
+	sessions, err := services.LoadSessions(eventID, masjidID, activeOnly)
+	if err != nil {
+		log.Println("Error fetching event sessions:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	now := time.Now()
+	for i, s := range sessions {
+		if next := s.NextOccurrenceAfter(now, s.Location()); next != nil {
+			sessions[i].NextOccurrence = &next.StartAt
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    sessions,
+		"jenis":   services.SessionJenis,
+	})
+}
+
+// Handler untuk membuat sesi terjadwal
+func CreateEventSession(c *fiber.Ctx) error {
+	s, ok := parseEventSession(c)
+	if !ok {
+		return nil
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO event_sessions (event_id, masjid_id, nama, jenis, start_at, end_at, recurrence, recurrence_until, capacity, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.EventID, s.MasjidID, s.Nama, s.Jenis, s.StartAt, s.EndAt, s.Recurrence, s.RecurrenceUntil, s.Capacity, s.Active)
+	if err != nil {
+		log.Println("Error creating event session:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create session"})
+	}
+	id, _ := result.LastInsertId()
+	s.ID = int(id)
+
+	recordAudit(c, database.DB, "session.create", "event_session", id, nil, s)
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Session created successfully",
+		"data":    s,
+	})
+}
+
+// Handler untuk mengubah sesi. Absensi yang sudah tercatat tetap menunjuk ke sesi ini.
+func UpdateEventSession(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session id"})
+	}
+
+	before, err := services.LoadSession(id)
+	if err == services.ErrSessionNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	after, ok := parseEventSession(c)
+	if !ok {
+		return nil
+	}
+	after.ID = id
+	after.CreatedAt = before.CreatedAt
+
+	_, err = database.DB.Exec(`
+		UPDATE event_sessions SET event_id = ?, masjid_id = ?, nama = ?, jenis = ?, start_at = ?, end_at = ?,
+			recurrence = ?, recurrence_until = ?, capacity = ?, active = ?
+		WHERE id = ?`,
+		after.EventID, after.MasjidID, after.Nama, after.Jenis, after.StartAt, after.EndAt,
+		after.Recurrence, after.RecurrenceUntil, after.Capacity, after.Active, id)
+	if err != nil {
+		log.Println("Error updating event session:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update session"})
+	}
+
+	recordAudit(c, database.DB, "session.update", "event_session", id, before, after)
+
+	return c.JSON(fiber.Map{
+		"message": "Session updated successfully",
+		"data":    after,
+	})
+}
+
+// Handler untuk menghapus sesi. Sesi yang sudah punya absensi tidak bisa dihapus,
+// nonaktifkan saja supaya rekapnya tetap ada.
+func DeleteEventSession(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session id"})
+	}
+
+	before, err := services.LoadSession(id)
+	if err == services.ErrSessionNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	var used bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM absensi WHERE session_id = ?)", id).Scan(&used); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if used {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": "Session already has attendance, deactivate it instead"})
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM event_sessions WHERE id = ?", id); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete session"})
+	}
+
+	recordAudit(c, database.DB, "session.delete", "event_session", id, before, nil)
+
+	return c.JSON(fiber.Map{"message": "Session deleted successfully"})
+}
+
+// Handler untuk rekap absensi satu kemunculan sesi. ?tanggal= memilih kemunculan
+// sesi berulang (default kemunculan terakhir), ?masjid_id= membatasi ke satu masjid
+// untuk sesi yang berlaku di semua masjid.
+func GetRekapSesi(c *fiber.Ctx) error {
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
+	sessionID, err := strconv.Atoi(c.Params("id_session"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session id"})
+	}
+
+	occ, rekapList, err := fetchRekapSesi(sessionID, c.Query("masjid_id"), c.Query("tanggal"))
+	if err != nil {
+		return reportError(c, err, "Failed to fetch rekap sesi")
+	}
+
+	if format != "" {
+		return utils.SendExport(c, format, fmt.Sprintf("rekap-sesi-%d-%s", sessionID, occ.Tanggal), rekapSesiTable(occ, rekapList, c.Query("masjid_id")))
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Success",
+		"session":    occ,
+		"data":       rekapList,
+		"attendance": len(rekapList),
+	})
+}
+
+// fetchRekapSesi mengambil peserta yang absen di satu kemunculan sesi, dengan jam
+// scan pertamanya. idMasjid kosong berarti semua masjid.
+func fetchRekapSesi(sessionID int, idMasjid, tanggal string) (*services.SessionOccurrence, []RekapAbsen, error) {
+	occ, query, args, err := rekapSesiQuery(sessionID, idMasjid, tanggal)
+	if err != nil {
+		return nil, nil, err
+	}
+	rekapList, err := queryRekapAbsen(query+" ORDER BY jam ASC", args)
+	return occ, rekapList, err
+}
+
+// rekapSesiQuery menyusun query rekap satu kemunculan sesi (satu baris per
+// peserta, tanpa ORDER BY) supaya bisa dipakai utuh untuk export atau dipaging.
+func rekapSesiQuery(sessionID int, idMasjid, tanggal string) (*services.SessionOccurrence, string, []interface{}, error) {
+	session, err := services.LoadSession(sessionID)
+	if err == services.ErrSessionNotFound {
+		return nil, "", nil, fiber.NewError(http.StatusNotFound, "Session not found")
+	} else if err != nil {
+		return nil, "", nil, err
+	}
+
+	loc := session.Location()
+	if idMasjid != "" {
+		loc = masjidLocation(idMasjid)
+	}
+	occ := session.LatestOccurrence(time.Now(), loc)
+	if tanggal != "" {
+		if occ, err = session.OccurrenceOn(tanggal, loc); err != nil {
+			return nil, "", nil, fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	query := `
+		SELECT absensi.user_id, COALESCE(peserta.fullname, '') AS fullname, MIN(absensi.created_at) AS jam, peserta.isHideName
+		FROM absensi
+		LEFT JOIN petugas ON absensi.mesin_id = petugas.id_user
+		LEFT JOIN peserta ON absensi.user_id = peserta.id
+		WHERE absensi.session_id = ? AND absensi.voided_at IS NULL
+		AND absensi.created_at >= ? AND absensi.created_at < ?`
+	args := []interface{}{sessionID, occ.StartAt, occ.EndAt}
+	if idMasjid != "" {
+		query += " AND petugas.id_masjid = ?"
+		args = append(args, idMasjid)
+	}
+	query += " GROUP BY absensi.user_id, peserta.fullname, peserta.isHideName"
+	return occ, query, args, nil
+}
+
+func rekapSesiTable(occ *services.SessionOccurrence, rekapList []RekapAbsen, idMasjid string) *utils.ExportTable {
+	loc := occ.Session.Location()
+	masjid := "Semua masjid"
+	if idMasjid != "" {
+		loc = masjidLocation(idMasjid)
+		masjid = masjidName(idMasjid)
+	}
+	table := &utils.ExportTable{
+		Title: "Rekap Sesi " + occ.Session.Nama,
+		Meta: []string{
+			"Masjid: " + masjid,
+			"Jenis: " + occ.Session.Jenis,
+			"Waktu: " + occ.StartAt.In(loc).Format("2006-01-02 15:04") + " - " + occ.EndAt.In(loc).Format("15:04") + " " + utils.ZoneAbbr(loc),
+		},
+		Headers: []string{"No", "Nama", "Jam (" + utils.ZoneAbbr(loc) + ")"},
+	}
+	for i, r := range rekapList {
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(i + 1),
+			displayName(r.Fullname, r.IsHideName == 1),
+			r.Jam.In(loc).Format("2006-01-02 15:04"),
+		})
+	}
+	total := strconv.Itoa(len(rekapList))
+	if occ.Session.Capacity != nil {
+		total += " / " + strconv.Itoa(*occ.Session.Capacity)
+	}
+	table.Totals = []string{"", "Total", total}
+	return table
+}
+
+// parseEventSession membaca dan memvalidasi body sesi, lalu mengubah waktu lokal
+// masjid ke UTC; kalau tidak valid response 400 sudah ditulis dan ok bernilai false
+func parseEventSession(c *fiber.Ctx) (*services.EventSession, bool) {
+	var req EventSessionRequest
+	if err := c.BodyParser(&req); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		return nil, false
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return nil, false
+	}
+
+	s := services.EventSession{
+		EventID:    req.EventID,
+		MasjidID:   req.MasjidID,
+		Nama:       req.Nama,
+		Jenis:      req.Jenis,
+		Recurrence: req.Recurrence,
+		Capacity:   req.Capacity,
+		Active:     req.Active == nil || *req.Active,
+	}
+	if s.Recurrence == "" {
+		s.Recurrence = "none"
+	}
+	if s.MasjidID != nil {
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM masjid WHERE id = ?)", *s.MasjidID).Scan(&exists); err != nil || !exists {
+			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Masjid not found"})
+			return nil, false
+		}
+	}
+
+	loc := s.Location()
+	startAt, err := time.ParseInLocation("2006-01-02 15:04", req.StartAt, loc)
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid start_at. Use YYYY-MM-DD HH:MM"})
+		return nil, false
+	}
+	endAt, err := time.ParseInLocation("2006-01-02 15:04", req.EndAt, loc)
+	if err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid end_at. Use YYYY-MM-DD HH:MM"})
+		return nil, false
+	}
+	s.StartAt, s.EndAt = startAt.UTC(), endAt.UTC()
+
+	if req.RecurrenceUntil != "" {
+		if s.Recurrence == "none" {
+			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "recurrence_until requires daily or weekly recurrence"})
+			return nil, false
+		}
+		if _, err := time.Parse("2006-01-02", req.RecurrenceUntil); err != nil {
+			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid recurrence_until. Use YYYY-MM-DD"})
+			return nil, false
+		}
+		s.RecurrenceUntil = &req.RecurrenceUntil
+	}
+
+	if err := services.ValidateSession(s); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return nil, false
+	}
+	return &s, true
+}
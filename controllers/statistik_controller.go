@@ -1,10 +1,12 @@
 package controllers
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
 	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
 	"strconv"
 	"time"
 
@@ -29,7 +31,7 @@ func GetNewRegistrantStatistics(c *fiber.Ctx) error {
     COALESCE(COUNT(DISTINCT peserta.id), 0) AS total_count
 		FROM masjid m
 		LEFT JOIN peserta ON m.id = peserta.masjid_id
-				AND DATE(CONVERT_TZ(peserta.created_at, '+00:00', '+07:00')) = DATE(?)
+				AND DATE(`+services.MasjidLocalTimeSQL("peserta.created_at", "m.id")+`) = DATE(?)
 		left JOIN setting on setting.id_masjid = m.id
 		where setting.id_event = ?
 		GROUP BY m.id, m.nama
@@ -70,139 +72,68 @@ func GetNewRegistrantStatistics(c *fiber.Ctx) error {
 
 }
 
+// GetAbsensiStatistics menghitung peserta unik hari itu di semua masjid (atau satu
+// regional); peserta yang scan di dua masjid tetap dihitung satu kali
 func GetAbsensiStatistics(c *fiber.Ctx) error {
 	tanggal := c.Query("tanggal")
 	if tanggal == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "tanggal is required"})
 	}
 
-	regionalID := c.Query("regional_id")
-	regionalFilter := ""
-	if regionalID != "" {
-		regionalFilter = "AND m.regional_id = ?"
+	if _, err := time.Parse("2006-01-02", tanggal); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid tanggal, use YYYY-MM-DD"})
 	}
 
-	query := fmt.Sprintf(`
-		SELECT
-			tag_clean AS tag,
-			kategori,
-			COUNT(DISTINCT user_tag_date) AS jumlah,
-			total.total_peserta,
-			gender.jumlah_pria,
-			gender.jumlah_wanita,
-			all_peserta.total_peserta_terdaftar
-		FROM (
-			SELECT
-				a.user_id,
-				DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) AS tgl_wib,
-				LOWER(TRIM(a.tag)) AS tag_clean,
-				CONCAT(a.user_id, '-', LOWER(TRIM(a.tag)), '-', DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00'))) AS user_tag_date,
-				CASE
-					WHEN STR_TO_DATE(p.dob, '%%Y-%%m-%%d') IS NULL THEN 'umum'
-					WHEN TIMESTAMPDIFF(YEAR, STR_TO_DATE(p.dob, '%%Y-%%m-%%d'), CURDATE()) <= 17 THEN 'pelajar'
-					ELSE 'umum'
-				END AS kategori
-			FROM absensi a
-			JOIN peserta p ON a.user_id = p.id
-			JOIN petugas pt ON a.mesin_id = pt.id_user
-			JOIN masjid m ON pt.id_masjid = m.id
-			JOIN detail_peserta dp ON dp.id_peserta = p.id
-			WHERE dp.id_event = 3
-				AND LOWER(TRIM(a.tag)) IN ('subuh', 'dzuhur', 'ashar', 'maghrib', 'isya')
-				AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) = ?
-				%s
-		) AS absen_clean
-		JOIN (
-			SELECT COUNT(DISTINCT a.user_id) AS total_peserta
-			FROM absensi a
-			JOIN petugas pt ON a.mesin_id = pt.id_user
-			JOIN masjid m ON pt.id_masjid = m.id
-			JOIN peserta p ON a.user_id = p.id
-			JOIN detail_peserta dp ON dp.id_peserta = p.id
-			WHERE dp.id_event = 3
-				AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) = ?
-				%s
-		) AS total ON 1=1
-		JOIN (
-			SELECT
-				SUM(CASE
-					WHEN LOWER(TRIM(p.gender)) IN ('laki-laki', 'male', 'lk', 'pria') THEN 1
-					ELSE 0
-				END) AS jumlah_pria,
-				SUM(CASE
-					WHEN LOWER(TRIM(p.gender)) IN ('perempuan', 'female', 'wanita') THEN 1
-					ELSE 0
-				END) AS jumlah_wanita
-			FROM (
-				SELECT DISTINCT a.user_id
-				FROM absensi a
-				JOIN petugas pt ON a.mesin_id = pt.id_user
-				JOIN masjid m ON pt.id_masjid = m.id
-				JOIN peserta p ON a.user_id = p.id
-				JOIN detail_peserta dp ON dp.id_peserta = p.id
-				WHERE dp.id_event = 3
-					AND DATE(CONVERT_TZ(a.created_at, '+00:00', '+07:00')) = ?
-					%s
-			) absen_unik
-			JOIN peserta p ON p.id = absen_unik.user_id
-		) AS gender ON 1=1
-		JOIN (
-			SELECT COUNT(*) AS total_peserta_terdaftar
-			FROM detail_peserta dp
-			JOIN peserta p ON dp.id_peserta = p.id
-			JOIN masjid m ON p.masjid_id = m.id
-			WHERE dp.id_event = 3
-			%s
-		) AS all_peserta ON 1=1
-		GROUP BY tag, kategori;
-	`, regionalFilter, regionalFilter, regionalFilter, regionalFilter)
-
-	var rows *sql.Rows
-	var err error
-
-	if regionalID != "" {
-		rows, err = database.DB.Query(query,
-			tanggal, regionalID,
-			tanggal, regionalID,
-			tanggal, regionalID,
-			regionalID,
-		)
-	} else {
-		rows, err = database.DB.Query(query,
-			tanggal,
-			tanggal,
-			tanggal,
-		)
+	regionalID := c.Query("regional_id")
+	regional, err := strconv.Atoi(regionalID)
+	if regionalID != "" && err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid regional_id"})
 	}
 
+	counts, err := services.DailyUniqueCounts(tanggal, 3, regional)
 	if err != nil {
 		log.Println("Query error:", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
-	defer rows.Close()
 
 	statistik := map[string]map[string]int{}
+	// Sholat per gender, supaya jumat (umumnya laki-laki) bisa dibaca terpisah dari dzuhur
+	statistikGender := map[string]map[string]int{}
 	var totalHadir, totalTerdaftar, jumlahPria, jumlahWanita int
-	for rows.Next() {
-		var tag, kategori string
-		var jumlah, pesertaHadir, pesertaTerdaftar, pria, wanita int
-
-		if err := rows.Scan(&tag, &kategori, &jumlah, &pesertaHadir, &pria, &wanita, &pesertaTerdaftar); err != nil {
-			log.Println("Scan error:", err)
+	for key, jumlah := range counts {
+		tag, gender, kategori := key.Tag, key.Gender, key.Kategori
+		if tag == services.CounterAllTags {
+			totalHadir += jumlah
+			switch gender {
+			case "male":
+				jumlahPria += jumlah
+			case "female":
+				jumlahWanita += jumlah
+			}
 			continue
 		}
-
-		if totalHadir == 0 {
-			totalHadir = pesertaHadir
-			totalTerdaftar = pesertaTerdaftar
-			jumlahPria = pria
-			jumlahWanita = wanita
+		if !isSholatTag(tag) {
+			continue
 		}
-
 		if _, exists := statistik[tag]; !exists {
 			statistik[tag] = map[string]int{}
+			statistikGender[tag] = map[string]int{}
 		}
-		statistik[tag][kategori] = jumlah
+		statistik[tag][kategori] += jumlah
+		statistikGender[tag][gender] += jumlah
+	}
+
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM detail_peserta dp
+		JOIN peserta p ON dp.id_peserta = p.id
+		JOIN masjid m ON p.masjid_id = m.id
+		WHERE dp.id_event = 3 AND dp.status = 1
+			AND (? = '' OR m.regional_id = ?)`,
+		regionalID, regionalID).Scan(&totalTerdaftar)
+	if err != nil {
+		log.Println("Query error:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
 
 	return c.JSON(fiber.Map{
@@ -213,9 +144,23 @@ func GetAbsensiStatistics(c *fiber.Ctx) error {
 		"jumlah_pria":             jumlahPria,
 		"jumlah_wanita":           jumlahWanita,
 		"statistik_per_sholat":    statistik,
+		"statistik_per_gender":    statistikGender,
 	})
 }
 
+// isSholatTag mengecek tag lima waktu atau jumat
+func isSholatTag(tag string) bool {
+	if tag == jumatTag {
+		return true
+	}
+	for _, t := range dailySholatTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // backup final
 // func GetAbsensiStatistics(c *fiber.Ctx) error {
 // 	tanggal := c.Query("tanggal")
@@ -404,120 +349,29 @@ func GetAbsensiStatistics(c *fiber.Ctx) error {
 // 	})
 // }
 
-// func GetEventStatistics(c *fiber.Ctx) error {
-// 	// Ambil event_id dari query parameter
-// 	eventIDStr := c.Query("event_id")
-// 	eventID, err := strconv.Atoi(eventIDStr)
-// 	if err != nil || eventID == 0 {
-// 		return c.Status(400).JSON(fiber.Map{"error": "event_id is required"})
-// 	}
-
-// 	// Variabel untuk menyimpan hasil query
-// 	var totalPeserta, totalAbsen, totalMale, totalFemale int
-// 	var persenHadir float64
-
-// 	// Query untuk mengambil statistik utama
-// 	query := `
-// 		SELECT
-// 			COALESCE(total_peserta, 0) AS total_peserta,
-// 			COALESCE(total_absen, 0) AS total_absen,
-// 			COALESCE(total_male, 0) AS total_male,
-// 			COALESCE(total_female, 0) AS total_female,
-// 			COALESCE((total_absen / NULLIF(total_peserta, 0) * 100), 0) AS persen_hadir
-// 		FROM (
-// 			SELECT
-// 				(SELECT COUNT(*)
-// 				 FROM peserta
-// 				 LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-// 				 WHERE id_event = ?) AS total_peserta,
-
-// 				(SELECT COUNT(DISTINCT user_id)
-// 				 FROM absensi
-// 				 WHERE event_id = ?
-// 				 AND DATE(CONVERT_TZ(created_at, '+00:00', '+07:00')) = DATE(CONVERT_TZ(NOW(), '+00:00', '+07:00'))) AS total_absen,
-
-// 				(SELECT COUNT(*)
-// 				 FROM peserta
-// 				 LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-// 				 WHERE id_event = ? AND gender = 'male') AS total_male,
-
-// 				(SELECT COUNT(*)
-// 				 FROM peserta
-// 				 LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-// 				 WHERE id_event = ? AND gender = 'female') AS total_female
-// 		) AS stats;
-// 	`
-
-// 	err = database.DB.QueryRow(query, eventID, eventID, eventID, eventID).Scan(&totalPeserta, &totalAbsen, &totalMale, &totalFemale, &persenHadir)
-// 	if err != nil {
-// 		log.Println("Error fetching event statistics:", err)
-// 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch event statistics"})
-// 	}
-
-// 	masjidStats := []map[string]interface{}{}
-// 	rows, err := database.DB.Query(`
-// 			SELECT
-// 					m.id AS masjid_id,
-// 					m.nama AS masjid_nama,
-// 					m.alamat,
-// 					regional.nama as nama_regional,
-// 					COALESCE(COUNT(DISTINCT CASE WHEN peserta.gender = 'male' THEN absensi.user_id END), 0) AS male_count,
-// 					COALESCE(COUNT(DISTINCT CASE WHEN peserta.gender = 'female' THEN absensi.user_id END), 0) AS female_count,
-// 					COALESCE(COUNT(DISTINCT absensi.user_id), 0) AS total_count
-// 			FROM masjid m
-// 			LEFT JOIN regional ON regional.id = m.regional_id
-// 			LEFT JOIN setting on setting.id_masjid = m.id
-// 			LEFT JOIN petugas p ON p.id_masjid = m.id
-// 			LEFT JOIN absensi ON p.id_user = absensi.mesin_id
-// 					AND absensi.event_id = ?
-// 					AND DATE(CONVERT_TZ(absensi.created_at, '+00:00', '+07:00')) = DATE(CONVERT_TZ(NOW(), '+00:00', '+07:00'))
-// 			LEFT JOIN peserta ON absensi.user_id = peserta.id
-// 			where setting.id_event = ?
-// 			GROUP BY m.id, m.nama
-// 			ORDER BY total_count DESC
-// 	`, eventID, eventID)
-
-// 	if err != nil {
-// 		log.Println("Error fetching masjid attendance statistics:", err)
-// 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch masjid attendance statistics"})
-// 	}
-// 	defer rows.Close()
-
-// 	// Menyimpan hasil query masjid
-// 	for rows.Next() {
-// 		var masjidID int
-// 		var masjidNama string
-// 		var masjidAlamat string
-// 		var masjidRegional string
-// 		var maleCount, femaleCount, totalCount int
-
-// 		if err := rows.Scan(&masjidID, &masjidNama, &masjidAlamat, &masjidRegional, &maleCount, &femaleCount, &totalCount); err != nil {
-// 			log.Println("Error scanning masjid row:", err)
-// 			continue
-// 		}
-
-// 		masjidStats = append(masjidStats, map[string]interface{}{
-// 			"masjid_id":       masjidID,
-// 			"masjid_nama":     masjidNama,
-// 			"masjid_alamat":   masjidAlamat,
-// 			"masjid_regional": masjidRegional,
-// 			"male_count":      maleCount,
-// 			"female_count":    femaleCount,
-// 			"total_count":     totalCount,
-// 		})
-// 	}
+// EventMasjidStat adalah jumlah hadir satu masjid untuk GetEventStatistics
+type EventMasjidStat struct {
+	MasjidID       int    `json:"masjid_id"`
+	MasjidNama     string `json:"masjid_nama"`
+	MasjidAlamat   string `json:"masjid_alamat"`
+	MasjidRegional string `json:"masjid_regional"`
+	MaleCount      int    `json:"male_count"`
+	FemaleCount    int    `json:"female_count"`
+	TotalCount     int    `json:"total_count"`
+}
 
-// 	// Return response JSON
-// 	return c.JSON(fiber.Map{
-// 		"event_id":      eventID,
-// 		"total_peserta": totalPeserta,
-// 		"total_absen":   totalAbsen,
-// 		"total_male":    totalMale,
-// 		"total_female":  totalFemale,
-// 		"persen_hadir":  persenHadir,
-// 		"masjid_stats":  masjidStats, // Data untuk bar chart
-// 	})
-// }
+type EventStatistics struct {
+	EventID      int               `json:"event_id"`
+	EventDate    string            `json:"event_date"`
+	TotalPeserta int               `json:"total_peserta"`
+	TotalAbsen   int               `json:"total_absen"`
+	TotalMale    int               `json:"total_male"`
+	TotalFemale  int               `json:"total_female"`
+	PersenHadir  float64           `json:"persen_hadir"`
+	MasjidStats  []EventMasjidStat `json:"masjid_stats"`
+
+	Demografi []services.DemographicCount `json:"demografi,omitempty"`
+}
 
 func GetEventStatistics(c *fiber.Ctx) error {
 	// Ambil event_id dari query parameter
@@ -527,29 +381,58 @@ func GetEventStatistics(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "event_id is required"})
 	}
 
-	// Ambil event_date dari query parameter, default ke hari ini jika tidak dikirim
+	// Ambil event_date dari query parameter, default ke hari ini (WIB) jika tidak dikirim
 	eventDate := c.Query("event_date")
 	if eventDate == "" {
-		eventDate = time.Now().Format("2006-01-02") // Format YYYY-MM-DD
+		eventDate = utils.Today(utils.DefaultLocation()) // Format YYYY-MM-DD
 	}
 
-	// Menentukan rentang waktu berdasarkan event_id
-	var timeCondition string
-	if eventID == 2 {
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
+
+	stats, err := fetchEventStatistics(eventID, eventDate)
+	if err != nil {
+		return reportError(c, err, "Failed to fetch event statistics")
+	}
+	if c.QueryBool("demografi") {
+		if stats.Demografi, err = fetchEventDemographics(eventID, eventDate); err != nil {
+			return reportError(c, err, "Failed to fetch event demographics")
+		}
+	}
+
+	if format != "" {
+		return utils.SendExport(c, format, fmt.Sprintf("statistik-event-%d-%s", eventID, eventDate), eventStatisticsTable(stats))
+	}
+
+	return c.JSON(stats)
+}
+
+// eventTimeCondition menentukan rentang waktu absensi satu hari event beserta
+// parameternya, dievaluasi di zona waktu masjid tempat scan. Kondisi memakai nama
+// tabel absensi tanpa alias.
+func eventTimeCondition(eventID int, eventDate string) (string, []interface{}) {
+	localTime := services.AbsensiLocalTimeSQL("absensi")
+	if overnightEvents[eventID] {
 		// Rentang waktu dari jam 19:00 event_date sampai 06:00 event_date +1
-		timeCondition = `
+		return `
 			(
-				CONVERT_TZ(absensi.created_at, '+00:00', '+07:00')
+				` + localTime + `
 				BETWEEN CONCAT(?, ' 19:00:00')
 				AND CONCAT(DATE_ADD(?, INTERVAL 1 DAY), ' 06:00:00')
 			)
-		`
-	} else {
-		// Rentang waktu berdasarkan tanggal normal
-		timeCondition = `
-			DATE(absensi.created_at) = DATE(?)
-		`
+		`, []interface{}{eventDate, eventDate}
 	}
+	// Rentang waktu berdasarkan tanggal lokal
+	return `
+			DATE(` + localTime + `) = DATE(?)
+		`, []interface{}{eventDate}
+}
+
+func fetchEventStatistics(eventID int, eventDate string) (*EventStatistics, error) {
+	// Menentukan rentang waktu berdasarkan event_id
+	timeCondition, timeArgs := eventTimeCondition(eventID, eventDate)
 
 	// Query untuk mengambil statistik utama
 	query := fmt.Sprintf(`
@@ -563,36 +446,30 @@ func GetEventStatistics(c *fiber.Ctx) error {
 			SELECT
 				(SELECT COUNT(*) FROM peserta
 				 LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-				 WHERE id_event = ?) AS total_peserta,
+				 WHERE id_event = ? AND detail_peserta.status = 1) AS total_peserta,
 
 				(SELECT COUNT(DISTINCT user_id) FROM absensi
-				 WHERE event_id = ? AND %s) AS total_absen,
+				 WHERE event_id = ? AND voided_at IS NULL AND %s) AS total_absen,
 
 				(SELECT COUNT(*) FROM peserta
 				 LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-				 WHERE id_event = ? AND gender = 'male') AS total_male,
+				 WHERE id_event = ? AND detail_peserta.status = 1 AND gender = 'male') AS total_male,
 
 				(SELECT COUNT(*) FROM peserta
 				 LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-				 WHERE id_event = ? AND gender = 'female') AS total_female
+				 WHERE id_event = ? AND detail_peserta.status = 1 AND gender = 'female') AS total_female
 		) AS stats;
 	`, timeCondition)
 
-	var totalPeserta, totalAbsen, totalMale, totalFemale int
-	var persenHadir float64
-
-	if eventID == 2 {
-		err = database.DB.QueryRow(query, eventID, eventID, eventDate, eventDate, eventID, eventID).Scan(&totalPeserta, &totalAbsen, &totalMale, &totalFemale, &persenHadir)
-	} else {
-		err = database.DB.QueryRow(query, eventID, eventID, eventDate, eventID, eventID).Scan(&totalPeserta, &totalAbsen, &totalMale, &totalFemale, &persenHadir)
-	}
+	stats := &EventStatistics{EventID: eventID, EventDate: eventDate, MasjidStats: []EventMasjidStat{}}
 
+	args := append([]interface{}{eventID, eventID}, timeArgs...)
+	args = append(args, eventID, eventID)
+	err := database.DB.QueryRow(query, args...).Scan(&stats.TotalPeserta, &stats.TotalAbsen, &stats.TotalMale, &stats.TotalFemale, &stats.PersenHadir)
 	if err != nil {
-		log.Println("Error fetching event statistics:", err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch event statistics"})
+		return nil, err
 	}
 
-	masjidStats := []map[string]interface{}{}
 	masjidQuery := fmt.Sprintf(`
 		SELECT
 			m.id AS masjid_id,
@@ -608,6 +485,7 @@ func GetEventStatistics(c *fiber.Ctx) error {
 		LEFT JOIN petugas p ON p.id_masjid = m.id
 		LEFT JOIN absensi ON p.id_user = absensi.mesin_id
 			AND absensi.event_id = ?
+			AND absensi.voided_at IS NULL
 			AND %s
 		LEFT JOIN peserta ON absensi.user_id = peserta.id
 		WHERE setting.id_event = ?
@@ -615,50 +493,88 @@ func GetEventStatistics(c *fiber.Ctx) error {
 		ORDER BY total_count DESC;
 	`, timeCondition)
 
-	var rows *sql.Rows
-	if eventID == 2 {
-		rows, err = database.DB.Query(masjidQuery, eventID, eventDate, eventDate, eventID)
-	} else {
-		rows, err = database.DB.Query(masjidQuery, eventID, eventDate, eventID)
-	}
-
+	args = append([]interface{}{eventID}, timeArgs...)
+	args = append(args, eventID)
+	rows, err := database.DB.Query(masjidQuery, args...)
 	if err != nil {
-		log.Println("Error fetching masjid attendance statistics:", err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch masjid attendance statistics"})
+		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var masjidID int
-		var masjidNama, masjidAlamat, masjidRegional string
-		var maleCount, femaleCount, totalCount int
-
-		if err := rows.Scan(&masjidID, &masjidNama, &masjidAlamat, &masjidRegional, &maleCount, &femaleCount, &totalCount); err != nil {
+		var ms EventMasjidStat
+		if err := rows.Scan(&ms.MasjidID, &ms.MasjidNama, &ms.MasjidAlamat, &ms.MasjidRegional, &ms.MaleCount, &ms.FemaleCount, &ms.TotalCount); err != nil {
 			log.Println("Error scanning masjid row:", err)
 			continue
 		}
+		stats.MasjidStats = append(stats.MasjidStats, ms)
+	}
 
-		masjidStats = append(masjidStats, map[string]interface{}{
-			"masjid_id":       masjidID,
-			"masjid_nama":     masjidNama,
-			"masjid_alamat":   masjidAlamat,
-			"masjid_regional": masjidRegional,
-			"male_count":      maleCount,
-			"female_count":    femaleCount,
-			"total_count":     totalCount,
-		})
+	return stats, nil
+}
+
+// fetchEventDemographics menghitung peserta hadir per sholat x gender x kelompok
+// umur pada satu hari event. Umur dihitung pada event_date.
+func fetchEventDemographics(eventID int, eventDate string) ([]services.DemographicCount, error) {
+	timeCondition, timeArgs := eventTimeCondition(eventID, eventDate)
+
+	// Disusun dengan konkatenasi karena ekspresi umur mengandung '%Y'
+	query := `
+		SELECT tag, gender, kategori, COUNT(DISTINCT user_id)
+		FROM (
+			SELECT absensi.user_id,
+				LOWER(TRIM(COALESCE(absensi.tag, ''))) AS tag,
+				COALESCE(peserta.gender, '` + services.GenderUnknown + `') AS gender,
+				` + services.AgeBracketSQL("peserta.dob", "DATE(?)") + ` AS kategori
+			FROM absensi
+			LEFT JOIN peserta ON absensi.user_id = peserta.id
+			WHERE absensi.event_id = ? AND absensi.voided_at IS NULL AND ` + timeCondition + `
+		) src
+		GROUP BY tag, gender, kategori`
+
+	args := append([]interface{}{eventDate, eventID}, timeArgs...)
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return c.JSON(fiber.Map{
-		"event_id":      eventID,
-		"event_date":    eventDate,
-		"total_peserta": totalPeserta,
-		"total_absen":   totalAbsen,
-		"total_male":    totalMale,
-		"total_female":  totalFemale,
-		"persen_hadir":  persenHadir,
-		"masjid_stats":  masjidStats,
-	})
+	result := []services.DemographicCount{}
+	for rows.Next() {
+		var d services.DemographicCount
+		if err := rows.Scan(&d.Tag, &d.Gender, &d.Kategori, &d.Jumlah); err != nil {
+			return nil, err
+		}
+		result = append(result, d)
+	}
+	services.SortDemographics(result)
+	return result, rows.Err()
+}
+
+func eventStatisticsTable(stats *EventStatistics) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title: "Statistik Event",
+		Meta: []string{
+			fmt.Sprintf("Event: %d", stats.EventID),
+			"Tanggal: " + stats.EventDate,
+			fmt.Sprintf("Total peserta: %d (laki-laki %d, perempuan %d)", stats.TotalPeserta, stats.TotalMale, stats.TotalFemale),
+			fmt.Sprintf("Total hadir: %d (%.1f%%)", stats.TotalAbsen, stats.PersenHadir),
+		},
+		Headers: []string{"No", "Masjid", "Alamat", "Regional", "Laki-laki", "Perempuan", "Total"},
+	}
+
+	var male, female, total int
+	for i, ms := range stats.MasjidStats {
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(i + 1), ms.MasjidNama, ms.MasjidAlamat, ms.MasjidRegional,
+			strconv.Itoa(ms.MaleCount), strconv.Itoa(ms.FemaleCount), strconv.Itoa(ms.TotalCount),
+		})
+		male += ms.MaleCount
+		female += ms.FemaleCount
+		total += ms.TotalCount
+	}
+	table.Totals = []string{"", "Total", "", "", strconv.Itoa(male), strconv.Itoa(female), strconv.Itoa(total)}
+	return table
 }
 
 // func GetEventStatistics(c *fiber.Ctx) error {
@@ -790,128 +706,308 @@ func GetEventStatistics(c *fiber.Ctx) error {
 // 	})
 // }
 
+// Event sesi malam (itikaf): kehadiran tanggal X dihitung dari 19:00 X sampai
+// 06:00 X+1 WIB, event lain per tanggal kalender WIB
+var overnightEvents = map[int]bool{2: true}
+
+// Batas jumlah titik data GetAttendanceStatistics dalam satu request
+const maxAttendancePeriods = 1000
+
+type AttendancePeriod struct {
+	Date         string  `json:"date"`
+	DateEnd      string  `json:"date_end"`
+	PersenHadir  float64 `json:"persen_hadir"`
+	TotalPeserta int     `json:"total_peserta"`
+	TotalHadir   int     `json:"total_hadir"`
+}
+
+// GetAttendanceStatistics mengembalikan persentase kehadiran per hari/minggu/bulan.
+// Query: event_id (default 2), start_date, end_date (default 10 hari terakhir),
+// masjid_id, regional_id, granularity=day|week|month.
 func GetAttendanceStatistics(c *fiber.Ctx) error {
-	startDate := "2025-03-20"
-	endDate := "2025-03-29"
-	eventID := 2
+	eventID, err := strconv.Atoi(c.Query("event_id", "2"))
+	if err != nil || eventID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "event_id must be a number"})
+	}
 
-	query := `
-		SELECT
-			dates.date AS event_date,
-			COALESCE(
-				(
-					(SELECT COUNT(DISTINCT user_id) FROM absensi
-					 WHERE event_id = ? AND 
-					 CONVERT_TZ(absensi.created_at, '+00:00', '+07:00') 
-					 BETWEEN CONCAT(dates.date, ' 19:00:00') 
-					 AND CONCAT(DATE_ADD(dates.date, INTERVAL 1 DAY), ' 06:00:00'))
-					/
-					NULLIF((SELECT COUNT(*) FROM peserta
-					LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-					WHERE detail_peserta.id_event = ?), 0) * 100
-				), 0) AS persen_hadir,
-			COALESCE((SELECT COUNT(*) FROM peserta
-				LEFT JOIN detail_peserta ON peserta.id = detail_peserta.id_peserta
-				WHERE detail_peserta.id_event = ?), 0) AS total_peserta,
-			COALESCE((SELECT COUNT(DISTINCT user_id) FROM absensi
-				 WHERE event_id = ? AND 
-				 CONVERT_TZ(absensi.created_at, '+00:00', '+07:00') 
-				 BETWEEN CONCAT(dates.date, ' 19:00:00') 
-				 AND CONCAT(DATE_ADD(dates.date, INTERVAL 1 DAY), ' 06:00:00')), 0) AS total_hadir
-		FROM (
-			SELECT DATE_ADD(?, INTERVAL seq DAY) AS date
-			FROM (SELECT 0 AS seq UNION ALL SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3 UNION ALL SELECT 4
-			      UNION ALL SELECT 5 UNION ALL SELECT 6 UNION ALL SELECT 7 UNION ALL SELECT 8 UNION ALL SELECT 9
-			      UNION ALL SELECT 10 UNION ALL SELECT 11 UNION ALL SELECT 12 UNION ALL SELECT 13 UNION ALL SELECT 14
-			      UNION ALL SELECT 15 UNION ALL SELECT 16 UNION ALL SELECT 17 UNION ALL SELECT 18 UNION ALL SELECT 19) AS seq
-			WHERE DATE_ADD(?, INTERVAL seq DAY) <= ? COLLATE utf8mb4_unicode_ci
-		) AS dates;
-	`
-
-	rows, err := database.DB.Query(query, eventID, eventID, eventID, eventID, startDate, startDate, endDate)
+	masjidID, _ := strconv.Atoi(c.Query("masjid_id", "0"))
+	regionalID, _ := strconv.Atoi(c.Query("regional_id", "0"))
+
+	endDate := c.Query("end_date", utils.Today(services.MasjidLocation(masjidID)))
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "end_date must be YYYY-MM-DD"})
+	}
+	startDate := c.Query("start_date", end.AddDate(0, 0, -9).Format("2006-01-02"))
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil || start.After(end) {
+		return c.Status(400).JSON(fiber.Map{"error": "start_date must be YYYY-MM-DD and not after end_date"})
+	}
+
+	granularity := c.Query("granularity", "day")
+	periods, err := attendancePeriods(start, end, granularity)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// ?custom_field=&custom_value= menyaring peserta berdasarkan jawaban formulir event
+	fields, err := services.LoadFormFields(eventID)
+	if err != nil {
+		log.Println("Error fetching form fields:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch attendance statistics"})
+	}
+	customFilter, customArgs, ok := customFieldFilter(c, fields, "dp")
+	if !ok {
+		return nil
+	}
+
+	var totalPeserta int
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM detail_peserta dp
+		JOIN peserta p ON dp.id_peserta = p.id
+		LEFT JOIN masjid m ON p.masjid_id = m.id
+		WHERE dp.id_event = ? AND dp.status = 1
+			AND (? = 0 OR p.masjid_id = ?)
+			AND (? = 0 OR m.regional_id = ?)`+customFilter,
+		append([]interface{}{eventID, masjidID, masjidID, regionalID, regionalID}, customArgs...)...).Scan(&totalPeserta)
 	if err != nil {
 		log.Println("Error fetching attendance statistics:", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch attendance statistics"})
 	}
-	defer rows.Close()
 
-	attendanceStats := []map[string]interface{}{}
+	// Tanggal sesi absensi: untuk event sesi malam jam 00:00-06:00 masih milik malam sebelumnya
+	localTime := services.MasjidLocalTimeSQL("a.created_at", "pt.id_masjid")
+	sessionDate := "DATE(" + localTime + ")"
+	windowCondition := ""
+	if overnightEvents[eventID] {
+		sessionDate = "DATE(" + localTime + " - INTERVAL 7 HOUR)"
+		windowCondition = "AND (TIME(" + localTime + ") >= '19:00:00' OR TIME(" + localTime + ") <= '06:00:00')"
+	}
+	bucket := sessionDate
+	switch granularity {
+	case "week":
+		bucket = "DATE_SUB(" + sessionDate + ", INTERVAL WEEKDAY(" + sessionDate + ") DAY)"
+	case "month":
+		bucket = "DATE_FORMAT(" + sessionDate + ", '%Y-%m-01')"
+	}
+
+	// Rentang created_at (UTC) yang mungkin masuk ke sesi start..end di zona mana pun,
+	// disaring ulang per sesi
+	rangeStart, rangeEnd, _ := utils.AnyZoneDayRange(startDate, end.AddDate(0, 0, 1).Format("2006-01-02"))
+
+	if customFilter != "" {
+		customFilter = "AND EXISTS (SELECT 1 FROM detail_peserta dp WHERE dp.id_peserta = a.user_id AND dp.id_event = a.event_id" + customFilter + ")"
+	}
+	args := []interface{}{eventID, rangeStart, rangeEnd, startDate, endDate, masjidID, masjidID, regionalID, regionalID}
+	rows, err := database.DB.Query(fmt.Sprintf(`
+		SELECT DATE_FORMAT(%s, '%%Y-%%m-%%d') AS bucket, COUNT(DISTINCT a.user_id)
+		FROM absensi a
+		LEFT JOIN petugas pt ON a.mesin_id = pt.id_user
+		LEFT JOIN masjid m ON pt.id_masjid = m.id
+		WHERE a.event_id = ? AND a.voided_at IS NULL
+			AND a.created_at >= ? AND a.created_at < ?
+			AND %s BETWEEN ? AND ?
+			%s
+			AND (? = 0 OR pt.id_masjid = ?)
+			AND (? = 0 OR m.regional_id = ?)
+			%s
+		GROUP BY bucket`, bucket, sessionDate, windowCondition, customFilter),
+		append(args, customArgs...)...)
+	if err != nil {
+		log.Println("Error fetching attendance statistics:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch attendance statistics"})
+	}
+	defer rows.Close()
 
+	hadir := make(map[string]int)
 	for rows.Next() {
-		var eventDate string
-		var persenHadir float64
-		var totalPeserta int
-		var totalHadir int
-		if err := rows.Scan(&eventDate, &persenHadir, &totalPeserta, &totalHadir); err != nil {
+		var date string
+		var n int
+		if err := rows.Scan(&date, &n); err != nil {
 			log.Println("Error scanning row:", err)
 			continue
 		}
-		attendanceStats = append(attendanceStats, map[string]interface{}{
-			"date":          eventDate,
-			"persen_hadir":  persenHadir,
-			"total_peserta": totalPeserta,
-			"total_hadir":   totalHadir,
+		hadir[date] = n
+	}
+
+	for i := range periods {
+		periods[i].TotalPeserta = totalPeserta
+		periods[i].TotalHadir = hadir[periods[i].Date]
+		if totalPeserta > 0 {
+			periods[i].PersenHadir = float64(periods[i].TotalHadir) / float64(totalPeserta) * 100
+		}
+	}
+
+	return c.JSON(periods)
+}
+
+// attendancePeriods membuat deret periode dari start sampai end (inklusif). Date
+// adalah awal periode (Senin untuk week, tanggal 1 untuk month); periode pertama
+// dan terakhir dipotong ke start/end.
+func attendancePeriods(start, end time.Time, granularity string) ([]AttendancePeriod, error) {
+	var next func(time.Time) time.Time
+	first := start
+	switch granularity {
+	case "day":
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		first = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		first = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, fmt.Errorf("granularity must be one of day, week, month")
+	}
+
+	periods := []AttendancePeriod{}
+	for t := first; !t.After(end); t = next(t) {
+		if len(periods) == maxAttendancePeriods {
+			return nil, fmt.Errorf("period too long, maximum %d %ss", maxAttendancePeriods, granularity)
+		}
+		periodEnd := next(t).AddDate(0, 0, -1)
+		if periodEnd.After(end) {
+			periodEnd = end
+		}
+		periods = append(periods, AttendancePeriod{
+			Date:    t.Format("2006-01-02"),
+			DateEnd: periodEnd.Format("2006-01-02"),
 		})
 	}
+	return periods, nil
+}
 
-	return c.JSON(attendanceStats)
+type MasjidSummary struct {
+	MasjidID     int    `json:"masjid_id"`
+	MasjidNama   string `json:"masjid_nama"`
+	MasjidAlamat string `json:"masjid_alamat"`
+	MasjidRegion string `json:"masjid_regional"`
+	TotalCount   int    `json:"total_count"`
+	SubuhCount   int    `json:"subuh_count"`
+	DzuhurCount  int    `json:"dzuhur_count"`
+	AsharCount   int    `json:"ashar_count"`
+	MaghribCount int    `json:"maghrib_count"`
+	IsyaCount    int    `json:"isya_count"`
+
+	Demografi []services.DemographicCount `json:"demografi,omitempty"`
 }
 
 func GetRekapPerMasjid(c *fiber.Ctx) error {
 	eventDate := c.Query("event_date")
 	if eventDate == "" {
-		eventDate = time.Now().Format("2006-01-02")
+		eventDate = utils.Today(utils.DefaultLocation())
 	}
 
-	query := `
-		SELECT 
-    m.id AS masjid_id,
-    m.nama AS masjid_nama,
-    m.alamat AS masjid_alamat,
-    r.nama AS masjid_regional,
-    COUNT(DISTINCT dt.user_id, dt.tag) AS total_count,
-    COUNT(DISTINCT CASE WHEN dt.tag = 'subuh' THEN dt.user_id END) AS subuh_count,
-    COUNT(DISTINCT CASE WHEN dt.tag = 'dzuhur' THEN dt.user_id END) AS dzuhur_count,
-    COUNT(DISTINCT CASE WHEN dt.tag = 'ashar' THEN dt.user_id END) AS ashar_count,
-    COUNT(DISTINCT CASE WHEN dt.tag = 'maghrib' THEN dt.user_id END) AS maghrib_count,
-    COUNT(DISTINCT CASE WHEN dt.tag = 'isya' THEN dt.user_id END) AS isya_count
-FROM setting s
-LEFT JOIN masjid m ON s.id_masjid = m.id
-LEFT JOIN regional r ON m.regional_id = r.id
-LEFT JOIN petugas pt ON m.id = pt.id_masjid
-LEFT JOIN (
-    SELECT DISTINCT user_id, tag, mesin_id, DATE(CONVERT_TZ(created_at, '+00:00', '+07:00')) as event_date
-    FROM absensi
-    WHERE tag IS NOT NULL
-      AND DATE(CONVERT_TZ(created_at, '+00:00', '+07:00')) = ?
-) dt ON dt.mesin_id = pt.id_user
-WHERE s.id_event = 3
-GROUP BY m.id, m.nama, m.alamat, r.nama
-ORDER BY total_count DESC
-
-	`
-
-	rows, err := database.DB.Query(query, eventDate)
+	format := c.Query("format")
+	if format != "" && !utils.IsExportFormat(format) {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be one of xlsx, csv, pdf"})
+	}
+
+	regionalID, _ := strconv.Atoi(c.Query("regional_id", "0"))
+	q, err := utils.ParseListQuery(c, rekapPerMasjidListSpec)
+	if err != nil {
+		return reportError(c, err, "Invalid query")
+	}
+
+	// Export selalu berisi semua masjid; JSON diambil per halaman
+	if format != "" {
+		result, err := fetchRekapPerMasjid(eventDate, regionalID, nil)
+		if err != nil {
+			log.Println("Query error:", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+		}
+		return utils.SendExport(c, format, "rekap-masjid-"+eventDate, rekapPerMasjidTable(result, eventDate))
+	}
+
+	total, err := countEventMasjid(3, regionalID)
 	if err != nil {
 		log.Println("Query error:", err)
 		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
 	}
-	defer rows.Close()
 
-	type MasjidSummary struct {
-		MasjidID     int    `json:"masjid_id"`
-		MasjidNama   string `json:"masjid_nama"`
-		MasjidAlamat string `json:"masjid_alamat"`
-		MasjidRegion string `json:"masjid_regional"`
-		TotalCount   int    `json:"total_count"`
-		SubuhCount   int    `json:"subuh_count"`
-		DzuhurCount  int    `json:"dzuhur_count"`
-		AsharCount   int    `json:"ashar_count"`
-		MaghribCount int    `json:"maghrib_count"`
-		IsyaCount    int    `json:"isya_count"`
+	page, err := fetchRekapPerMasjid(eventDate, regionalID, q)
+	if err != nil {
+		log.Println("Query error:", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+	}
+	if c.QueryBool("demografi") {
+		if err := attachRekapDemographics(page, eventDate); err != nil {
+			log.Println("Query error:", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Database query failed"})
+		}
+	}
+
+	return c.JSON(q.Response(page, total))
+}
+
+// rekapPerMasjidListSpec: ?sort=total|name, default jamaah terbanyak dulu
+var rekapPerMasjidListSpec = utils.ListSpec{
+	Sorts:       map[string]string{"total": "total_count", "name": "m.nama"},
+	DefaultSort: "-total",
+}
+
+// countEventMasjid menghitung masjid yang punya setting untuk event, regionalID 0
+// berarti semua regional
+func countEventMasjid(eventID, regionalID int) (int, error) {
+	var total int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(*)
+		FROM (SELECT DISTINCT id_masjid FROM setting WHERE id_event = ?) s
+		JOIN masjid m ON s.id_masjid = m.id
+		WHERE (? = 0 OR m.regional_id = ?)`, eventID, regionalID, regionalID).Scan(&total)
+	return total, err
+}
+
+// fetchRekapPerMasjid menghitung jumlah jamaah per sholat di setiap masjid event 3
+// dari absensi_daily_counters, regionalID 0 berarti semua regional. q nil berarti
+// semua masjid urut jamaah terbanyak; selain itu hanya halaman q.
+func fetchRekapPerMasjid(eventDate string, regionalID int, q *utils.ListQuery) ([]MasjidSummary, error) {
+	query := `
+		SELECT
+			m.id AS masjid_id,
+			m.nama AS masjid_nama,
+			m.alamat AS masjid_alamat,
+			COALESCE(r.nama, '') AS masjid_regional,
+			COALESCE(c.total_count, 0) AS total_count,
+			COALESCE(c.subuh_count, 0),
+			COALESCE(c.dzuhur_count, 0),
+			COALESCE(c.ashar_count, 0),
+			COALESCE(c.maghrib_count, 0),
+			COALESCE(c.isya_count, 0)
+		FROM (SELECT DISTINCT id_masjid FROM setting WHERE id_event = 3) s
+		JOIN masjid m ON s.id_masjid = m.id
+		LEFT JOIN regional r ON m.regional_id = r.id
+		LEFT JOIN (
+			SELECT
+				masjid_id,
+				SUM(CASE WHEN tag <> '*' THEN jumlah ELSE 0 END) AS total_count,
+				SUM(CASE WHEN tag = 'subuh' THEN jumlah ELSE 0 END) AS subuh_count,
+				SUM(CASE WHEN tag = 'dzuhur' THEN jumlah ELSE 0 END) AS dzuhur_count,
+				SUM(CASE WHEN tag = 'ashar' THEN jumlah ELSE 0 END) AS ashar_count,
+				SUM(CASE WHEN tag = 'maghrib' THEN jumlah ELSE 0 END) AS maghrib_count,
+				SUM(CASE WHEN tag = 'isya' THEN jumlah ELSE 0 END) AS isya_count
+			FROM absensi_daily_counters
+			WHERE tanggal = ?
+			GROUP BY masjid_id
+		) c ON c.masjid_id = m.id
+		WHERE (? = 0 OR m.regional_id = ?)`
+	args := []interface{}{eventDate, regionalID, regionalID}
+	if q == nil {
+		query += " ORDER BY total_count DESC, m.id"
+	} else {
+		limitSQL, limitArgs := q.LimitSQL()
+		query += q.OrderSQL("m.id") + limitSQL
+		args = append(args, limitArgs...)
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	var result []MasjidSummary
+	result := []MasjidSummary{}
 	for rows.Next() {
 		var ms MasjidSummary
 		if err := rows.Scan(
@@ -932,5 +1028,133 @@ ORDER BY total_count DESC
 		result = append(result, ms)
 	}
 
-	return c.JSON(result)
+	return result, rows.Err()
+}
+
+// attachRekapDemographics mengisi breakdown sholat x gender x kelompok umur tiap
+// masjid dari absensi_daily_counters
+func attachRekapDemographics(result []MasjidSummary, eventDate string) error {
+	rows, err := database.DB.Query(`
+		SELECT masjid_id, tag, gender, kategori, SUM(jumlah)
+		FROM absensi_daily_counters
+		WHERE tanggal = ? AND tag <> ?
+		GROUP BY masjid_id, tag, gender, kategori`, eventDate, services.CounterAllTags)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	perMasjid := make(map[int][]services.DemographicCount)
+	for rows.Next() {
+		var masjidID int
+		var d services.DemographicCount
+		if err := rows.Scan(&masjidID, &d.Tag, &d.Gender, &d.Kategori, &d.Jumlah); err != nil {
+			return err
+		}
+		perMasjid[masjidID] = append(perMasjid[masjidID], d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range result {
+		demografi := perMasjid[result[i].MasjidID]
+		if demografi == nil {
+			demografi = []services.DemographicCount{}
+		}
+		services.SortDemographics(demografi)
+		result[i].Demografi = demografi
+	}
+	return nil
+}
+
+func rekapPerMasjidTable(result []MasjidSummary, eventDate string) *utils.ExportTable {
+	table := &utils.ExportTable{
+		Title:   "Rekap Sholat per Masjid",
+		Meta:    []string{"Tanggal: " + eventDate},
+		Headers: []string{"No", "Masjid", "Regional", "Subuh", "Dzuhur", "Ashar", "Maghrib", "Isya", "Total"},
+	}
+
+	sum := make([]int, 6)
+	for i, ms := range result {
+		counts := []int{ms.SubuhCount, ms.DzuhurCount, ms.AsharCount, ms.MaghribCount, ms.IsyaCount, ms.TotalCount}
+		row := []string{strconv.Itoa(i + 1), ms.MasjidNama, ms.MasjidRegion}
+		for j, n := range counts {
+			row = append(row, strconv.Itoa(n))
+			sum[j] += n
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	table.Totals = []string{"", "Total", ""}
+	for _, n := range sum {
+		table.Totals = append(table.Totals, strconv.Itoa(n))
+	}
+	return table
+}
+
+// Handler untuk membangun ulang counter dashboard dari tabel absensi
+func RebuildDailyCounters(c *fiber.Ctx) error {
+	body := struct {
+		DateFrom string `json:"date_from"`
+		DateTo   string `json:"date_to"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if !validDateRange(body.DateFrom, body.DateTo) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date_from and date_to must be YYYY-MM-DD and date_from <= date_to"})
+	}
+
+	n, err := services.RebuildDailyCounters(body.DateFrom, body.DateTo)
+	if err != nil {
+		log.Println("Error rebuilding daily counters:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rebuild daily counters"})
+	}
+
+	recordAudit(c, database.DB, "counters.rebuild", "absensi_daily_counters", body.DateFrom+".."+body.DateTo, nil, fiber.Map{
+		"date_from": body.DateFrom,
+		"date_to":   body.DateTo,
+		"rows":      n,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"rows":    n,
+	})
+}
+
+// Handler untuk mengecek counter dashboard terhadap hitungan langsung dari absensi
+func CheckDailyCounters(c *fiber.Ctx) error {
+	dateFrom := c.Query("date_from", utils.LatestToday())
+	dateTo := c.Query("date_to", dateFrom)
+	if !validDateRange(dateFrom, dateTo) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "date_from and date_to must be YYYY-MM-DD and date_from <= date_to"})
+	}
+
+	mismatches, err := services.CheckDailyCounters(dateFrom, dateTo)
+	if err != nil {
+		log.Println("Error checking daily counters:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check daily counters"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "Success",
+		"date_from":  dateFrom,
+		"date_to":    dateTo,
+		"consistent": len(mismatches) == 0,
+		"mismatches": mismatches,
+	})
+}
+
+func validDateRange(dateFrom, dateTo string) bool {
+	from, err := time.Parse("2006-01-02", dateFrom)
+	if err != nil {
+		return false
+	}
+	to, err := time.Parse("2006-01-02", dateTo)
+	if err != nil {
+		return false
+	}
+	return !to.Before(from)
 }
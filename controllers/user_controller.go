@@ -2,8 +2,10 @@ package controllers
 
 import (
 	"database/sql"
+	"log"
 	"shollu/database"
 	"shollu/models"
+	"shollu/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
@@ -28,3 +30,32 @@ func GetProfile(c *fiber.Ctx) error {
 	// Kirim data user sebagai respons
 	return c.JSON(user)
 }
+
+// jwtUserID mengambil id user dari token JWT yang sudah divalidasi middleware
+func jwtUserID(c *fiber.Ctx) int {
+	userToken, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return 0
+	}
+	claims, ok := userToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0
+	}
+	userID, _ := claims["id"].(float64)
+	return int(userID)
+}
+
+// isAdminUser mengecek role user yang login; di bawah /api/admin hasilnya sudah
+// disimpan middleware AdminOnly
+func isAdminUser(c *fiber.Ctx) bool {
+	if isAdmin, ok := c.Locals("is_admin").(bool); ok {
+		return isAdmin
+	}
+	isAdmin, err := services.IsAdmin(jwtUserID(c))
+	if err != nil {
+		log.Println("Error checking user role:", err)
+		return false
+	}
+	c.Locals("is_admin", isAdmin)
+	return isAdmin
+}
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"shollu/database"
+	"shollu/services"
+	"shollu/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebhookSubscriptionRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	URL    string   `json:"url" validate:"required,url,max=500"`
+	Events []string `json:"events" validate:"required,min=1"`
+	Secret string   `json:"secret" validate:"omitempty,min=16,max=100"`
+	Active *bool    `json:"active"`
+}
+
+type WebhookSubscription struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	OutboxID       int64      `json:"outbox_id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Handler untuk daftar subscription webhook (secret tidak ditampilkan)
+func GetWebhookSubscriptions(c *fiber.Ctx) error {
+	rows, err := database.DB.Query(`
+		SELECT id, name, url, events, active, created_at FROM webhook_subscriptions ORDER BY id ASC`)
+	if err != nil {
+		log.Println("Error fetching webhook subscriptions:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch webhook subscriptions"})
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		var s WebhookSubscription
+		var events string
+		if err := rows.Scan(&s.ID, &s.Name, &s.URL, &events, &s.Active, &s.CreatedAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		s.Events = strings.Split(events, ",")
+		subs = append(subs, s)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    subs,
+		"events":  services.WebhookEvents,
+	})
+}
+
+// Handler untuk membuat subscription webhook; secret hanya dikembalikan sekali di sini
+func CreateWebhookSubscription(c *fiber.Ctx) error {
+	req, ok := parseWebhookSubscription(c)
+	if !ok {
+		return nil
+	}
+	if req.Secret == "" {
+		b := make([]byte, 32)
+		rand.Read(b)
+		req.Secret = hex.EncodeToString(b)
+	}
+	active := req.Active == nil || *req.Active
+
+	result, err := database.DB.Exec(`
+		INSERT INTO webhook_subscriptions (name, url, secret, events, active, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		req.Name, req.URL, req.Secret, strings.Join(req.Events, ","), active, jwtUserID(c))
+	if err != nil {
+		log.Println("Error creating webhook subscription:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create webhook subscription"})
+	}
+	id, _ := result.LastInsertId()
+
+	recordAudit(c, database.DB, "webhook.create", "webhook_subscription", id, nil, fiber.Map{
+		"name":   req.Name,
+		"url":    req.URL,
+		"events": req.Events,
+		"active": active,
+	})
+
+	return c.Status(http.StatusCreated).JSON(fiber.Map{
+		"message": "Webhook subscription created successfully",
+		"data": WebhookSubscription{
+			ID:     int(id),
+			Name:   req.Name,
+			URL:    req.URL,
+			Events: req.Events,
+			Secret: req.Secret,
+			Active: active,
+		},
+	})
+}
+
+// Handler untuk mengubah subscription webhook; secret lama dipakai kalau tidak dikirim
+func UpdateWebhookSubscription(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid webhook id"})
+	}
+
+	var before WebhookSubscription
+	var events string
+	err = database.DB.QueryRow("SELECT id, name, url, events, active FROM webhook_subscriptions WHERE id = ?", id).
+		Scan(&before.ID, &before.Name, &before.URL, &events, &before.Active)
+	if err == sql.ErrNoRows {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Webhook subscription not found"})
+	} else if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	before.Events = strings.Split(events, ",")
+
+	req, ok := parseWebhookSubscription(c)
+	if !ok {
+		return nil
+	}
+	active := req.Active == nil || *req.Active
+
+	_, err = database.DB.Exec(`
+		UPDATE webhook_subscriptions SET name = ?, url = ?, events = ?, active = ?, secret = COALESCE(NULLIF(?, ''), secret)
+		WHERE id = ?`, req.Name, req.URL, strings.Join(req.Events, ","), active, req.Secret, id)
+	if err != nil {
+		log.Println("Error updating webhook subscription:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update webhook subscription"})
+	}
+
+	after := WebhookSubscription{ID: id, Name: req.Name, URL: req.URL, Events: req.Events, Active: active}
+	recordAudit(c, database.DB, "webhook.update", "webhook_subscription", id, before, after)
+
+	return c.JSON(fiber.Map{
+		"message": "Webhook subscription updated successfully",
+		"data":    after,
+	})
+}
+
+// Handler untuk menghapus subscription webhook beserta antrian delivery-nya yang belum terkirim
+func DeleteWebhookSubscription(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid webhook id"})
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete webhook subscription"})
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Webhook subscription not found"})
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE subscription_id = ? AND status = 'pending'", id); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete webhook subscription"})
+	}
+
+	recordAudit(c, tx, "webhook.delete", "webhook_subscription", id, nil, nil)
+
+	if err := tx.Commit(); err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete webhook subscription"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Webhook subscription deleted successfully"})
+}
+
+// Handler untuk daftar delivery webhook, ?status=dead untuk dead letter
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	query := `
+		SELECT d.id, d.outbox_id, d.subscription_id, o.event_type, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, COALESCE(d.last_error, ''), d.delivered_at, d.created_at
+		FROM webhook_deliveries d
+		JOIN webhook_outbox o ON d.outbox_id = o.id
+		WHERE 1 = 1`
+	var args []interface{}
+	if status := c.Query("status"); status != "" {
+		query += " AND d.status = ?"
+		args = append(args, status)
+	}
+	if subscriptionID := c.Query("subscription_id"); subscriptionID != "" {
+		query += " AND d.subscription_id = ?"
+		args = append(args, subscriptionID)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query += " AND o.event_type = ?"
+		args = append(args, eventType)
+	}
+	query += " ORDER BY d.id DESC LIMIT 200"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching webhook deliveries:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch webhook deliveries"})
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var statusCode sql.NullInt64
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.OutboxID, &d.SubscriptionID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&statusCode, &d.LastError, &deliveredAt, &d.CreatedAt); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Error reading data"})
+		}
+		if statusCode.Valid {
+			code := int(statusCode.Int64)
+			d.LastStatusCode = &code
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Success",
+		"data":    deliveries,
+	})
+}
+
+// Handler untuk mengirim ulang satu delivery webhook
+func RedeliverWebhook(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid delivery id"})
+	}
+
+	err = services.RedeliverWebhook(id)
+	if err == services.ErrWebhookDeliveryNotFound {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Webhook delivery not found or still in progress"})
+	} else if err != nil {
+		log.Println("Error scheduling webhook redelivery:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to schedule redelivery"})
+	}
+
+	recordAudit(c, database.DB, "webhook.redeliver", "webhook_delivery", id, nil, nil)
+
+	return c.JSON(fiber.Map{
+		"message":     "Webhook delivery scheduled",
+		"delivery_id": id,
+	})
+}
+
+// parseWebhookSubscription membaca dan memvalidasi body subscription; kalau tidak
+// valid response 400 sudah ditulis dan ok bernilai false
+func parseWebhookSubscription(c *fiber.Ctx) (*WebhookSubscriptionRequest, bool) {
+	var req WebhookSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		return nil, false
+	}
+	if err := utils.Validate.Struct(req); err != nil {
+		errors := utils.FormatValidationErrors(err)
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"errors": errors})
+		return nil, false
+	}
+
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "url must be http or https"})
+		return nil, false
+	}
+
+	known := make(map[string]bool)
+	for _, e := range services.WebhookEvents {
+		known[e] = true
+	}
+	for _, e := range req.Events {
+		if e != "*" && !known[e] {
+			c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Unknown event " + e})
+			return nil, false
+		}
+	}
+	return &req, true
+}
@@ -0,0 +1,24 @@
+-- Void (soft delete) untuk absensi dan antrian review anomali scan
+
+ALTER TABLE absensi
+    ADD COLUMN voided_at DATETIME NULL DEFAULT NULL,
+    ADD COLUMN voided_by INT NULL DEFAULT NULL,
+    ADD COLUMN void_reason VARCHAR(255) NULL DEFAULT NULL,
+    ADD INDEX idx_absensi_voided_at (voided_at),
+    ADD INDEX idx_absensi_mesin_created (mesin_id, created_at),
+    ADD INDEX idx_absensi_user_created (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS absensi_flags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    absensi_id INT NOT NULL,
+    rule VARCHAR(50) NOT NULL,
+    detail VARCHAR(255) NOT NULL DEFAULT '',
+    source ENUM('realtime', 'batch') NOT NULL DEFAULT 'realtime',
+    status ENUM('pending', 'approved', 'voided') NOT NULL DEFAULT 'pending',
+    reviewed_by INT NULL DEFAULT NULL,
+    reviewed_at DATETIME NULL DEFAULT NULL,
+    review_note VARCHAR(255) NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_absensi_flags_rule (absensi_id, rule),
+    KEY idx_absensi_flags_status (status)
+);
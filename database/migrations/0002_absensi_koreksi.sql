@@ -0,0 +1,18 @@
+-- Absensi manual (input petugas/admin) dan audit log perubahan absensi
+
+ALTER TABLE absensi
+    ADD COLUMN is_manual TINYINT(1) NOT NULL DEFAULT 0,
+    ADD COLUMN manual_reason VARCHAR(255) NULL DEFAULT NULL,
+    ADD COLUMN created_by INT NULL DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS absensi_audit (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    absensi_id INT NOT NULL,
+    action ENUM('create', 'void', 'restore') NOT NULL,
+    actor_id INT NULL DEFAULT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    before_data JSON NULL,
+    after_data JSON NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_absensi_audit_absensi (absensi_id)
+);
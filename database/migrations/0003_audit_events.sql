@@ -0,0 +1,17 @@
+-- Audit log umum untuk semua endpoint yang mengubah data
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor_type ENUM('user', 'device', 'anonymous') NOT NULL,
+    actor_id VARCHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,
+    entity VARCHAR(64) NOT NULL,
+    entity_id VARCHAR(64) NOT NULL DEFAULT '',
+    diff JSON NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_audit_events_entity (entity, entity_id),
+    KEY idx_audit_events_actor (actor_type, actor_id),
+    KEY idx_audit_events_action (action),
+    KEY idx_audit_events_created (created_at)
+);
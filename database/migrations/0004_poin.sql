@@ -0,0 +1,38 @@
+-- Aturan poin per event/sholat dan relasi poin ke absensi
+
+CREATE TABLE IF NOT EXISTS poin_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    event_id INT NOT NULL,
+    tag VARCHAR(20) NOT NULL,
+    point_sholat INT NOT NULL DEFAULT 0,
+    arrival_top_n INT NOT NULL DEFAULT 0,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_poin_rules_event_tag (event_id, tag)
+);
+
+-- Nilai awal sama dengan perhitungan lama di SaveAbsenQR
+INSERT IGNORE INTO poin_rules (event_id, tag, point_sholat, arrival_top_n) VALUES
+    (3, 'subuh', 40, 10),
+    (3, 'dzuhur', 0, 10),
+    (3, 'ashar', 0, 10),
+    (3, 'maghrib', 30, 10),
+    (3, 'isya', 30, 10);
+
+CREATE TABLE IF NOT EXISTS poin (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    tanggal DATE NOT NULL,
+    tag VARCHAR(20) NOT NULL,
+    point_sholat INT NOT NULL DEFAULT 0,
+    point_kehadiran INT NOT NULL DEFAULT 0,
+    total_point INT NOT NULL DEFAULT 0
+);
+
+ALTER TABLE poin
+    ADD COLUMN absensi_id INT NULL DEFAULT NULL,
+    ADD COLUMN event_id INT NULL DEFAULT NULL,
+    ADD COLUMN mesin_id VARCHAR(50) NULL DEFAULT NULL,
+    ADD COLUMN urutan INT NOT NULL DEFAULT 0,
+    ADD UNIQUE KEY uq_poin_absensi (absensi_id),
+    ADD KEY idx_poin_event_tanggal (event_id, tanggal);
@@ -0,0 +1,33 @@
+-- Definisi badge (achievement) dan badge yang sudah diraih peserta
+
+CREATE TABLE IF NOT EXISTS badges (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(50) NOT NULL,
+    nama VARCHAR(100) NOT NULL,
+    deskripsi VARCHAR(255) NOT NULL DEFAULT '',
+    event_id INT NOT NULL DEFAULT 3,
+    tags VARCHAR(100) NOT NULL,
+    consecutive_days INT NOT NULL DEFAULT 0,
+    min_count INT NOT NULL DEFAULT 0,
+    masjid_id INT NULL DEFAULT NULL,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_badges_code (code)
+);
+
+-- tags: daftar sholat (dipisah koma) yang semuanya harus dihadiri dalam satu hari
+-- consecutive_days: minimal hari berturut-turut, min_count: minimal total hari
+INSERT IGNORE INTO badges (code, nama, deskripsi, tags, consecutive_days, min_count) VALUES
+    ('subuh_40', '40 Hari Subuh Berjamaah', 'Sholat subuh berjamaah 40 hari berturut-turut', 'subuh', 40, 0),
+    ('lima_waktu_7', 'Lima Waktu Sepekan', 'Sholat lima waktu berjamaah 7 hari berturut-turut', 'subuh,dzuhur,ashar,maghrib,isya', 7, 0),
+    ('subuh_100', 'Sahabat Subuh', 'Sholat subuh berjamaah 100 kali', 'subuh', 0, 100);
+
+CREATE TABLE IF NOT EXISTS peserta_badges (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    peserta_id INT NOT NULL,
+    badge_id INT NOT NULL,
+    awarded_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_peserta_badges (peserta_id, badge_id),
+    KEY idx_peserta_badges_badge (badge_id)
+);
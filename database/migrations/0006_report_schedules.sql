@@ -0,0 +1,32 @@
+-- Jadwal laporan otomatis dan riwayat pengirimannya
+
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    report VARCHAR(50) NOT NULL,
+    params JSON NULL,
+    format ENUM('xlsx', 'csv', 'pdf') NOT NULL DEFAULT 'xlsx',
+    cron_expr VARCHAR(100) NOT NULL,
+    channel ENUM('email', 'webhook', 'file') NOT NULL,
+    target VARCHAR(500) NOT NULL DEFAULT '',
+    max_retries INT NOT NULL DEFAULT 3,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_by INT NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS report_runs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    schedule_id INT NOT NULL,
+    status ENUM('running', 'success', 'retrying', 'failed') NOT NULL DEFAULT 'running',
+    attempt INT NOT NULL DEFAULT 1,
+    trigger_type ENUM('schedule', 'manual', 'retry') NOT NULL DEFAULT 'schedule',
+    file_name VARCHAR(255) NOT NULL DEFAULT '',
+    error TEXT NULL,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NULL DEFAULT NULL,
+    next_retry_at DATETIME NULL DEFAULT NULL,
+    KEY idx_report_runs_schedule (schedule_id, started_at),
+    KEY idx_report_runs_retry (status, next_retry_at)
+);
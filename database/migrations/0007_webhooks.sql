@@ -0,0 +1,38 @@
+-- Webhook keluar: subscription partner, outbox transaksional dan status pengiriman
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    url VARCHAR(500) NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    events VARCHAR(255) NOT NULL DEFAULT '*',
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_by INT NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Ditulis dalam transaksi yang sama dengan perubahan datanya
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSON NOT NULL,
+    created_at DATETIME NOT NULL,
+    dispatched_at DATETIME NULL DEFAULT NULL,
+    KEY idx_webhook_outbox_dispatched (dispatched_at)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    outbox_id BIGINT NOT NULL,
+    subscription_id INT NOT NULL,
+    status ENUM('pending', 'delivering', 'delivered', 'dead') NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_status_code INT NULL DEFAULT NULL,
+    last_error VARCHAR(500) NULL DEFAULT NULL,
+    delivered_at DATETIME NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_webhook_deliveries (outbox_id, subscription_id),
+    KEY idx_webhook_deliveries_due (status, next_attempt_at)
+);
@@ -0,0 +1,17 @@
+-- Counter harian absensi untuk dashboard, di-update saat scan/void/restore.
+-- tag '*' berisi jumlah peserta unik per hari (semua sholat) di masjid tersebut.
+-- Bisa dibangun ulang dari absensi: ./shollu rebuild-counters [from] [to]
+
+CREATE TABLE IF NOT EXISTS absensi_daily_counters (
+    tanggal DATE NOT NULL,
+    event_id INT NOT NULL,
+    masjid_id INT NOT NULL,
+    tag VARCHAR(20) NOT NULL,
+    gender VARCHAR(10) NOT NULL,
+    kategori VARCHAR(10) NOT NULL,
+    jumlah INT NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (tanggal, event_id, masjid_id, tag, gender, kategori),
+    KEY idx_absensi_daily_counters_masjid (masjid_id, tanggal)
+);
+
@@ -0,0 +1,39 @@
+-- Kelompok umur yang bisa diatur dan gender peserta yang dinormalisasi.
+-- Setelah migrasi ini jalankan ./shollu rebuild-counters supaya kategori di
+-- absensi_daily_counters mengikuti age_brackets.
+
+CREATE TABLE IF NOT EXISTS age_brackets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(20) NOT NULL,
+    label VARCHAR(50) NOT NULL,
+    min_age INT NOT NULL DEFAULT 0,
+    max_age INT NULL DEFAULT NULL,
+    is_default TINYINT(1) NOT NULL DEFAULT 0,
+    urutan INT NOT NULL DEFAULT 0,
+    UNIQUE KEY uq_age_brackets_code (code)
+);
+
+-- Sama dengan pembagian lama: pelajar <= 17 tahun, selebihnya (dan tanggal lahir kosong) umum
+INSERT IGNORE INTO age_brackets (code, label, min_age, max_age, is_default, urutan) VALUES
+    ('pelajar', 'Pelajar', 0, 17, 0, 1),
+    ('umum', 'Umum', 18, NULL, 1, 2);
+
+-- Simpan nilai gender asli sebelum dinormalisasi. Nilai di luar daftar di bawah
+-- menjadi NULL dan hanya tersisa di tabel ini; cek dengan:
+--   SELECT gender, COUNT(*) FROM peserta_gender_raw WHERE peserta_id IN
+--     (SELECT id FROM peserta WHERE gender IS NULL) GROUP BY gender;
+CREATE TABLE IF NOT EXISTS peserta_gender_raw (
+    peserta_id INT NOT NULL PRIMARY KEY,
+    gender TEXT NOT NULL
+);
+
+INSERT IGNORE INTO peserta_gender_raw (peserta_id, gender)
+    SELECT id, gender FROM peserta WHERE gender IS NOT NULL;
+
+UPDATE peserta SET gender = CASE
+    WHEN LOWER(TRIM(gender)) IN ('laki-laki', 'laki laki', 'male', 'lk', 'l', 'pria') THEN 'male'
+    WHEN LOWER(TRIM(gender)) IN ('perempuan', 'female', 'wanita', 'pr', 'p') THEN 'female'
+    ELSE NULL
+END;
+
+ALTER TABLE peserta MODIFY gender ENUM('male', 'female') NULL DEFAULT NULL;
@@ -0,0 +1,8 @@
+-- Zona waktu per regional dan masjid (nama IANA: Asia/Jakarta, Asia/Makassar,
+-- Asia/Jayapura). masjid.timezone NULL berarti ikut regional.
+-- Setelah regional di luar WIB diatur, jalankan ./shollu rebuild-counters supaya
+-- tanggal di absensi_daily_counters mengikuti zona masjid.
+
+ALTER TABLE regional ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Jakarta';
+
+ALTER TABLE masjid ADD COLUMN timezone VARCHAR(64) NULL DEFAULT NULL;
@@ -0,0 +1,25 @@
+-- Sesi terjadwal di luar lima sholat harian: kajian, tarawih, jumat, malam itikaf.
+-- start_at/end_at disimpan dalam UTC; untuk sesi berulang keduanya adalah
+-- kemunculan pertama dan diulang harian/mingguan sampai recurrence_until
+-- (tanggal lokal masjid). masjid_id NULL berarti berlaku di semua masjid event.
+
+CREATE TABLE IF NOT EXISTS event_sessions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    event_id INT NOT NULL,
+    masjid_id INT NULL DEFAULT NULL,
+    nama VARCHAR(150) NOT NULL,
+    jenis VARCHAR(20) NOT NULL,
+    start_at DATETIME NOT NULL,
+    end_at DATETIME NOT NULL,
+    recurrence ENUM('none', 'daily', 'weekly') NOT NULL DEFAULT 'none',
+    recurrence_until DATE NULL DEFAULT NULL,
+    capacity INT NULL DEFAULT NULL,
+    active TINYINT(1) NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    KEY idx_event_sessions_event_masjid (event_id, masjid_id)
+);
+
+ALTER TABLE absensi
+    ADD COLUMN session_id INT NULL DEFAULT NULL,
+    ADD INDEX idx_absensi_session (session_id, created_at);
@@ -0,0 +1,7 @@
+-- Jendela scan sholat Jumat. Di hari Jumat jadwal dzuhur dipakai sebagai waktu
+-- Jumat untuk jamaah laki-laki; khutbah dimulai sebelum waktu dzuhur sehingga
+-- jendela sebelumnya lebih panjang. Ubah menit di sini sesuai kebiasaan masjid.
+
+INSERT INTO sholat_config (nama_sholat, sebelum_menit, sesudah_menit)
+SELECT 'jumat', 45, 60
+WHERE NOT EXISTS (SELECT 1 FROM sholat_config WHERE LOWER(nama_sholat) = 'jumat');
@@ -0,0 +1,24 @@
+-- Kapasitas pendaftaran per (masjid, event). Tanpa baris di sini pendaftaran
+-- tidak dibatasi. waitlist_limit NULL berarti antrian tunggu tidak dibatasi,
+-- 0 berarti tidak ada antrian tunggu.
+
+CREATE TABLE IF NOT EXISTS masjid_event_capacity (
+    masjid_id INT NOT NULL,
+    event_id INT NOT NULL,
+    capacity INT NOT NULL,
+    waitlist_limit INT NULL DEFAULT NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (masjid_id, event_id)
+);
+
+-- Pendaftaran sekarang menyimpan masjidnya sendiri (bisa berbeda per event).
+-- status: 1 = terdaftar, 2 = antrian tunggu, 3 = dibatalkan.
+ALTER TABLE detail_peserta
+    ADD COLUMN masjid_id INT NULL DEFAULT NULL,
+    ADD COLUMN waitlisted_at DATETIME NULL DEFAULT NULL,
+    ADD INDEX idx_detail_peserta_event_masjid (id_event, masjid_id, status);
+
+UPDATE detail_peserta dp
+JOIN peserta p ON dp.id_peserta = p.id
+SET dp.masjid_id = p.masjid_id
+WHERE dp.masjid_id IS NULL;
@@ -0,0 +1,18 @@
+-- Riwayat perubahan pendaftaran event (detail_peserta): daftar, antrian tunggu
+-- naik, batal, daftar ulang dan pindah masjid. Status mengikuti detail_peserta.status
+-- (1 = terdaftar, 2 = antrian tunggu, 3 = dibatalkan); from_status NULL untuk pendaftaran baru.
+
+CREATE TABLE IF NOT EXISTS enrollment_history (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    id_peserta INT NOT NULL,
+    id_event INT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    from_status TINYINT NULL DEFAULT NULL,
+    to_status TINYINT NOT NULL,
+    from_masjid_id INT NULL DEFAULT NULL,
+    to_masjid_id INT NULL DEFAULT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    actor_id INT NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_enrollment_history_peserta (id_peserta, id_event, id)
+);
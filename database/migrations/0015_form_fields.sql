@@ -0,0 +1,20 @@
+-- Field tambahan formulir pendaftaran per event (nama sekolah, kontak darurat,
+-- ukuran kaos, ...). rules adalah tag go-playground/validator yang dijalankan
+-- untuk nilai field (misalnya "min=3,max=100" atau "email"); options adalah
+-- daftar pilihan JSON untuk select/multiselect.
+
+CREATE TABLE IF NOT EXISTS event_form_fields (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    event_id INT NOT NULL,
+    field_key VARCHAR(50) NOT NULL,
+    label VARCHAR(100) NOT NULL,
+    type ENUM('text', 'number', 'date', 'select', 'multiselect', 'boolean') NOT NULL DEFAULT 'text',
+    required TINYINT(1) NOT NULL DEFAULT 0,
+    options JSON NULL,
+    rules VARCHAR(255) NOT NULL DEFAULT '',
+    urutan INT NOT NULL DEFAULT 0,
+    UNIQUE KEY uq_event_form_fields (event_id, field_key)
+);
+
+-- Jawaban field tambahan disimpan per pendaftaran event
+ALTER TABLE detail_peserta ADD COLUMN custom_fields JSON NULL DEFAULT NULL;
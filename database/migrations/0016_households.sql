@@ -0,0 +1,29 @@
+-- Satu nomor HP (contact) bisa dipakai beberapa peserta dalam satu keluarga,
+-- misalnya orang tua dan anak-anaknya. guardian_peserta_id adalah wali utama
+-- yang bisa melihat kehadiran anggota lain.
+
+CREATE TABLE IF NOT EXISTS households (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    contact VARCHAR(20) NOT NULL,
+    guardian_peserta_id INT NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_households_contact (contact)
+);
+
+ALTER TABLE peserta
+    ADD COLUMN household_id INT NULL DEFAULT NULL,
+    ADD INDEX idx_peserta_household (household_id),
+    ADD INDEX idx_peserta_contact (contact);
+
+-- Nomor yang sudah dipakai lebih dari satu peserta langsung jadi keluarga,
+-- wali utamanya peserta yang paling dulu terdaftar.
+INSERT INTO households (contact, guardian_peserta_id)
+SELECT contact, MIN(id) FROM peserta
+WHERE contact IS NOT NULL AND contact <> ''
+GROUP BY contact
+HAVING COUNT(*) > 1;
+
+UPDATE peserta p
+JOIN households h ON p.contact = h.contact
+SET p.household_id = h.id
+WHERE p.household_id IS NULL;
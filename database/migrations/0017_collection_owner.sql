@@ -0,0 +1,10 @@
+-- Pemilik collection (users.id). Collection lama tanpa pemilik hanya bisa
+-- dilihat dan dikelola admin; isi owner_user_id untuk menyerahkannya ke user.
+
+ALTER TABLE collections
+    ADD COLUMN owner_user_id INT NULL DEFAULT NULL,
+    ADD COLUMN updated_at DATETIME NULL DEFAULT NULL,
+    ADD INDEX idx_collections_owner (owner_user_id);
+
+ALTER TABLE collection_items
+    ADD INDEX idx_collection_items_member (collection_id, id_peserta);
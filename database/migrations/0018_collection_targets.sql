@@ -0,0 +1,14 @@
+-- Target kehadiran collection. type count: minimal target kali per period
+-- (day, week, range = seluruh rentang laporan); type percent: minimal target
+-- persen dari sholat yang dilacak. tag kosong berarti semua sholat yang dilacak.
+
+CREATE TABLE IF NOT EXISTS collection_targets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    collection_id INT NOT NULL,
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    tag VARCHAR(20) NOT NULL DEFAULT '',
+    type ENUM('count', 'percent') NOT NULL,
+    target DECIMAL(8,2) NOT NULL,
+    period ENUM('day', 'week', 'range') NOT NULL DEFAULT 'week',
+    KEY idx_collection_targets_collection (collection_id)
+);
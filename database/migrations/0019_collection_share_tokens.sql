@@ -0,0 +1,20 @@
+-- Link berbagi collection. Token acak hanya disimpan hash SHA-256-nya; pin
+-- (opsional) disimpan dengan bcrypt. privacy: full = nama lengkap, hide = nama
+-- peserta dengan isHideName disembunyikan, initials = semua nama jadi inisial.
+
+CREATE TABLE IF NOT EXISTS collection_share_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    collection_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    privacy ENUM('full', 'hide', 'initials') NOT NULL DEFAULT 'hide',
+    pin_hash VARCHAR(255) NULL DEFAULT NULL,
+    pin_failures INT NOT NULL DEFAULT 0,
+    expires_at DATETIME NULL DEFAULT NULL,
+    revoked_at DATETIME NULL DEFAULT NULL,
+    created_by INT NULL DEFAULT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME NULL DEFAULT NULL,
+    UNIQUE KEY uq_collection_share_tokens_hash (token_hash),
+    KEY idx_collection_share_tokens_collection (collection_id)
+);
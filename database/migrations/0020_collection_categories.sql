@@ -0,0 +1,14 @@
+-- Kategori collection bertingkat (parent_id) dan bisa khusus satu masjid
+-- (masjid_id NULL berarti berlaku untuk semua masjid).
+
+ALTER TABLE category_collection
+    ADD COLUMN parent_id INT NULL DEFAULT NULL,
+    ADD COLUMN masjid_id INT NULL DEFAULT NULL,
+    ADD COLUMN created_at DATETIME NULL DEFAULT NULL,
+    ADD COLUMN updated_at DATETIME NULL DEFAULT NULL,
+    ADD INDEX idx_category_collection_parent (parent_id),
+    ADD INDEX idx_category_collection_masjid (masjid_id);
+
+ALTER TABLE detail_category_collection
+    ADD INDEX idx_detail_category_collection (category_id, collection_id),
+    ADD INDEX idx_detail_category_collection_col (collection_id);
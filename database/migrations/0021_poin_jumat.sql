@@ -0,0 +1,8 @@
+-- Scan sholat Jumat disimpan dengan tag jumat (lihat 0012) sehingga butuh aturan
+-- poin sendiri. Nilai awal disalin dari aturan dzuhur tiap event; ubah lewat
+-- PUT /api/admin/poin-rules kalau Jumat mau diberi poin berbeda.
+
+INSERT IGNORE INTO poin_rules (event_id, tag, point_sholat, arrival_top_n, active)
+SELECT event_id, 'jumat', point_sholat, arrival_top_n, active
+FROM poin_rules
+WHERE tag = 'dzuhur';
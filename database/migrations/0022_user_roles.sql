@@ -0,0 +1,6 @@
+-- Role user untuk route /api/admin. User dari /api/register selalu 'user';
+-- admin harus dinaikkan manual, misalnya:
+--   UPDATE users SET role = 'admin' WHERE email = 'pengurus@example.com';
+
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
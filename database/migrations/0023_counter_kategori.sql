@@ -0,0 +1,4 @@
+-- Kode kelompok umur (age_brackets.code) boleh sampai 20 karakter dan disimpan
+-- apa adanya di absensi_daily_counters.kategori, jadi kolomnya harus sama lebar.
+
+ALTER TABLE absensi_daily_counters MODIFY kategori VARCHAR(20) NOT NULL;
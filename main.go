@@ -1,10 +1,13 @@
 package main
 
 import (
+	"log"
+	"os"
 	"regexp"
 	"shollu/config"
 	"shollu/database"
 	"shollu/routes"
+	"shollu/services"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
@@ -52,6 +55,17 @@ func main() {
 	config.LoadConfig()
 	database.Connect()
 
+	// ./shollu rebuild-counters [date_from] [date_to]
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-counters" {
+		rebuildCounters(os.Args[2:])
+		return
+	}
+
+	services.StartAnomalyScheduler()
+	services.StartAuditRetention()
+	services.StartReportScheduler()
+	services.StartWebhookWorker()
+
 	app := fiber.New()
 
 	// Middleware Prometheus (hindari logging `/metrics`)
@@ -87,7 +101,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*", // Izinkan semua domain (ganti dengan domain frontend jika perlu)
 		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, Last-Event-ID",
 	}))
 
 	app.Options("*", func(c *fiber.Ctx) error {
@@ -101,3 +115,19 @@ func main() {
 
 	app.Listen("0.0.0.0:3000")
 }
+
+func rebuildCounters(args []string) {
+	var dateFrom, dateTo string
+	if len(args) > 0 {
+		dateFrom = args[0]
+	}
+	if len(args) > 1 {
+		dateTo = args[1]
+	}
+
+	n, err := services.RebuildDailyCounters(dateFrom, dateTo)
+	if err != nil {
+		log.Fatalln("Error rebuilding daily counters:", err)
+	}
+	log.Printf("Daily counters rebuilt: %d rows\n", n)
+}
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"log"
+	"shollu/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// AdminOnly dipasang setelah JWTMiddleware dan menolak user yang role-nya bukan
+// admin. Hasilnya disimpan di c.Locals("is_admin").
+func AdminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := 0
+		if token, ok := c.Locals("user").(*jwt.Token); ok {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				id, _ := claims["id"].(float64)
+				userID = int(id)
+			}
+		}
+		isAdmin, err := services.IsAdmin(userID)
+		if err != nil {
+			log.Println("Error checking user role:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+		if !isAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Admin access required"})
+		}
+		c.Locals("is_admin", true)
+		return c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"fmt"
+	"shollu/config"
+	"shollu/services"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// AuditActor menentukan siapa yang melakukan request dan menyimpannya di
+// c.Locals("audit_actor") untuk dipakai services.RecordAudit. Request tanpa
+// token tetap diteruskan sebagai anonymous (dikenali dari IP).
+func AuditActor() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actor := services.AuditActor{Type: "anonymous", IP: c.IP()}
+
+		if token, ok := bearerToken(c); ok {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if id, ok := claims["id"].(float64); ok {
+					actor.Type = "user"
+					actor.ID = fmt.Sprintf("%d", int(id))
+				}
+			}
+		}
+
+		c.Locals("audit_actor", actor)
+		return c.Next()
+	}
+}
+
+// bearerToken mem-parse JWT dari header Authorization tanpa menolak request
+// kalau tidak ada atau tidak valid.
+func bearerToken(c *fiber.Ctx) (*jwt.Token, bool) {
+	auth := c.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, false
+	}
+	token, err := jwt.Parse(strings.TrimPrefix(auth, "Bearer "), func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return []byte(config.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	return token, true
+}
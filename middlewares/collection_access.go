@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"log"
+	"shollu/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CollectionAccess melindungi route collection ber-:slug. Request diteruskan
+// kalau membawa JWT yang valid (disimpan di c.Locals("user") seperti
+// JWTMiddleware) atau share token untuk collection itu lewat header
+// X-Share-Token / query ?token=, dengan pin lewat X-Share-Pin / ?pin= kalau
+// link-nya memakai pin. Share token disimpan di c.Locals("share_token").
+func CollectionAccess() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token, ok := bearerToken(c); ok {
+			c.Locals("user", token)
+			return c.Next()
+		}
+
+		raw := c.Get("X-Share-Token", c.Query("token"))
+		if raw == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		share, err := services.ResolveShareToken(raw, c.Params("slug"), c.Get("X-Share-Pin", c.Query("pin")))
+		switch err {
+		case nil:
+			c.Locals("share_token", share)
+			return c.Next()
+		case services.ErrShareTokenInvalid:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Share link is invalid or has expired"})
+		case services.ErrSharePinRequired:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "PIN is required", "pin_required": true})
+		case services.ErrSharePinInvalid:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid PIN", "pin_required": true})
+		case services.ErrSharePinLocked:
+			return c.Status(fiber.StatusLocked).JSON(fiber.Map{"error": "Share link is locked, ask the owner for a new link"})
+		}
+		log.Println("Error resolving share token:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+}
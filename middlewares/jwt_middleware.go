@@ -17,3 +17,14 @@ func JWTMiddleware() fiber.Handler {
 func jwtError(c *fiber.Ctx, err error) error {
 	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 }
+
+// JWTStreamMiddleware sama dengan JWTMiddleware tetapi token juga boleh dikirim lewat
+// query ?token=, karena EventSource dan WebSocket di browser tidak bisa mengirim header.
+func JWTStreamMiddleware() fiber.Handler {
+	return jwtware.New(jwtware.Config{
+		SigningKey:   []byte(config.JWTSecret),
+		TokenLookup:  "header:Authorization,query:token",
+		AuthScheme:   "Bearer",
+		ErrorHandler: jwtError,
+	})
+}
@@ -18,13 +18,17 @@ func ApiKeyMiddleware(c *fiber.Ctx) error {
 }
 
 func SetupRoutes(app *fiber.App) {
-	api := app.Group("/api")
+	api := app.Group("/api", middlewares.AuditActor())
 	api.Post("/login", controllers.Login)
 	api.Post("/register", controllers.Register)
 	api.Post("/register-itikaf", controllers.RegisterPesertaItikaf)
 	api.Get("/register-masjid/:id_event", controllers.GetMasjidList)
+	api.Get("/capacity/:id_event", controllers.GetEventCapacity)
+	api.Get("/events/:id_event/form-fields", controllers.GetEventFormFields)
 	api.Get("/rekap-absen/:id_masjid", controllers.GetRekapAbsen)
 	api.Get("/rekap-absen-sholat/:id_masjid", controllers.GetRekapSholat)
+	api.Get("/rekap-sesi/:id_session", controllers.GetRekapSesi)
+	api.Get("/sessions", controllers.GetEventSessions)
 	api.Get("/get-masjid/:id_masjid", controllers.GetMasjidByID)
 	api.Get("/statistics-event", controllers.GetEventStatistics)
 	api.Get("/dashboard", controllers.GetNewRegistrantStatistics)
@@ -34,17 +38,99 @@ func SetupRoutes(app *fiber.App) {
 
 	apiV1 := app.Group("/api/v1")
 	apiV1.Post("/absent-qr", ApiKeyMiddleware, controllers.SaveAbsenQR)
-	apiV1.Post("/collections-create", controllers.CreateCollection)
-	apiV1.Get("/collections-get-absensi/:slug", controllers.ViewCollection)
-	apiV1.Get("/collections-get", controllers.GetCollectionsMeta)
-	apiV1.Get("/collections-get-meta/:slug", controllers.GetCollectionsMetaDetail)
-	apiV1.Post("/collections/add-peserta", controllers.AddPesertaToCollection)
+	apiV1.Post("/collections-create", middlewares.JWTMiddleware(), controllers.CreateCollection)
+	apiV1.Get("/collections-get-absensi/:slug", middlewares.CollectionAccess(), controllers.ViewCollection)
+	apiV1.Get("/collections-get", middlewares.JWTMiddleware(), controllers.GetCollectionsMeta)
+	apiV1.Get("/collections-get-meta/:slug", middlewares.CollectionAccess(), controllers.GetCollectionsMetaDetail)
+	apiV1.Post("/collections/add-peserta", middlewares.JWTMiddleware(), controllers.AddPesertaToCollection)
 	apiV1.Get("/data-peserta-masjid", controllers.GetPesertaDanMasjid)
-	apiV1.Get("/collections-absensi/:slug", controllers.ViewCollectionNew)
+	apiV1.Get("/collections-absensi/:slug", middlewares.CollectionAccess(), controllers.ViewCollectionNew)
+	apiV1.Get("/collections-ranking/:slug", middlewares.CollectionAccess(), controllers.GetCollectionRanking)
+
+	apiV1.Get("/leaderboard", controllers.GetLeaderboard)
+	apiV1.Get("/peserta/:id/achievements", controllers.GetPesertaAchievements)
+	apiV1.Get("/household/:qr_code", controllers.GetHousehold)
+	apiV1.Get("/household/:qr_code/members/:id/absensi", controllers.GetHouseholdMemberAbsensi)
 
 	apiV1.Get("/collections/category-collection", controllers.GetKategoriCollection)
-	apiV1.Get("/collections/collection-category", controllers.GetCollectionsByCategory)
+	apiV1.Get("/collections/collection-category", middlewares.JWTMiddleware(), controllers.GetCollectionsByCategory)
+
+	live := api.Group("/live", middlewares.JWTStreamMiddleware())
+	live.Get("/:id_event/:id_masjid/stream", controllers.StreamLiveFeed)
+	live.Get("/:id_event/:id_masjid/ws", controllers.LiveFeedUpgrade, controllers.LiveFeedWebSocket)
 
 	user := api.Group("/users", middlewares.JWTMiddleware())
 	user.Get("/profile", controllers.GetProfile)
+
+	// Collection dikelola pemiliknya sendiri, cukup login; admin boleh mengelola semua
+	collections := api.Group("/collections", middlewares.JWTMiddleware())
+	collections.Post("/", controllers.CreateCollection)
+	collections.Get("/:id", controllers.GetCollection)
+	collections.Put("/:id", controllers.UpdateCollection)
+	collections.Delete("/:id", controllers.DeleteCollection)
+	collections.Post("/:id/members", controllers.AddCollectionMembers)
+	collections.Post("/:id/members/remove", controllers.RemoveCollectionMembers)
+	collections.Delete("/:id/members/:id_peserta", controllers.DeleteCollectionMember)
+	collections.Get("/:id/targets", controllers.GetCollectionTargets)
+	collections.Put("/:id/targets", controllers.UpdateCollectionTargets)
+	collections.Get("/:id/share-tokens", controllers.GetCollectionShareTokens)
+	collections.Post("/:id/share-tokens", controllers.CreateCollectionShareToken)
+	collections.Delete("/:id/share-tokens/:token_id", controllers.RevokeCollectionShareToken)
+	collections.Put("/:id/categories", controllers.UpdateCollectionCategories)
+
+	admin := api.Group("/admin", middlewares.JWTMiddleware(), middlewares.AdminOnly())
+	admin.Get("/absensi-flags", controllers.GetAbsensiFlags)
+	admin.Post("/absensi-flags/run-batch", controllers.RunAnomalyBatch)
+	admin.Post("/absensi-flags/:id/review", controllers.ReviewAbsensiFlag)
+	admin.Post("/absensi/manual", controllers.CreateManualAbsensi)
+	admin.Post("/absensi/:id/void", controllers.VoidAbsensi)
+	admin.Post("/absensi/:id/restore", controllers.RestoreAbsensi)
+	admin.Get("/absensi/:id/audit", controllers.GetAbsensiAudit)
+	admin.Get("/audit-events", controllers.GetAuditEvents)
+	admin.Get("/poin-rules", controllers.GetPoinRules)
+	admin.Put("/poin-rules", controllers.UpdatePoinRules)
+	admin.Post("/poin/recompute", controllers.RecomputePoin)
+	admin.Post("/achievements/backfill", controllers.BackfillAchievements)
+	admin.Get("/badges", controllers.GetBadges)
+	admin.Post("/badges", controllers.CreateBadge)
+	admin.Put("/badges/:id", controllers.UpdateBadge)
+	admin.Delete("/badges/:id", controllers.DeleteBadge)
+	admin.Get("/report-schedules", controllers.GetReportSchedules)
+	admin.Post("/report-schedules", controllers.CreateReportSchedule)
+	admin.Put("/report-schedules/:id", controllers.UpdateReportSchedule)
+	admin.Delete("/report-schedules/:id", controllers.DeleteReportSchedule)
+	admin.Post("/report-schedules/:id/run", controllers.RunReportSchedule)
+	admin.Get("/report-schedules/:id/runs", controllers.GetReportRuns)
+	admin.Get("/analytics/cohorts", controllers.GetRetentionCohorts)
+	admin.Get("/analytics/trends", controllers.GetPrayerTrends)
+	admin.Get("/analytics/churn", controllers.GetChurnList)
+	admin.Get("/analytics/growth", controllers.GetMasjidGrowth)
+	admin.Put("/regional/:id/timezone", controllers.UpdateRegionalTimezone)
+	admin.Put("/masjid/:id/timezone", controllers.UpdateMasjidTimezone)
+	admin.Get("/age-brackets", controllers.GetAgeBrackets)
+	admin.Put("/age-brackets", controllers.UpdateAgeBrackets)
+	admin.Post("/counters/rebuild", controllers.RebuildDailyCounters)
+	admin.Get("/counters/check", controllers.CheckDailyCounters)
+	admin.Put("/capacity", controllers.UpdateEventCapacity)
+	admin.Put("/events/:id_event/form-fields", controllers.UpdateEventFormFields)
+	admin.Get("/events/:id_event/registrations", controllers.GetEventRegistrations)
+	admin.Get("/peserta/:id/enrollments", controllers.GetPesertaEnrollments)
+	admin.Post("/peserta/:id/enrollments", controllers.EnrollPeserta)
+	admin.Post("/peserta/:id/events/:id_event/cancel", controllers.CancelPesertaEnrollment)
+	admin.Post("/peserta/:id/events/:id_event/transfer", controllers.TransferPesertaEnrollment)
+	admin.Post("/collection-categories", controllers.CreateCollectionCategory)
+	admin.Put("/collection-categories/:id", controllers.UpdateCollectionCategory)
+	admin.Delete("/collection-categories/:id", controllers.DeleteCollectionCategory)
+	admin.Get("/households", controllers.GetHouseholdByContact)
+	admin.Put("/households/:id/guardian", controllers.UpdateHouseholdGuardian)
+	admin.Get("/sessions", controllers.GetAdminEventSessions)
+	admin.Post("/sessions", controllers.CreateEventSession)
+	admin.Put("/sessions/:id", controllers.UpdateEventSession)
+	admin.Delete("/sessions/:id", controllers.DeleteEventSession)
+	admin.Get("/webhooks", controllers.GetWebhookSubscriptions)
+	admin.Post("/webhooks", controllers.CreateWebhookSubscription)
+	admin.Put("/webhooks/:id", controllers.UpdateWebhookSubscription)
+	admin.Delete("/webhooks/:id", controllers.DeleteWebhookSubscription)
+	admin.Get("/webhook-deliveries", controllers.GetWebhookDeliveries)
+	admin.Post("/webhook-deliveries/:id/redeliver", controllers.RedeliverWebhook)
 }
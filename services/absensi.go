@@ -0,0 +1,223 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrAbsensiNotFound      = errors.New("absensi not found")
+	ErrAbsensiAlreadyVoided = errors.New("absensi already voided")
+	ErrAbsensiNotVoided     = errors.New("absensi is not voided")
+)
+
+// AbsensiRecord adalah absensi yang baru saja disimpan, dipakai oleh hook setelah insert
+// (poin, anomali, dsb). Tanggal adalah tanggal lokal absensi di zona masjid.
+type AbsensiRecord struct {
+	ID        int64
+	UserID    int
+	MesinID   string
+	EventID   int
+	Tag       string
+	Tanggal   string
+	CreatedAt time.Time // UTC
+}
+
+// AbsensiSnapshot adalah isi satu baris absensi, disimpan sebagai before/after di audit log.
+type AbsensiSnapshot struct {
+	ID           int64      `json:"id"`
+	UserID       int        `json:"user_id"`
+	FingerID     string     `json:"finger_id"`
+	MesinID      string     `json:"mesin_id"`
+	EventID      int        `json:"event_id"`
+	Tag          string     `json:"tag"`
+	SessionID    *int       `json:"session_id"`
+	Jam          time.Time  `json:"jam"`
+	CreatedAt    time.Time  `json:"created_at"`
+	IsManual     bool       `json:"is_manual"`
+	ManualReason string     `json:"manual_reason"`
+	VoidedAt     *time.Time `json:"voided_at"`
+	VoidedBy     *int       `json:"voided_by"`
+	VoidReason   string     `json:"void_reason"`
+}
+
+// ManualAbsensi adalah data absensi yang diinput manual ketika scanner gagal.
+type ManualAbsensi struct {
+	UserID  int
+	QRCode  string
+	MesinID string
+	EventID int
+	Tag     string
+	Waktu   time.Time
+	Reason  string
+	ActorID int
+}
+
+// CreateManualAbsensi menyimpan absensi manual beserta poin, counter dashboard
+// dan audit log-nya. Record yang dikembalikan dipakai pemanggil untuk webhook dan
+// evaluasi badge, sama seperti scan QR.
+func CreateManualAbsensi(tx *sql.Tx, entry ManualAbsensi) (AbsensiRecord, error) {
+	waktu := entry.Waktu.UTC()
+	rec := AbsensiRecord{
+		UserID:    entry.UserID,
+		MesinID:   entry.MesinID,
+		EventID:   entry.EventID,
+		Tag:       entry.Tag,
+		Tanggal:   entry.Waktu.Format("2006-01-02"), // Waktu sudah dalam zona masjid
+		CreatedAt: waktu,
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO absensi (user_id, finger_id, jam, mesin_id, event_id, tag, created_at, is_manual, manual_reason, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?)`,
+		entry.UserID, entry.QRCode, waktu, entry.MesinID, entry.EventID, entry.Tag, waktu, entry.Reason, entry.ActorID)
+	if err != nil {
+		return rec, err
+	}
+
+	rec.ID, err = result.LastInsertId()
+	if err != nil {
+		return rec, err
+	}
+
+	if err := AwardPoin(tx, rec); err != nil {
+		return rec, err
+	}
+	if err := AdjustDailyCounters(tx, rec.ID, 1); err != nil {
+		return rec, err
+	}
+
+	after, err := loadAbsensiSnapshot(tx, rec.ID)
+	if err != nil {
+		return rec, err
+	}
+	return rec, writeAbsensiAudit(tx, rec.ID, "create", entry.ActorID, entry.Reason, nil, after)
+}
+
+// VoidAbsensi menandai absensi sebagai void (soft delete). Baris tidak dihapus
+// supaya tetap bisa diaudit, tapi tidak lagi dihitung di rekap maupun statistik,
+// dan badge yang hanya terpenuhi karena absensi ini dicabut.
+func VoidAbsensi(tx *sql.Tx, absensiID int64, actorID int, reason string) error {
+	before, err := loadAbsensiSnapshot(tx, absensiID)
+	if err != nil {
+		return err
+	}
+	if before.VoidedAt != nil {
+		return ErrAbsensiAlreadyVoided
+	}
+
+	_, err = tx.Exec(`
+		UPDATE absensi SET voided_at = ?, voided_by = ?, void_reason = ?
+		WHERE id = ? AND voided_at IS NULL`,
+		time.Now().UTC(), actorID, reason, absensiID)
+	if err != nil {
+		return err
+	}
+	if err := AdjustDailyCounters(tx, absensiID, -1); err != nil {
+		return err
+	}
+	if err := ReevaluateAchievements(tx, before.UserID, before.EventID); err != nil {
+		return err
+	}
+
+	after, err := loadAbsensiSnapshot(tx, absensiID)
+	if err != nil {
+		return err
+	}
+	return writeAbsensiAudit(tx, absensiID, "void", actorID, reason, before, after)
+}
+
+// RestoreAbsensi membatalkan void sehingga absensi kembali dihitung.
+func RestoreAbsensi(tx *sql.Tx, absensiID int64, actorID int, reason string) error {
+	before, err := loadAbsensiSnapshot(tx, absensiID)
+	if err != nil {
+		return err
+	}
+	if before.VoidedAt == nil {
+		return ErrAbsensiNotVoided
+	}
+
+	_, err = tx.Exec(`
+		UPDATE absensi SET voided_at = NULL, voided_by = NULL, void_reason = NULL
+		WHERE id = ?`, absensiID)
+	if err != nil {
+		return err
+	}
+	if err := AdjustDailyCounters(tx, absensiID, 1); err != nil {
+		return err
+	}
+	if err := ReevaluateAchievements(tx, before.UserID, before.EventID); err != nil {
+		return err
+	}
+
+	after, err := loadAbsensiSnapshot(tx, absensiID)
+	if err != nil {
+		return err
+	}
+	return writeAbsensiAudit(tx, absensiID, "restore", actorID, reason, before, after)
+}
+
+// LoadAbsensiSnapshot membaca satu baris absensi (termasuk yang sudah di-void).
+func LoadAbsensiSnapshot(tx *sql.Tx, absensiID int64) (*AbsensiSnapshot, error) {
+	return loadAbsensiSnapshot(tx, absensiID)
+}
+
+func loadAbsensiSnapshot(tx *sql.Tx, absensiID int64) (*AbsensiSnapshot, error) {
+	var s AbsensiSnapshot
+	var voidedAt sql.NullTime
+	var voidedBy, sessionID sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT id, user_id, COALESCE(finger_id, ''), mesin_id, event_id, COALESCE(tag, ''), session_id, jam, created_at,
+			is_manual, COALESCE(manual_reason, ''), voided_at, voided_by, COALESCE(void_reason, '')
+		FROM absensi WHERE id = ? FOR UPDATE`, absensiID).Scan(
+		&s.ID, &s.UserID, &s.FingerID, &s.MesinID, &s.EventID, &s.Tag, &sessionID, &s.Jam, &s.CreatedAt,
+		&s.IsManual, &s.ManualReason, &voidedAt, &voidedBy, &s.VoidReason)
+	if err == sql.ErrNoRows {
+		return nil, ErrAbsensiNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if sessionID.Valid {
+		id := int(sessionID.Int64)
+		s.SessionID = &id
+	}
+	if voidedAt.Valid {
+		s.VoidedAt = &voidedAt.Time
+	}
+	if voidedBy.Valid {
+		by := int(voidedBy.Int64)
+		s.VoidedBy = &by
+	}
+	return &s, nil
+}
+
+func writeAbsensiAudit(tx *sql.Tx, absensiID int64, action string, actorID int, reason string, before, after *AbsensiSnapshot) error {
+	beforeJSON, err := snapshotJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshotJSON(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO absensi_audit (absensi_id, action, actor_id, reason, before_data, after_data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		absensiID, action, actorID, reason, beforeJSON, afterJSON, time.Now().UTC())
+	return err
+}
+
+func snapshotJSON(s *AbsensiSnapshot) (interface{}, error) {
+	if s == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
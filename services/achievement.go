@@ -0,0 +1,411 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+// Badge adalah definisi achievement. Satu hari dihitung "hadir" kalau peserta
+// absen di semua Tags pada hari itu (dan di MasjidID kalau diisi). Badge diraih
+// ketika streak mencapai ConsecutiveDays dan total hari mencapai MinCount
+// (kriteria bernilai 0 diabaikan).
+type Badge struct {
+	ID              int      `json:"id"`
+	Code            string   `json:"code"`
+	Nama            string   `json:"nama"`
+	Deskripsi       string   `json:"deskripsi"`
+	EventID         int      `json:"event_id"`
+	Tags            []string `json:"tags"`
+	ConsecutiveDays int      `json:"consecutive_days"`
+	MinCount        int      `json:"min_count"`
+	MasjidID        *int     `json:"masjid_id"`
+	Active          bool     `json:"active"`
+}
+
+var ErrBadgeNotFound = errors.New("badge not found")
+
+// Streak adalah progres peserta terhadap satu badge.
+type Streak struct {
+	Badge        Badge      `json:"badge"`
+	Current      int        `json:"current"`
+	Longest      int        `json:"longest"`
+	TotalDays    int        `json:"total_days"`
+	LastDate     string     `json:"last_date"`
+	AchievedAt   *time.Time `json:"-"`
+	AchievedDate string     `json:"-"`
+}
+
+// pesertaDay adalah rekap kehadiran peserta dalam satu hari (WIB).
+type pesertaDay struct {
+	Tags     map[string]bool
+	LastScan time.Time
+}
+
+// LoadBadges mengambil semua badge aktif.
+func LoadBadges() ([]Badge, error) {
+	return queryBadges("WHERE active = 1")
+}
+
+// ListBadges mengambil semua badge termasuk yang nonaktif, untuk halaman admin.
+func ListBadges() ([]Badge, error) {
+	return queryBadges("")
+}
+
+// LoadBadge mengambil satu badge (aktif maupun tidak).
+func LoadBadge(id int) (*Badge, error) {
+	badges, err := queryBadges("WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(badges) == 0 {
+		return nil, ErrBadgeNotFound
+	}
+	return &badges[0], nil
+}
+
+func queryBadges(where string, args ...interface{}) ([]Badge, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, code, nama, deskripsi, event_id, tags, consecutive_days, min_count, masjid_id, active
+		FROM badges `+where+` ORDER BY id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	badges := []Badge{}
+	for rows.Next() {
+		var b Badge
+		var tags string
+		var masjidID sql.NullInt64
+		if err := rows.Scan(&b.ID, &b.Code, &b.Nama, &b.Deskripsi, &b.EventID, &tags, &b.ConsecutiveDays, &b.MinCount, &masjidID, &b.Active); err != nil {
+			return nil, err
+		}
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+				b.Tags = append(b.Tags, tag)
+			}
+		}
+		if masjidID.Valid {
+			id := int(masjidID.Int64)
+			b.MasjidID = &id
+		}
+		badges = append(badges, b)
+	}
+	return badges, rows.Err()
+}
+
+// PesertaStreaks menghitung progres peserta untuk setiap badge aktif.
+func PesertaStreaks(userID int) ([]Streak, error) {
+	badges, err := LoadBadges()
+	if err != nil {
+		return nil, err
+	}
+
+	days := make(map[int]map[string]*pesertaDay)
+	today := utils.Today(PesertaLocation(userID))
+
+	streaks := []Streak{}
+	for _, badge := range badges {
+		if _, ok := days[badge.EventID]; !ok {
+			days[badge.EventID], err = loadPesertaDays(database.DB, userID, badge.EventID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		streaks = append(streaks, computeStreak(badge, days[badge.EventID], today))
+	}
+	return streaks, nil
+}
+
+// EvaluateScanAchievements dipanggil setelah scan; hanya badge yang memuat tag
+// scan tersebut yang dievaluasi ulang.
+func EvaluateScanAchievements(scan AbsensiRecord) {
+	badges, err := LoadBadges()
+	if err != nil {
+		log.Println("Error loading badges:", err)
+		return
+	}
+
+	// Scan jumat juga relevan untuk badge dzuhur
+	scanned := map[string]bool{scan.Tag: true}
+	var relevant []Badge
+	for _, badge := range badges {
+		if badge.EventID != scan.EventID {
+			continue
+		}
+		for _, tag := range badge.Tags {
+			if TagAttended(scanned, tag) {
+				relevant = append(relevant, badge)
+				break
+			}
+		}
+	}
+	if len(relevant) == 0 {
+		return
+	}
+
+	if _, err := evaluateAchievements(scan.UserID, relevant); err != nil {
+		log.Printf("Error evaluating achievements for peserta %d: %v", scan.UserID, err)
+	}
+}
+
+// BackfillAchievements mengevaluasi semua badge dari riwayat absensi. Waktu award
+// diambil dari scan terakhir pada hari kriteria badge pertama kali terpenuhi.
+// userID 0 berarti semua peserta. Mengembalikan jumlah badge baru.
+func BackfillAchievements(userID int) (int, error) {
+	badges, err := LoadBadges()
+	if err != nil {
+		return 0, err
+	}
+	if len(badges) == 0 {
+		return 0, nil
+	}
+
+	var userIDs []int
+	if userID > 0 {
+		userIDs = append(userIDs, userID)
+	} else {
+		rows, err := database.DB.Query("SELECT DISTINCT user_id FROM absensi WHERE voided_at IS NULL")
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			userIDs = append(userIDs, id)
+		}
+		rows.Close()
+	}
+
+	total := 0
+	for _, id := range userIDs {
+		awarded, err := evaluateAchievements(id, badges)
+		if err != nil {
+			return total, err
+		}
+		total += awarded
+	}
+	return total, nil
+}
+
+// evaluateAchievements memberikan badge yang kriterianya sudah terpenuhi dan belum
+// dimiliki peserta. Pencabutan badge setelah void ada di ReevaluateAchievements.
+func evaluateAchievements(userID int, badges []Badge) (int, error) {
+	earned := make(map[int]bool)
+	rows, err := database.DB.Query("SELECT badge_id FROM peserta_badges WHERE peserta_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		earned[id] = true
+	}
+	rows.Close()
+
+	days := make(map[int]map[string]*pesertaDay)
+	today := utils.Today(PesertaLocation(userID))
+	awarded := 0
+	for _, badge := range badges {
+		if earned[badge.ID] {
+			continue
+		}
+		if _, ok := days[badge.EventID]; !ok {
+			days[badge.EventID], err = loadPesertaDays(database.DB, userID, badge.EventID)
+			if err != nil {
+				return awarded, err
+			}
+		}
+
+		streak := computeStreak(badge, days[badge.EventID], today)
+		if streak.AchievedAt == nil {
+			continue
+		}
+
+		result, err := database.DB.Exec(`
+			INSERT IGNORE INTO peserta_badges (peserta_id, badge_id, awarded_at) VALUES (?, ?, ?)`,
+			userID, badge.ID, streak.AchievedAt.UTC())
+		if err != nil {
+			return awarded, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			awarded++
+		}
+	}
+	return awarded, nil
+}
+
+// ReevaluateAchievements menyesuaikan badge peserta di satu event setelah
+// absensinya di-void atau di-restore, dalam transaksi yang sama: badge yang
+// kriterianya tidak lagi terpenuhi dicabut, yang terpenuhi lagi diberikan kembali.
+func ReevaluateAchievements(tx *sql.Tx, userID, eventID int) error {
+	badges, err := LoadBadges()
+	if err != nil {
+		return err
+	}
+
+	earned := make(map[int]bool)
+	rows, err := tx.Query("SELECT badge_id FROM peserta_badges WHERE peserta_id = ? FOR UPDATE", userID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		earned[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	days, err := loadPesertaDays(tx, userID, eventID)
+	if err != nil {
+		return err
+	}
+	today := utils.Today(PesertaLocation(userID))
+	for _, badge := range badges {
+		if badge.EventID != eventID {
+			continue
+		}
+		streak := computeStreak(badge, days, today)
+		switch {
+		case streak.AchievedAt == nil && earned[badge.ID]:
+			_, err = tx.Exec("DELETE FROM peserta_badges WHERE peserta_id = ? AND badge_id = ?", userID, badge.ID)
+		case streak.AchievedAt != nil && !earned[badge.ID]:
+			_, err = tx.Exec(`
+				INSERT IGNORE INTO peserta_badges (peserta_id, badge_id, awarded_at) VALUES (?, ?, ?)`,
+				userID, badge.ID, streak.AchievedAt.UTC())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadPesertaDays(exec interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, userID, eventID int) (map[string]*pesertaDay, error) {
+	rows, err := exec.Query(`
+		SELECT DATE_FORMAT(`+MasjidLocalTimeSQL("a.created_at", "pt.id_masjid")+`, '%Y-%m-%d'), a.tag, COALESCE(pt.id_masjid, 0), a.created_at
+		FROM absensi a
+		LEFT JOIN petugas pt ON a.mesin_id = pt.id_user
+		WHERE a.user_id = ? AND a.event_id = ? AND a.voided_at IS NULL AND a.tag <> ''`, userID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]*pesertaDay)
+	for rows.Next() {
+		var tanggal, tag string
+		var masjidID int
+		var createdAt time.Time
+		if err := rows.Scan(&tanggal, &tag, &masjidID, &createdAt); err != nil {
+			return nil, err
+		}
+		day, ok := days[tanggal]
+		if !ok {
+			day = &pesertaDay{Tags: make(map[string]bool)}
+			days[tanggal] = day
+		}
+		// Simpan per tag+masjid supaya badge dengan scope masjid bisa dicek
+		tag = strings.ToLower(tag)
+		day.Tags[tag] = true
+		day.Tags[tag+"@"+strconv.Itoa(masjidID)] = true
+		// Jumat menggantikan dzuhur di hari Jumat
+		if tag == TagJumat {
+			day.Tags["dzuhur"] = true
+			day.Tags["dzuhur@"+strconv.Itoa(masjidID)] = true
+		}
+		if createdAt.After(day.LastScan) {
+			day.LastScan = createdAt
+		}
+	}
+	return days, rows.Err()
+}
+
+// computeStreak menghitung streak berjalan, streak terpanjang, total hari dan
+// kapan kriteria badge pertama kali terpenuhi.
+func computeStreak(badge Badge, days map[string]*pesertaDay, today string) Streak {
+	streak := Streak{Badge: badge}
+
+	var dates []string
+	for tanggal, day := range days {
+		if dayQualifies(badge, day) {
+			dates = append(dates, tanggal)
+		}
+	}
+	sort.Strings(dates)
+
+	run := 0
+	var prev time.Time
+	for _, tanggal := range dates {
+		d, err := time.Parse("2006-01-02", tanggal)
+		if err != nil {
+			continue
+		}
+		if run > 0 && d.Sub(prev) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		prev = d
+		streak.TotalDays++
+		if run > streak.Longest {
+			streak.Longest = run
+		}
+
+		if streak.AchievedAt == nil && run >= badge.ConsecutiveDays && streak.TotalDays >= badge.MinCount {
+			at := days[tanggal].LastScan
+			streak.AchievedAt = &at
+			streak.AchievedDate = tanggal
+		}
+	}
+
+	if len(dates) > 0 {
+		streak.LastDate = dates[len(dates)-1]
+		// Streak masih berjalan kalau hari terakhir adalah hari ini atau kemarin
+		// (sholat hari ini belum tentu sudah lengkap)
+		t, _ := time.Parse("2006-01-02", today)
+		last, _ := time.Parse("2006-01-02", streak.LastDate)
+		if t.Sub(last) <= 24*time.Hour {
+			streak.Current = run
+		}
+	}
+	return streak
+}
+
+func dayQualifies(badge Badge, day *pesertaDay) bool {
+	if len(badge.Tags) == 0 {
+		return false
+	}
+	for _, tag := range badge.Tags {
+		key := tag
+		if badge.MasjidID != nil {
+			key = tag + "@" + strconv.Itoa(*badge.MasjidID)
+		}
+		if !day.Tags[key] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+// Ambang batas rule anomali. Nilai default cukup longgar supaya antrian review
+// tidak dibanjiri false positive, bisa dituning tanpa mengubah rule-nya.
+var (
+	AnomalyMultiMasjidWindow = 30 * time.Minute // QR yang sama di masjid berbeda dalam rentang ini
+	AnomalyBurstPerMinute    = 100              // jumlah scan per menit per mesin
+	AnomalyGroupMaxPeserta   = 5                // "kelompok kecil" yang selalu di-scan petugas yang sama
+	AnomalyGroupMinSlot      = 10               // minimal slot (tanggal x sholat) sebelum dianggap pola
+	AnomalyGroupLookbackDays = 7
+	AnomalyBatchHour         = 1 // jam (WIB) batch harian dijalankan
+)
+
+// AnomalyFlag adalah satu temuan rule terhadap satu baris absensi.
+type AnomalyFlag struct {
+	AbsensiID int64
+	Rule      string
+	Detail    string
+}
+
+// AnomalyRule mendefinisikan satu pola mencurigakan. Scan dipanggil setiap insert
+// absensi, Batch dipanggil oleh job harian; salah satunya boleh nil.
+type AnomalyRule struct {
+	Name  string
+	Scan  func(db *sql.DB, scan AbsensiRecord) ([]AnomalyFlag, error)
+	Batch func(db *sql.DB, tanggal string) ([]AnomalyFlag, error)
+}
+
+var AnomalyRules = []AnomalyRule{
+	{Name: "multi_masjid", Scan: scanMultiMasjid, Batch: batchMultiMasjid},
+	{Name: "device_burst", Scan: scanDeviceBurst, Batch: batchDeviceBurst},
+	{Name: "same_group", Batch: batchSameGroup},
+}
+
+// CheckScanAnomalies menjalankan semua rule realtime untuk satu scan dan menyimpan flag-nya.
+func CheckScanAnomalies(scan AbsensiRecord) {
+	var flags []AnomalyFlag
+	for _, rule := range AnomalyRules {
+		if rule.Scan == nil {
+			continue
+		}
+		found, err := rule.Scan(database.DB, scan)
+		if err != nil {
+			log.Printf("Anomaly rule %s failed for absensi %d: %v", rule.Name, scan.ID, err)
+			continue
+		}
+		flags = append(flags, found...)
+	}
+
+	if err := saveAnomalyFlags(flags, "realtime"); err != nil {
+		log.Println("Error saving anomaly flags:", err)
+	}
+}
+
+// RunAnomalyBatch menjalankan semua rule batch untuk satu tanggal (WIB) dan
+// mengembalikan jumlah flag yang ditemukan.
+func RunAnomalyBatch(tanggal string) (int, error) {
+	var flags []AnomalyFlag
+	for _, rule := range AnomalyRules {
+		if rule.Batch == nil {
+			continue
+		}
+		found, err := rule.Batch(database.DB, tanggal)
+		if err != nil {
+			return 0, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		flags = append(flags, found...)
+	}
+
+	if err := saveAnomalyFlags(flags, "batch"); err != nil {
+		return 0, err
+	}
+	return len(flags), nil
+}
+
+// StartAnomalyScheduler menjalankan batch anomali setiap malam untuk data hari sebelumnya.
+func StartAnomalyScheduler() {
+	go func() {
+		loc := utils.DefaultLocation()
+		for {
+			now := time.Now().In(loc)
+			next := time.Date(now.Year(), now.Month(), now.Day(), AnomalyBatchHour, 0, 0, 0, loc)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			tanggal := next.AddDate(0, 0, -1).Format("2006-01-02")
+			total, err := RunAnomalyBatch(tanggal)
+			if err != nil {
+				log.Println("Anomaly batch failed:", err)
+				continue
+			}
+			log.Printf("Anomaly batch %s: %d flag", tanggal, total)
+		}
+	}()
+}
+
+func saveAnomalyFlags(flags []AnomalyFlag, source string) error {
+	if len(flags) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(flags))
+	args := make([]interface{}, 0, len(flags)*4)
+	for _, f := range flags {
+		placeholders = append(placeholders, "(?, ?, ?, ?)")
+		args = append(args, f.AbsensiID, f.Rule, f.Detail, source)
+	}
+
+	// Flag yang sama (absensi + rule) cukup dicatat sekali
+	_, err := database.DB.Exec(`
+		INSERT IGNORE INTO absensi_flags (absensi_id, rule, detail, source)
+		VALUES `+strings.Join(placeholders, ","), args...)
+	return err
+}
+
+func scanMultiMasjid(db *sql.DB, scan AbsensiRecord) ([]AnomalyFlag, error) {
+	rows, err := db.Query(`
+		SELECT a.id, m.nama
+		FROM absensi a
+		JOIN petugas pt ON a.mesin_id = pt.id_user
+		JOIN masjid m ON pt.id_masjid = m.id
+		WHERE a.user_id = ? AND a.id <> ? AND a.voided_at IS NULL
+			AND a.created_at BETWEEN ? AND ?
+			AND pt.id_masjid <> (SELECT id_masjid FROM petugas WHERE id_user = ? LIMIT 1)`,
+		scan.UserID, scan.ID,
+		scan.CreatedAt.Add(-AnomalyMultiMasjidWindow), scan.CreatedAt.Add(AnomalyMultiMasjidWindow),
+		scan.MesinID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []AnomalyFlag
+	for rows.Next() {
+		var otherID int64
+		var masjidName string
+		if err := rows.Scan(&otherID, &masjidName); err != nil {
+			return nil, err
+		}
+		flags = append(flags,
+			AnomalyFlag{AbsensiID: scan.ID, Rule: "multi_masjid", Detail: fmt.Sprintf("QR juga di-scan di %s (absensi #%d)", masjidName, otherID)},
+			AnomalyFlag{AbsensiID: otherID, Rule: "multi_masjid", Detail: fmt.Sprintf("QR juga di-scan di masjid lain (absensi #%d)", scan.ID)},
+		)
+	}
+	return flags, rows.Err()
+}
+
+func batchMultiMasjid(db *sql.DB, tanggal string) ([]AnomalyFlag, error) {
+	window := int(AnomalyMultiMasjidWindow / time.Minute)
+	rows, err := db.Query(`
+		SELECT a1.id, a2.id, m1.nama, m2.nama
+		FROM absensi a1
+		JOIN petugas p1 ON a1.mesin_id = p1.id_user
+		JOIN absensi a2 ON a2.user_id = a1.user_id AND a2.id > a1.id AND a2.voided_at IS NULL
+			AND a2.created_at BETWEEN a1.created_at - INTERVAL ? MINUTE AND a1.created_at + INTERVAL ? MINUTE
+		JOIN petugas p2 ON a2.mesin_id = p2.id_user AND p2.id_masjid <> p1.id_masjid
+		JOIN masjid m1 ON p1.id_masjid = m1.id
+		JOIN masjid m2 ON p2.id_masjid = m2.id
+		WHERE a1.voided_at IS NULL
+			AND `+AbsensiLocalDateSQL("a1")+` = ?`,
+		window, window, tanggal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []AnomalyFlag
+	for rows.Next() {
+		var id1, id2 int64
+		var masjid1, masjid2 string
+		if err := rows.Scan(&id1, &id2, &masjid1, &masjid2); err != nil {
+			return nil, err
+		}
+		flags = append(flags,
+			AnomalyFlag{AbsensiID: id1, Rule: "multi_masjid", Detail: fmt.Sprintf("QR juga di-scan di %s (absensi #%d)", masjid2, id2)},
+			AnomalyFlag{AbsensiID: id2, Rule: "multi_masjid", Detail: fmt.Sprintf("QR juga di-scan di %s (absensi #%d)", masjid1, id1)},
+		)
+	}
+	return flags, rows.Err()
+}
+
+func scanDeviceBurst(db *sql.DB, scan AbsensiRecord) ([]AnomalyFlag, error) {
+	var total int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM absensi
+		WHERE mesin_id = ? AND voided_at IS NULL AND created_at > ? AND created_at <= ?`,
+		scan.MesinID, scan.CreatedAt.Add(-time.Minute), scan.CreatedAt).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+	if total <= AnomalyBurstPerMinute {
+		return nil, nil
+	}
+	return []AnomalyFlag{{
+		AbsensiID: scan.ID,
+		Rule:      "device_burst",
+		Detail:    fmt.Sprintf("Mesin %s melakukan %d scan dalam 1 menit", scan.MesinID, total),
+	}}, nil
+}
+
+func batchDeviceBurst(db *sql.DB, tanggal string) ([]AnomalyFlag, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.mesin_id, burst.total
+		FROM absensi a
+		JOIN (
+			SELECT mesin_id, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i') AS menit, COUNT(*) AS total
+			FROM absensi
+			WHERE voided_at IS NULL
+				AND `+AbsensiLocalDateSQL("")+` = ?
+			GROUP BY mesin_id, menit
+			HAVING total > ?
+		) burst ON a.mesin_id = burst.mesin_id
+			AND DATE_FORMAT(a.created_at, '%Y-%m-%d %H:%i') = burst.menit
+		WHERE a.voided_at IS NULL`,
+		tanggal, AnomalyBurstPerMinute)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []AnomalyFlag
+	for rows.Next() {
+		var id int64
+		var mesinID string
+		var total int
+		if err := rows.Scan(&id, &mesinID, &total); err != nil {
+			return nil, err
+		}
+		flags = append(flags, AnomalyFlag{
+			AbsensiID: id,
+			Rule:      "device_burst",
+			Detail:    fmt.Sprintf("Mesin %s melakukan %d scan dalam 1 menit", mesinID, total),
+		})
+	}
+	return flags, rows.Err()
+}
+
+// batchSameGroup mencari petugas yang selama beberapa hari terakhir hanya men-scan
+// kelompok kecil yang sama di hampir setiap sholat.
+func batchSameGroup(db *sql.DB, tanggal string) ([]AnomalyFlag, error) {
+	rows, err := db.Query(`
+		SELECT mesin_id, COUNT(DISTINCT user_id) AS peserta,
+			COUNT(DISTINCT `+AbsensiLocalDateSQL("")+`, tag) AS slot,
+			COUNT(*) AS total
+		FROM absensi
+		WHERE voided_at IS NULL AND tag <> ''
+			AND `+AbsensiLocalDateSQL("")+` BETWEEN DATE_SUB(?, INTERVAL ? DAY) AND ?
+		GROUP BY mesin_id
+		HAVING peserta <= ? AND slot >= ? AND total >= peserta * slot * 0.9`,
+		tanggal, AnomalyGroupLookbackDays-1, tanggal, AnomalyGroupMaxPeserta, AnomalyGroupMinSlot)
+	if err != nil {
+		return nil, err
+	}
+
+	type suspect struct {
+		MesinID string
+		Peserta int
+		Slot    int
+	}
+	var suspects []suspect
+	for rows.Next() {
+		var s suspect
+		var total int
+		if err := rows.Scan(&s.MesinID, &s.Peserta, &s.Slot, &total); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		suspects = append(suspects, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var flags []AnomalyFlag
+	for _, s := range suspects {
+		idRows, err := db.Query(`
+			SELECT id FROM absensi
+			WHERE mesin_id = ? AND voided_at IS NULL
+				AND `+AbsensiLocalDateSQL("")+` = ?`,
+			s.MesinID, tanggal)
+		if err != nil {
+			return nil, err
+		}
+		for idRows.Next() {
+			var id int64
+			if err := idRows.Scan(&id); err != nil {
+				idRows.Close()
+				return nil, err
+			}
+			flags = append(flags, AnomalyFlag{
+				AbsensiID: id,
+				Rule:      "same_group",
+				Detail: fmt.Sprintf("Mesin %s hanya men-scan %d peserta yang sama di %d sholat selama %d hari terakhir",
+					s.MesinID, s.Peserta, s.Slot, AnomalyGroupLookbackDays),
+			})
+		}
+		idRows.Close()
+		if err := idRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return flags, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"reflect"
+	"time"
+
+	"shollu/config"
+	"shollu/database"
+)
+
+// AuditActor adalah pihak yang melakukan perubahan: user (JWT), device (mesin scanner)
+// atau anonymous yang hanya dikenali dari IP.
+type AuditActor struct {
+	Type string
+	ID   string
+	IP   string
+}
+
+// Execer dipenuhi oleh *sql.DB maupun *sql.Tx, supaya audit bisa ikut transaksi.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// RecordAudit menyimpan satu audit event. before/after boleh struct, map atau nil;
+// yang disimpan hanya field yang berubah dalam bentuk {"field": [lama, baru]}.
+func RecordAudit(exec Execer, actor AuditActor, action, entity, entityID string, before, after interface{}) error {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	var diffJSON interface{}
+	if len(diff) > 0 {
+		b, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		diffJSON = string(b)
+	}
+
+	actorType := actor.Type
+	if actorType == "" {
+		actorType = "anonymous"
+	}
+
+	_, err = exec.Exec(`
+		INSERT INTO audit_events (actor_type, actor_id, ip, action, entity, entity_id, diff, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		actorType, actor.ID, actor.IP, action, entity, entityID, diffJSON, time.Now().UTC())
+	return err
+}
+
+// StartAuditRetention menghapus audit event yang lebih tua dari AUDIT_RETENTION_DAYS setiap hari.
+func StartAuditRetention() {
+	if config.AuditRetentionDays <= 0 {
+		return
+	}
+
+	go func() {
+		for {
+			cutoff := time.Now().UTC().AddDate(0, 0, -config.AuditRetentionDays)
+			total, err := purgeAuditEvents(cutoff)
+			if err != nil {
+				log.Println("Audit retention failed:", err)
+			} else if total > 0 {
+				log.Printf("Audit retention: %d event dihapus", total)
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
+
+func purgeAuditEvents(cutoff time.Time) (int64, error) {
+	var total int64
+	for {
+		// Hapus bertahap supaya tidak mengunci tabel terlalu lama
+		result, err := database.DB.Exec("DELETE FROM audit_events WHERE created_at < ? LIMIT 5000", cutoff)
+		if err != nil {
+			return total, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += affected
+		if affected < 5000 {
+			return total, nil
+		}
+	}
+}
+
+func auditDiff(before, after interface{}) (map[string][2]interface{}, error) {
+	beforeMap, err := toAuditMap(before)
+	if err != nil {
+		return nil, err
+	}
+	afterMap, err := toAuditMap(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string][2]interface{})
+	for key, newValue := range afterMap {
+		oldValue, ok := beforeMap[key]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			diff[key] = [2]interface{}{oldValue, newValue}
+		}
+	}
+	for key, oldValue := range beforeMap {
+		if _, ok := afterMap[key]; !ok {
+			diff[key] = [2]interface{}{oldValue, nil}
+		}
+	}
+	return diff, nil
+}
+
+func toAuditMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return map[string]interface{}{}, nil
+	}
+
+	// Lewat JSON supaya tag `json:"-"` (misal password) otomatis tidak ikut tersimpan
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"shollu/database"
+)
+
+var ErrCapacityFull = errors.New("capacity and waitlist are full")
+
+// MasjidCapacity adalah kapasitas satu (masjid, event) beserta pemakaiannya.
+// Sisa nil berarti tidak dibatasi.
+type MasjidCapacity struct {
+	MasjidID      int  `json:"masjid_id"`
+	EventID       int  `json:"event_id"`
+	Capacity      *int `json:"capacity"`
+	WaitlistLimit *int `json:"waitlist_limit"`
+	Terdaftar     int  `json:"terdaftar"`
+	Waitlist      int  `json:"waitlist"`
+	Sisa          *int `json:"sisa"`
+}
+
+// ReserveSeat menentukan status pendaftaran baru di (masjid, event) dan harus
+// dipanggil di transaksi yang sama dengan insert detail_peserta. Baris kapasitas
+// dikunci sehingga pendaftaran bersamaan dihitung satu per satu. Mengembalikan
+// ErrCapacityFull kalau kursi dan antrian tunggu sudah penuh.
+func ReserveSeat(tx *sql.Tx, eventID, masjidID int) (int, error) {
+	var capacity int
+	var waitlistLimit sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT capacity, waitlist_limit FROM masjid_event_capacity
+		WHERE masjid_id = ? AND event_id = ? FOR UPDATE`, masjidID, eventID).Scan(&capacity, &waitlistLimit)
+	if err == sql.ErrNoRows {
+		return EnrollmentActive, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	terdaftar, waitlist, err := countEnrollments(tx, eventID, masjidID)
+	if err != nil {
+		return 0, err
+	}
+	if terdaftar < capacity {
+		return EnrollmentActive, nil
+	}
+	if waitlistLimit.Valid && waitlist >= int(waitlistLimit.Int64) {
+		return 0, ErrCapacityFull
+	}
+	return EnrollmentWaitlist, nil
+}
+
+// PromoteWaitlist memindahkan antrian tunggu terlama ke terdaftar selama masih ada
+// kursi, lalu mengirim webhook peserta.promoted. Panggil setelah pendaftaran
+// dibatalkan/dipindah atau kapasitas dinaikkan. Mengembalikan id peserta yang naik.
+func PromoteWaitlist(tx *sql.Tx, eventID, masjidID int) ([]int, error) {
+	var capacity int
+	err := tx.QueryRow(`
+		SELECT capacity FROM masjid_event_capacity
+		WHERE masjid_id = ? AND event_id = ? FOR UPDATE`, masjidID, eventID).Scan(&capacity)
+	if err == sql.ErrNoRows {
+		// Tanpa batas kapasitas semua antrian langsung naik
+		capacity = -1
+	} else if err != nil {
+		return nil, err
+	}
+
+	terdaftar, _, err := countEnrollments(tx, eventID, masjidID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT id_peserta FROM detail_peserta
+		WHERE id_event = ? AND masjid_id = ? AND status = ?
+		ORDER BY waitlisted_at ASC, id_peserta ASC`
+	args := []interface{}{eventID, masjidID, EnrollmentWaitlist}
+	if capacity >= 0 {
+		if terdaftar >= capacity {
+			return nil, nil
+		}
+		query += " LIMIT ?"
+		args = append(args, capacity-terdaftar)
+	}
+
+	rows, err := tx.Query(query+" FOR UPDATE", args...)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range promoted {
+		_, err := tx.Exec(`
+			UPDATE detail_peserta SET status = ?, waitlisted_at = NULL
+			WHERE id_peserta = ? AND id_event = ?`, EnrollmentActive, id, eventID)
+		if err != nil {
+			return nil, err
+		}
+		err = writeEnrollmentHistory(tx, EnrollmentChange{
+			PesertaID:    id,
+			EventID:      eventID,
+			Action:       "promote",
+			FromStatus:   EnrollmentWaitlist,
+			ToStatus:     EnrollmentActive,
+			FromMasjidID: masjidID,
+			ToMasjidID:   masjidID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = EmitEvent(tx, EventPesertaPromoted, map[string]interface{}{
+			"peserta_id":  id,
+			"event_id":    eventID,
+			"masjid_id":   masjidID,
+			"promoted_at": time.Now().UTC(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+// LoadCapacities mengambil kapasitas dan pemakaian untuk semua masjid event
+// (masjid yang terdaftar di setting untuk event tersebut). masjidID 0 berarti semua.
+func LoadCapacities(eventID, masjidID int) ([]MasjidCapacity, error) {
+	query := `
+		SELECT s.id_masjid, c.capacity, c.waitlist_limit,
+			(SELECT COUNT(*) FROM detail_peserta dp WHERE dp.id_event = s.id_event AND dp.masjid_id = s.id_masjid AND dp.status = ?),
+			(SELECT COUNT(*) FROM detail_peserta dp WHERE dp.id_event = s.id_event AND dp.masjid_id = s.id_masjid AND dp.status = ?)
+		FROM setting s
+		LEFT JOIN masjid_event_capacity c ON c.masjid_id = s.id_masjid AND c.event_id = s.id_event
+		WHERE s.id_event = ?`
+	args := []interface{}{EnrollmentActive, EnrollmentWaitlist, eventID}
+	if masjidID != 0 {
+		query += " AND s.id_masjid = ?"
+		args = append(args, masjidID)
+	}
+	query += " ORDER BY s.id_masjid ASC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	capacities := []MasjidCapacity{}
+	for rows.Next() {
+		c := MasjidCapacity{EventID: eventID}
+		var capacity, waitlistLimit sql.NullInt64
+		if err := rows.Scan(&c.MasjidID, &capacity, &waitlistLimit, &c.Terdaftar, &c.Waitlist); err != nil {
+			return nil, err
+		}
+		if capacity.Valid {
+			n := int(capacity.Int64)
+			sisa := n - c.Terdaftar
+			if sisa < 0 {
+				sisa = 0
+			}
+			c.Capacity, c.Sisa = &n, &sisa
+		}
+		if waitlistLimit.Valid {
+			n := int(waitlistLimit.Int64)
+			c.WaitlistLimit = &n
+		}
+		capacities = append(capacities, c)
+	}
+	return capacities, rows.Err()
+}
+
+func countEnrollments(tx *sql.Tx, eventID, masjidID int) (terdaftar, waitlist int, err error) {
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(status = ?), 0), COALESCE(SUM(status = ?), 0)
+		FROM detail_peserta WHERE id_event = ? AND masjid_id = ?`,
+		EnrollmentActive, EnrollmentWaitlist, eventID, masjidID).Scan(&terdaftar, &waitlist)
+	return terdaftar, waitlist, err
+}
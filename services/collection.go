@@ -0,0 +1,290 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"shollu/database"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrNotCollectionOwner = errors.New("collection belongs to another user")
+	ErrNoMemberSelector   = errors.New("qr_codes, peserta_ids or filter is required")
+	ErrEmptyMemberFilter  = errors.New("filter needs at least one of masjid_id, event_id or gender")
+)
+
+// Collection adalah satu baris collections. MasjidID berisi "all" atau id
+// dipisah koma, TrackingCode kode sholat dipisah koma (lihat collectionSholatMap).
+type Collection struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	TrackingCode string `json:"tracking_code"`
+	DateStart    string `json:"date_start"`
+	DateEnd      string `json:"date_end"`
+	MasjidID     string `json:"masjid_id"`
+	OwnerUserID  *int   `json:"owner_user_id"`
+	Members      int    `json:"members"`
+}
+
+// MemberFilter memilih peserta dari pendaftaran aktif, misalnya semua
+// pendaftar masjid X. Field kosong/0 tidak menyaring, tetapi minimal satu
+// field harus diisi supaya filter tidak memilih semua peserta.
+type MemberFilter struct {
+	MasjidID int    `json:"masjid_id" validate:"omitempty,min=1"`
+	EventID  int    `json:"event_id" validate:"omitempty,min=1"`
+	Gender   string `json:"gender" validate:"omitempty,oneof=male female"`
+}
+
+// MemberSelector adalah kumpulan peserta untuk operasi anggota collection;
+// ketiga cara boleh digabung.
+type MemberSelector struct {
+	QRCodes    []string      `json:"qr_codes" validate:"max=5000"`
+	PesertaIDs []int64       `json:"peserta_ids" validate:"max=5000,dive,min=1"`
+	Filter     *MemberFilter `json:"filter"`
+}
+
+// LoadCollection mengambil collection beserta jumlah anggotanya.
+func LoadCollection(id int64) (*Collection, error) {
+	return loadCollection("c.id = ?", id)
+}
+
+// LoadCollectionBySlug sama dengan LoadCollection tapi dicari dari slug.
+func LoadCollectionBySlug(slug string) (*Collection, error) {
+	return loadCollection("c.slug = ?", slug)
+}
+
+func loadCollection(where string, arg interface{}) (*Collection, error) {
+	var col Collection
+	var owner sql.NullInt64
+	err := database.DB.QueryRow(`
+		SELECT c.id, c.name, c.slug, c.tracking_code, DATE_FORMAT(c.date_start, '%Y-%m-%d'), DATE_FORMAT(c.date_end, '%Y-%m-%d'),
+			c.masjid_id, c.owner_user_id, (SELECT COUNT(*) FROM collection_items ci WHERE ci.collection_id = c.id)
+		FROM collections c WHERE `+where, arg).
+		Scan(&col.ID, &col.Name, &col.Slug, &col.TrackingCode, &col.DateStart, &col.DateEnd, &col.MasjidID, &owner, &col.Members)
+	if err == sql.ErrNoRows {
+		return nil, ErrCollectionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if owner.Valid {
+		id := int(owner.Int64)
+		col.OwnerUserID = &id
+	}
+	return &col, nil
+}
+
+// CheckCollectionOwner memastikan userID boleh mengubah collection. Admin boleh
+// mengubah semua collection; collection tanpa pemilik (dibuat sebelum ada
+// kepemilikan) hanya boleh diubah admin.
+func CheckCollectionOwner(col *Collection, userID int, isAdmin bool) error {
+	if isAdmin {
+		return nil
+	}
+	if col.OwnerUserID == nil || *col.OwnerUserID != userID {
+		return ErrNotCollectionOwner
+	}
+	return nil
+}
+
+// ResolveMemberSelector mengubah selector menjadi daftar id peserta unik.
+// Mengembalikan juga QR code/id yang tidak ditemukan.
+func ResolveMemberSelector(sel MemberSelector) ([]int64, []string, error) {
+	if len(sel.QRCodes) == 0 && len(sel.PesertaIDs) == 0 && sel.Filter == nil {
+		return nil, nil, ErrNoMemberSelector
+	}
+	if f := sel.Filter; f != nil && f.MasjidID == 0 && f.EventID == 0 && f.Gender == "" {
+		return nil, nil, ErrEmptyMemberFilter
+	}
+	seen := make(map[int64]bool)
+	ids := []int64{}
+	missing := []string{}
+	add := func(id int64) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if len(sel.QRCodes) > 0 {
+		found, err := pesertaByColumn("qr_code", stringArgs(sel.QRCodes))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, qr := range sel.QRCodes {
+			if id, ok := found[qr]; ok {
+				add(id)
+			} else {
+				missing = append(missing, qr)
+			}
+		}
+	}
+
+	if len(sel.PesertaIDs) > 0 {
+		args := make([]interface{}, len(sel.PesertaIDs))
+		for i, id := range sel.PesertaIDs {
+			args[i] = id
+		}
+		found, err := pesertaByColumn("id", args)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, id := range sel.PesertaIDs {
+			key := strconv.FormatInt(id, 10)
+			if _, ok := found[key]; ok {
+				add(id)
+			} else {
+				missing = append(missing, key)
+			}
+		}
+	}
+
+	if f := sel.Filter; f != nil {
+		rows, err := database.DB.Query(`
+			SELECT DISTINCT dp.id_peserta
+			FROM detail_peserta dp
+			JOIN peserta p ON dp.id_peserta = p.id
+			WHERE dp.status = ?
+				AND (? = 0 OR dp.masjid_id = ?)
+				AND (? = 0 OR dp.id_event = ?)
+				AND (? = '' OR p.gender = ?)
+			ORDER BY dp.id_peserta`,
+			EnrollmentActive, f.MasjidID, f.MasjidID, f.EventID, f.EventID, f.Gender, f.Gender)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, nil, err
+			}
+			add(id)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, missing, nil
+}
+
+// AddCollectionMembers menambahkan peserta ke collection dan melewati yang
+// sudah menjadi anggota. Mengembalikan id peserta yang benar-benar ditambahkan.
+func AddCollectionMembers(tx *sql.Tx, col *Collection, pesertaIDs []int64) ([]int64, error) {
+	existing := make(map[int64]bool)
+	rows, err := tx.Query("SELECT id_peserta FROM collection_items WHERE collection_id = ? FOR UPDATE", col.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO collection_items (create_time, collection_id, collection_slug, id_peserta)
+		VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	added := []int64{}
+	for _, id := range pesertaIDs {
+		if existing[id] {
+			continue
+		}
+		if _, err := stmt.Exec(now, col.ID, col.Slug, id); err != nil {
+			return nil, err
+		}
+		existing[id] = true
+		added = append(added, id)
+	}
+	return added, nil
+}
+
+// RemoveCollectionMembers mengeluarkan peserta dari collection dan
+// mengembalikan id peserta yang benar-benar dihapus.
+func RemoveCollectionMembers(tx *sql.Tx, collectionID int64, pesertaIDs []int64) ([]int64, error) {
+	removed := []int64{}
+	for _, id := range pesertaIDs {
+		res, err := tx.Exec("DELETE FROM collection_items WHERE collection_id = ? AND id_peserta = ?", collectionID, id)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			removed = append(removed, id)
+		}
+	}
+	return removed, nil
+}
+
+// DeleteCollection menghapus collection beserta anggota, target, link berbagi dan
+// relasi kategorinya.
+func DeleteCollection(tx *sql.Tx, collectionID int64) error {
+	for _, query := range []string{
+		"DELETE FROM collection_items WHERE collection_id = ?",
+		"DELETE FROM collection_targets WHERE collection_id = ?",
+		"DELETE FROM collection_share_tokens WHERE collection_id = ?",
+		"DELETE FROM detail_category_collection WHERE collection_id = ?",
+		"DELETE FROM collections WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, collectionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pesertaByColumn memetakan nilai column (qr_code atau id) ke id peserta.
+func pesertaByColumn(column string, values []interface{}) (map[string]int64, error) {
+	found := make(map[string]int64)
+	for start := 0; start < len(values); start += 500 {
+		end := start + 500
+		if end > len(values) {
+			end = len(values)
+		}
+		chunk := values[start:end]
+		rows, err := database.DB.Query(
+			"SELECT id, CAST("+column+" AS CHAR) FROM peserta WHERE "+column+" IN (?"+strings.Repeat(",?", len(chunk)-1)+")",
+			chunk...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var key string
+			if err := rows.Scan(&id, &key); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found[key] = id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
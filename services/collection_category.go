@@ -0,0 +1,353 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+var (
+	ErrCategoryNotFound      = errors.New("category not found")
+	ErrCategoryParentInvalid = errors.New("parent category not found or belongs to another masjid")
+	ErrCategoryCycle         = errors.New("category cannot be its own ancestor")
+	ErrCategoryHasChildren   = errors.New("category still has subcategories")
+	ErrCategoryScope         = errors.New("category belongs to another masjid")
+)
+
+// CollectionCategory adalah satu baris category_collection. MasjidID nil berarti
+// kategori global; Collections jumlah collection yang langsung di kategori ini.
+type CollectionCategory struct {
+	ID          int                  `json:"id"`
+	Name        string               `json:"name"`
+	ParentID    *int                 `json:"parent_id"`
+	MasjidID    *int                 `json:"masjid_id"`
+	Collections int                  `json:"collections"`
+	Children    []CollectionCategory `json:"children,omitempty"`
+}
+
+// CategoryCollection adalah collection di daftar per kategori.
+type CategoryCollection struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	Masjid    string `json:"masjid"`
+	DateStart string `json:"date_start"`
+}
+
+// LoadCategories mengambil kategori global ditambah kategori masjidID; masjidID 0
+// mengambil semua kategori.
+func LoadCategories(masjidID int) ([]CollectionCategory, error) {
+	rows, err := database.DB.Query(`
+		SELECT cc.id, cc.category_name, cc.parent_id, cc.masjid_id,
+			(SELECT COUNT(*) FROM detail_category_collection dc WHERE dc.category_id = cc.id)
+		FROM category_collection cc
+		WHERE ? = 0 OR cc.masjid_id IS NULL OR cc.masjid_id = ?
+		ORDER BY cc.category_name ASC, cc.id ASC`, masjidID, masjidID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []CollectionCategory{}
+	for rows.Next() {
+		var cat CollectionCategory
+		var parent, masjid sql.NullInt64
+		if err := rows.Scan(&cat.ID, &cat.Name, &parent, &masjid, &cat.Collections); err != nil {
+			return nil, err
+		}
+		cat.ParentID = nullIntPtr(parent)
+		cat.MasjidID = nullIntPtr(masjid)
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// LoadCategory mengambil satu kategori.
+func LoadCategory(id int) (*CollectionCategory, error) {
+	var cat CollectionCategory
+	var parent, masjid sql.NullInt64
+	err := database.DB.QueryRow(`
+		SELECT cc.id, cc.category_name, cc.parent_id, cc.masjid_id,
+			(SELECT COUNT(*) FROM detail_category_collection dc WHERE dc.category_id = cc.id)
+		FROM category_collection cc WHERE cc.id = ?`, id).
+		Scan(&cat.ID, &cat.Name, &parent, &masjid, &cat.Collections)
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	cat.ParentID = nullIntPtr(parent)
+	cat.MasjidID = nullIntPtr(masjid)
+	return &cat, nil
+}
+
+// CategoryTree menyusun daftar datar menjadi pohon. Kategori yang parent-nya
+// tidak ada di daftar menjadi akar.
+func CategoryTree(categories []CollectionCategory) []CollectionCategory {
+	byParent := make(map[int][]CollectionCategory)
+	known := make(map[int]bool)
+	for _, cat := range categories {
+		known[cat.ID] = true
+	}
+	roots := []CollectionCategory{}
+	for _, cat := range categories {
+		if cat.ParentID != nil && known[*cat.ParentID] {
+			byParent[*cat.ParentID] = append(byParent[*cat.ParentID], cat)
+		} else {
+			roots = append(roots, cat)
+		}
+	}
+	visited := make(map[int]bool)
+	var attach func(list []CollectionCategory) []CollectionCategory
+	attach = func(list []CollectionCategory) []CollectionCategory {
+		for i := range list {
+			if !visited[list[i].ID] {
+				visited[list[i].ID] = true
+				list[i].Children = attach(byParent[list[i].ID])
+			}
+		}
+		return list
+	}
+	return attach(roots)
+}
+
+// CategoryDescendants mengembalikan id kategori beserta semua turunannya.
+func CategoryDescendants(categories []CollectionCategory, id int) []int {
+	children := make(map[int][]int)
+	for _, cat := range categories {
+		if cat.ParentID != nil {
+			children[*cat.ParentID] = append(children[*cat.ParentID], cat.ID)
+		}
+	}
+	seen := map[int]bool{id: true}
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// SaveCategory membuat kategori baru (id 0) atau mengubah kategori id. Parent
+// harus ada, bukan turunan kategori itu sendiri, dan global atau di masjid yang sama.
+func SaveCategory(tx *sql.Tx, id int, name string, parentID, masjidID *int) (int, error) {
+	if parentID != nil {
+		var parentMasjid sql.NullInt64
+		err := tx.QueryRow("SELECT masjid_id FROM category_collection WHERE id = ?", *parentID).Scan(&parentMasjid)
+		if err == sql.ErrNoRows {
+			return 0, ErrCategoryParentInvalid
+		} else if err != nil {
+			return 0, err
+		}
+		if parentMasjid.Valid && (masjidID == nil || int64(*masjidID) != parentMasjid.Int64) {
+			return 0, ErrCategoryParentInvalid
+		}
+		if id != 0 {
+			if err := checkCategoryCycle(tx, id, *parentID); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	now := time.Now()
+	if id == 0 {
+		res, err := tx.Exec(`
+			INSERT INTO category_collection (category_name, parent_id, masjid_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)`, name, intPtrArg(parentID), intPtrArg(masjidID), now, now)
+		if err != nil {
+			return 0, err
+		}
+		newID, err := res.LastInsertId()
+		return int(newID), err
+	}
+
+	res, err := tx.Exec(`
+		UPDATE category_collection SET category_name = ?, parent_id = ?, masjid_id = ?, updated_at = ?
+		WHERE id = ?`, name, intPtrArg(parentID), intPtrArg(masjidID), now, id)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := LoadCategory(id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// DeleteCategory menghapus kategori beserta relasinya ke collection. Kategori
+// yang masih punya sub kategori tidak boleh dihapus.
+func DeleteCategory(tx *sql.Tx, id int) error {
+	var children int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM category_collection WHERE parent_id = ?", id).Scan(&children); err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrCategoryHasChildren
+	}
+	if _, err := tx.Exec("DELETE FROM detail_category_collection WHERE category_id = ?", id); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM category_collection WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// CollectionCategoryIDs mengambil id kategori sebuah collection.
+func CollectionCategoryIDs(collectionID int64) ([]int, error) {
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT category_id FROM detail_category_collection
+		WHERE collection_id = ? ORDER BY category_id`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SetCollectionCategories mengganti seluruh kategori collection. Kategori khusus
+// masjid hanya boleh dipakai collection untuk semua masjid atau yang mencakup
+// masjid tersebut.
+func SetCollectionCategories(tx *sql.Tx, col *Collection, categoryIDs []int) error {
+	masjids := make(map[string]bool)
+	for _, id := range strings.Split(col.MasjidID, ",") {
+		masjids[strings.TrimSpace(id)] = true
+	}
+	seen := make(map[int]bool)
+	for _, id := range categoryIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var masjid sql.NullInt64
+		err := tx.QueryRow("SELECT masjid_id FROM category_collection WHERE id = ?", id).Scan(&masjid)
+		if err == sql.ErrNoRows {
+			return ErrCategoryNotFound
+		} else if err != nil {
+			return err
+		}
+		if masjid.Valid && col.MasjidID != "all" && !masjids[strconv.FormatInt(masjid.Int64, 10)] {
+			return ErrCategoryScope
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM detail_category_collection WHERE collection_id = ?", col.ID); err != nil {
+		return err
+	}
+	for id := range seen {
+		if _, err := tx.Exec(`
+			INSERT INTO detail_category_collection (category_id, collection_id) VALUES (?, ?)`, id, col.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollectionsByCategory mengambil satu halaman collection di kategori
+// categoryIDs, opsional hanya yang mencakup masjidID. Mengembalikan juga totalnya.
+func CollectionsByCategory(categoryIDs []int, masjidID int, q *utils.ListQuery) ([]CategoryCollection, int, error) {
+	collections := []CategoryCollection{}
+	if len(categoryIDs) == 0 {
+		return collections, 0, nil
+	}
+	args := make([]interface{}, 0, len(categoryIDs)+3)
+	for _, id := range categoryIDs {
+		args = append(args, id)
+	}
+	args = append(args, masjidID, masjidID)
+	where := `
+		FROM collections c
+		WHERE c.id IN (SELECT dc.collection_id FROM detail_category_collection dc
+				WHERE dc.category_id IN (?` + strings.Repeat(",?", len(categoryIDs)-1) + `))
+			AND (? = 0 OR c.masjid_id = 'all' OR FIND_IN_SET(?, REPLACE(c.masjid_id, ' ', '')) > 0)`
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*)"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	if cond, condArgs := q.CursorSQL("c.id"); cond != "" {
+		where += " AND " + cond
+		args = append(args, condArgs...)
+	}
+	limitSQL, limitArgs := q.LimitSQL()
+	rows, err := database.DB.Query(`
+		SELECT c.id, c.name, c.slug, c.masjid_id, DATE_FORMAT(c.date_start, '%Y-%m-%d')`+where+q.OrderSQL("c.id")+limitSQL,
+		append(args, limitArgs...)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var col CategoryCollection
+		if err := rows.Scan(&col.ID, &col.Name, &col.Slug, &col.Masjid, &col.DateStart); err != nil {
+			return nil, 0, err
+		}
+		collections = append(collections, col)
+	}
+	if n := len(collections); n > 0 {
+		last := collections[n-1]
+		sortValue := map[string]interface{}{"name": last.Name, "date_start": last.DateStart}[q.Sort]
+		q.NextAfter(n, sortValue, last.ID)
+	}
+	return collections, total, rows.Err()
+}
+
+// checkCategoryCycle memastikan parentID bukan id itu sendiri atau turunannya.
+func checkCategoryCycle(tx *sql.Tx, id, parentID int) error {
+	seen := make(map[int]bool)
+	for current := parentID; ; {
+		if current == id {
+			return ErrCategoryCycle
+		}
+		if seen[current] {
+			return nil
+		}
+		seen[current] = true
+		var parent sql.NullInt64
+		err := tx.QueryRow("SELECT parent_id FROM category_collection WHERE id = ?", current).Scan(&parent)
+		if err == sql.ErrNoRows || (err == nil && !parent.Valid) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		current = int(parent.Int64)
+	}
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+func intPtrArg(v *int) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"shollu/database"
+)
+
+// CollectionTarget adalah target kehadiran anggota collection, misalnya
+// "subuh 5x per minggu" (count, tag subuh, target 5, period week) atau "80%
+// sholat yang dilacak" (percent, target 80).
+type CollectionTarget struct {
+	ID           int     `json:"id"`
+	CollectionID int64   `json:"collection_id"`
+	Label        string  `json:"label" validate:"max=100"`
+	Tag          string  `json:"tag" validate:"max=20"`
+	Type         string  `json:"type" validate:"required,oneof=count percent"`
+	Target       float64 `json:"target" validate:"gt=0"`
+	Period       string  `json:"period" validate:"omitempty,oneof=day week range"`
+}
+
+// TargetProgress adalah capaian satu target untuk satu anggota.
+type TargetProgress struct {
+	TargetID int     `json:"target_id"`
+	Label    string  `json:"label"`
+	Actual   int     `json:"actual"`
+	Expected float64 `json:"expected"`
+	Percent  float64 `json:"percent"`
+	Met      bool    `json:"met"`
+	AtRisk   bool    `json:"at_risk"`
+}
+
+// CollectionProgress adalah ringkasan semua target satu anggota: Percent
+// rata-rata capaian, Met kalau semua target tercapai, AtRisk kalau ada target
+// yang tertinggal dari laju yang dibutuhkan.
+type CollectionProgress struct {
+	Percent float64          `json:"percent"`
+	Met     bool             `json:"met"`
+	AtRisk  bool             `json:"at_risk"`
+	Targets []TargetProgress `json:"targets"`
+}
+
+// LoadCollectionTargets mengambil target collection.
+func LoadCollectionTargets(collectionID int64) ([]CollectionTarget, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, collection_id, label, tag, type, target, period
+		FROM collection_targets WHERE collection_id = ? ORDER BY id`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []CollectionTarget{}
+	for rows.Next() {
+		var t CollectionTarget
+		if err := rows.Scan(&t.ID, &t.CollectionID, &t.Label, &t.Tag, &t.Type, &t.Target, &t.Period); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// LoadTargetsByCollection mengambil target beberapa collection sekaligus,
+// dikelompokkan per collection_id.
+func LoadTargetsByCollection(collectionIDs []int64) (map[int64][]CollectionTarget, error) {
+	byCollection := make(map[int64][]CollectionTarget)
+	if len(collectionIDs) == 0 {
+		return byCollection, nil
+	}
+	args := make([]interface{}, len(collectionIDs))
+	for i, id := range collectionIDs {
+		args[i] = id
+	}
+	rows, err := database.DB.Query(`
+		SELECT id, collection_id, label, tag, type, target, period
+		FROM collection_targets WHERE collection_id IN (?`+strings.Repeat(",?", len(args)-1)+`)
+		ORDER BY collection_id, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t CollectionTarget
+		if err := rows.Scan(&t.ID, &t.CollectionID, &t.Label, &t.Tag, &t.Type, &t.Target, &t.Period); err != nil {
+			return nil, err
+		}
+		byCollection[t.CollectionID] = append(byCollection[t.CollectionID], t)
+	}
+	return byCollection, rows.Err()
+}
+
+// ValidateCollectionTargets memastikan tag termasuk sholat yang dilacak
+// collection dan target persen tidak lebih dari 100.
+func ValidateCollectionTargets(targets []CollectionTarget, trackedTags []string) error {
+	for i, t := range targets {
+		if t.Tag != "" && !containsString(trackedTags, t.Tag) {
+			return fmt.Errorf("target %d: tag %q is not tracked by this collection", i+1, t.Tag)
+		}
+		if t.Type == "percent" && t.Target > 100 {
+			return fmt.Errorf("target %d: percent target must not exceed 100", i+1)
+		}
+	}
+	return nil
+}
+
+// ReplaceCollectionTargets mengganti seluruh target collection.
+func ReplaceCollectionTargets(tx *sql.Tx, collectionID int64, targets []CollectionTarget) error {
+	if _, err := tx.Exec("DELETE FROM collection_targets WHERE collection_id = ?", collectionID); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		period := t.Period
+		if period == "" {
+			period = "week"
+		}
+		_, err := tx.Exec(`
+			INSERT INTO collection_targets (collection_id, label, tag, type, target, period)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			collectionID, t.Label, t.Tag, t.Type, t.Target, period)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TargetLabel mengembalikan label target, dibuat dari definisinya kalau kosong.
+func TargetLabel(t CollectionTarget) string {
+	if t.Label != "" {
+		return t.Label
+	}
+	tag := t.Tag
+	if tag == "" {
+		tag = "sholat"
+	}
+	if t.Type == "percent" {
+		return fmt.Sprintf("%s %g%%", tag, t.Target)
+	}
+	per := map[string]string{"day": "per hari", "week": "per minggu", "range": "per periode"}[t.Period]
+	if per == "" {
+		per = "per minggu"
+	}
+	return fmt.Sprintf("%s %gx %s", tag, t.Target, per)
+}
+
+// EvaluateTargets menghitung capaian target satu anggota pada tanggal dates
+// (urut, YYYY-MM-DD) untuk sholat tags. hadir[tanggal][tag] true kalau hadir;
+// jumat ikut memenuhi target dzuhur.
+// Anggota at risk kalau capaiannya di bawah target x bagian rentang yang sudah
+// lewat (tanggal sampai today).
+func EvaluateTargets(targets []CollectionTarget, dates, tags []string, hadir map[string]map[string]bool, today string) CollectionProgress {
+	progress := CollectionProgress{Met: true, Targets: []TargetProgress{}}
+	if len(targets) == 0 || len(dates) == 0 {
+		return progress
+	}
+
+	elapsed := 0
+	for _, d := range dates {
+		if d <= today {
+			elapsed++
+		}
+	}
+	elapsedFraction := float64(elapsed) / float64(len(dates))
+
+	var sum float64
+	for _, t := range targets {
+		targetTags := tags
+		if t.Tag != "" {
+			targetTags = []string{t.Tag}
+		}
+		actual := 0
+		for _, d := range dates {
+			for _, tag := range targetTags {
+				if TagAttended(hadir[d], tag) {
+					actual++
+				}
+			}
+		}
+
+		days := float64(len(dates))
+		var expected float64
+		switch {
+		case t.Type == "percent":
+			expected = days * float64(len(targetTags)) * t.Target / 100
+		case t.Period == "day":
+			expected = t.Target * days
+		case t.Period == "range":
+			expected = t.Target
+		default:
+			expected = t.Target * days / 7
+		}
+
+		tp := TargetProgress{
+			TargetID: t.ID,
+			Label:    TargetLabel(t),
+			Actual:   actual,
+			Expected: math.Round(expected*100) / 100,
+			Percent:  100,
+		}
+		if expected > 0 {
+			tp.Percent = math.Round(math.Min(float64(actual)/expected, 1)*10000) / 100
+		}
+		tp.Met = float64(actual) >= expected-1e-9
+		tp.AtRisk = !tp.Met && elapsedFraction > 0 && float64(actual) < expected*elapsedFraction
+
+		sum += tp.Percent
+		progress.Met = progress.Met && tp.Met
+		progress.AtRisk = progress.AtRisk || tp.AtRisk
+		progress.Targets = append(progress.Targets, tp)
+	}
+	progress.Percent = math.Round(sum/float64(len(targets))*100) / 100
+	return progress
+}
+
+// RankEntry adalah satu baris peringkat collection.
+type RankEntry struct {
+	Rank      int                 `json:"rank"`
+	UserID    int                 `json:"user_id"`
+	Fullname  string              `json:"fullname"`
+	Score     float64             `json:"score"`
+	Total     int                 `json:"total"`
+	HariHadir int                 `json:"hari_hadir"`
+	Progress  *CollectionProgress `json:"progress,omitempty"`
+}
+
+// RankEntries mengurutkan berdasarkan Score, lalu Total, lalu HariHadir (semua
+// menurun). Peserta yang sama di ketiganya mendapat peringkat sama (1, 2, 2, 4)
+// dan diurutkan berdasarkan nama lalu id supaya hasilnya selalu sama.
+func RankEntries(entries []RankEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		if a.HariHadir != b.HariHadir {
+			return a.HariHadir > b.HariHadir
+		}
+		if na, nb := strings.ToLower(a.Fullname), strings.ToLower(b.Fullname); na != nb {
+			return na < nb
+		}
+		return a.UserID < b.UserID
+	})
+	for i := range entries {
+		if i > 0 && entries[i].Score == entries[i-1].Score && entries[i].Total == entries[i-1].Total &&
+			entries[i].HariHadir == entries[i-1].HariHadir {
+			entries[i].Rank = entries[i-1].Rank
+		} else {
+			entries[i].Rank = i + 1
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// twoWeeks adalah 14 tanggal mulai Senin 2025-03-03; 2025-03-07 dan 2025-03-14 hari Jumat.
+var twoWeeks = func() []string {
+	start, _ := time.Parse("2006-01-02", "2025-03-03")
+	dates := make([]string, 14)
+	for i := range dates {
+		dates[i] = start.AddDate(0, 0, i).Format("2006-01-02")
+	}
+	return dates
+}()
+
+var sholatTags = []string{"subuh", "dzuhur", "ashar", "maghrib", "isya"}
+
+// attend menandai hadir untuk tags di setiap tanggal dates.
+func attend(hadir map[string]map[string]bool, dates []string, tags ...string) map[string]map[string]bool {
+	if hadir == nil {
+		hadir = make(map[string]map[string]bool)
+	}
+	for _, d := range dates {
+		if hadir[d] == nil {
+			hadir[d] = make(map[string]bool)
+		}
+		for _, tag := range tags {
+			hadir[d][tag] = true
+		}
+	}
+	return hadir
+}
+
+func TestEvaluateTargets(t *testing.T) {
+	subuhWeekly := CollectionTarget{ID: 1, Type: "count", Tag: "subuh", Target: 5, Period: "week"}
+	threeDaily := CollectionTarget{ID: 2, Type: "count", Target: 3, Period: "day"}
+	percent80 := CollectionTarget{ID: 3, Type: "percent", Target: 80}
+	last := twoWeeks[len(twoWeeks)-1]
+	midway := twoWeeks[6] // 7 dari 14 hari sudah lewat
+
+	tests := []struct {
+		name         string
+		target       CollectionTarget
+		hadir        map[string]map[string]bool
+		today        string
+		wantActual   int
+		wantExpected float64
+		wantPercent  float64
+		wantMet      bool
+		wantAtRisk   bool
+	}{
+		{"count per week met", subuhWeekly, attend(nil, twoWeeks[:10], "subuh"), last, 10, 10, 100, true, false},
+		{"count per week over target", subuhWeekly, attend(nil, twoWeeks, "subuh"), last, 14, 10, 100, true, false},
+		{"count per week at risk midway", subuhWeekly, attend(nil, twoWeeks[:3], "subuh"), midway, 3, 10, 30, false, true},
+		{"count per week on pace midway", subuhWeekly, attend(nil, twoWeeks[:5], "subuh"), midway, 5, 10, 50, false, false},
+		{"count per week missed at end", subuhWeekly, attend(nil, twoWeeks[:9], "subuh"), last, 9, 10, 90, false, true},
+		{"other tags do not count", subuhWeekly, attend(nil, twoWeeks, "isya"), last, 0, 10, 0, false, true},
+		{"count per day met", threeDaily, attend(nil, twoWeeks, "subuh", "maghrib", "isya"), last, 42, 42, 100, true, false},
+		{"count per day at risk", threeDaily, attend(nil, twoWeeks, "subuh"), last, 14, 42, 33.33, false, true},
+		{"count per day on pace midway", threeDaily, attend(nil, twoWeeks[:7], "subuh", "maghrib", "isya"), midway, 21, 42, 50, false, false},
+		{"percent met", percent80, attend(nil, twoWeeks[:12], sholatTags...), last, 60, 56, 100, true, false},
+		{"percent at risk midway", percent80, attend(nil, twoWeeks[:7], "subuh", "dzuhur", "ashar"), midway, 21, 56, 37.5, false, true},
+		{"percent on pace midway", percent80, attend(nil, twoWeeks[:7], "subuh", "dzuhur", "ashar", "isya"), midway, 28, 56, 50, false, false},
+		{"not started is not at risk", subuhWeekly, nil, "2025-03-01", 0, 10, 0, false, false},
+		{"range target", CollectionTarget{ID: 4, Type: "count", Tag: "isya", Target: 3, Period: "range"},
+			attend(nil, twoWeeks[:3], "isya"), midway, 3, 3, 100, true, false},
+		{"jumat counts as dzuhur", CollectionTarget{ID: 5, Type: "count", Tag: "dzuhur", Target: 2, Period: "week"},
+			attend(attend(nil, []string{"2025-03-03", "2025-03-10"}, "dzuhur"), []string{"2025-03-07", "2025-03-14"}, TagJumat),
+			last, 4, 4, 100, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EvaluateTargets([]CollectionTarget{tt.target}, twoWeeks, sholatTags, tt.hadir, tt.today)
+			if len(got.Targets) != 1 {
+				t.Fatalf("targets = %d, want 1", len(got.Targets))
+			}
+			tp := got.Targets[0]
+			if tp.TargetID != tt.target.ID {
+				t.Errorf("target_id = %d, want %d", tp.TargetID, tt.target.ID)
+			}
+			if tp.Actual != tt.wantActual || tp.Expected != tt.wantExpected || tp.Percent != tt.wantPercent {
+				t.Errorf("actual/expected/percent = %d/%g/%g, want %d/%g/%g",
+					tp.Actual, tp.Expected, tp.Percent, tt.wantActual, tt.wantExpected, tt.wantPercent)
+			}
+			if tp.Met != tt.wantMet || tp.AtRisk != tt.wantAtRisk {
+				t.Errorf("met/at_risk = %v/%v, want %v/%v", tp.Met, tp.AtRisk, tt.wantMet, tt.wantAtRisk)
+			}
+			if got.Met != tp.Met || got.AtRisk != tp.AtRisk || got.Percent != tp.Percent {
+				t.Errorf("summary = %+v, want it to follow the only target", got)
+			}
+		})
+	}
+}
+
+func TestEvaluateTargetsSummary(t *testing.T) {
+	targets := []CollectionTarget{
+		{ID: 1, Type: "count", Tag: "subuh", Target: 5, Period: "week"},
+		{ID: 2, Type: "count", Tag: "isya", Target: 5, Period: "week"},
+	}
+	hadir := attend(attend(nil, twoWeeks, "subuh"), twoWeeks[:5], "isya")
+
+	got := EvaluateTargets(targets, twoWeeks, sholatTags, hadir, twoWeeks[len(twoWeeks)-1])
+	if got.Met {
+		t.Errorf("met = true with one target missed")
+	}
+	if !got.AtRisk {
+		t.Errorf("at_risk = false with one target behind")
+	}
+	if got.Percent != 75 {
+		t.Errorf("percent = %g, want average 75", got.Percent)
+	}
+
+	empty := EvaluateTargets(nil, twoWeeks, sholatTags, hadir, twoWeeks[0])
+	if !empty.Met || empty.AtRisk || len(empty.Targets) != 0 {
+		t.Errorf("no targets = %+v, want met with no targets", empty)
+	}
+}
+
+func TestRankEntries(t *testing.T) {
+	entries := []RankEntry{
+		{UserID: 4, Fullname: "Dodi", Score: 60, Total: 20, HariHadir: 10},
+		{UserID: 3, Fullname: "citra", Score: 80, Total: 30, HariHadir: 12},
+		{UserID: 1, Fullname: "Ahmad", Score: 95, Total: 40, HariHadir: 14},
+		{UserID: 2, Fullname: "Budi", Score: 80, Total: 30, HariHadir: 12},
+		{UserID: 6, Fullname: "Fajar", Score: 60, Total: 20, HariHadir: 9},
+		{UserID: 5, Fullname: "Eko", Score: 60, Total: 25, HariHadir: 8},
+	}
+	RankEntries(entries)
+
+	var gotIDs, gotRanks []int
+	for _, e := range entries {
+		gotIDs = append(gotIDs, e.UserID)
+		gotRanks = append(gotRanks, e.Rank)
+	}
+	// Budi dan citra seri di semua kriteria: peringkat sama, urut nama tanpa
+	// membedakan huruf besar. Eko, Dodi dan Fajar dipisahkan Total lalu HariHadir.
+	if want := []int{1, 2, 3, 5, 4, 6}; !reflect.DeepEqual(gotIDs, want) {
+		t.Errorf("order = %v, want %v", gotIDs, want)
+	}
+	if want := []int{1, 2, 2, 4, 5, 6}; !reflect.DeepEqual(gotRanks, want) {
+		t.Errorf("ranks = %v, want %v", gotRanks, want)
+	}
+
+	// Seri dengan nama yang sama diurutkan berdasarkan id
+	same := []RankEntry{{UserID: 9, Fullname: "Ali", Score: 50}, {UserID: 7, Fullname: "ali", Score: 50}}
+	RankEntries(same)
+	if same[0].UserID != 7 || same[0].Rank != 1 || same[1].Rank != 1 {
+		t.Errorf("same name tie = %+v", same)
+	}
+}
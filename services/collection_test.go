@@ -0,0 +1,22 @@
+package services
+
+import "testing"
+
+func TestResolveMemberSelectorRejectsEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		sel  MemberSelector
+		want error
+	}{
+		{"no selector", MemberSelector{}, ErrNoMemberSelector},
+		{"empty filter", MemberSelector{Filter: &MemberFilter{}}, ErrEmptyMemberFilter},
+		{"empty filter with ids", MemberSelector{PesertaIDs: []int64{}, Filter: &MemberFilter{}}, ErrEmptyMemberFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ResolveMemberSelector(tt.sel); err != tt.want {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
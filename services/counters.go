@@ -0,0 +1,259 @@
+package services
+
+import (
+	"database/sql"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+// DailyCounterKey adalah satu baris absensi_daily_counters.
+type DailyCounterKey struct {
+	Tanggal  string `json:"tanggal"`
+	EventID  int    `json:"event_id"`
+	MasjidID int    `json:"masjid_id"`
+	Tag      string `json:"tag"`
+	Gender   string `json:"gender"`
+	Kategori string `json:"kategori"`
+}
+
+// CounterMismatch adalah selisih antara counter tersimpan dan hasil hitung ulang dari absensi.
+type CounterMismatch struct {
+	DailyCounterKey
+	Stored   int `json:"stored"`
+	Expected int `json:"expected"`
+}
+
+// Tag khusus untuk jumlah peserta unik per hari di satu masjid.
+const CounterAllTags = "*"
+
+// counterSourceSQL menurunkan dimensi counter dari satu baris absensi. Tanggal
+// dihitung di zona waktu masjid; kategori adalah kode age_brackets dengan umur
+// dihitung pada tanggal absensi.
+var counterSourceSQL = `
+	SELECT a.user_id, a.event_id, COALESCE(pt.id_masjid, 0) AS masjid_id,
+		LOWER(TRIM(COALESCE(a.tag, ''))) AS tag,
+		DATE_FORMAT(` + MasjidLocalTimeSQL("a.created_at", "pt.id_masjid") + `, '%Y-%m-%d') AS tanggal,
+		COALESCE(p.gender, '` + GenderUnknown + `') AS gender,
+		` + AgeBracketSQL("p.dob", "DATE("+MasjidLocalTimeSQL("a.created_at", "pt.id_masjid")+")") + ` AS kategori
+	FROM absensi a
+	LEFT JOIN peserta p ON a.user_id = p.id
+	LEFT JOIN petugas pt ON a.mesin_id = pt.id_user`
+
+// AdjustDailyCounters meng-update counter untuk satu absensi. Panggil setelah
+// status absensi berubah dalam transaksi yang sama: delta +1 setelah insert atau
+// restore, -1 setelah void. Counter hanya berubah kalau tidak ada absensi hidup
+// lain untuk peserta yang sama di hari, masjid dan sholat tersebut.
+func AdjustDailyCounters(tx *sql.Tx, absensiID int64, delta int) error {
+	var userID int
+	var key DailyCounterKey
+	err := tx.QueryRow(counterSourceSQL+" WHERE a.id = ?", absensiID).Scan(
+		&userID, &key.EventID, &key.MasjidID, &key.Tag, &key.Tanggal, &key.Gender, &key.Kategori)
+	if err == sql.ErrNoRows {
+		return ErrAbsensiNotFound
+	} else if err != nil {
+		return err
+	}
+
+	start, end, err := utils.DayRange(key.Tanggal, key.Tanggal, MasjidLocation(key.MasjidID))
+	if err != nil {
+		return err
+	}
+
+	others := `
+		SELECT EXISTS(
+			SELECT 1 FROM absensi a
+			LEFT JOIN petugas pt ON a.mesin_id = pt.id_user
+			WHERE a.id <> ? AND a.user_id = ? AND a.event_id = ? AND COALESCE(pt.id_masjid, 0) = ?
+			AND a.voided_at IS NULL AND a.created_at >= ? AND a.created_at < ?`
+
+	var sameTag bool
+	err = tx.QueryRow(others+" AND LOWER(TRIM(COALESCE(a.tag, ''))) = ?)",
+		absensiID, userID, key.EventID, key.MasjidID, start, end, key.Tag).Scan(&sameTag)
+	if err != nil {
+		return err
+	}
+	if sameTag {
+		// Sholat ini sudah terhitung, otomatis hari ini juga
+		return nil
+	}
+	if err := bumpDailyCounter(tx, key, delta); err != nil {
+		return err
+	}
+
+	var sameDay bool
+	err = tx.QueryRow(others+")", absensiID, userID, key.EventID, key.MasjidID, start, end).Scan(&sameDay)
+	if err != nil {
+		return err
+	}
+	if sameDay {
+		return nil
+	}
+	key.Tag = CounterAllTags
+	return bumpDailyCounter(tx, key, delta)
+}
+
+func bumpDailyCounter(tx *sql.Tx, key DailyCounterKey, delta int) error {
+	_, err := tx.Exec(`
+		INSERT INTO absensi_daily_counters (tanggal, event_id, masjid_id, tag, gender, kategori, jumlah)
+		VALUES (?, ?, ?, ?, ?, ?, GREATEST(?, 0))
+		ON DUPLICATE KEY UPDATE jumlah = GREATEST(jumlah + ?, 0)`,
+		key.Tanggal, key.EventID, key.MasjidID, key.Tag, key.Gender, key.Kategori, delta, delta)
+	return err
+}
+
+// RebuildDailyCounters menghitung ulang counter dari absensi untuk rentang tanggal
+// (lokal masjid). dateFrom/dateTo kosong berarti sejak absensi pertama sampai hari ini.
+// Mengembalikan jumlah baris counter yang ditulis.
+func RebuildDailyCounters(dateFrom, dateTo string) (int, error) {
+	dateFrom, dateTo, err := resolveCounterRange(dateFrom, dateTo)
+	if err != nil {
+		return 0, err
+	}
+	start, end, err := utils.AnyZoneDayRange(dateFrom, dateTo)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM absensi_daily_counters WHERE tanggal BETWEEN ? AND ?", dateFrom, dateTo); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO absensi_daily_counters (tanggal, event_id, masjid_id, tag, gender, kategori, jumlah)
+		`+expectedCountersSQL, start, end, dateFrom, dateTo, start, end, dateFrom, dateTo)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), tx.Commit()
+}
+
+// CheckDailyCounters membandingkan counter tersimpan dengan hasil hitung ulang
+// dari absensi dan mengembalikan baris yang berbeda.
+func CheckDailyCounters(dateFrom, dateTo string) ([]CounterMismatch, error) {
+	start, end, err := utils.AnyZoneDayRange(dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := loadCounters(expectedCountersSQL, start, end, dateFrom, dateTo, start, end, dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := loadCounters(`
+		SELECT DATE_FORMAT(tanggal, '%Y-%m-%d'), event_id, masjid_id, tag, gender, kategori, jumlah
+		FROM absensi_daily_counters WHERE tanggal BETWEEN ? AND ?`, dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []CounterMismatch{}
+	for key, want := range expected {
+		if got := stored[key]; got != want {
+			mismatches = append(mismatches, CounterMismatch{DailyCounterKey: key, Stored: got, Expected: want})
+		}
+	}
+	for key, got := range stored {
+		if _, ok := expected[key]; !ok && got != 0 {
+			mismatches = append(mismatches, CounterMismatch{DailyCounterKey: key, Stored: got})
+		}
+	}
+	return mismatches, nil
+}
+
+// expectedCountersSQL menghasilkan isi counter dari absensi hidup dalam rentang
+// created_at [start, end) yang tanggal lokalnya di antara dateFrom dan dateTo.
+// Parameter: start, end, dateFrom, dateTo, start, end, dateFrom, dateTo.
+var expectedCountersSQL = `
+	SELECT tanggal, event_id, masjid_id, tag, gender, kategori, COUNT(DISTINCT user_id)
+	FROM (` + counterSourceSQL + `
+		WHERE a.voided_at IS NULL AND a.created_at >= ? AND a.created_at < ?
+	) src
+	WHERE tanggal BETWEEN ? AND ?
+	GROUP BY tanggal, event_id, masjid_id, tag, gender, kategori
+	UNION ALL
+	SELECT tanggal, event_id, masjid_id, '` + CounterAllTags + `', gender, kategori, COUNT(DISTINCT user_id)
+	FROM (` + counterSourceSQL + `
+		WHERE a.voided_at IS NULL AND a.created_at >= ? AND a.created_at < ?
+	) src
+	WHERE tanggal BETWEEN ? AND ?
+	GROUP BY tanggal, event_id, masjid_id, gender, kategori`
+
+// DailyUniqueCounts menghitung peserta unik satu tanggal lokal di semua masjid
+// (atau satu regional) per sholat, gender dan kategori, plus tag CounterAllTags
+// untuk peserta unik semua sholat. Counter per masjid tidak bisa dijumlahkan
+// untuk angka ini karena peserta yang scan di dua masjid akan terhitung dua
+// kali, jadi dihitung langsung dari absensi hari itu. MasjidID hasilnya 0.
+func DailyUniqueCounts(tanggal string, eventID, regionalID int) (map[DailyCounterKey]int, error) {
+	start, end, err := utils.AnyZoneDayRange(tanggal, tanggal)
+	if err != nil {
+		return nil, err
+	}
+	return loadCounters(dailyUniqueSQL,
+		eventID, start, end, tanggal, regionalID, regionalID,
+		eventID, start, end, tanggal, regionalID, regionalID)
+}
+
+// dailyUniqueSQL seperti expectedCountersSQL tetapi tanpa dimensi masjid.
+// Parameter: eventID, start, end, tanggal, regionalID, regionalID (dua kali).
+var dailyUniqueSQL = `
+	SELECT src.tanggal, src.event_id, 0, src.tag, src.gender, src.kategori, COUNT(DISTINCT src.user_id)
+	FROM (` + counterSourceSQL + `
+		WHERE a.voided_at IS NULL AND a.event_id = ? AND a.created_at >= ? AND a.created_at < ?
+	) src
+	JOIN masjid m ON src.masjid_id = m.id
+	WHERE src.tanggal = ? AND (? = 0 OR m.regional_id = ?)
+	GROUP BY src.tanggal, src.event_id, src.tag, src.gender, src.kategori
+	UNION ALL
+	SELECT src.tanggal, src.event_id, 0, '` + CounterAllTags + `', src.gender, src.kategori, COUNT(DISTINCT src.user_id)
+	FROM (` + counterSourceSQL + `
+		WHERE a.voided_at IS NULL AND a.event_id = ? AND a.created_at >= ? AND a.created_at < ?
+	) src
+	JOIN masjid m ON src.masjid_id = m.id
+	WHERE src.tanggal = ? AND (? = 0 OR m.regional_id = ?)
+	GROUP BY src.tanggal, src.event_id, src.gender, src.kategori`
+
+func loadCounters(query string, args ...interface{}) (map[DailyCounterKey]int, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := make(map[DailyCounterKey]int)
+	for rows.Next() {
+		var key DailyCounterKey
+		var n int
+		if err := rows.Scan(&key.Tanggal, &key.EventID, &key.MasjidID, &key.Tag, &key.Gender, &key.Kategori, &n); err != nil {
+			return nil, err
+		}
+		counters[key] = n
+	}
+	return counters, rows.Err()
+}
+
+func resolveCounterRange(dateFrom, dateTo string) (string, string, error) {
+	if dateTo == "" {
+		dateTo = utils.LatestToday()
+	}
+	if dateFrom == "" {
+		// WIB adalah zona paling barat, jadi tanggalnya paling awal
+		var first sql.NullString
+		err := database.DB.QueryRow(`
+			SELECT DATE_FORMAT(CONVERT_TZ(MIN(created_at), '+00:00', '+07:00'), '%Y-%m-%d') FROM absensi`).Scan(&first)
+		if err != nil {
+			return "", "", err
+		}
+		dateFrom = dateTo
+		if first.Valid {
+			dateFrom = first.String
+		}
+	}
+	return dateFrom, dateTo, nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"shollu/database"
+)
+
+// AgeBracket adalah satu kelompok umur, misalnya pelajar 0-17. MaxAge nil berarti
+// tanpa batas atas. Peserta tanpa tanggal lahir masuk ke bracket IsDefault.
+type AgeBracket struct {
+	ID        int    `json:"id"`
+	Code      string `json:"code" validate:"required,max=20"`
+	Label     string `json:"label" validate:"required,max=50"`
+	MinAge    int    `json:"min_age" validate:"min=0"`
+	MaxAge    *int   `json:"max_age"`
+	IsDefault bool   `json:"is_default"`
+	Urutan    int    `json:"urutan"`
+}
+
+// DemographicCount adalah jumlah peserta unik untuk satu kombinasi sholat x gender x kelompok umur.
+type DemographicCount struct {
+	Tag      string `json:"tag"`
+	Gender   string `json:"gender"`
+	Kategori string `json:"kategori"`
+	Jumlah   int    `json:"jumlah"`
+}
+
+// Gender peserta yang kosong di database dihitung sebagai unknown.
+const GenderUnknown = "unknown"
+
+// AgeBracketSQL menghasilkan ekspresi SQL kode bracket untuk tanggal lahir dobExpr
+// pada tanggal atExpr (umur dihitung pada tanggal absensi, bukan hari ini).
+func AgeBracketSQL(dobExpr, atExpr string) string {
+	age := "TIMESTAMPDIFF(YEAR, STR_TO_DATE(" + dobExpr + ", '%Y-%m-%d'), " + atExpr + ")"
+	return `COALESCE(
+			(SELECT ab.code FROM age_brackets ab
+			 WHERE ` + age + ` BETWEEN ab.min_age AND COALESCE(ab.max_age, 999)
+			 ORDER BY ab.urutan, ab.id LIMIT 1),
+			(SELECT ab.code FROM age_brackets ab WHERE ab.is_default = 1 LIMIT 1),
+			'umum')`
+}
+
+// LoadAgeBrackets mengambil semua bracket urut sesuai urutan.
+func LoadAgeBrackets() ([]AgeBracket, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, code, label, min_age, max_age, is_default, urutan
+		FROM age_brackets ORDER BY urutan, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	brackets := []AgeBracket{}
+	for rows.Next() {
+		var b AgeBracket
+		var maxAge sql.NullInt64
+		if err := rows.Scan(&b.ID, &b.Code, &b.Label, &b.MinAge, &maxAge, &b.IsDefault, &b.Urutan); err != nil {
+			return nil, err
+		}
+		if maxAge.Valid {
+			max := int(maxAge.Int64)
+			b.MaxAge = &max
+		}
+		brackets = append(brackets, b)
+	}
+	return brackets, rows.Err()
+}
+
+// ValidateAgeBrackets memastikan kode unik, rentang tidak tumpang tindih dan
+// tepat satu bracket default.
+func ValidateAgeBrackets(brackets []AgeBracket) error {
+	if len(brackets) == 0 {
+		return fmt.Errorf("at least one age bracket is required")
+	}
+
+	sorted := make([]AgeBracket, len(brackets))
+	copy(sorted, brackets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinAge < sorted[j].MinAge })
+
+	codes := make(map[string]bool)
+	defaults := 0
+	for i, b := range sorted {
+		code := strings.ToLower(strings.TrimSpace(b.Code))
+		if code == "" || code == CounterAllTags {
+			return fmt.Errorf("invalid bracket code %q", b.Code)
+		}
+		if codes[code] {
+			return fmt.Errorf("duplicate bracket code %q", b.Code)
+		}
+		codes[code] = true
+		if b.IsDefault {
+			defaults++
+		}
+		if b.MaxAge != nil && *b.MaxAge < b.MinAge {
+			return fmt.Errorf("bracket %q: max_age must not be below min_age", b.Code)
+		}
+		if i > 0 {
+			prev := sorted[i-1]
+			if prev.MaxAge == nil || *prev.MaxAge >= b.MinAge {
+				return fmt.Errorf("brackets %q and %q overlap", prev.Code, b.Code)
+			}
+		}
+	}
+	if defaults != 1 {
+		return fmt.Errorf("exactly one bracket must be the default")
+	}
+	return nil
+}
+
+// ReplaceAgeBrackets mengganti seluruh bracket. Counter harian perlu dibangun
+// ulang supaya kategori lama ikut berubah.
+func ReplaceAgeBrackets(tx *sql.Tx, brackets []AgeBracket) error {
+	if _, err := tx.Exec("DELETE FROM age_brackets"); err != nil {
+		return err
+	}
+	for i, b := range brackets {
+		urutan := b.Urutan
+		if urutan == 0 {
+			urutan = i + 1
+		}
+		_, err := tx.Exec(`
+			INSERT INTO age_brackets (code, label, min_age, max_age, is_default, urutan)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			strings.ToLower(strings.TrimSpace(b.Code)), b.Label, b.MinAge, b.MaxAge, b.IsDefault, urutan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClassifyAge mencari kode bracket untuk tanggal lahir dob pada tanggal at. Versi
+// Go dari AgeBracketSQL untuk data yang sudah ada di memory.
+func ClassifyAge(brackets []AgeBracket, dob *time.Time, at time.Time) string {
+	fallback := "umum"
+	for _, b := range brackets {
+		if b.IsDefault {
+			fallback = b.Code
+		}
+	}
+	if dob == nil {
+		return fallback
+	}
+
+	age := at.Year() - dob.Year()
+	if at.Month() < dob.Month() || (at.Month() == dob.Month() && at.Day() < dob.Day()) {
+		age--
+	}
+	for _, b := range brackets {
+		if age >= b.MinAge && (b.MaxAge == nil || age <= *b.MaxAge) {
+			return b.Code
+		}
+	}
+	return fallback
+}
+
+// SortDemographics mengurutkan hasil breakdown berdasarkan tag, gender, kategori.
+func SortDemographics(counts []DemographicCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		if a.Gender != b.Gender {
+			return a.Gender < b.Gender
+		}
+		return a.Kategori < b.Kategori
+	})
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"shollu/database"
+)
+
+// Status detail_peserta.
+const (
+	EnrollmentActive    = 1
+	EnrollmentWaitlist  = 2
+	EnrollmentCancelled = 3
+)
+
+var EnrollmentStatusNames = map[int]string{
+	EnrollmentActive:    "terdaftar",
+	EnrollmentWaitlist:  "waitlist",
+	EnrollmentCancelled: "dibatalkan",
+}
+
+var (
+	ErrEnrollmentNotFound = errors.New("enrollment not found")
+	ErrAlreadyEnrolled    = errors.New("peserta is already enrolled in this event")
+	ErrSameMasjid         = errors.New("enrollment is already in this masjid")
+)
+
+// Enrollment adalah satu baris detail_peserta.
+type Enrollment struct {
+	PesertaID int    `json:"peserta_id"`
+	EventID   int    `json:"event_id"`
+	MasjidID  *int   `json:"masjid_id"`
+	Status    int    `json:"status"`
+	Label     string `json:"status_label"`
+}
+
+// EnrollmentChange adalah satu baris enrollment_history. FromStatus 0 berarti
+// pendaftaran baru; masjid 0 disimpan sebagai NULL.
+type EnrollmentChange struct {
+	ID           int64     `json:"id"`
+	PesertaID    int       `json:"peserta_id"`
+	EventID      int       `json:"event_id"`
+	Action       string    `json:"action"`
+	FromStatus   int       `json:"from_status"`
+	ToStatus     int       `json:"to_status"`
+	FromMasjidID int       `json:"from_masjid_id"`
+	ToMasjidID   int       `json:"to_masjid_id"`
+	Reason       string    `json:"reason"`
+	ActorID      int       `json:"actor_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Enroll mendaftarkan peserta ke event di masjid tertentu. Kursi dihitung lewat
+// ReserveSeat sehingga peserta bisa masuk antrian tunggu. Pendaftaran yang
+// pernah dibatalkan diaktifkan lagi; yang masih aktif/antri ditolak dengan
+// ErrAlreadyEnrolled. customFields adalah jawaban formulir yang sudah lolos
+// CheckCustomFields.
+func Enroll(tx *sql.Tx, pesertaID, eventID, masjidID, actorID int, reason string, customFields map[string]interface{}) (int, error) {
+	current, err := lockEnrollment(tx, pesertaID, eventID)
+	if err != nil && err != ErrEnrollmentNotFound {
+		return 0, err
+	}
+	if err == nil && current.Status != EnrollmentCancelled {
+		return current.Status, ErrAlreadyEnrolled
+	}
+
+	status, err := ReserveSeat(tx, eventID, masjidID)
+	if err != nil {
+		return 0, err
+	}
+	var fields interface{}
+	if len(customFields) > 0 {
+		b, err := json.Marshal(customFields)
+		if err != nil {
+			return 0, err
+		}
+		fields = string(b)
+	}
+
+	change := EnrollmentChange{
+		PesertaID:  pesertaID,
+		EventID:    eventID,
+		Action:     "enroll",
+		ToStatus:   status,
+		ToMasjidID: masjidID,
+		Reason:     reason,
+		ActorID:    actorID,
+	}
+	if current == nil {
+		_, err = tx.Exec(`
+			INSERT INTO detail_peserta (id_peserta, id_event, status, masjid_id, waitlisted_at, custom_fields)
+			VALUES (?, ?, ?, ?, IF(? = ?, UTC_TIMESTAMP(), NULL), ?)`,
+			pesertaID, eventID, status, masjidID, status, EnrollmentWaitlist, fields)
+	} else {
+		change.Action = "reenroll"
+		change.FromStatus = current.Status
+		change.FromMasjidID = derefInt(current.MasjidID)
+		_, err = tx.Exec(`
+			UPDATE detail_peserta SET status = ?, masjid_id = ?, waitlisted_at = IF(? = ?, UTC_TIMESTAMP(), NULL),
+				custom_fields = COALESCE(?, custom_fields)
+			WHERE id_peserta = ? AND id_event = ?`,
+			status, masjidID, status, EnrollmentWaitlist, fields, pesertaID, eventID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return status, writeEnrollmentHistory(tx, change)
+}
+
+// CancelEnrollment membatalkan pendaftaran peserta di event dan menaikkan antrian
+// tunggu di masjidnya. Mengembalikan masjid pendaftaran dan id peserta yang naik.
+func CancelEnrollment(tx *sql.Tx, pesertaID, eventID, actorID int, reason string) (int, []int, error) {
+	current, err := lockEnrollment(tx, pesertaID, eventID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if current.Status == EnrollmentCancelled {
+		return 0, nil, ErrEnrollmentNotFound
+	}
+	masjidID := derefInt(current.MasjidID)
+
+	_, err = tx.Exec(`
+		UPDATE detail_peserta SET status = ?, waitlisted_at = NULL
+		WHERE id_peserta = ? AND id_event = ?`, EnrollmentCancelled, pesertaID, eventID)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = writeEnrollmentHistory(tx, EnrollmentChange{
+		PesertaID:    pesertaID,
+		EventID:      eventID,
+		Action:       "cancel",
+		FromStatus:   current.Status,
+		ToStatus:     EnrollmentCancelled,
+		FromMasjidID: masjidID,
+		ToMasjidID:   masjidID,
+		Reason:       reason,
+		ActorID:      actorID,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if current.Status != EnrollmentActive || masjidID == 0 {
+		return masjidID, nil, nil
+	}
+	promoted, err := PromoteWaitlist(tx, eventID, masjidID)
+	return masjidID, promoted, err
+}
+
+// TransferEnrollment memindahkan pendaftaran aktif/antri ke masjid lain. Kursi di
+// masjid tujuan dihitung ulang (bisa jadi antri), kursi di masjid asal diberikan
+// ke antrian tunggunya. Mengembalikan status baru, masjid asal dan id peserta yang naik.
+func TransferEnrollment(tx *sql.Tx, pesertaID, eventID, toMasjidID, actorID int, reason string) (int, int, []int, error) {
+	current, err := lockEnrollment(tx, pesertaID, eventID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if current.Status == EnrollmentCancelled {
+		return 0, 0, nil, ErrEnrollmentNotFound
+	}
+	fromMasjidID := derefInt(current.MasjidID)
+	if fromMasjidID == toMasjidID {
+		return 0, 0, nil, ErrSameMasjid
+	}
+
+	status, err := ReserveSeat(tx, eventID, toMasjidID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE detail_peserta SET status = ?, masjid_id = ?, waitlisted_at = IF(? = ?, UTC_TIMESTAMP(), NULL)
+		WHERE id_peserta = ? AND id_event = ?`,
+		status, toMasjidID, status, EnrollmentWaitlist, pesertaID, eventID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	err = writeEnrollmentHistory(tx, EnrollmentChange{
+		PesertaID:    pesertaID,
+		EventID:      eventID,
+		Action:       "transfer",
+		FromStatus:   current.Status,
+		ToStatus:     status,
+		FromMasjidID: fromMasjidID,
+		ToMasjidID:   toMasjidID,
+		Reason:       reason,
+		ActorID:      actorID,
+	})
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	if current.Status != EnrollmentActive || fromMasjidID == 0 {
+		return status, fromMasjidID, nil, nil
+	}
+	promoted, err := PromoteWaitlist(tx, eventID, fromMasjidID)
+	return status, fromMasjidID, promoted, err
+}
+
+// LoadEnrollments mengambil semua pendaftaran event seorang peserta.
+func LoadEnrollments(pesertaID int) ([]Enrollment, error) {
+	rows, err := database.DB.Query(`
+		SELECT id_peserta, id_event, masjid_id, status FROM detail_peserta
+		WHERE id_peserta = ? ORDER BY id_event ASC`, pesertaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrollments := []Enrollment{}
+	for rows.Next() {
+		e, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, *e)
+	}
+	return enrollments, rows.Err()
+}
+
+// LoadEnrollmentHistory mengambil riwayat pendaftaran peserta, eventID 0 berarti semua event.
+func LoadEnrollmentHistory(pesertaID, eventID int) ([]EnrollmentChange, error) {
+	query := `
+		SELECT id, id_peserta, id_event, action, COALESCE(from_status, 0), to_status,
+			COALESCE(from_masjid_id, 0), COALESCE(to_masjid_id, 0), reason, COALESCE(actor_id, 0), created_at
+		FROM enrollment_history WHERE id_peserta = ?`
+	args := []interface{}{pesertaID}
+	if eventID != 0 {
+		query += " AND id_event = ?"
+		args = append(args, eventID)
+	}
+	query += " ORDER BY id ASC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []EnrollmentChange{}
+	for rows.Next() {
+		var h EnrollmentChange
+		if err := rows.Scan(&h.ID, &h.PesertaID, &h.EventID, &h.Action, &h.FromStatus, &h.ToStatus,
+			&h.FromMasjidID, &h.ToMasjidID, &h.Reason, &h.ActorID, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+func lockEnrollment(tx *sql.Tx, pesertaID, eventID int) (*Enrollment, error) {
+	e, err := scanEnrollment(tx.QueryRow(`
+		SELECT id_peserta, id_event, masjid_id, status FROM detail_peserta
+		WHERE id_peserta = ? AND id_event = ? FOR UPDATE`, pesertaID, eventID))
+	if err == sql.ErrNoRows {
+		return nil, ErrEnrollmentNotFound
+	}
+	return e, err
+}
+
+func scanEnrollment(row interface{ Scan(...interface{}) error }) (*Enrollment, error) {
+	var e Enrollment
+	var masjidID sql.NullInt64
+	if err := row.Scan(&e.PesertaID, &e.EventID, &masjidID, &e.Status); err != nil {
+		return nil, err
+	}
+	if masjidID.Valid {
+		id := int(masjidID.Int64)
+		e.MasjidID = &id
+	}
+	e.Label = EnrollmentStatusNames[e.Status]
+	return &e, nil
+}
+
+func writeEnrollmentHistory(tx *sql.Tx, h EnrollmentChange) error {
+	_, err := tx.Exec(`
+		INSERT INTO enrollment_history (id_peserta, id_event, action, from_status, to_status,
+			from_masjid_id, to_masjid_id, reason, actor_id, created_at)
+		VALUES (?, ?, ?, NULLIF(?, 0), ?, NULLIF(?, 0), NULLIF(?, 0), ?, NULLIF(?, 0), ?)`,
+		h.PesertaID, h.EventID, h.Action, h.FromStatus, h.ToStatus,
+		h.FromMasjidID, h.ToMasjidID, h.Reason, h.ActorID, time.Now().UTC())
+	return err
+}
+
+func derefInt(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FormField adalah satu field tambahan formulir pendaftaran event. Rules adalah
+// tag validator (utils.Validate) yang dijalankan untuk nilainya; untuk
+// multiselect rules berlaku ke jumlah pilihan.
+type FormField struct {
+	ID       int      `json:"id"`
+	EventID  int      `json:"event_id"`
+	Key      string   `json:"key" validate:"required,max=50"`
+	Label    string   `json:"label" validate:"required,max=100"`
+	Type     string   `json:"type" validate:"required,oneof=text number date select multiselect boolean"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options"`
+	Rules    string   `json:"rules" validate:"max=255"`
+	Urutan   int      `json:"urutan"`
+}
+
+var formFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// LoadFormFields mengambil field tambahan event urut sesuai urutan.
+func LoadFormFields(eventID int) ([]FormField, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, event_id, field_key, label, type, required, options, rules, urutan
+		FROM event_form_fields WHERE event_id = ? ORDER BY urutan, id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []FormField{}
+	for rows.Next() {
+		var f FormField
+		var options sql.NullString
+		if err := rows.Scan(&f.ID, &f.EventID, &f.Key, &f.Label, &f.Type, &f.Required, &options, &f.Rules, &f.Urutan); err != nil {
+			return nil, err
+		}
+		if options.Valid {
+			if err := json.Unmarshal([]byte(options.String), &f.Options); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// ValidateFormFields memastikan key unik dan berformat snake_case, select punya
+// pilihan dan rules adalah tag validator yang dikenal.
+func ValidateFormFields(fields []FormField) error {
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if !formFieldKeyPattern.MatchString(f.Key) {
+			return fmt.Errorf("field key %q must be lowercase letters, digits and underscores", f.Key)
+		}
+		if seen[f.Key] {
+			return fmt.Errorf("duplicate field key %q", f.Key)
+		}
+		seen[f.Key] = true
+		if (f.Type == "select" || f.Type == "multiselect") && len(f.Options) == 0 {
+			return fmt.Errorf("field %q needs options", f.Key)
+		}
+		if err := checkFieldRules(f); err != nil {
+			return fmt.Errorf("field %q has invalid rules: %v", f.Key, err)
+		}
+	}
+	return nil
+}
+
+// ReplaceFormFields mengganti seluruh field tambahan event. Jawaban yang sudah
+// tersimpan di detail_peserta tidak ikut dihapus.
+func ReplaceFormFields(tx *sql.Tx, eventID int, fields []FormField) error {
+	if _, err := tx.Exec("DELETE FROM event_form_fields WHERE event_id = ?", eventID); err != nil {
+		return err
+	}
+	for i, f := range fields {
+		urutan := f.Urutan
+		if urutan == 0 {
+			urutan = i + 1
+		}
+		var options interface{}
+		if len(f.Options) > 0 {
+			b, err := json.Marshal(f.Options)
+			if err != nil {
+				return err
+			}
+			options = string(b)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO event_form_fields (event_id, field_key, label, type, required, options, rules, urutan)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			eventID, f.Key, f.Label, f.Type, f.Required, options, strings.TrimSpace(f.Rules), urutan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckCustomFields memvalidasi jawaban formulir terhadap definisi field dan
+// mengembalikan nilai yang sudah dinormalisasi (number jadi float64, date jadi
+// YYYY-MM-DD). Error per field memakai format utils.FormatValidationErrors
+// dengan key "custom_fields.<key>".
+func CheckCustomFields(fields []FormField, values map[string]interface{}) (map[string]interface{}, map[string]string) {
+	clean := make(map[string]interface{})
+	errs := make(map[string]string)
+	known := make(map[string]bool)
+
+	for _, f := range fields {
+		known[f.Key] = true
+		name := "custom_fields." + f.Key
+		raw, present := values[f.Key]
+		if !present || raw == nil || raw == "" {
+			if f.Required {
+				errs[name] = "Invalid required"
+			}
+			continue
+		}
+
+		value, ok := normalizeFieldValue(f, raw)
+		if !ok {
+			errs[name] = "Invalid " + f.Type
+			continue
+		}
+		if values, isList := value.([]string); isList && len(values) == 0 && f.Required {
+			errs[name] = "Invalid required"
+			continue
+		}
+		if tag := failedRule(f, value); tag != "" {
+			errs[name] = "Invalid " + tag
+			continue
+		}
+		clean[f.Key] = value
+	}
+
+	for key := range values {
+		if !known[key] {
+			errs["custom_fields."+key] = "Invalid unknown"
+		}
+	}
+	return clean, errs
+}
+
+// CustomFieldFilterSQL menghasilkan kondisi SQL untuk menyaring pendaftaran
+// (alias detail_peserta dpAlias) dengan jawaban field sama dengan value. Untuk
+// multiselect cukup salah satu pilihannya yang sama.
+func CustomFieldFilterSQL(dpAlias string, f FormField, value string) (string, []interface{}) {
+	path := `$."` + f.Key + `"`
+	switch f.Type {
+	case "multiselect":
+		return "JSON_CONTAINS(JSON_EXTRACT(" + dpAlias + ".custom_fields, ?), JSON_QUOTE(?))", []interface{}{path, value}
+	case "boolean":
+		return "JSON_EXTRACT(" + dpAlias + ".custom_fields, ?) = CAST(? AS JSON)", []interface{}{path, strconv.FormatBool(value == "true" || value == "1")}
+	case "number":
+		return "CAST(JSON_EXTRACT(" + dpAlias + ".custom_fields, ?) AS DECIMAL(20,6)) = ?", []interface{}{path, value}
+	}
+	return "JSON_UNQUOTE(JSON_EXTRACT(" + dpAlias + ".custom_fields, ?)) = ?", []interface{}{path, value}
+}
+
+// FormatCustomField mengubah jawaban field menjadi teks untuk export.
+func FormatCustomField(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		if v {
+			return "Ya"
+		}
+		return "Tidak"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = FormatCustomField(item)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+func normalizeFieldValue(f FormField, raw interface{}) (interface{}, bool) {
+	switch f.Type {
+	case "text":
+		s, ok := raw.(string)
+		return strings.TrimSpace(s), ok
+	case "number":
+		switch v := raw.(type) {
+		case float64:
+			return v, true
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return n, err == nil
+		}
+	case "date":
+		s, ok := raw.(string)
+		if !ok {
+			return nil, false
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, false
+		}
+		return s, true
+	case "boolean":
+		switch v := raw.(type) {
+		case bool:
+			return v, true
+		case string:
+			b, err := strconv.ParseBool(v)
+			return b, err == nil
+		}
+	case "select":
+		s, ok := raw.(string)
+		return s, ok && containsString(f.Options, s)
+	case "multiselect":
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok || !containsString(f.Options, s) {
+				return nil, false
+			}
+			values = append(values, s)
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// failedRule menjalankan rules field lewat validator dan mengembalikan tag yang gagal.
+func failedRule(f FormField, value interface{}) string {
+	if f.Rules == "" {
+		return ""
+	}
+	if values, ok := value.([]string); ok {
+		value = len(values)
+	}
+	err := utils.Validate.Var(value, f.Rules)
+	if errs, ok := err.(validator.ValidationErrors); ok && len(errs) > 0 {
+		return errs[0].Tag()
+	} else if err != nil {
+		return "rules"
+	}
+	return ""
+}
+
+// checkFieldRules mencoba rules dengan nilai contoh; validator panic untuk tag
+// yang tidak dikenal sehingga panic diubah menjadi error.
+func checkFieldRules(f FormField) (err error) {
+	if strings.TrimSpace(f.Rules) == "" {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	var sample interface{} = ""
+	switch f.Type {
+	case "number":
+		sample = 0.0
+	case "multiselect":
+		sample = 0
+	case "boolean":
+		sample = false
+	}
+	utils.Validate.Var(sample, f.Rules)
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
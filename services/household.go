@@ -0,0 +1,242 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+var (
+	ErrHouseholdNotFound  = errors.New("household not found")
+	ErrNotGuardian        = errors.New("peserta is not the household guardian")
+	ErrNotHouseholdMember = errors.New("peserta is not a member of this household")
+)
+
+// Household adalah satu nomor HP yang dipakai beberapa peserta (keluarga).
+type Household struct {
+	ID         int               `json:"id"`
+	Contact    string            `json:"contact"`
+	GuardianID int               `json:"guardian_peserta_id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	Members    []HouseholdMember `json:"members"`
+}
+
+// HouseholdMember adalah peserta yang memakai nomor HP keluarga.
+type HouseholdMember struct {
+	PesertaID  int    `json:"peserta_id"`
+	FullName   string `json:"fullname"`
+	Gender     string `json:"gender"`
+	Dob        string `json:"dob,omitempty"`
+	MasjidID   int    `json:"masjid_id"`
+	QRCode     string `json:"qr_code,omitempty"`
+	IsGuardian bool   `json:"is_guardian"`
+}
+
+// MemberAttendance adalah ringkasan kehadiran satu anggota keluarga.
+type MemberAttendance struct {
+	HouseholdMember
+	TotalAbsen    int        `json:"total_absen"`
+	HariHadir     int        `json:"hari_hadir"`
+	TerakhirHadir *time.Time `json:"terakhir_hadir"`
+}
+
+// ContactMembers mengambil semua peserta dengan nomor HP contact, wali utama
+// lebih dulu lalu urut pendaftaran.
+func ContactMembers(contact string) ([]HouseholdMember, error) {
+	return queryMembers(`
+		SELECT p.id, COALESCE(p.fullname, ''), COALESCE(p.gender, ''), COALESCE(DATE_FORMAT(p.dob, '%Y-%m-%d'), ''),
+			COALESCE(p.masjid_id, 0), COALESCE(p.qr_code, ''), COALESCE(h.guardian_peserta_id = p.id, 0)
+		FROM peserta p
+		LEFT JOIN households h ON p.household_id = h.id
+		WHERE p.contact = ?
+		ORDER BY COALESCE(h.guardian_peserta_id = p.id, 0) DESC, p.id ASC`, contact)
+}
+
+// MatchMember mencari anggota dengan nama yang sama (tanpa beda huruf besar
+// dan spasi), nil kalau tidak ada.
+func MatchMember(members []HouseholdMember, fullname string) *HouseholdMember {
+	name := strings.Join(strings.Fields(strings.ToLower(fullname)), " ")
+	for i := range members {
+		if strings.Join(strings.Fields(strings.ToLower(members[i].FullName)), " ") == name {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// EnsureHousehold mengambil (atau membuat) keluarga untuk nomor HP contact dan
+// memasukkan semua peserta dengan nomor itu ke dalamnya. Keluarga baru memakai
+// peserta paling lama sebagai wali utama. Panggil setelah peserta baru diinsert
+// di transaksi yang sama.
+func EnsureHousehold(tx *sql.Tx, contact string) (int, error) {
+	res, err := tx.Exec(`
+		INSERT INTO households (contact, guardian_peserta_id)
+		SELECT ?, MIN(id) FROM peserta WHERE contact = ?
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`, contact, contact)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("UPDATE peserta SET household_id = ? WHERE contact = ? AND household_id IS NULL", id, contact)
+	return int(id), err
+}
+
+// LoadHousehold mengambil keluarga beserta anggotanya.
+func LoadHousehold(id int) (*Household, error) {
+	var h Household
+	var guardianID sql.NullInt64
+	err := database.DB.QueryRow("SELECT id, contact, guardian_peserta_id, created_at FROM households WHERE id = ?", id).
+		Scan(&h.ID, &h.Contact, &guardianID, &h.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrHouseholdNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	h.GuardianID = int(guardianID.Int64)
+
+	h.Members, err = queryMembers(`
+		SELECT p.id, COALESCE(p.fullname, ''), COALESCE(p.gender, ''), COALESCE(DATE_FORMAT(p.dob, '%Y-%m-%d'), ''),
+			COALESCE(p.masjid_id, 0), COALESCE(p.qr_code, ''), p.id = ?
+		FROM peserta p WHERE p.household_id = ?
+		ORDER BY p.id = ? DESC, p.id ASC`, h.GuardianID, h.ID, h.GuardianID)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// HouseholdByContact mengambil keluarga untuk nomor HP contact.
+func HouseholdByContact(contact string) (*Household, error) {
+	var id int
+	err := database.DB.QueryRow("SELECT id FROM households WHERE contact = ?", contact).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrHouseholdNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return LoadHousehold(id)
+}
+
+// GuardianHousehold mengambil keluarga dari QR code wali utamanya. QR anggota
+// lain ditolak dengan ErrNotGuardian.
+func GuardianHousehold(qrCode string) (*Household, error) {
+	var householdID sql.NullInt64
+	var isGuardian bool
+	err := database.DB.QueryRow(`
+		SELECT p.household_id, COALESCE(h.guardian_peserta_id = p.id, 0)
+		FROM peserta p
+		LEFT JOIN households h ON p.household_id = h.id
+		WHERE p.qr_code = ?`, qrCode).Scan(&householdID, &isGuardian)
+	if err == sql.ErrNoRows || (err == nil && !householdID.Valid) {
+		return nil, ErrHouseholdNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if !isGuardian {
+		return nil, ErrNotGuardian
+	}
+	return LoadHousehold(int(householdID.Int64))
+}
+
+// SetGuardian mengganti wali utama keluarga; pesertaID harus anggota keluarga itu.
+func SetGuardian(tx *sql.Tx, householdID, pesertaID int) error {
+	var member bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM peserta WHERE id = ? AND household_id = ?)", pesertaID, householdID).Scan(&member)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotHouseholdMember
+	}
+	res, err := tx.Exec("UPDATE households SET guardian_peserta_id = ? WHERE id = ?", pesertaID, householdID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM households WHERE id = ?)", householdID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrHouseholdNotFound
+		}
+	}
+	return nil
+}
+
+// HouseholdAttendance meringkas kehadiran setiap anggota di rentang tanggal
+// lokal dateFrom..dateTo. eventID 0 berarti semua event.
+func HouseholdAttendance(h *Household, eventID int, dateFrom, dateTo string) ([]MemberAttendance, error) {
+	result := make([]MemberAttendance, len(h.Members))
+	if len(h.Members) == 0 {
+		return result, nil
+	}
+	index := make(map[int]int, len(h.Members))
+	args := []interface{}{}
+	placeholders := make([]string, len(h.Members))
+	for i, m := range h.Members {
+		result[i].HouseholdMember = m
+		index[m.PesertaID] = i
+		placeholders[i] = "?"
+		args = append(args, m.PesertaID)
+	}
+
+	rangeStart, rangeEnd, err := utils.AnyZoneDayRange(dateFrom, dateTo)
+	if err != nil {
+		return nil, err
+	}
+	localDate := AbsensiLocalDateSQL("a")
+	args = append(args, eventID, eventID, rangeStart, rangeEnd, dateFrom, dateTo)
+	rows, err := database.DB.Query(`
+		SELECT a.user_id, COUNT(*), COUNT(DISTINCT `+localDate+`), MAX(a.created_at)
+		FROM absensi a
+		WHERE a.user_id IN (`+strings.Join(placeholders, ",")+`)
+			AND a.voided_at IS NULL
+			AND (? = 0 OR a.event_id = ?)
+			AND a.created_at >= ? AND a.created_at < ?
+			AND `+localDate+` BETWEEN ? AND ?
+		GROUP BY a.user_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, total, hari int
+		var last time.Time
+		if err := rows.Scan(&userID, &total, &hari, &last); err != nil {
+			return nil, err
+		}
+		if i, ok := index[userID]; ok {
+			result[i].TotalAbsen = total
+			result[i].HariHadir = hari
+			result[i].TerakhirHadir = &last
+		}
+	}
+	return result, rows.Err()
+}
+
+func queryMembers(query string, args ...interface{}) ([]HouseholdMember, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []HouseholdMember{}
+	for rows.Next() {
+		var m HouseholdMember
+		if err := rows.Scan(&m.PesertaID, &m.FullName, &m.Gender, &m.Dob, &m.MasjidID, &m.QRCode, &m.IsGuardian); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
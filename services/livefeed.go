@@ -0,0 +1,238 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+// Pengaturan live feed. Setiap feed (event + masjid) menyimpan LiveReplaySize
+// pesan terakhir untuk replay ketika client reconnect dengan Last-Event-ID.
+// Subscriber yang antriannya penuh (LiveSubscriberBuffer) diputus supaya tidak
+// menahan publisher; client cukup reconnect dan replay.
+var (
+	LiveReplaySize       = 200
+	LiveSubscriberBuffer = 64
+	LiveHeartbeat        = 15 * time.Second
+)
+
+// LiveScan adalah satu scan yang ditampilkan di layar masjid. Nama sudah
+// disamarkan kalau peserta memilih isHideName.
+type LiveScan struct {
+	AbsensiID int64     `json:"absensi_id"`
+	UserID    int       `json:"user_id"`
+	Nama      string    `json:"nama"`
+	Tag       string    `json:"tag"`
+	Tanggal   string    `json:"tanggal"`
+	ScannedAt time.Time `json:"scanned_at"`
+	Count     int       `json:"count"`
+}
+
+// LiveMessage adalah pesan yang dikirim ke subscriber. Type "scan" berisi
+// LiveScan, "snapshot" berisi LiveSnapshot.
+type LiveMessage struct {
+	ID   int64       `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// LiveSnapshot dikirim saat client baru terhubung atau Last-Event-ID-nya
+// sudah tidak ada di buffer replay.
+type LiveSnapshot struct {
+	Tanggal string         `json:"tanggal"`
+	Counts  map[string]int `json:"counts"`
+	Recent  []LiveScan     `json:"recent"`
+}
+
+// LiveSubscriber menerima pesan lewat C. Done ditutup kalau subscriber diputus
+// oleh hub (antrian penuh).
+type LiveSubscriber struct {
+	C    chan LiveMessage
+	Done chan struct{}
+
+	feed *liveFeed
+	once sync.Once
+}
+
+type liveFeedKey struct {
+	eventID  int
+	masjidID int
+}
+
+type liveFeed struct {
+	key     liveFeedKey
+	mu      sync.Mutex
+	buffer  []LiveMessage
+	tanggal string
+	counts  map[string]int
+	seeded  bool
+	subs    map[*LiveSubscriber]struct{}
+}
+
+// LiveHub adalah pub/sub in-memory untuk scan absensi per event dan masjid.
+type LiveHub struct {
+	mu    sync.Mutex
+	feeds map[liveFeedKey]*liveFeed
+	seq   int64
+}
+
+// ID pesan diawali dari waktu start supaya tetap naik setelah server restart.
+var DefaultLiveHub = &LiveHub{
+	feeds: make(map[liveFeedKey]*liveFeed),
+	seq:   time.Now().UnixMilli() * 1000,
+}
+
+func (h *LiveHub) feed(eventID, masjidID int) *liveFeed {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := liveFeedKey{eventID, masjidID}
+	f, ok := h.feeds[key]
+	if !ok {
+		f = &liveFeed{key: key, subs: make(map[*LiveSubscriber]struct{})}
+		h.feeds[key] = f
+	}
+	return f
+}
+
+func (h *LiveHub) nextID() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	return h.seq
+}
+
+// PublishScan mengirim scan ke semua layar yang memantau event dan masjid tersebut.
+// Dipanggil setelah absensi commit.
+func (h *LiveHub) PublishScan(eventID, masjidID int, scan LiveScan) {
+	f := h.feed(eventID, masjidID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Hitungan awal diambil dari database dan sudah termasuk scan ini
+	if f.rollDay(scan.Tanggal) {
+		f.counts[scan.Tag]++
+	}
+	scan.Count = f.counts[scan.Tag]
+
+	msg := LiveMessage{ID: h.nextID(), Type: "scan", Data: scan}
+	f.buffer = append(f.buffer, msg)
+	if len(f.buffer) > LiveReplaySize {
+		f.buffer = f.buffer[len(f.buffer)-LiveReplaySize:]
+	}
+
+	for sub := range f.subs {
+		select {
+		case sub.C <- msg:
+		default:
+			f.drop(sub)
+		}
+	}
+}
+
+// Subscribe mendaftarkan subscriber baru. Kalau lastEventID masih ada di buffer
+// pesan setelahnya di-replay; selain itu subscriber menerima snapshot dulu.
+func (h *LiveHub) Subscribe(eventID, masjidID int, lastEventID int64) *LiveSubscriber {
+	f := h.feed(eventID, masjidID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var backlog []LiveMessage
+	if lastEventID > 0 && len(f.buffer) > 0 && f.buffer[0].ID <= lastEventID {
+		for _, msg := range f.buffer {
+			if msg.ID > lastEventID {
+				backlog = append(backlog, msg)
+			}
+		}
+	} else {
+		backlog = []LiveMessage{{ID: h.nextID(), Type: "snapshot", Data: f.snapshot()}}
+	}
+
+	size := LiveSubscriberBuffer
+	if len(backlog) > size {
+		size = len(backlog)
+	}
+	sub := &LiveSubscriber{
+		C:    make(chan LiveMessage, size),
+		Done: make(chan struct{}),
+		feed: f,
+	}
+	for _, msg := range backlog {
+		sub.C <- msg
+	}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close melepas subscriber dari feed-nya.
+func (s *LiveSubscriber) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.feed.drop(s)
+}
+
+// drop harus dipanggil dengan f.mu terkunci.
+func (f *liveFeed) drop(sub *LiveSubscriber) {
+	delete(f.subs, sub)
+	sub.once.Do(func() { close(sub.Done) })
+}
+
+// rollDay memastikan hitungan untuk tanggal tersebut sudah dimuat. Mengembalikan
+// false kalau hitungan baru saja dimuat dari database.
+func (f *liveFeed) rollDay(tanggal string) bool {
+	if f.seeded && f.tanggal == tanggal {
+		return true
+	}
+	f.tanggal = tanggal
+	f.counts = make(map[string]int)
+	f.buffer = nil
+	f.seeded = true
+
+	counts, err := loadLiveCounts(f.key.eventID, f.key.masjidID, tanggal)
+	if err != nil {
+		log.Println("Error loading live feed counts:", err)
+		return true
+	}
+	f.counts = counts
+	return false
+}
+
+func (f *liveFeed) snapshot() LiveSnapshot {
+	tanggal := utils.Today(MasjidLocation(f.key.masjidID))
+	f.rollDay(tanggal)
+
+	snap := LiveSnapshot{Tanggal: tanggal, Counts: make(map[string]int), Recent: []LiveScan{}}
+	for tag, n := range f.counts {
+		snap.Counts[tag] = n
+	}
+	for _, msg := range f.buffer {
+		if scan, ok := msg.Data.(LiveScan); ok {
+			snap.Recent = append(snap.Recent, scan)
+		}
+	}
+	return snap
+}
+
+func loadLiveCounts(eventID, masjidID int, tanggal string) (map[string]int, error) {
+	rows, err := database.DB.Query(`
+		SELECT tag, SUM(jumlah) FROM absensi_daily_counters
+		WHERE event_id = ? AND masjid_id = ? AND tanggal = ? AND tag <> ?
+		GROUP BY tag`, eventID, masjidID, tanggal, CounterAllTags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var tag string
+		var n int
+		if err := rows.Scan(&tag, &n); err != nil {
+			return nil, err
+		}
+		counts[tag] = n
+	}
+	return counts, rows.Err()
+}
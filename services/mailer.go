@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"shollu/config"
+)
+
+// Attachment adalah file yang dilampirkan ke email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mail adalah satu email keluar.
+type Mail struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Mailer mengirim email. Implementasinya bisa SMTP atau fake untuk lokal/test.
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+// DefaultMailer dipakai channel email laporan. Diisi StartReportScheduler setelah
+// config dimuat kalau belum di-set (misalnya oleh test).
+var DefaultMailer Mailer
+
+// NewMailerFromConfig membuat SMTPMailer kalau SMTP_HOST diisi, selain itu
+// FakeMailer yang hanya mencatat ke log.
+func NewMailerFromConfig() Mailer {
+	if config.SMTPHost == "" {
+		return &FakeMailer{}
+	}
+	return &SMTPMailer{
+		Host:     config.SMTPHost,
+		Port:     config.SMTPPort,
+		Username: config.SMTPUser,
+		Password: config.SMTPPassword,
+		From:     config.SMTPFrom,
+	}
+}
+
+// SMTPMailer mengirim email lewat server SMTP (STARTTLS bila didukung server).
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := m.Host + ":" + strconv.Itoa(m.Port)
+	return smtp.SendMail(addr, auth, m.From, mail.To, buildMIME(m.From, mail))
+}
+
+// FakeMailer menyimpan email di memori, dipakai untuk lokal dan test. Kalau Err
+// diisi, Send mengembalikannya tanpa menyimpan email (untuk mensimulasikan gagal kirim).
+type FakeMailer struct {
+	mu   sync.Mutex
+	Sent []Mail
+	Err  error
+}
+
+func (m *FakeMailer) Send(mail Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	m.Sent = append(m.Sent, mail)
+	log.Printf("FakeMailer: %q to %s (%d attachment)", mail.Subject, strings.Join(mail.To, ","), len(mail.Attachments))
+	return nil
+}
+
+func buildMIME(from string, mail Mail) []byte {
+	boundary := fmt.Sprintf("shollu-%d", time.Now().UnixNano())
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(mail.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(mail.Body + "\r\n")
+
+	for _, a := range mail.Attachments {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", a.ContentType)
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&buf, "Content-Disposition: attachment; filename=%q\r\n\r\n", a.Filename)
+
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			buf.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		buf.WriteString(encoded + "\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
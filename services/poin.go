@@ -0,0 +1,210 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+// PoinRule adalah aturan poin untuk satu sholat/tag dalam satu event.
+// Peserta yang datang di urutan 1..ArrivalTopN per mesin mendapat poin
+// kehadiran ArrivalTopN+1-urutan (urutan 1 dapat paling banyak).
+type PoinRule struct {
+	EventID     int    `json:"event_id"`
+	Tag         string `json:"tag"`
+	PointSholat int    `json:"point_sholat"`
+	ArrivalTopN int    `json:"arrival_top_n"`
+	Active      bool   `json:"active"`
+}
+
+// Poin adalah hasil perhitungan poin untuk satu absensi.
+type Poin struct {
+	Urutan         int
+	PointSholat    int
+	PointKehadiran int
+	Total          int
+}
+
+var (
+	poinRulesMu       sync.RWMutex
+	poinRulesCache    map[int]map[string]PoinRule
+	poinRulesLoadedAt time.Time
+)
+
+const poinRulesTTL = 5 * time.Minute
+
+// CalculatePoin menghitung poin dari aturan dan urutan kedatangan.
+func CalculatePoin(rule PoinRule, urutan int) Poin {
+	p := Poin{Urutan: urutan, PointSholat: rule.PointSholat}
+	if urutan >= 1 && urutan <= rule.ArrivalTopN {
+		p.PointKehadiran = rule.ArrivalTopN + 1 - urutan
+	}
+	p.Total = p.PointSholat + p.PointKehadiran
+	return p
+}
+
+// AwardPoin menghitung dan menyimpan poin untuk absensi yang baru di-insert,
+// di dalam transaksi yang sama dengan insert absensi-nya.
+func AwardPoin(tx *sql.Tx, rec AbsensiRecord) error {
+	if rec.Tag == "" {
+		return nil
+	}
+	if rec.Tanggal == "" {
+		rec.Tanggal = utils.LocalDate(rec.CreatedAt, utils.DefaultLocation())
+	}
+
+	rules, err := activePoinRules(rec.EventID)
+	if err != nil {
+		return err
+	}
+	rule, ok := rules[rec.Tag]
+	if !ok {
+		return nil
+	}
+
+	var count int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM absensi
+		WHERE event_id = ? AND tag = ? AND mesin_id = ? AND id < ? AND voided_at IS NULL
+			AND `+AbsensiLocalDateSQL("")+` = ?`,
+		rec.EventID, rec.Tag, rec.MesinID, rec.ID, rec.Tanggal).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	return savePoin(tx, rec, CalculatePoin(rule, count+1))
+}
+
+// RecomputePoin menghitung ulang semua poin event dalam rentang tanggal, misalnya
+// setelah aturan poin diubah atau ada absensi yang di-void.
+func RecomputePoin(eventID int, dateFrom, dateTo string) (int, error) {
+	InvalidatePoinRules()
+	rules, err := activePoinRules(eventID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM poin WHERE event_id = ? AND tanggal BETWEEN ? AND ?", eventID, dateFrom, dateTo)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, user_id, mesin_id, tag, DATE_FORMAT(`+AbsensiLocalTimeSQL("")+`, '%Y-%m-%d') AS tanggal
+		FROM absensi
+		WHERE event_id = ? AND voided_at IS NULL AND tag <> ''
+			AND `+AbsensiLocalDateSQL("")+` BETWEEN ? AND ?
+		ORDER BY id ASC`, eventID, dateFrom, dateTo)
+	if err != nil {
+		return 0, err
+	}
+
+	var records []AbsensiRecord
+	for rows.Next() {
+		rec := AbsensiRecord{EventID: eventID}
+		if err := rows.Scan(&rec.ID, &rec.UserID, &rec.MesinID, &rec.Tag, &rec.Tanggal); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		records = append(records, rec)
+	}
+	rows.Close()
+
+	// Urutan kedatangan dihitung per (tanggal, tag, mesin), sama seperti saat scan
+	urutan := make(map[string]int)
+	total := 0
+	for _, rec := range records {
+		rule, ok := rules[rec.Tag]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s|%s|%s", rec.Tanggal, rec.Tag, rec.MesinID)
+		urutan[key]++
+		if err := savePoin(tx, rec, CalculatePoin(rule, urutan[key])); err != nil {
+			return 0, err
+		}
+		total++
+	}
+
+	return total, tx.Commit()
+}
+
+// LoadPoinRules mengambil semua aturan poin sebuah event (termasuk yang tidak aktif).
+func LoadPoinRules(eventID int) ([]PoinRule, error) {
+	rows, err := database.DB.Query(`
+		SELECT event_id, tag, point_sholat, arrival_top_n, active
+		FROM poin_rules WHERE event_id = ? ORDER BY id ASC`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []PoinRule{}
+	for rows.Next() {
+		var r PoinRule
+		if err := rows.Scan(&r.EventID, &r.Tag, &r.PointSholat, &r.ArrivalTopN, &r.Active); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// InvalidatePoinRules memaksa aturan poin dibaca ulang dari database.
+func InvalidatePoinRules() {
+	poinRulesMu.Lock()
+	poinRulesCache = nil
+	poinRulesMu.Unlock()
+}
+
+func activePoinRules(eventID int) (map[string]PoinRule, error) {
+	poinRulesMu.RLock()
+	if poinRulesCache != nil && time.Since(poinRulesLoadedAt) < poinRulesTTL {
+		if rules, ok := poinRulesCache[eventID]; ok {
+			poinRulesMu.RUnlock()
+			return rules, nil
+		}
+	}
+	poinRulesMu.RUnlock()
+
+	all, err := LoadPoinRules(eventID)
+	if err != nil {
+		return nil, err
+	}
+	rules := make(map[string]PoinRule)
+	for _, r := range all {
+		if r.Active {
+			rules[r.Tag] = r
+		}
+	}
+
+	poinRulesMu.Lock()
+	if poinRulesCache == nil || time.Since(poinRulesLoadedAt) >= poinRulesTTL {
+		poinRulesCache = make(map[int]map[string]PoinRule)
+		poinRulesLoadedAt = time.Now()
+	}
+	poinRulesCache[eventID] = rules
+	poinRulesMu.Unlock()
+
+	return rules, nil
+}
+
+func savePoin(tx *sql.Tx, rec AbsensiRecord, p Poin) error {
+	_, err := tx.Exec(`
+		INSERT INTO poin (absensi_id, user_id, event_id, mesin_id, tanggal, tag, urutan, point_sholat, point_kehadiran, total_point)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE urutan = VALUES(urutan), point_sholat = VALUES(point_sholat),
+			point_kehadiran = VALUES(point_kehadiran), total_point = VALUES(total_point)`,
+		rec.ID, rec.UserID, rec.EventID, rec.MesinID, rec.Tanggal, rec.Tag, p.Urutan, p.PointSholat, p.PointKehadiran, p.Total)
+	return err
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"shollu/config"
+	"shollu/database"
+	"shollu/utils"
+
+	"github.com/robfig/cron/v3"
+)
+
+var ErrReportScheduleNotFound = errors.New("report schedule not found")
+
+// ReportRetryDelay adalah jeda retry pertama; retry berikutnya dikali nomor attempt.
+var ReportRetryDelay = 5 * time.Minute
+
+// ReportSchedule adalah laporan yang di-generate otomatis sesuai cron dan
+// dikirim lewat satu channel (email, webhook atau file).
+type ReportSchedule struct {
+	ID         int               `json:"id"`
+	Name       string            `json:"name"`
+	Report     string            `json:"report"`
+	Params     map[string]string `json:"params"`
+	Format     string            `json:"format"`
+	CronExpr   string            `json:"cron_expr"`
+	Channel    string            `json:"channel"`
+	Target     string            `json:"target"`
+	MaxRetries int               `json:"max_retries"`
+	Active     bool              `json:"active"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// ReportFile adalah hasil render laporan yang siap dikirim.
+type ReportFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ReportBuilder menyusun tabel laporan dari params jadwal, beserta nama file
+// (tanpa ekstensi). Builder didaftarkan oleh package controllers.
+type ReportBuilder func(params map[string]string) (*utils.ExportTable, string, error)
+
+// ReportChannel mengirim file laporan ke tujuan jadwal.
+type ReportChannel interface {
+	Deliver(schedule ReportSchedule, file ReportFile) error
+}
+
+var (
+	reportBuilders = make(map[string]ReportBuilder)
+
+	ReportChannels = map[string]ReportChannel{
+		"email":   emailChannel{},
+		"webhook": webhookChannel{client: &http.Client{Timeout: 30 * time.Second}},
+		"file":    fileChannel{},
+	}
+
+	reportCron   *cron.Cron
+	reportCronMu sync.Mutex
+)
+
+// RegisterReport mendaftarkan builder laporan dengan nama yang dipakai di kolom report.
+func RegisterReport(name string, builder ReportBuilder) {
+	reportBuilders[name] = builder
+}
+
+// ReportNames mengembalikan nama semua laporan yang bisa dijadwalkan.
+func ReportNames() []string {
+	names := make([]string, 0, len(reportBuilders))
+	for name := range reportBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateReportSchedule mengecek laporan, channel dan cron expression jadwal.
+func ValidateReportSchedule(s ReportSchedule) error {
+	if _, ok := reportBuilders[s.Report]; !ok {
+		return fmt.Errorf("unknown report %q", s.Report)
+	}
+	if _, ok := ReportChannels[s.Channel]; !ok {
+		return fmt.Errorf("unknown channel %q", s.Channel)
+	}
+	if !utils.IsExportFormat(s.Format) {
+		return fmt.Errorf("unknown format %q", s.Format)
+	}
+	if _, err := cron.ParseStandard(s.CronExpr); err != nil {
+		return fmt.Errorf("invalid cron_expr: %w", err)
+	}
+	return nil
+}
+
+// StartReportScheduler menjalankan semua jadwal aktif (waktu cron dalam WIB)
+// dan loop retry untuk run yang gagal.
+func StartReportScheduler() {
+	if DefaultMailer == nil {
+		DefaultMailer = NewMailerFromConfig()
+	}
+
+	reportCronMu.Lock()
+	reportCron = cron.New(cron.WithLocation(utils.DefaultLocation()))
+	reportCronMu.Unlock()
+
+	if err := ReloadReportSchedules(); err != nil {
+		log.Println("Error loading report schedules:", err)
+	}
+	reportCron.Start()
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			retryDueReportRuns()
+		}
+	}()
+}
+
+// ReloadReportSchedules membaca ulang jadwal aktif, dipanggil setiap jadwal diubah.
+func ReloadReportSchedules() error {
+	reportCronMu.Lock()
+	defer reportCronMu.Unlock()
+	if reportCron == nil {
+		return nil
+	}
+
+	schedules, err := LoadReportSchedules(true)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range reportCron.Entries() {
+		reportCron.Remove(entry.ID)
+	}
+	for _, s := range schedules {
+		scheduleID := s.ID
+		_, err := reportCron.AddFunc(s.CronExpr, func() {
+			if _, err := RunReportSchedule(scheduleID, "schedule"); err != nil {
+				log.Printf("Report schedule %d failed: %v", scheduleID, err)
+			}
+		})
+		if err != nil {
+			log.Printf("Skipping report schedule %d: %v", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// LoadReportSchedules mengambil semua jadwal, atau hanya yang aktif.
+func LoadReportSchedules(activeOnly bool) ([]ReportSchedule, error) {
+	query := `
+		SELECT id, name, report, COALESCE(params, '{}'), format, cron_expr, channel, target, max_retries, active, created_at
+		FROM report_schedules`
+	if activeOnly {
+		query += " WHERE active = 1"
+	}
+	query += " ORDER BY id ASC"
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []ReportSchedule{}
+	for rows.Next() {
+		s, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *s)
+	}
+	return schedules, rows.Err()
+}
+
+// LoadReportSchedule mengambil satu jadwal.
+func LoadReportSchedule(id int) (*ReportSchedule, error) {
+	row := database.DB.QueryRow(`
+		SELECT id, name, report, COALESCE(params, '{}'), format, cron_expr, channel, target, max_retries, active, created_at
+		FROM report_schedules WHERE id = ?`, id)
+	s, err := scanReportSchedule(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrReportScheduleNotFound
+	}
+	return s, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReportSchedule(row rowScanner) (*ReportSchedule, error) {
+	var s ReportSchedule
+	var params string
+	if err := row.Scan(&s.ID, &s.Name, &s.Report, &params, &s.Format, &s.CronExpr, &s.Channel, &s.Target,
+		&s.MaxRetries, &s.Active, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	s.Params = make(map[string]string)
+	if err := json.Unmarshal([]byte(params), &s.Params); err != nil {
+		return nil, fmt.Errorf("schedule %d params: %w", s.ID, err)
+	}
+	return &s, nil
+}
+
+// RunReportSchedule menjalankan satu jadwal sekarang dan mengembalikan id run-nya.
+func RunReportSchedule(scheduleID int, trigger string) (int64, error) {
+	s, err := LoadReportSchedule(scheduleID)
+	if err != nil {
+		return 0, err
+	}
+	return runReport(*s, 1, trigger)
+}
+
+func runReport(s ReportSchedule, attempt int, trigger string) (int64, error) {
+	result, err := database.DB.Exec(`
+		INSERT INTO report_runs (schedule_id, status, attempt, trigger_type, started_at)
+		VALUES (?, 'running', ?, ?, ?)`, s.ID, attempt, trigger, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	fileName, runErr := generateAndDeliver(s)
+	now := time.Now().UTC()
+	if runErr == nil {
+		_, err = database.DB.Exec(`
+			UPDATE report_runs SET status = 'success', file_name = ?, finished_at = ? WHERE id = ?`,
+			fileName, now, runID)
+		return runID, err
+	}
+
+	status, nextRetry := reportRetryState(s, attempt, now)
+	_, err = database.DB.Exec(`
+		UPDATE report_runs SET status = ?, file_name = ?, error = ?, finished_at = ?, next_retry_at = ? WHERE id = ?`,
+		status, fileName, runErr.Error(), now, nextRetry, runID)
+	if err != nil {
+		log.Println("Error updating report run:", err)
+	}
+	return runID, runErr
+}
+
+// reportRetryState menentukan status run yang gagal: retrying dengan jeda yang
+// makin panjang sampai max_retries habis, lalu failed (nextRetry nil).
+func reportRetryState(s ReportSchedule, attempt int, now time.Time) (string, *time.Time) {
+	if attempt > s.MaxRetries {
+		return "failed", nil
+	}
+	next := now.Add(ReportRetryDelay * time.Duration(attempt))
+	return "retrying", &next
+}
+
+func generateAndDeliver(s ReportSchedule) (string, error) {
+	builder, ok := reportBuilders[s.Report]
+	if !ok {
+		return "", fmt.Errorf("unknown report %q", s.Report)
+	}
+	channel, ok := ReportChannels[s.Channel]
+	if !ok {
+		return "", fmt.Errorf("unknown channel %q", s.Channel)
+	}
+
+	table, name, err := builder(s.Params)
+	if err != nil {
+		return "", fmt.Errorf("build report: %w", err)
+	}
+	data, err := table.Render(s.Format)
+	if err != nil {
+		return "", fmt.Errorf("render report: %w", err)
+	}
+
+	file := ReportFile{
+		Filename:    name + "." + s.Format,
+		ContentType: utils.ExportContentType(s.Format),
+		Data:        data,
+	}
+	if err := channel.Deliver(s, file); err != nil {
+		return file.Filename, fmt.Errorf("deliver via %s: %w", s.Channel, err)
+	}
+	return file.Filename, nil
+}
+
+// retryDueReportRuns menjalankan ulang run yang gagal dan sudah waktunya di-retry.
+func retryDueReportRuns() {
+	rows, err := database.DB.Query(`
+		SELECT id, schedule_id, attempt FROM report_runs
+		WHERE status = 'retrying' AND next_retry_at <= ?`, time.Now().UTC())
+	if err != nil {
+		log.Println("Error fetching report retries:", err)
+		return
+	}
+
+	type due struct {
+		runID      int64
+		scheduleID int
+		attempt    int
+	}
+	var runs []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.runID, &d.scheduleID, &d.attempt); err == nil {
+			runs = append(runs, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range runs {
+		// Klaim run supaya tidak di-retry dua kali
+		result, err := database.DB.Exec("UPDATE report_runs SET status = 'failed' WHERE id = ? AND status = 'retrying'", d.runID)
+		if err != nil {
+			continue
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		s, err := LoadReportSchedule(d.scheduleID)
+		if err != nil || !s.Active {
+			continue
+		}
+		if _, err := runReport(*s, d.attempt+1, "retry"); err != nil {
+			log.Printf("Retry of report schedule %d failed: %v", d.scheduleID, err)
+		}
+	}
+}
+
+type emailChannel struct{}
+
+func (emailChannel) Deliver(s ReportSchedule, file ReportFile) error {
+	var to []string
+	for _, addr := range strings.Split(s.Target, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return errors.New("no email recipient")
+	}
+	if DefaultMailer == nil {
+		DefaultMailer = NewMailerFromConfig()
+	}
+
+	return DefaultMailer.Send(Mail{
+		To:      to,
+		Subject: s.Name,
+		Body:    fmt.Sprintf("Assalamu'alaikum,\n\nBerikut laporan %s (%s) terlampir.\n", s.Name, file.Filename),
+		Attachments: []Attachment{{
+			Filename:    file.Filename,
+			ContentType: file.ContentType,
+			Data:        file.Data,
+		}},
+	})
+}
+
+type webhookChannel struct {
+	client *http.Client
+}
+
+func (w webhookChannel) Deliver(s ReportSchedule, file ReportFile) error {
+	req, err := http.NewRequest(http.MethodPost, s.Target, bytes.NewReader(file.Data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", file.ContentType)
+	req.Header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Filename))
+	req.Header.Set("X-Report-Schedule", s.Name)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+type fileChannel struct{}
+
+// Deliver menulis file ke REPORT_DROP_DIR/<target>. Target adalah sub-folder
+// relatif dan tidak boleh keluar dari folder drop.
+func (fileChannel) Deliver(s ReportSchedule, file ReportFile) error {
+	dir := filepath.Join(config.ReportDropDir, filepath.Clean("/"+s.Target))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// Tulis ke file sementara dulu supaya pembaca tidak melihat file setengah jadi
+	path := filepath.Join(dir, file.Filename)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, file.Data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
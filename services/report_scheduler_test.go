@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"shollu/utils"
+)
+
+func testReportSchedule(t *testing.T) ReportSchedule {
+	t.Helper()
+	RegisterReport("test_rekap", func(params map[string]string) (*utils.ExportTable, string, error) {
+		return &utils.ExportTable{
+			Title:   "Rekap Test",
+			Headers: []string{"No", "Nama"},
+			Rows:    [][]string{{"1", "Ahmad"}, {"2", "Budi"}},
+		}, "rekap-" + params["id_masjid"], nil
+	})
+	t.Cleanup(func() { delete(reportBuilders, "test_rekap") })
+
+	mailer := DefaultMailer
+	t.Cleanup(func() { DefaultMailer = mailer })
+
+	return ReportSchedule{
+		ID:         7,
+		Name:       "Rekap Harian",
+		Report:     "test_rekap",
+		Params:     map[string]string{"id_masjid": "12"},
+		Format:     "csv",
+		CronExpr:   "0 6 * * *",
+		Channel:    "email",
+		Target:     "takmir@example.com, admin@example.com,",
+		MaxRetries: 2,
+		Active:     true,
+	}
+}
+
+func TestReportScheduleEmailDelivery(t *testing.T) {
+	s := testReportSchedule(t)
+	if err := ValidateReportSchedule(s); err != nil {
+		t.Fatalf("ValidateReportSchedule: %v", err)
+	}
+	mailer := &FakeMailer{}
+	DefaultMailer = mailer
+
+	fileName, err := generateAndDeliver(s)
+	if err != nil {
+		t.Fatalf("generateAndDeliver: %v", err)
+	}
+	if fileName != "rekap-12.csv" {
+		t.Errorf("file name = %q, want rekap-12.csv", fileName)
+	}
+	if len(mailer.Sent) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(mailer.Sent))
+	}
+	mail := mailer.Sent[0]
+	if want := []string{"takmir@example.com", "admin@example.com"}; !reflect.DeepEqual(mail.To, want) {
+		t.Errorf("to = %v, want %v", mail.To, want)
+	}
+	if mail.Subject != s.Name {
+		t.Errorf("subject = %q, want %q", mail.Subject, s.Name)
+	}
+	if len(mail.Attachments) != 1 {
+		t.Fatalf("attachments = %d, want 1", len(mail.Attachments))
+	}
+	att := mail.Attachments[0]
+	if att.Filename != "rekap-12.csv" || att.ContentType != utils.ExportContentType("csv") {
+		t.Errorf("attachment = %s (%s)", att.Filename, att.ContentType)
+	}
+	if !strings.Contains(string(att.Data), "Budi") {
+		t.Errorf("attachment does not contain report rows: %q", att.Data)
+	}
+}
+
+func TestReportScheduleRetryOnFailure(t *testing.T) {
+	s := testReportSchedule(t)
+	mailer := &FakeMailer{Err: errors.New("smtp: connection refused")}
+	DefaultMailer = mailer
+	now := time.Date(2025, 3, 10, 23, 0, 0, 0, time.UTC)
+
+	// Attempt 1 dan 2 gagal: masih dalam max_retries, retry dengan jeda makin panjang
+	for attempt := 1; attempt <= s.MaxRetries; attempt++ {
+		fileName, err := generateAndDeliver(s)
+		if err == nil || !strings.Contains(err.Error(), "deliver via email") {
+			t.Fatalf("attempt %d: err = %v, want delivery error", attempt, err)
+		}
+		if fileName != "rekap-12.csv" {
+			t.Errorf("attempt %d: file name = %q, want it recorded on failure", attempt, fileName)
+		}
+		status, next := reportRetryState(s, attempt, now)
+		if status != "retrying" || next == nil {
+			t.Fatalf("attempt %d: status = %s, next = %v, want retrying", attempt, status, next)
+		}
+		if want := now.Add(ReportRetryDelay * time.Duration(attempt)); !next.Equal(want) {
+			t.Errorf("attempt %d: next retry = %s, want %s", attempt, next, want)
+		}
+	}
+	if len(mailer.Sent) != 0 {
+		t.Errorf("failed attempts recorded %d mails", len(mailer.Sent))
+	}
+
+	// Retry berikutnya berhasil terkirim
+	mailer.Err = nil
+	if _, err := generateAndDeliver(s); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(mailer.Sent) != 1 {
+		t.Errorf("sent %d mails after retry, want 1", len(mailer.Sent))
+	}
+
+	// Setelah max_retries habis run berhenti sebagai failed
+	status, next := reportRetryState(s, s.MaxRetries+1, now)
+	if status != "failed" || next != nil {
+		t.Errorf("after max_retries: status = %s, next = %v, want failed", status, next)
+	}
+}
+
+func TestReportScheduleNoRecipient(t *testing.T) {
+	s := testReportSchedule(t)
+	s.Target = " , "
+	mailer := &FakeMailer{}
+	DefaultMailer = mailer
+
+	if _, err := generateAndDeliver(s); err == nil {
+		t.Fatal("expected error for empty recipient list")
+	}
+	if len(mailer.Sent) != 0 {
+		t.Errorf("sent %d mails, want 0", len(mailer.Sent))
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Jenis sesi yang bisa dijadwalkan. Jenis dipakai sebagai tag absensi sehingga
+// poin, counter dan webhook ikut membedakannya.
+var SessionJenis = []string{"kajian", "tarawih", "jumat", "itikaf", "lainnya"}
+
+// EventSession adalah sesi terjadwal di satu masjid (atau semua masjid kalau
+// MasjidID nil). StartAt/EndAt adalah kemunculan pertama dalam UTC.
+type EventSession struct {
+	ID              int        `json:"id"`
+	EventID         int        `json:"event_id"`
+	MasjidID        *int       `json:"masjid_id"`
+	Nama            string     `json:"nama"`
+	Jenis           string     `json:"jenis"`
+	StartAt         time.Time  `json:"start_at"`
+	EndAt           time.Time  `json:"end_at"`
+	Recurrence      string     `json:"recurrence"`
+	RecurrenceUntil *string    `json:"recurrence_until"`
+	Capacity        *int       `json:"capacity"`
+	Active          bool       `json:"active"`
+	CreatedAt       time.Time  `json:"created_at"`
+	NextOccurrence  *time.Time `json:"next_occurrence,omitempty"`
+}
+
+// SessionOccurrence adalah satu kemunculan sesi. Tanggal adalah tanggal lokal
+// masjid saat sesi dimulai, dipakai sebagai kunci rekap sesi berulang.
+type SessionOccurrence struct {
+	Session EventSession `json:"session"`
+	Tanggal string       `json:"tanggal"`
+	StartAt time.Time    `json:"start_at"`
+	EndAt   time.Time    `json:"end_at"`
+}
+
+const sessionColumns = `id, event_id, masjid_id, nama, jenis, start_at, end_at, recurrence,
+	DATE_FORMAT(recurrence_until, '%Y-%m-%d'), capacity, active, created_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (EventSession, error) {
+	var s EventSession
+	var masjidID, capacity sql.NullInt64
+	var until sql.NullString
+	err := row.Scan(&s.ID, &s.EventID, &masjidID, &s.Nama, &s.Jenis, &s.StartAt, &s.EndAt, &s.Recurrence,
+		&until, &capacity, &s.Active, &s.CreatedAt)
+	if err != nil {
+		return s, err
+	}
+	if masjidID.Valid {
+		id := int(masjidID.Int64)
+		s.MasjidID = &id
+	}
+	if until.Valid {
+		s.RecurrenceUntil = &until.String
+	}
+	if capacity.Valid {
+		n := int(capacity.Int64)
+		s.Capacity = &n
+	}
+	s.StartAt, s.EndAt = s.StartAt.UTC(), s.EndAt.UTC()
+	return s, nil
+}
+
+// LoadSession mengambil satu sesi.
+func LoadSession(id int) (EventSession, error) {
+	s, err := scanSession(database.DB.QueryRow("SELECT "+sessionColumns+" FROM event_sessions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return s, ErrSessionNotFound
+	}
+	return s, err
+}
+
+// LoadSessions mengambil sesi event, eventID/masjidID 0 berarti semua. Sesi tanpa
+// masjid ikut muncul untuk setiap masjid.
+func LoadSessions(eventID, masjidID int, activeOnly bool) ([]EventSession, error) {
+	query := "SELECT " + sessionColumns + " FROM event_sessions WHERE 1 = 1"
+	var args []interface{}
+	if eventID != 0 {
+		query += " AND event_id = ?"
+		args = append(args, eventID)
+	}
+	if masjidID != 0 {
+		query += " AND (masjid_id = ? OR masjid_id IS NULL)"
+		args = append(args, masjidID)
+	}
+	if activeOnly {
+		query += " AND active = 1"
+	}
+	query += " ORDER BY start_at ASC, id ASC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []EventSession{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// ValidateSession memeriksa jenis, urutan waktu dan pengulangan sesi.
+func ValidateSession(s EventSession) error {
+	known := false
+	for _, j := range SessionJenis {
+		if j == s.Jenis {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown jenis %q", s.Jenis)
+	}
+	if !s.EndAt.After(s.StartAt) {
+		return fmt.Errorf("end_at must be after start_at")
+	}
+	if period := recurrencePeriod(s.Recurrence); period > 0 && s.EndAt.Sub(s.StartAt) > time.Duration(period)*24*time.Hour {
+		return fmt.Errorf("session is longer than its recurrence period")
+	}
+	if s.Capacity != nil && *s.Capacity < 1 {
+		return fmt.Errorf("capacity must be at least 1")
+	}
+	return nil
+}
+
+// Location mengembalikan zona waktu sesi (zona masjid, atau default untuk sesi semua masjid).
+func (s EventSession) Location() *time.Location {
+	if s.MasjidID == nil {
+		return utils.DefaultLocation()
+	}
+	return MasjidLocation(*s.MasjidID)
+}
+
+// OccurrenceAt mengembalikan kemunculan sesi yang sedang berlangsung pada waktu
+// at di zona loc, atau nil kalau tidak ada.
+func (s EventSession) OccurrenceAt(at time.Time, loc *time.Location) *SessionOccurrence {
+	duration := s.EndAt.Sub(s.StartAt)
+	period := recurrencePeriod(s.Recurrence)
+	if period == 0 {
+		if at.Before(s.StartAt) || !at.Before(s.EndAt) {
+			return nil
+		}
+		return s.occurrence(s.StartAt, duration, loc)
+	}
+
+	// Tidak ada DST di zona yang didukung, jadi satu hari selalu 24 jam
+	first := s.StartAt.In(loc)
+	if at.Before(first) {
+		return nil
+	}
+	n := int(at.Sub(first) / (time.Duration(period) * 24 * time.Hour))
+	start := first.AddDate(0, 0, n*period)
+	if !at.Before(start.Add(duration)) || !s.withinRecurrence(start, loc) {
+		return nil
+	}
+	return s.occurrence(start, duration, loc)
+}
+
+// OccurrenceOn mengembalikan kemunculan sesi yang dimulai pada tanggal lokal tanggal.
+// Tanggal kosong berarti kemunculan pertama (sesi tanpa pengulangan).
+func (s EventSession) OccurrenceOn(tanggal string, loc *time.Location) (*SessionOccurrence, error) {
+	duration := s.EndAt.Sub(s.StartAt)
+	first := s.StartAt.In(loc)
+	if tanggal == "" || recurrencePeriod(s.Recurrence) == 0 {
+		if tanggal != "" && tanggal != first.Format("2006-01-02") {
+			return nil, fmt.Errorf("session does not occur on %s", tanggal)
+		}
+		return s.occurrence(first, duration, loc), nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", tanggal, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", tanggal)
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), first.Hour(), first.Minute(), first.Second(), 0, loc)
+	days := int(start.Sub(first).Hours() / 24)
+	if start.Before(first) || days%recurrencePeriod(s.Recurrence) != 0 || !s.withinRecurrence(start, loc) {
+		return nil, fmt.Errorf("session does not occur on %s", tanggal)
+	}
+	return s.occurrence(start, duration, loc), nil
+}
+
+// NextOccurrenceAfter mengembalikan kemunculan yang sedang atau akan berlangsung setelah at.
+func (s EventSession) NextOccurrenceAfter(at time.Time, loc *time.Location) *SessionOccurrence {
+	if occ := s.OccurrenceAt(at, loc); occ != nil {
+		return occ
+	}
+	duration := s.EndAt.Sub(s.StartAt)
+	first := s.StartAt.In(loc)
+	if !at.After(first) {
+		return s.occurrence(first, duration, loc)
+	}
+	period := recurrencePeriod(s.Recurrence)
+	if period == 0 {
+		return nil
+	}
+	n := int(at.Sub(first)/(time.Duration(period)*24*time.Hour)) + 1
+	start := first.AddDate(0, 0, n*period)
+	if !s.withinRecurrence(start, loc) {
+		return nil
+	}
+	return s.occurrence(start, duration, loc)
+}
+
+// LatestOccurrence mengembalikan kemunculan terakhir yang sudah dimulai pada
+// waktu at, atau kemunculan pertama kalau sesi belum pernah dimulai.
+func (s EventSession) LatestOccurrence(at time.Time, loc *time.Location) *SessionOccurrence {
+	duration := s.EndAt.Sub(s.StartAt)
+	first := s.StartAt.In(loc)
+	period := recurrencePeriod(s.Recurrence)
+	if s.RecurrenceUntil != nil {
+		if until, err := time.ParseInLocation("2006-01-02", *s.RecurrenceUntil, loc); err == nil {
+			if last := until.AddDate(0, 0, 1).Add(-time.Second); at.After(last) {
+				at = last
+			}
+		}
+	}
+	if period == 0 || !at.After(first) {
+		return s.occurrence(first, duration, loc)
+	}
+	n := int(at.Sub(first) / (time.Duration(period) * 24 * time.Hour))
+	return s.occurrence(first.AddDate(0, 0, n*period), duration, loc)
+}
+
+func (s EventSession) occurrence(start time.Time, duration time.Duration, loc *time.Location) *SessionOccurrence {
+	return &SessionOccurrence{
+		Session: s,
+		Tanggal: start.In(loc).Format("2006-01-02"),
+		StartAt: start.UTC(),
+		EndAt:   start.Add(duration).UTC(),
+	}
+}
+
+func (s EventSession) withinRecurrence(start time.Time, loc *time.Location) bool {
+	return s.RecurrenceUntil == nil || start.In(loc).Format("2006-01-02") <= *s.RecurrenceUntil
+}
+
+func recurrencePeriod(recurrence string) int {
+	switch recurrence {
+	case "daily":
+		return 1
+	case "weekly":
+		return 7
+	}
+	return 0
+}
+
+// ActiveSession mencari sesi event yang sedang berlangsung di masjid pada waktu
+// at. Kalau beberapa sesi tumpang tindih, sesi khusus masjid didahulukan dari
+// sesi semua masjid. hasSessions bernilai true kalau event punya sesi aktif di
+// masjid ini, meskipun tidak ada yang sedang berlangsung.
+func ActiveSession(eventID, masjidID int, at time.Time) (occ *SessionOccurrence, hasSessions bool, err error) {
+	sessions, err := LoadSessions(eventID, masjidID, true)
+	if err != nil {
+		return nil, false, err
+	}
+	loc := MasjidLocation(masjidID)
+	for _, s := range sessions {
+		found := s.OccurrenceAt(at, loc)
+		if found == nil {
+			continue
+		}
+		if occ == nil || (occ.Session.MasjidID == nil && s.MasjidID != nil) {
+			occ = found
+		}
+	}
+	return occ, len(sessions) > 0, nil
+}
+
+// SessionAttendance menghitung peserta unik yang sudah absen di satu kemunculan sesi.
+func SessionAttendance(exec interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, occ *SessionOccurrence) (int, error) {
+	var n int
+	err := exec.QueryRow(`
+		SELECT COUNT(DISTINCT user_id) FROM absensi
+		WHERE session_id = ? AND voided_at IS NULL AND created_at >= ? AND created_at < ?`,
+		occ.Session.ID, occ.StartAt, occ.EndAt).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+var (
+	ErrShareTokenInvalid  = errors.New("share token is invalid, expired or revoked")
+	ErrShareTokenNotFound = errors.New("share token not found")
+	ErrSharePinRequired   = errors.New("share pin is required")
+	ErrSharePinInvalid    = errors.New("share pin is invalid")
+	ErrSharePinLocked     = errors.New("share link is locked after too many wrong pins")
+)
+
+// SharePinMaxFailures adalah jumlah pin salah sebelum link dikunci.
+const SharePinMaxFailures = 10
+
+// Mode privasi nama peserta di halaman share.
+const (
+	SharePrivacyFull     = "full"
+	SharePrivacyHide     = "hide"
+	SharePrivacyInitials = "initials"
+)
+
+// ShareToken adalah link berbagi collection. Token mentah hanya dikembalikan
+// sekali saat dibuat.
+type ShareToken struct {
+	ID           int        `json:"id"`
+	CollectionID int64      `json:"collection_id"`
+	Label        string     `json:"label"`
+	Privacy      string     `json:"privacy"`
+	HasPin       bool       `json:"has_pin"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedBy    int        `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+// CreateShareToken membuat link berbagi baru dan mengembalikan token mentahnya.
+// pin kosong berarti tanpa pin, expiresAt nil berarti tidak kedaluwarsa.
+func CreateShareToken(tx *sql.Tx, collectionID int64, label, privacy, pin string, expiresAt *time.Time, createdBy int) (string, int64, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", 0, err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	var pinHash interface{}
+	if pin != "" {
+		hashed, err := utils.HashPassword(pin)
+		if err != nil {
+			return "", 0, err
+		}
+		pinHash = hashed
+	}
+	var expires interface{}
+	if expiresAt != nil {
+		expires = expiresAt.UTC()
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO collection_share_tokens (collection_id, token_hash, label, privacy, pin_hash, expires_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?)`,
+		collectionID, hashShareToken(raw), label, privacy, pinHash, expires, createdBy, time.Now().UTC())
+	if err != nil {
+		return "", 0, err
+	}
+	id, err := res.LastInsertId()
+	return raw, id, err
+}
+
+// LoadShareTokens mengambil semua link berbagi collection, terbaru lebih dulu.
+func LoadShareTokens(collectionID int64) ([]ShareToken, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, collection_id, label, privacy, pin_hash IS NOT NULL, expires_at, revoked_at,
+			COALESCE(created_by, 0), created_at, last_used_at
+		FROM collection_share_tokens WHERE collection_id = ? ORDER BY id DESC`, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []ShareToken{}
+	for rows.Next() {
+		var t ShareToken
+		var expires, revoked, lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.CollectionID, &t.Label, &t.Privacy, &t.HasPin, &expires, &revoked,
+			&t.CreatedBy, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		t.ExpiresAt = nullTimePtr(expires)
+		t.RevokedAt = nullTimePtr(revoked)
+		t.LastUsedAt = nullTimePtr(lastUsed)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeShareToken mencabut link berbagi collection.
+func RevokeShareToken(tx *sql.Tx, collectionID int64, tokenID int) error {
+	res, err := tx.Exec(`
+		UPDATE collection_share_tokens SET revoked_at = COALESCE(revoked_at, ?)
+		WHERE id = ? AND collection_id = ?`, time.Now().UTC(), tokenID, collectionID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM collection_share_tokens WHERE id = ? AND collection_id = ?)", tokenID, collectionID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrShareTokenNotFound
+		}
+	}
+	return nil
+}
+
+// ResolveShareToken memeriksa token mentah untuk collection slug beserta pinnya.
+// Pin yang salah dihitung; setelah SharePinMaxFailures link dikunci.
+func ResolveShareToken(raw, slug, pin string) (*ShareToken, error) {
+	if raw == "" {
+		return nil, ErrShareTokenInvalid
+	}
+	var t ShareToken
+	var pinHash sql.NullString
+	var failures int
+	var expires, revoked sql.NullTime
+	err := database.DB.QueryRow(`
+		SELECT st.id, st.collection_id, st.label, st.privacy, st.pin_hash, st.pin_failures, st.expires_at, st.revoked_at
+		FROM collection_share_tokens st
+		JOIN collections c ON st.collection_id = c.id
+		WHERE st.token_hash = ? AND c.slug = ?`, hashShareToken(raw), slug).
+		Scan(&t.ID, &t.CollectionID, &t.Label, &t.Privacy, &pinHash, &failures, &expires, &revoked)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	if revoked.Valid || (expires.Valid && !time.Now().Before(expires.Time)) {
+		return nil, ErrShareTokenInvalid
+	}
+	t.ExpiresAt = nullTimePtr(expires)
+
+	if pinHash.Valid {
+		t.HasPin = true
+		if failures >= SharePinMaxFailures {
+			return nil, ErrSharePinLocked
+		}
+		if pin == "" {
+			return nil, ErrSharePinRequired
+		}
+		if !utils.CheckPassword(pinHash.String, pin) {
+			if _, err := database.DB.Exec("UPDATE collection_share_tokens SET pin_failures = pin_failures + 1 WHERE id = ?", t.ID); err != nil {
+				return nil, err
+			}
+			return nil, ErrSharePinInvalid
+		}
+	}
+
+	if _, err := database.DB.Exec("UPDATE collection_share_tokens SET last_used_at = ?, pin_failures = 0 WHERE id = ?", time.Now().UTC(), t.ID); err != nil {
+		log.Println("Error updating share token usage:", err)
+	}
+	return &t, nil
+}
+
+func hashShareToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,11 @@
+package services
+
+// TagJumat adalah tag scan sholat Jumat jamaah laki-laki. Di hari Jumat scan ini
+// menggantikan dzuhur, jadi badge dan target yang meminta dzuhur juga terpenuhi
+// oleh jumat.
+const TagJumat = "jumat"
+
+// TagAttended mengecek apakah tag tercatat hadir di tags; jumat memenuhi dzuhur.
+func TagAttended(tags map[string]bool, tag string) bool {
+	return tags[tag] || (tag == "dzuhur" && tags[TagJumat])
+}
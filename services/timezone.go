@@ -0,0 +1,106 @@
+package services
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"shollu/database"
+	"shollu/utils"
+)
+
+// Zona waktu masjid adalah masjid.timezone, kalau kosong ikut regional.timezone.
+// Tanggal absensi, jendela waktu sholat dan default "hari ini" dihitung di zona
+// masjid tempat scan.
+
+var (
+	timezoneMu       sync.RWMutex
+	masjidTimezones  map[int]string
+	timezoneLoadedAt time.Time
+)
+
+const timezoneTTL = 5 * time.Minute
+
+// MasjidTimezoneSQL menghasilkan subquery nama zona masjid untuk ekspresi id masjid.
+func MasjidTimezoneSQL(masjidIDExpr string) string {
+	return `(SELECT COALESCE(tzm.timezone, tzr.timezone) FROM masjid tzm
+		LEFT JOIN regional tzr ON tzm.regional_id = tzr.id WHERE tzm.id = ` + masjidIDExpr + `)`
+}
+
+// MasjidLocalTimeSQL mengubah kolom UTC tsExpr ke waktu lokal masjid masjidIDExpr.
+func MasjidLocalTimeSQL(tsExpr, masjidIDExpr string) string {
+	return utils.LocalTimeSQL(tsExpr, MasjidTimezoneSQL(masjidIDExpr))
+}
+
+// AbsensiLocalTimeSQL mengubah created_at absensi ke waktu lokal masjid tempat
+// scan (lewat petugas.id_user = mesin_id). alias kosong berarti tabel absensi.
+func AbsensiLocalTimeSQL(alias string) string {
+	if alias == "" {
+		alias = "absensi"
+	}
+	return utils.LocalTimeSQL(alias+".created_at", `(SELECT COALESCE(tzm.timezone, tzr.timezone) FROM petugas tzp
+		JOIN masjid tzm ON tzp.id_masjid = tzm.id
+		LEFT JOIN regional tzr ON tzm.regional_id = tzr.id
+		WHERE tzp.id_user = `+alias+`.mesin_id LIMIT 1)`)
+}
+
+// AbsensiLocalDateSQL adalah DATE() dari AbsensiLocalTimeSQL.
+func AbsensiLocalDateSQL(alias string) string {
+	return "DATE(" + AbsensiLocalTimeSQL(alias) + ")"
+}
+
+// MasjidLocation mengembalikan zona waktu masjid. Masjid yang tidak dikenal
+// (atau 0) memakai zona default.
+func MasjidLocation(masjidID int) *time.Location {
+	return utils.Location(masjidTimezone(masjidID))
+}
+
+// PesertaLocation mengembalikan zona waktu masjid tempat peserta terdaftar.
+func PesertaLocation(userID int) *time.Location {
+	var masjidID sql.NullInt64
+	if err := database.DB.QueryRow("SELECT masjid_id FROM peserta WHERE id = ?", userID).Scan(&masjidID); err != nil {
+		return utils.DefaultLocation()
+	}
+	return MasjidLocation(int(masjidID.Int64))
+}
+
+// InvalidateTimezones memaksa zona masjid dibaca ulang setelah regional/masjid diubah.
+func InvalidateTimezones() {
+	timezoneMu.Lock()
+	masjidTimezones = nil
+	timezoneMu.Unlock()
+}
+
+func masjidTimezone(masjidID int) string {
+	timezoneMu.RLock()
+	if masjidTimezones != nil && time.Since(timezoneLoadedAt) < timezoneTTL {
+		tz := masjidTimezones[masjidID]
+		timezoneMu.RUnlock()
+		return tz
+	}
+	timezoneMu.RUnlock()
+
+	rows, err := database.DB.Query(`
+		SELECT m.id, COALESCE(m.timezone, r.timezone)
+		FROM masjid m LEFT JOIN regional r ON m.regional_id = r.id`)
+	if err != nil {
+		return utils.DefaultTimezone
+	}
+	defer rows.Close()
+
+	timezones := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var tz sql.NullString
+		if err := rows.Scan(&id, &tz); err != nil {
+			return utils.DefaultTimezone
+		}
+		timezones[id] = tz.String
+	}
+
+	timezoneMu.Lock()
+	masjidTimezones = timezones
+	timezoneLoadedAt = time.Now()
+	timezoneMu.Unlock()
+	return timezones[masjidID]
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"database/sql"
+
+	"shollu/database"
+)
+
+// Role user yang disimpan di users.role.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsAdmin mengecek apakah user boleh memakai route /api/admin. Role selalu dibaca
+// dari database supaya pencabutan role langsung berlaku tanpa menunggu token habis.
+func IsAdmin(userID int) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	var role string
+	err := database.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return role == RoleAdmin, nil
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"shollu/database"
+)
+
+// Event yang bisa di-subscribe partner.
+const (
+	EventAttendanceRecorded  = "attendance.recorded"
+	EventPesertaRegistered   = "peserta.registered"
+	EventCollectionMemberAdd = "collection.member_added"
+	EventCollectionMemberDel = "collection.member_removed"
+	EventPesertaPromoted     = "peserta.promoted"
+)
+
+var WebhookEvents = []string{EventAttendanceRecorded, EventPesertaRegistered, EventCollectionMemberAdd, EventCollectionMemberDel, EventPesertaPromoted}
+
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+// Pengaturan worker webhook. Retry ke-n menunggu WebhookRetryBase * 2^(n-1),
+// maksimal WebhookRetryMax; setelah WebhookMaxAttempts masuk dead letter.
+var (
+	WebhookPollInterval = 5 * time.Second
+	WebhookRetryBase    = 30 * time.Second
+	WebhookRetryMax     = 6 * time.Hour
+	WebhookMaxAttempts  = 8
+	WebhookBatchSize    = 100
+
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// WebhookEnvelope adalah body JSON yang dikirim ke partner.
+type WebhookEnvelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// EmitEvent menulis event ke outbox. Panggil dengan *sql.Tx yang sama dengan
+// perubahan datanya supaya event hanya terkirim kalau transaksinya commit.
+func EmitEvent(exec Execer, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec(`
+		INSERT INTO webhook_outbox (event_type, payload, created_at) VALUES (?, ?, ?)`,
+		eventType, string(payload), time.Now().UTC())
+	return err
+}
+
+// SignWebhook menghasilkan header signature: t=<unix>,v1=<hex hmac-sha256(secret, "<t>.<body>")>.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// StartWebhookWorker menyebar event outbox ke subscription dan mengirim
+// delivery yang sudah jatuh tempo.
+func StartWebhookWorker() {
+	go func() {
+		ticker := time.NewTicker(WebhookPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := dispatchWebhookOutbox(); err != nil {
+				log.Println("Error dispatching webhook outbox:", err)
+			}
+			if err := deliverDueWebhooks(); err != nil {
+				log.Println("Error delivering webhooks:", err)
+			}
+		}
+	}()
+}
+
+// RedeliverWebhook menjadwalkan ulang satu delivery (termasuk yang sudah dead)
+// untuk segera dikirim.
+func RedeliverWebhook(deliveryID int64) error {
+	result, err := database.DB.Exec(`
+		UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND status <> 'delivering'`, time.Now().UTC(), deliveryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
+
+// dispatchWebhookOutbox membuat baris delivery untuk setiap subscription aktif
+// yang berlangganan event tersebut.
+func dispatchWebhookOutbox() error {
+	rows, err := database.DB.Query(`
+		SELECT id, event_type FROM webhook_outbox
+		WHERE dispatched_at IS NULL ORDER BY id ASC LIMIT ?`, WebhookBatchSize)
+	if err != nil {
+		return err
+	}
+	type outboxEvent struct {
+		id        int64
+		eventType string
+	}
+	var events []outboxEvent
+	for rows.Next() {
+		var e outboxEvent
+		if err := rows.Scan(&e.id, &e.eventType); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if len(events) == 0 {
+		return nil
+	}
+
+	subs, err := activeWebhookSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, e := range events {
+		tx, err := database.DB.Begin()
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if !subscribesTo(sub.events, e.eventType) {
+				continue
+			}
+			_, err = tx.Exec(`
+				INSERT IGNORE INTO webhook_deliveries (outbox_id, subscription_id, next_attempt_at)
+				VALUES (?, ?, ?)`, e.id, sub.id, now)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			_, err = tx.Exec("UPDATE webhook_outbox SET dispatched_at = ? WHERE id = ?", now, e.id)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type webhookSubscription struct {
+	id     int
+	url    string
+	secret string
+	events string
+}
+
+func activeWebhookSubscriptions() ([]webhookSubscription, error) {
+	rows, err := database.DB.Query("SELECT id, url, secret, events FROM webhook_subscriptions WHERE active = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []webhookSubscription
+	for rows.Next() {
+		var s webhookSubscription
+		if err := rows.Scan(&s.id, &s.url, &s.secret, &s.events); err != nil {
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	return subs, rows.Err()
+}
+
+func subscribesTo(events, eventType string) bool {
+	for _, e := range strings.Split(events, ",") {
+		if e = strings.TrimSpace(e); e == "*" || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type dueDelivery struct {
+	id        int64
+	attempts  int
+	url       string
+	secret    string
+	outboxID  int64
+	eventType string
+	payload   string
+	createdAt time.Time
+}
+
+func deliverDueWebhooks() error {
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.attempts, s.url, s.secret, o.id, o.event_type, o.payload, o.created_at
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON d.subscription_id = s.id
+		JOIN webhook_outbox o ON d.outbox_id = o.id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= ? AND s.active = 1
+		ORDER BY d.next_attempt_at ASC LIMIT ?`, time.Now().UTC(), WebhookBatchSize)
+	if err != nil {
+		return err
+	}
+	var due []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.attempts, &d.url, &d.secret, &d.outboxID, &d.eventType, &d.payload, &d.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		// Klaim delivery supaya tidak dikirim dua kali oleh instance lain
+		result, err := database.DB.Exec(`
+			UPDATE webhook_deliveries SET status = 'delivering' WHERE id = ? AND status = 'pending'`, d.id)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		deliverWebhook(d)
+	}
+	return nil
+}
+
+func deliverWebhook(d dueDelivery) {
+	body, _ := json.Marshal(WebhookEnvelope{
+		ID:        d.outboxID,
+		Type:      d.eventType,
+		CreatedAt: d.createdAt,
+		Data:      json.RawMessage(d.payload),
+	})
+
+	statusCode, err := postWebhook(d, body)
+	attempts := d.attempts + 1
+	now := time.Now().UTC()
+
+	if err == nil {
+		_, err = database.DB.Exec(`
+			UPDATE webhook_deliveries SET status = 'delivered', attempts = ?, last_status_code = ?, last_error = NULL, delivered_at = ?
+			WHERE id = ?`, attempts, statusCode, now, d.id)
+		if err != nil {
+			log.Println("Error updating webhook delivery:", err)
+		}
+		return
+	}
+
+	status := "pending"
+	if attempts >= WebhookMaxAttempts {
+		status = "dead"
+	}
+	errMsg := err.Error()
+	if len(errMsg) > 500 {
+		errMsg = errMsg[:500]
+	}
+	var code interface{}
+	if statusCode > 0 {
+		code = statusCode
+	}
+	_, err = database.DB.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = ?
+		WHERE id = ?`, status, attempts, code, errMsg, now.Add(webhookBackoff(attempts)), d.id)
+	if err != nil {
+		log.Println("Error updating webhook delivery:", err)
+	}
+}
+
+func postWebhook(d dueDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Shollu-Event", d.eventType)
+	req.Header.Set("X-Shollu-Delivery", strconv.FormatInt(d.id, 10))
+	req.Header.Set("X-Shollu-Signature", SignWebhook(d.secret, time.Now().Unix(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	delay := WebhookRetryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= WebhookRetryMax {
+			return WebhookRetryMax
+		}
+	}
+	return delay
+}
@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// ExportTable adalah laporan tabular yang bisa di-render ke CSV, XLSX atau PDF.
+type ExportTable struct {
+	Title     string
+	Meta      []string // baris keterangan di bawah judul (tanggal, masjid, dst)
+	Headers   []string
+	Rows      [][]string
+	Totals    []string // baris total, opsional
+	Footnotes []string
+
+	footnoteIndex map[string]int
+}
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pdf":  "application/pdf",
+}
+
+// IsExportFormat mengecek apakah format export didukung.
+func IsExportFormat(format string) bool {
+	_, ok := exportContentTypes[format]
+	return ok
+}
+
+// ExportContentType mengembalikan content type untuk format export.
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// Footnote mendaftarkan catatan kaki dan mengembalikan penandanya, misal "[1]".
+// Teks yang sama selalu mendapat nomor yang sama.
+func (t *ExportTable) Footnote(text string) string {
+	if t.footnoteIndex == nil {
+		t.footnoteIndex = make(map[string]int)
+	}
+	n, ok := t.footnoteIndex[text]
+	if !ok {
+		t.Footnotes = append(t.Footnotes, text)
+		n = len(t.Footnotes)
+		t.footnoteIndex[text] = n
+	}
+	return "[" + strconv.Itoa(n) + "]"
+}
+
+func (t *ExportTable) footnoteLines() []string {
+	lines := make([]string, len(t.Footnotes))
+	for i, note := range t.Footnotes {
+		lines[i] = fmt.Sprintf("[%d] %s", i+1, note)
+	}
+	return lines
+}
+
+// Render menghasilkan isi file export sesuai format.
+func (t *ExportTable) Render(format string) ([]byte, error) {
+	switch format {
+	case "csv":
+		return t.renderCSV()
+	case "xlsx":
+		return t.renderXLSX()
+	case "pdf":
+		return t.renderPDF()
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// SendExport me-render tabel dan mengirimkannya sebagai file attachment.
+func SendExport(c *fiber.Ctx, format, filename string, t *ExportTable) error {
+	data, err := t.Render(format)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate export"})
+	}
+	c.Set(fiber.HeaderContentType, ExportContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	return c.Send(data)
+}
+
+func (t *ExportTable) renderCSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(t.Headers)
+	w.WriteAll(t.Rows)
+	if len(t.Totals) > 0 {
+		w.Write(t.Totals)
+	}
+	if len(t.Footnotes) > 0 {
+		w.Write([]string{})
+		for _, line := range t.footnoteLines() {
+			w.Write([]string{line})
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func (t *ExportTable) renderXLSX() ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Rekap"
+	f.SetSheetName("Sheet1", sheet)
+
+	bold, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	titleStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 14}})
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true},
+		Fill:      excelize.Fill{Type: "pattern", Color: []string{"D9E1F2"}, Pattern: 1},
+		Alignment: &excelize.Alignment{Horizontal: "center", WrapText: true},
+	})
+
+	row := 1
+	f.SetCellValue(sheet, cellName(1, row), t.Title)
+	f.SetCellStyle(sheet, cellName(1, row), cellName(1, row), titleStyle)
+	row++
+	for _, line := range t.Meta {
+		f.SetCellValue(sheet, cellName(1, row), line)
+		row++
+	}
+	row++
+
+	headerRow := row
+	f.SetSheetRow(sheet, cellName(1, row), &t.Headers)
+	f.SetCellStyle(sheet, cellName(1, row), cellName(len(t.Headers), row), headerStyle)
+	row++
+
+	for _, r := range t.Rows {
+		values := exportCellValues(r)
+		f.SetSheetRow(sheet, cellName(1, row), &values)
+		row++
+	}
+	if len(t.Totals) > 0 {
+		values := exportCellValues(t.Totals)
+		f.SetSheetRow(sheet, cellName(1, row), &values)
+		f.SetCellStyle(sheet, cellName(1, row), cellName(len(t.Totals), row), bold)
+		row++
+	}
+
+	if len(t.Footnotes) > 0 {
+		row++
+		for _, line := range t.footnoteLines() {
+			f.SetCellValue(sheet, cellName(1, row), line)
+			row++
+		}
+	}
+
+	for i, header := range t.Headers {
+		width := float64(len(header)) + 2
+		for _, r := range t.Rows {
+			if i < len(r) && float64(len(r[i]))+2 > width {
+				width = float64(len(r[i])) + 2
+			}
+		}
+		if width > 50 {
+			width = 50
+		}
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		f.SetColWidth(sheet, col, col, width)
+	}
+	f.SetPanes(sheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      headerRow,
+		TopLeftCell: cellName(1, headerRow+1),
+		ActivePane:  "bottomLeft",
+	})
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (t *ExportTable) renderPDF() ([]byte, error) {
+	// Tabel lebar (grid collection) pakai kertas lebih besar dan huruf lebih kecil
+	pageSize, fontSize := "A4", 9.0
+	if len(t.Headers) > 12 {
+		pageSize, fontSize = "A3", 7.0
+	}
+	if len(t.Headers) > 30 {
+		fontSize = 5.5
+	}
+
+	pdf := fpdf.New("L", "mm", pageSize, "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.SetAutoPageBreak(true, 12)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pageWidth, _ := pdf.GetPageSize()
+	usable := pageWidth - 20
+	widths := pdfColumnWidths(pdf, t, usable, fontSize)
+	lineHeight := fontSize * 0.6
+
+	drawHeader := func() {
+		pdf.SetFont("Helvetica", "B", fontSize)
+		pdf.SetFillColor(217, 225, 242)
+		for i, header := range t.Headers {
+			pdf.CellFormat(widths[i], lineHeight+1, tr(header), "1", 0, "C", true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", fontSize)
+	}
+
+	pdf.SetHeaderFunc(func() {
+		if pdf.PageNo() > 1 {
+			drawHeader()
+		}
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(usable, 8, tr(t.Title), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range t.Meta {
+		pdf.CellFormat(usable, 5, tr(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(2)
+	drawHeader()
+
+	drawRow := func(r []string) {
+		for i := range t.Headers {
+			value := ""
+			if i < len(r) {
+				value = r[i]
+			}
+			align := "C"
+			if i == 1 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], lineHeight, tr(value), "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	for _, r := range t.Rows {
+		drawRow(r)
+	}
+	if len(t.Totals) > 0 {
+		pdf.SetFont("Helvetica", "B", fontSize)
+		drawRow(t.Totals)
+	}
+
+	if len(t.Footnotes) > 0 {
+		pdf.Ln(3)
+		pdf.SetFont("Helvetica", "", 8)
+		for _, line := range t.footnoteLines() {
+			pdf.CellFormat(usable, 4, tr(line), "", 1, "L", false, 0, "")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfColumnWidths membagi lebar halaman: kolom nama (kolom ke-2) mendapat sisa
+// ruang setelah kolom lain diberi lebar secukupnya.
+func pdfColumnWidths(pdf *fpdf.Fpdf, t *ExportTable, usable, fontSize float64) []float64 {
+	pdf.SetFont("Helvetica", "B", fontSize)
+	widths := make([]float64, len(t.Headers))
+	total := 0.0
+	for i, header := range t.Headers {
+		w := pdf.GetStringWidth(header) + 3
+		for _, r := range t.Rows {
+			if i < len(r) {
+				if rw := pdf.GetStringWidth(r[i]) + 3; rw > w {
+					w = rw
+				}
+			}
+		}
+		widths[i] = w
+		total += w
+	}
+
+	if total > usable {
+		scale := usable / total
+		for i := range widths {
+			widths[i] *= scale
+		}
+	} else if len(widths) > 1 {
+		widths[1] += usable - total
+	}
+	return widths
+}
+
+// exportCellValues mengubah angka menjadi numeric cell supaya bisa dijumlah di Excel.
+func exportCellValues(r []string) []interface{} {
+	values := make([]interface{}, len(r))
+	for i, v := range r {
+		if n, err := strconv.Atoi(v); err == nil {
+			values[i] = n
+		} else {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func cellName(col, row int) string {
+	name, _ := excelize.CoordinatesToCellName(col, row)
+	return name
+}
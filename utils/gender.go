@@ -0,0 +1,22 @@
+package utils
+
+import "strings"
+
+// Nilai gender yang disimpan di peserta.gender.
+const (
+	GenderMale   = "male"
+	GenderFemale = "female"
+)
+
+// NormalizeGender mengubah variasi input gender (Laki-laki, pria, L, wanita, ...)
+// menjadi male/female. Input yang tidak dikenal dikembalikan apa adanya supaya
+// ditolak oleh validasi oneof=male female.
+func NormalizeGender(gender string) string {
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "male", "laki-laki", "laki laki", "lk", "l", "pria":
+		return GenderMale
+	case "female", "perempuan", "wanita", "pr", "p":
+		return GenderFemale
+	}
+	return gender
+}
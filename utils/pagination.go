@@ -0,0 +1,268 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Batas list endpoint supaya satu request tidak membaca seluruh tabel. Halaman
+// lebih dalam dari MaxListOffset harus memakai ?cursor=.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+	MaxListOffset    = 10000
+)
+
+// FilterKind menentukan cara nilai filter di query string dibaca.
+type FilterKind int
+
+const (
+	FilterString FilterKind = iota
+	FilterInt
+	FilterBool
+	FilterDate // YYYY-MM-DD
+)
+
+// ListSpec adalah parameter yang diterima sebuah list endpoint. Sorts memetakan
+// nama di ?sort= ke ekspresi SQL (atau kunci bebas untuk list yang diurutkan di
+// Go); DefaultSort misalnya "-id". Cursor true kalau endpoint mendukung keyset
+// pagination lewat ?cursor=.
+type ListSpec struct {
+	Sorts        map[string]string
+	DefaultSort  string
+	Filters      map[string]FilterKind
+	Cursor       bool
+	DefaultLimit int
+}
+
+// ListQuery adalah hasil ParseListQuery: ?page=&limit= atau ?cursor=, ?sort= dan filter.
+type ListQuery struct {
+	Page    int
+	Limit   int
+	Sort    string
+	SortSQL string
+	Desc    bool
+	Filters map[string]interface{}
+
+	cursor *listCursor
+	next   string
+}
+
+type listCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+// ParseListQuery membaca parameter list sesuai spec. Error berupa *fiber.Error 400.
+func ParseListQuery(c *fiber.Ctx, spec ListSpec) (*ListQuery, error) {
+	q := &ListQuery{Page: 1, Limit: spec.DefaultLimit, Filters: map[string]interface{}{}}
+	if q.Limit == 0 {
+		q.Limit = DefaultListLimit
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, fiber.NewError(http.StatusBadRequest, "limit must be a positive number")
+		}
+		if limit > MaxListLimit {
+			limit = MaxListLimit
+		}
+		q.Limit = limit
+	}
+	if v := c.Query("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return nil, fiber.NewError(http.StatusBadRequest, "page must be a positive number")
+		}
+		q.Page = page
+	}
+
+	sortParam := c.Query("sort", spec.DefaultSort)
+	if sortParam != "" {
+		name := strings.TrimPrefix(sortParam, "-")
+		expr, ok := spec.Sorts[name]
+		if !ok {
+			names := make([]string, 0, len(spec.Sorts))
+			for n := range spec.Sorts {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fiber.NewError(http.StatusBadRequest, "sort must be one of "+strings.Join(names, ", ")+" (prefix - for descending)")
+		}
+		q.Sort, q.SortSQL, q.Desc = name, expr, strings.HasPrefix(sortParam, "-")
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		if !spec.Cursor {
+			return nil, fiber.NewError(http.StatusBadRequest, "cursor is not supported on this endpoint")
+		}
+		var cur listCursor
+		b, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil || json.Unmarshal(b, &cur) != nil || cur.Sort != sortParam {
+			return nil, fiber.NewError(http.StatusBadRequest, "Invalid cursor")
+		}
+		q.cursor = &cur
+		q.Page = 1
+	} else if (q.Page-1)*q.Limit > MaxListOffset {
+		msg := "page is too deep"
+		if spec.Cursor {
+			msg += ", use cursor"
+		}
+		return nil, fiber.NewError(http.StatusBadRequest, msg)
+	}
+
+	for name, kind := range spec.Filters {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		switch kind {
+		case FilterInt:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fiber.NewError(http.StatusBadRequest, "Invalid "+name)
+			}
+			q.Filters[name] = n
+		case FilterBool:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fiber.NewError(http.StatusBadRequest, "Invalid "+name)
+			}
+			q.Filters[name] = b
+		case FilterDate:
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return nil, fiber.NewError(http.StatusBadRequest, name+" must be YYYY-MM-DD")
+			}
+			q.Filters[name] = v
+		default:
+			if len(v) > 100 {
+				return nil, fiber.NewError(http.StatusBadRequest, name+" is too long")
+			}
+			q.Filters[name] = v
+		}
+	}
+	return q, nil
+}
+
+// Offset adalah jumlah baris yang dilewati; 0 kalau memakai cursor.
+func (q *ListQuery) Offset() int {
+	if q.cursor != nil {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit
+}
+
+// Has true kalau filter name dikirim.
+func (q *ListQuery) Has(name string) bool {
+	_, ok := q.Filters[name]
+	return ok
+}
+
+// Int mengembalikan filter FilterInt, 0 kalau tidak dikirim.
+func (q *ListQuery) Int(name string) int {
+	n, _ := q.Filters[name].(int)
+	return n
+}
+
+// String mengembalikan filter FilterString/FilterDate, "" kalau tidak dikirim.
+func (q *ListQuery) String(name string) string {
+	s, _ := q.Filters[name].(string)
+	return s
+}
+
+// Bool mengembalikan filter FilterBool.
+func (q *ListQuery) Bool(name string) bool {
+	b, _ := q.Filters[name].(bool)
+	return b
+}
+
+// OrderSQL mengembalikan " ORDER BY <sort>, <idExpr>" dengan idExpr sebagai
+// pemecah seri supaya urutan (dan cursor) stabil.
+func (q *ListQuery) OrderSQL(idExpr string) string {
+	dir := " ASC"
+	if q.Desc {
+		dir = " DESC"
+	}
+	if q.SortSQL == "" || q.SortSQL == idExpr {
+		return " ORDER BY " + idExpr + dir
+	}
+	return " ORDER BY " + q.SortSQL + dir + ", " + idExpr + dir
+}
+
+// CursorSQL mengembalikan kondisi keyset untuk ?cursor= (tanpa AND di depan),
+// atau "" kalau tidak ada cursor.
+func (q *ListQuery) CursorSQL(idExpr string) (string, []interface{}) {
+	if q.cursor == nil {
+		return "", nil
+	}
+	op := " > "
+	if q.Desc {
+		op = " < "
+	}
+	if q.SortSQL == "" || q.SortSQL == idExpr {
+		return idExpr + op + "?", []interface{}{q.cursor.ID}
+	}
+	return "(" + q.SortSQL + op + "? OR (" + q.SortSQL + " = ? AND " + idExpr + op + "?))",
+		[]interface{}{q.cursor.Value, q.cursor.Value, q.cursor.ID}
+}
+
+// LimitSQL mengembalikan " LIMIT ? OFFSET ?" beserta argumennya.
+func (q *ListQuery) LimitSQL() (string, []interface{}) {
+	return " LIMIT ? OFFSET ?", []interface{}{q.Limit, q.Offset()}
+}
+
+// Bounds mengembalikan indeks slice [start, end) halaman ini untuk list yang
+// sudah diurutkan di Go.
+func (q *ListQuery) Bounds(total int) (int, int) {
+	start := q.Offset()
+	if start > total {
+		start = total
+	}
+	end := start + q.Limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// NextAfter menyiapkan next_cursor dari baris terakhir halaman (nilai sort dan
+// id-nya) kalau halaman penuh. count adalah jumlah baris di halaman ini.
+func (q *ListQuery) NextAfter(count int, sortValue interface{}, id int64) {
+	if count < q.Limit {
+		return
+	}
+	if t, ok := sortValue.(time.Time); ok {
+		sortValue = t.Format("2006-01-02 15:04:05")
+	}
+	sortParam := q.Sort
+	if q.Desc {
+		sortParam = "-" + sortParam
+	}
+	b, _ := json.Marshal(listCursor{Sort: sortParam, Value: sortValue, ID: id})
+	q.next = base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Response adalah envelope list: data beserta page, limit, total dan
+// next_cursor kalau masih ada halaman berikutnya.
+func (q *ListQuery) Response(data interface{}, total int) fiber.Map {
+	res := fiber.Map{
+		"message": "Success",
+		"data":    data,
+		"page":    q.Page,
+		"limit":   q.Limit,
+		"total":   total,
+	}
+	if q.next != "" && (q.cursor != nil || q.Offset()+q.Limit < total) {
+		res["next_cursor"] = q.next
+	}
+	return res
+}
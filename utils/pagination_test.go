@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseList menjalankan ParseListQuery pada request GET /?<rawQuery>.
+func parseList(t *testing.T, spec ListSpec, rawQuery string) (*ListQuery, error) {
+	t.Helper()
+	var q *ListQuery
+	var parseErr error
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		q, parseErr = ParseListQuery(c, spec)
+		return nil
+	})
+	if _, err := app.Test(httptest.NewRequest(http.MethodGet, "/?"+rawQuery, nil)); err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	return q, parseErr
+}
+
+func encodeCursor(sort string, value interface{}, id int64) string {
+	b, _ := json.Marshal(listCursor{Sort: sort, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var testListSpec = ListSpec{
+	Sorts:       map[string]string{"id": "t.id", "name": "t.name"},
+	DefaultSort: "-id",
+	Cursor:      true,
+}
+
+func TestParseListQueryLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      ListSpec
+		query     string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"default", ListSpec{}, "", DefaultListLimit, false},
+		{"spec default", ListSpec{DefaultLimit: 20}, "", 20, false},
+		{"explicit", ListSpec{}, "limit=10", 10, false},
+		{"clamped to max", ListSpec{}, "limit=5000", MaxListLimit, false},
+		{"max", ListSpec{}, "limit=200", MaxListLimit, false},
+		{"zero", ListSpec{}, "limit=0", 0, true},
+		{"negative", ListSpec{}, "limit=-5", 0, true},
+		{"not a number", ListSpec{}, "limit=ten", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseList(t, tt.spec, tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got limit %d", q.Limit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseListQuery: %v", err)
+			}
+			if q.Limit != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", q.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestParseListQueryDeepOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ListSpec
+		query   string
+		wantErr string
+	}{
+		{"last allowed page", ListSpec{}, "limit=100&page=101", ""},
+		{"too deep", ListSpec{}, "limit=100&page=102", "page is too deep"},
+		{"too deep with cursor support", testListSpec, "limit=100&page=102", "page is too deep, use cursor"},
+		{"cursor ignores page", testListSpec, "limit=100&page=500&cursor=" + encodeCursor("-id", 10, 10), ""},
+		{"page zero", ListSpec{}, "page=0", "page must be a positive number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseList(t, tt.spec, tt.query)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseListQuery: %v", err)
+				}
+				if q.Offset() > MaxListOffset {
+					t.Errorf("offset = %d, exceeds %d", q.Offset(), MaxListOffset)
+				}
+				return
+			}
+			fe, ok := err.(*fiber.Error)
+			if !ok || fe.Code != http.StatusBadRequest || fe.Message != tt.wantErr {
+				t.Errorf("err = %v, want 400 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseListQueryCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    ListSpec
+		query   string
+		wantErr bool
+	}{
+		{"matching sort", testListSpec, "cursor=" + encodeCursor("-id", 10, 10), false},
+		{"matching explicit sort", testListSpec, "sort=name&cursor=" + encodeCursor("name", "budi", 7), false},
+		{"sort mismatch", testListSpec, "sort=name&cursor=" + encodeCursor("-id", 10, 10), true},
+		{"direction mismatch", testListSpec, "sort=id&cursor=" + encodeCursor("-id", 10, 10), true},
+		{"not base64", testListSpec, "cursor=%25%25", true},
+		{"not json", testListSpec, "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("nope")), true},
+		{"unsupported", ListSpec{Sorts: testListSpec.Sorts, DefaultSort: "-id"}, "cursor=" + encodeCursor("-id", 10, 10), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseList(t, tt.spec, tt.query)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseListQuerySortAndFilters(t *testing.T) {
+	spec := ListSpec{
+		Sorts:   testListSpec.Sorts,
+		Filters: map[string]FilterKind{"q": FilterString, "masjid_id": FilterInt, "active": FilterBool, "from": FilterDate},
+	}
+	q, err := parseList(t, spec, "sort=-name&q=budi&masjid_id=4&active=true&from=2025-03-10")
+	if err != nil {
+		t.Fatalf("ParseListQuery: %v", err)
+	}
+	if q.Sort != "name" || q.SortSQL != "t.name" || !q.Desc {
+		t.Errorf("sort = %q %q desc=%v", q.Sort, q.SortSQL, q.Desc)
+	}
+	if q.String("q") != "budi" || q.Int("masjid_id") != 4 || !q.Bool("active") || q.String("from") != "2025-03-10" {
+		t.Errorf("filters = %v", q.Filters)
+	}
+	if q.Has("regional_id") {
+		t.Errorf("Has(regional_id) = true for a filter that was not sent")
+	}
+
+	for _, bad := range []string{"sort=email", "masjid_id=abc", "active=maybe", "from=10-03-2025", "q=" + strings.Repeat("a", 101)} {
+		if _, err := parseList(t, spec, bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestCursorSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{"no cursor", "", "", nil},
+		{"id descending", "cursor=" + encodeCursor("-id", 10, 10), "t.id < ?", []interface{}{int64(10)}},
+		{"id ascending", "sort=id&cursor=" + encodeCursor("id", 10, 10), "t.id > ?", []interface{}{int64(10)}},
+		{"name ascending", "sort=name&cursor=" + encodeCursor("name", "budi", 7),
+			"(t.name > ? OR (t.name = ? AND t.id > ?))", []interface{}{"budi", "budi", int64(7)}},
+		{"name descending", "sort=-name&cursor=" + encodeCursor("-name", "budi", 7),
+			"(t.name < ? OR (t.name = ? AND t.id < ?))", []interface{}{"budi", "budi", int64(7)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseList(t, testListSpec, tt.query)
+			if err != nil {
+				t.Fatalf("ParseListQuery: %v", err)
+			}
+			sql, args := q.CursorSQL("t.id")
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+			if tt.query != "" && q.Offset() != 0 {
+				t.Errorf("offset = %d with cursor, want 0", q.Offset())
+			}
+		})
+	}
+}
+
+func TestOrderAndLimitSQL(t *testing.T) {
+	q, err := parseList(t, testListSpec, "sort=name&page=3&limit=20")
+	if err != nil {
+		t.Fatalf("ParseListQuery: %v", err)
+	}
+	if got := q.OrderSQL("t.id"); got != " ORDER BY t.name ASC, t.id ASC" {
+		t.Errorf("OrderSQL = %q", got)
+	}
+	sql, args := q.LimitSQL()
+	if sql != " LIMIT ? OFFSET ?" || !reflect.DeepEqual(args, []interface{}{20, 40}) {
+		t.Errorf("LimitSQL = %q %v", sql, args)
+	}
+
+	q, _ = parseList(t, testListSpec, "")
+	if got := q.OrderSQL("t.id"); got != " ORDER BY t.id DESC" {
+		t.Errorf("default OrderSQL = %q", got)
+	}
+}
+
+func TestResponseNextCursor(t *testing.T) {
+	q, _ := parseList(t, testListSpec, "limit=2")
+	q.NextAfter(2, 9, 9)
+	res := q.Response([]int{10, 9}, 5)
+	next, ok := res["next_cursor"].(string)
+	if !ok {
+		t.Fatalf("next_cursor missing: %v", res)
+	}
+	if res["total"] != 5 || res["page"] != 1 || res["limit"] != 2 {
+		t.Errorf("envelope = %v", res)
+	}
+
+	// Cursor berikutnya dibaca kembali dengan sort yang sama
+	q, err := parseList(t, testListSpec, "limit=2&cursor="+next)
+	if err != nil {
+		t.Fatalf("next_cursor rejected: %v", err)
+	}
+	if sql, args := q.CursorSQL("t.id"); sql != "t.id < ?" || args[0] != int64(9) {
+		t.Errorf("CursorSQL = %q %v", sql, args)
+	}
+
+	// Halaman terakhir (tidak penuh) tidak punya next_cursor
+	q, _ = parseList(t, testListSpec, "limit=2&page=3")
+	q.NextAfter(1, 1, 1)
+	if _, ok := q.Response([]int{1}, 5)["next_cursor"]; ok {
+		t.Errorf("next_cursor on last page")
+	}
+}
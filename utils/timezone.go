@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Data zona waktu ikut di-embed supaya tidak bergantung pada tzdata di server
+	_ "time/tzdata"
+)
+
+// Zona waktu default untuk regional/masjid yang belum diatur dan untuk data
+// tanpa masjid (WIB).
+const DefaultTimezone = "Asia/Jakarta"
+
+// Zona waktu yang didukung beserta offset UTC-nya. Indonesia tidak memakai DST
+// sehingga offset tetap; SQL memakai offset ini di CONVERT_TZ supaya tidak
+// bergantung pada tabel time zone MySQL.
+var SupportedTimezones = map[string]string{
+	"Asia/Jakarta":   "+07:00", // WIB
+	"Asia/Pontianak": "+07:00", // WIB
+	"Asia/Makassar":  "+08:00", // WITA
+	"Asia/Jayapura":  "+09:00", // WIT
+}
+
+var (
+	locationsMu sync.Mutex
+	locations   = make(map[string]*time.Location)
+)
+
+// IsSupportedTimezone mengecek apakah nama zona (IANA) bisa dipakai untuk regional/masjid.
+func IsSupportedTimezone(name string) bool {
+	_, ok := SupportedTimezones[name]
+	return ok
+}
+
+// Location mengembalikan *time.Location untuk nama zona. Nama kosong atau tidak
+// didukung jatuh ke DefaultTimezone.
+func Location(name string) *time.Location {
+	if !IsSupportedTimezone(name) {
+		name = DefaultTimezone
+	}
+
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+	if loc, ok := locations[name]; ok {
+		return loc
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		loc = time.FixedZone(name, offsetSeconds(SupportedTimezones[name]))
+	}
+	locations[name] = loc
+	return loc
+}
+
+// DefaultLocation adalah Location(DefaultTimezone).
+func DefaultLocation() *time.Location {
+	return Location(DefaultTimezone)
+}
+
+// Today mengembalikan tanggal hari ini (YYYY-MM-DD) di zona loc.
+func Today(loc *time.Location) string {
+	return time.Now().In(loc).Format("2006-01-02")
+}
+
+// LatestToday mengembalikan tanggal hari ini di zona paling timur, yaitu tanggal
+// terbaru yang mungkin dimiliki masjid mana pun.
+func LatestToday() string {
+	latest := ""
+	for name := range SupportedTimezones {
+		if today := Today(Location(name)); today > latest {
+			latest = today
+		}
+	}
+	return latest
+}
+
+// LocalDate mengembalikan tanggal t (YYYY-MM-DD) di zona loc.
+func LocalDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// UTCOffset mengembalikan offset zona loc dalam format CONVERT_TZ ('+07:00').
+func UTCOffset(loc *time.Location) string {
+	return time.Now().In(loc).Format("-07:00")
+}
+
+// ZoneAbbr mengembalikan singkatan zona loc (WIB, WITA, WIT) untuk label laporan.
+func ZoneAbbr(loc *time.Location) string {
+	return time.Now().In(loc).Format("MST")
+}
+
+// DayRange mengubah rentang tanggal lokal (inklusif) di zona loc menjadi
+// rentang UTC [start, end) untuk dibandingkan dengan created_at.
+func DayRange(dateFrom, dateTo string, loc *time.Location) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation("2006-01-02", dateFrom, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q", dateFrom)
+	}
+	to, err := time.ParseInLocation("2006-01-02", dateTo, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q", dateTo)
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("date_to must not be before date_from")
+	}
+	return from.UTC(), to.AddDate(0, 0, 1).UTC(), nil
+}
+
+// AnyZoneDayRange seperti DayRange tapi mencakup rentang tanggal tersebut di
+// semua zona yang didukung: mulai dari tengah malam zona paling timur sampai
+// tengah malam zona paling barat. Hasilnya perlu difilter lagi per tanggal lokal.
+func AnyZoneDayRange(dateFrom, dateTo string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	for name := range SupportedTimezones {
+		s, e, err := DayRange(dateFrom, dateTo, Location(name))
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if start.IsZero() || s.Before(start) {
+			start = s
+		}
+		if e.After(end) {
+			end = e
+		}
+	}
+	return start, end, nil
+}
+
+// TimezoneOffsetSQL menghasilkan ekspresi SQL offset UTC ('+07:00', ...) untuk
+// kolom/ekspresi nama zona tzExpr. Zona kosong atau tidak dikenal dianggap WIB.
+func TimezoneOffsetSQL(tzExpr string) string {
+	names := make([]string, 0, len(SupportedTimezones))
+	for name := range SupportedTimezones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("CASE " + tzExpr)
+	for _, name := range names {
+		if offset := SupportedTimezones[name]; offset != SupportedTimezones[DefaultTimezone] {
+			b.WriteString(" WHEN '" + name + "' THEN '" + offset + "'")
+		}
+	}
+	b.WriteString(" ELSE '" + SupportedTimezones[DefaultTimezone] + "' END")
+	return b.String()
+}
+
+// LocalTimeSQL mengubah kolom UTC tsExpr ke waktu lokal zona tzExpr.
+func LocalTimeSQL(tsExpr, tzExpr string) string {
+	return "CONVERT_TZ(" + tsExpr + ", '+00:00', " + TimezoneOffsetSQL(tzExpr) + ")"
+}
+
+func offsetSeconds(offset string) int {
+	var h, m int
+	fmt.Sscanf(offset, "+%d:%d", &h, &m)
+	return h*3600 + m*60
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDayRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		tz        string
+		from, to  string
+		wantStart string
+		wantEnd   string
+	}{
+		{"WIB single day", "Asia/Jakarta", "2025-03-10", "2025-03-10", "2025-03-09T17:00:00Z", "2025-03-10T17:00:00Z"},
+		{"WITA single day", "Asia/Makassar", "2025-03-10", "2025-03-10", "2025-03-09T16:00:00Z", "2025-03-10T16:00:00Z"},
+		{"WIT single day", "Asia/Jayapura", "2025-03-10", "2025-03-10", "2025-03-09T15:00:00Z", "2025-03-10T15:00:00Z"},
+		{"WIB range across month", "Asia/Jakarta", "2025-02-27", "2025-03-02", "2025-02-26T17:00:00Z", "2025-03-02T17:00:00Z"},
+		{"WIT range across year", "Asia/Jayapura", "2024-12-31", "2025-01-01", "2024-12-30T15:00:00Z", "2025-01-01T15:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := DayRange(tt.from, tt.to, Location(tt.tz))
+			if err != nil {
+				t.Fatalf("DayRange: %v", err)
+			}
+			if got := start.Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestDayRangeInvalid(t *testing.T) {
+	loc := DefaultLocation()
+	for _, r := range [][2]string{{"2025-03-10", "2025-03-09"}, {"10-03-2025", "2025-03-10"}, {"2025-03-10", ""}} {
+		if _, _, err := DayRange(r[0], r[1], loc); err == nil {
+			t.Errorf("DayRange(%q, %q) expected error", r[0], r[1])
+		}
+	}
+}
+
+// Scan subuh di WIB/WITA/WIT jatuh sebelum tengah malam UTC, jadi tanggal
+// lokalnya satu hari setelah tanggal UTC.
+func TestLocalDateAcrossUTCMidnight(t *testing.T) {
+	tests := []struct {
+		tz   string
+		utc  string
+		want string
+	}{
+		{"Asia/Jakarta", "2025-03-09T21:30:00Z", "2025-03-10"},   // 04:30 WIB
+		{"Asia/Jakarta", "2025-03-09T16:59:59Z", "2025-03-09"},   // 23:59 WIB
+		{"Asia/Makassar", "2025-03-09T20:30:00Z", "2025-03-10"},  // 04:30 WITA
+		{"Asia/Makassar", "2025-03-09T15:59:59Z", "2025-03-09"},  // 23:59 WITA
+		{"Asia/Jayapura", "2025-03-09T19:30:00Z", "2025-03-10"},  // 04:30 WIT
+		{"Asia/Jayapura", "2025-03-09T15:00:00Z", "2025-03-10"},  // 00:00 WIT
+		{"Asia/Jayapura", "2025-03-09T14:59:59Z", "2025-03-09"},  // 23:59 WIT
+		{"Asia/Pontianak", "2025-03-09T17:00:00Z", "2025-03-10"}, // 00:00 WIB
+	}
+	for _, tt := range tests {
+		ts, _ := time.Parse(time.RFC3339, tt.utc)
+		if got := LocalDate(ts, Location(tt.tz)); got != tt.want {
+			t.Errorf("LocalDate(%s, %s) = %s, want %s", tt.utc, tt.tz, got, tt.want)
+		}
+		// Tanggal lokal harus berada di dalam DayRange tanggal tersebut
+		start, end, _ := DayRange(tt.want, tt.want, Location(tt.tz))
+		if ts.Before(start) || !ts.Before(end) {
+			t.Errorf("%s not inside DayRange(%s) in %s: [%s, %s)", tt.utc, tt.want, tt.tz, start, end)
+		}
+	}
+}
+
+func TestToday(t *testing.T) {
+	for _, tz := range []string{"Asia/Jakarta", "Asia/Makassar", "Asia/Jayapura"} {
+		loc := Location(tz)
+		before := time.Now()
+		got := Today(loc)
+		after := time.Now()
+		if got != LocalDate(before, loc) && got != LocalDate(after, loc) {
+			t.Errorf("Today(%s) = %s, want %s", tz, got, LocalDate(after, loc))
+		}
+		if _, err := time.Parse("2006-01-02", got); err != nil {
+			t.Errorf("Today(%s) = %q is not YYYY-MM-DD", tz, got)
+		}
+	}
+}
+
+func TestUTCOffset(t *testing.T) {
+	tests := map[string]string{
+		"Asia/Jakarta":   "+07:00",
+		"Asia/Pontianak": "+07:00",
+		"Asia/Makassar":  "+08:00",
+		"Asia/Jayapura":  "+09:00",
+		"":               "+07:00",
+		"Europe/London":  "+07:00", // tidak didukung, jatuh ke WIB
+	}
+	for tz, want := range tests {
+		if got := UTCOffset(Location(tz)); got != want {
+			t.Errorf("UTCOffset(%q) = %s, want %s", tz, got, want)
+		}
+	}
+}
+
+func TestLocationFallback(t *testing.T) {
+	if got := Location("Mars/Olympus").String(); got != DefaultTimezone {
+		t.Errorf("Location(unsupported) = %s, want %s", got, DefaultTimezone)
+	}
+	if got := ZoneAbbr(Location("Asia/Makassar")); got != "WITA" {
+		t.Errorf("ZoneAbbr(Asia/Makassar) = %s, want WITA", got)
+	}
+}